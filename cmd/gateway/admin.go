@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/aluko123/go-network-proxy/inference/queue"
+	"github.com/aluko123/go-network-proxy/inference/router"
+	"github.com/aluko123/go-network-proxy/pkg/logger"
+)
+
+// queueView is the JSON shape of one queue in GET /admin/queue
+type queueView struct {
+	Name     string        `json:"name"`
+	Depth    int           `json:"depth"`
+	Requests []requestView `json:"requests"`
+}
+
+type requestView struct {
+	queue.RequestInfo
+	WaitMs int64 `json:"wait_ms"`
+}
+
+// adminQueueHandler renders the contents of every inference queue as JSON
+func adminQueueHandler(qs *queue.ModelQueues) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		views := make([]queueView, 0)
+		for _, pq := range qs.All() {
+			snapshot := pq.Snapshot()
+			requests := make([]requestView, len(snapshot))
+			for i, info := range snapshot {
+				requests[i] = requestView{RequestInfo: info, WaitMs: info.WaitTime.Milliseconds()}
+			}
+			views = append(views, queueView{
+				Name:     pq.Name(),
+				Depth:    len(snapshot),
+				Requests: requests,
+			})
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{"queues": views})
+	})
+}
+
+// adminWorkersHandler lists the router's workers with their health and load
+func adminWorkersHandler(rt *router.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"workers": rt.Workers()})
+	})
+}
+
+// registerPrivateRoutes adds the admin endpoints that change the running
+// gateway (log level, worker membership) or reveal its traffic and topology
+// (queued requests, worker addresses and load) to admin, but only when it is the private -metrics-addr
+// listener's mux rather than the public one. On the public mux any client
+// could switch on debug logging to flood the logs, attach a worker that
+// receives every prompt or detach the real ones, list other clients'
+// request IDs, or map the internal worker addresses, and, since patterns have no host, so could a forward-proxy
+// request such as POST http://anything/admin/workers. qs and rt are nil
+// without an inference gateway. It reports whether the routes were added.
+func registerPrivateRoutes(public, admin *http.ServeMux, qs *queue.ModelQueues, rt *router.Router) bool {
+	if admin == public {
+		return false
+	}
+	admin.Handle("/admin/loglevel", adminLogLevelHandler())
+	if rt != nil {
+		admin.Handle("/admin/queue", adminQueueHandler(qs))
+		admin.Handle("GET /admin/workers", adminWorkersHandler(rt))
+		admin.Handle("POST /admin/workers", adminAddWorkerHandler(rt))
+		admin.Handle("DELETE /admin/workers/{id}", adminRemoveWorkerHandler(rt))
+	}
+	return true
+}
+
+// addWorkerRequest is the body of POST /admin/workers
+type addWorkerRequest struct {
+	ID   string `json:"id"`   // optional; defaults to the next worker-N
+	Addr string `json:"addr"` // host:port, optionally addr=weight
+}
+
+// adminAddWorkerHandler connects a new worker to the shared queue at runtime
+func adminAddWorkerHandler(rt *router.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req addWorkerRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Addr == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "body must be JSON with a non-empty addr"})
+			return
+		}
+
+		id, err := rt.AddWorker(req.ID, req.Addr)
+		if errors.Is(err, router.ErrDuplicateWorker) {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string]string{"id": id, "addr": req.Addr})
+	})
+}
+
+// adminRemoveWorkerHandler takes a worker out of rotation. The worker drains
+// in the background, so this returns 202 before its in-flight requests finish.
+func adminRemoveWorkerHandler(rt *router.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		err := rt.RemoveWorker(id)
+		if errors.Is(err, router.ErrUnknownWorker) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusAccepted, map[string]string{"id": id, "status": "draining"})
+	})
+}
+
+// adminLogLevelHandler reports the shared log level on GET and changes it on
+// POST ({"level": "debug"}) without a restart
+func adminLogLevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var req struct {
+				Level string `json:"level"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "body must be JSON with a level"})
+				return
+			}
+			lvl, err := logger.ParseLevel(req.Level)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			logger.SetLevel(lvl)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"level": logger.GetLevel().String()})
+	})
+}
+
+// readyzHandler reports whether the gateway can serve traffic: 200 when the
+// inference API is disabled or at least one worker is healthy, 503 otherwise.
+// rt may be nil.
+func readyzHandler(rt *router.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rt == nil {
+			writeJSON(w, http.StatusOK, map[string]any{"status": "ready"})
+			return
+		}
+		healthy := rt.HealthyWorkers(nil)
+		if healthy == 0 {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]any{"status": "no inference workers available", "healthy_workers": 0})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"status": "ready", "healthy_workers": healthy})
+	})
+}
+
+// buildInfo identifies the running binary, for GET /version and proxy_build_info
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	GoVersion string `json:"go_version"`
+}
+
+// readBuildInfo combines the -ldflags variables with what the Go toolchain
+// recorded, so builds without -ldflags still report their revision
+func readBuildInfo() buildInfo {
+	info := buildInfo{Version: version, Commit: commit, GoVersion: runtime.Version()}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+		if bi, ok := debug.ReadBuildInfo(); ok {
+			for _, s := range bi.Settings {
+				if s.Key == "vcs.revision" && s.Value != "" {
+					info.Commit = s.Value
+				}
+			}
+		}
+	}
+	return info
+}
+
+// versionHandler reports the build the gateway runs
+func versionHandler(info buildInfo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, info)
+	})
+}
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aluko123/go-network-proxy/inference/queue"
+	"github.com/aluko123/go-network-proxy/inference/router"
+)
+
+func TestRegisterPrivateRoutes(t *testing.T) {
+	rt := new(router.Router)
+	pattern := func(mux *http.ServeMux, method, target string) string {
+		_, p := mux.Handler(httptest.NewRequest(method, target, nil))
+		return p
+	}
+
+	// Default: admin endpoints share the public mux, where the forward
+	// proxy catches everything unrouted
+	public := http.NewServeMux()
+	public.Handle("/", http.NotFoundHandler())
+	if registerPrivateRoutes(public, public, new(queue.ModelQueues), rt) {
+		t.Error("private routes registered on the public mux")
+	}
+	for _, target := range []string{"/admin/workers", "http://anything/admin/workers"} {
+		if p := pattern(public, http.MethodPost, target); p != "/" {
+			t.Errorf("POST %s routed to %q on -addr, want the proxy", target, p)
+		}
+	}
+	if p := pattern(public, http.MethodDelete, "/admin/workers/worker-0"); p != "/" {
+		t.Errorf("DELETE routed to %q on -addr, want the proxy", p)
+	}
+	if p := pattern(public, http.MethodGet, "http://anything/admin/workers"); p != "/" {
+		t.Errorf("GET /admin/workers routed to %q on -addr, want the proxy", p)
+	}
+	if p := pattern(public, http.MethodGet, "http://anything/admin/queue"); p != "/" {
+		t.Errorf("GET /admin/queue routed to %q on -addr, want the proxy", p)
+	}
+	if p := pattern(public, http.MethodPost, "/admin/loglevel"); p != "/" {
+		t.Errorf("POST /admin/loglevel routed to %q on -addr, want the proxy", p)
+	}
+
+	// With -metrics-addr they go on the private listener only
+	private := http.NewServeMux()
+	if !registerPrivateRoutes(public, private, new(queue.ModelQueues), rt) {
+		t.Fatal("private routes not registered on the private mux")
+	}
+	if p := pattern(private, http.MethodPost, "/admin/workers"); p != "POST /admin/workers" {
+		t.Errorf("POST /admin/workers on the private mux routed to %q", p)
+	}
+	if p := pattern(public, http.MethodPost, "/admin/workers"); p != "/" {
+		t.Errorf("POST /admin/workers leaked onto -addr: %q", p)
+	}
+	if p := pattern(private, http.MethodGet, "/admin/workers"); p != "GET /admin/workers" {
+		t.Errorf("GET /admin/workers on the private mux routed to %q", p)
+	}
+	if p := pattern(private, http.MethodGet, "/admin/queue"); p != "/admin/queue" {
+		t.Errorf("GET /admin/queue on the private mux routed to %q", p)
+	}
+	if p := pattern(private, http.MethodPost, "/admin/loglevel"); p != "/admin/loglevel" {
+		t.Errorf("POST /admin/loglevel on the private mux routed to %q", p)
+	}
+}
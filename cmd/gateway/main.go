@@ -3,152 +3,403 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"encoding/json"
 	"flag"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/http/pprof"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/aluko123/go-network-proxy/inference/cache"
 	"github.com/aluko123/go-network-proxy/inference/queue"
+	"github.com/aluko123/go-network-proxy/inference/quota"
 	"github.com/aluko123/go-network-proxy/inference/router"
 	"github.com/aluko123/go-network-proxy/inference/worker"
+	"github.com/aluko123/go-network-proxy/pkg/auth"
 	"github.com/aluko123/go-network-proxy/pkg/blocklist"
+	"github.com/aluko123/go-network-proxy/pkg/config"
 	"github.com/aluko123/go-network-proxy/pkg/limit"
 	"github.com/aluko123/go-network-proxy/pkg/logger"
+	"github.com/aluko123/go-network-proxy/pkg/metrics"
 	"github.com/aluko123/go-network-proxy/pkg/middleware"
+	"github.com/aluko123/go-network-proxy/pkg/resolver"
+	"github.com/aluko123/go-network-proxy/pkg/tlsconfig"
+	"github.com/aluko123/go-network-proxy/pkg/tracing"
 	"github.com/aluko123/go-network-proxy/proxy/handlers"
 	"github.com/aluko123/go-network-proxy/proxy/tunnel"
+	"github.com/pires/go-proxyproto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
 	"golang.org/x/time/rate"
 )
 
+// Set at build time, e.g.
+//
+//	go build -ldflags "-X main.version=v1.4.0 -X main.commit=$(git rev-parse --short HEAD)" ./cmd/gateway
+var (
+	version = "dev"
+	commit  = "" // empty falls back to the VCS revision Go embeds in the binary
+)
+
 func main() {
-	// --- 1. Configuration Flags ---
-	var (
-		pemPath     string
-		keyPath     string
-		proto       string
-		debug       bool
-		limiterType string
-		redisAddr   string
-		rateLimit   int
-		rateBurst   int
-		workerAddrs string
-		logFormat   string
-
-		// Timeout configuration
-		readTimeout      time.Duration
-		writeTimeout     time.Duration
-		idleTimeout      time.Duration
-		dialTimeout      time.Duration
-		inferenceTimeout time.Duration
-		shutdownTimeout  time.Duration
-	)
+	// --- 1. Configuration ---
+	// Precedence: command-line flags, then PROXY_* environment variables,
+	// then the -config file, then defaults
+	cfg := config.Default()
+	cfg.RegisterFlags(flag.CommandLine)
+	configFile := flag.String("config", "", "JSON or YAML file of options keyed by flag name; flags and PROXY_* env vars override it")
+	flag.Parse()
 
-	flag.StringVar(&pemPath, "pem", "server.pem", "path to pem file")
-	flag.StringVar(&keyPath, "key", "server.key", "path to key file")
-	flag.StringVar(&proto, "proto", "http", "protocol to use: http or https")
-	flag.BoolVar(&debug, "debug", false, "enable debug logging")
+	if err := config.LoadEnv(flag.CommandLine); err != nil {
+		logger.New(cfg.LogFormat).Error("invalid environment configuration", "error", err)
+		os.Exit(1)
+	}
+	if *configFile != "" {
+		if err := config.LoadFile(flag.CommandLine, *configFile); err != nil {
+			logger.New(cfg.LogFormat).Error("failed to load -config", "error", err)
+			os.Exit(1)
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		logger.New(cfg.LogFormat).Error("invalid configuration", "error", err)
+		os.Exit(1)
+	}
 
-	flag.StringVar(&limiterType, "limiter", "redis", "Rate limiter type: memory or redis")
-	flag.StringVar(&redisAddr, "redis-addr", "localhost:6379", "Redis server address")
-	flag.IntVar(&rateLimit, "rate-limit", 100, "Requests per minute per IP")
-	flag.IntVar(&rateBurst, "rate-burst", 20, "Burst size for rate limiter")
+	build := readBuildInfo()
+	metrics.BuildInfo.WithLabelValues(build.Version, build.Commit, build.GoVersion).Set(1)
 
-	flag.StringVar(&workerAddrs, "worker-addrs", "", "Comma-separated list of inference worker addresses")
+	// --- 2. Initialize Infrastructure ---
 
-	flag.StringVar(&logFormat, "log-format", "json", "Log format: json or text")
+	// The application log uses the shared level, adjustable at runtime via /admin/loglevel
+	appLevel, err := logger.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		logger.New(cfg.LogFormat).Error("invalid -log-level", "error", err)
+		os.Exit(1)
+	}
+	if cfg.Debug {
+		appLevel = slog.LevelDebug
+	}
+	logger.SetLevel(appLevel)
+	logger.SetRedactedHeaders(strings.Split(cfg.RedactHeaders, ","))
 
-	// Timeout flags
-	flag.DurationVar(&readTimeout, "read-timeout", 30*time.Second, "HTTP read timeout")
-	flag.DurationVar(&writeTimeout, "write-timeout", 60*time.Second, "HTTP write timeout")
-	flag.DurationVar(&idleTimeout, "idle-timeout", 120*time.Second, "HTTP idle timeout")
-	flag.DurationVar(&dialTimeout, "dial-timeout", 10*time.Second, "Upstream connection dial timeout")
-	flag.DurationVar(&inferenceTimeout, "inference-timeout", 5*time.Minute, "Max inference request duration")
-	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", 30*time.Second, "Graceful shutdown timeout")
+	log, closeLog, err := newLogger(cfg.LogOutput, cfg.LogFormat, "", 0, 0)
+	if err != nil {
+		logger.New(cfg.LogFormat).Error("failed to initialize logger", "error", err)
+		os.Exit(1)
+	}
+	defer closeLog()
 
-	flag.Parse()
+	// Access logs go to the application logger unless configured separately
+	accessLog := log
+	if cfg.AccessLogOutput != "" || cfg.AccessLogFormat != "" || cfg.AccessLogLevel != "" || cfg.AccessLogMaxSize > 0 {
+		if cfg.AccessLogOutput == "" {
+			cfg.AccessLogOutput = cfg.LogOutput
+		}
+		if cfg.AccessLogFormat == "" {
+			cfg.AccessLogFormat = cfg.LogFormat
+		}
+		var closeAccessLog func() error
+		accessLog, closeAccessLog, err = newLogger(cfg.AccessLogOutput, cfg.AccessLogFormat, cfg.AccessLogLevel,
+			int64(cfg.AccessLogMaxSize)<<20, cfg.AccessLogMaxBackups)
+		if err != nil {
+			log.Error("failed to initialize access logger", "error", err)
+			os.Exit(1)
+		}
+		defer closeAccessLog()
+	}
 
-	// --- 2. Initialize Infrastructure ---
+	hostMetrics := metrics.HostConfig{MaxHosts: cfg.HostMetricsMax, Latency: cfg.HostMetricsLatency}
+	if cfg.HostMetricsAllow != "" {
+		hostMetrics.Allow = strings.Split(cfg.HostMetricsAllow, ",")
+	}
+	metrics.SetHostConfig(hostMetrics)
+
+	// Tracing falls back to propagation only when no collector is configured
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Endpoint:    cfg.OTelEndpoint,
+		Insecure:    cfg.OTelInsecure,
+		ServiceName: cfg.OTelServiceName,
+		SampleRatio: cfg.OTelSampleRatio,
+	})
+	if err != nil {
+		log.Error("failed to initialize tracing", "error", err)
+		os.Exit(1)
+	}
+	defer shutdownTracing(context.Background())
 
-	log := logger.New(logFormat)
+	// Blocklist
+	bm := blocklist.NewManager()
+	if err := bm.LoadFromFile(cfg.Blocklist); err != nil {
+		log.Warn("could not load blocklist", "error", err)
+	}
+	if cfg.BlockedPage != "" {
+		tmpl, err := template.ParseFiles(cfg.BlockedPage)
+		if err != nil {
+			log.Error("invalid -blocked-page", "error", err)
+			os.Exit(1)
+		}
+		blocklist.SetBlockedTemplate(tmpl)
+	}
+
+	// Upstream dials share one DNS cache, which also enforces blocked_ips
+	dns := resolver.New(resolver.Config{
+		TTL:        cfg.DNSCacheTTL,
+		MaxEntries: cfg.DNSCacheSize,
+		Blocked:    bm.IsBlockedIP,
+	})
 
 	// Configure timeouts for handlers
 	tunnel.SetConfig(tunnel.Config{
-		DialTimeout: dialTimeout,
+		DialTimeout:    cfg.DialTimeout,
+		KeepAlive:      cfg.TunnelKeepAlive,
+		FallbackDelay:  cfg.TunnelFallback,
+		LocalAddr:      net.ParseIP(cfg.TunnelLocalAddr),
+		CopyBufferSize: cfg.CopyBufferSize,
+		Resolver:       dns,
 	})
+	setHeaders, err := middleware.ParseHeaders(cfg.RequestHeaderSet)
+	if err != nil {
+		log.Error("invalid -request-header-set", "error", err)
+		os.Exit(1)
+	}
+	var removeHeaders []string
+	if cfg.RequestHeaderRemove != "" {
+		removeHeaders = strings.Split(cfg.RequestHeaderRemove, ",")
+	}
 	handlers.SetConfig(handlers.Config{
-		DialTimeout:     dialTimeout,
-		IdleConnTimeout: idleTimeout,
+		DialTimeout:     cfg.DialTimeout,
+		IdleConnTimeout: cfg.IdleTimeout,
+		CopyBufferSize:  cfg.CopyBufferSize,
+		Transparent:     cfg.Transparent,
+		RemoveHeaders:   removeHeaders,
+		SetHeaders:      setHeaders,
+		Resolver:        dns,
 	})
+	modelTimeouts, err := worker.ParseModelTimeouts(cfg.ModelTimeouts)
+	if err != nil {
+		log.Error("invalid -model-timeouts", "error", err)
+		os.Exit(1)
+	}
 	worker.SetConfig(worker.Config{
-		InferenceTimeout: inferenceTimeout,
+		InferenceTimeout: cfg.InferenceTimeout,
+		ModelTimeouts:    modelTimeouts,
+		MaxRetries:       cfg.MaxRetries,
+		MaxConcurrent:    cfg.WorkerMaxConcurrent,
+		TLSCAFile:        cfg.WorkerTLSCA,
+		TLSCertFile:      cfg.WorkerTLSCert,
+		TLSKeyFile:       cfg.WorkerTLSKey,
+		TLSServerName:    cfg.WorkerTLSServerName,
+		AuthToken:        cfg.WorkerAuthToken,
 	})
-
-	// Blocklist
-	bm := blocklist.NewManager()
-	// Note: Adjusted path to config/blocklist.json
-	if err := bm.LoadFromFile("configs/blocklist.json"); err != nil {
-		log.Warn("could not load blocklist", "error", err)
+	if cfg.WorkerAuthToken != "" && cfg.WorkerTLSCA == "" {
+		log.Warn("worker auth token is sent in plaintext; set -worker-tls-ca to encrypt worker traffic")
 	}
-
-	// Rate Limiter
-	var rateLimiter limit.RateLimiter
-	var err error
-
-	switch limiterType {
-	case "redis":
-		log.Info("initializing redis rate limiter", "addr", redisAddr, "limit", rateLimit, "burst", rateBurst)
-		rateLimiter, err = limit.NewRedisRateLimiter(redisAddr, rateLimit, rateBurst)
-		if err != nil {
-			log.Error("failed to initialize redis rate limiter", "error", err)
+	routerCfg := router.DefaultConfig()
+	routerCfg.HealthCheckInterval = cfg.HealthCheckInterval
+	routerCfg.HealthCheckTimeout = cfg.HealthCheckTimeout
+	routerCfg.UnhealthyThreshold = cfg.UnhealthyThreshold
+	routerCfg.ReconnectThreshold = cfg.ReconnectThreshold
+	routerCfg.ReconnectBackoff = cfg.ReconnectBackoff
+	routerCfg.ReconnectMaxBackoff = cfg.ReconnectMaxBackoff
+	routerCfg.BatchSize = cfg.BatchSize
+	routerCfg.BatchWindow = cfg.BatchWindow
+	router.SetConfig(routerCfg)
+
+	// Client IP: forwarded headers count only from trusted proxies
+	if cfg.TrustedProxies != "" {
+		if err := limit.SetTrustedProxies(strings.Split(cfg.TrustedProxies, ",")); err != nil {
+			log.Error("invalid -trusted-proxies", "error", err)
 			os.Exit(1)
 		}
-		log.Info("redis rate limiter initialized")
-	case "memory":
-		log.Info("initializing in-memory rate limiter", "limit", rateLimit)
-		rateLimiter = limit.NewMemoryRateLimiter(rate.Limit(float64(rateLimit)/60), rateBurst)
-		log.Info("in-memory rate limiter initialized")
-	default:
-		log.Error("invalid limiter type", "type", limiterType)
+	}
+	limit.SetSocketClientID(cfg.SocketClientID)
+	if err := limit.SetClientIPHeaders(strings.Split(cfg.ForwardHeaders, ",")); err != nil {
+		log.Error("invalid -client-ip-headers", "error", err)
 		os.Exit(1)
 	}
+
+	// Rate Limiter
+	methodLimits, err := limit.ParseMethodLimits(cfg.RateLimitMethods)
+	if err != nil {
+		log.Error("invalid -rate-limit-methods", "error", err)
+		os.Exit(1)
+	}
+	log.Info("initializing rate limiter", "type", cfg.Limiter, "limit", cfg.RateLimit, "burst", cfg.RateBurst, "method_overrides", len(methodLimits))
+	rateLimiter, err := newRateLimiter(cfg, "", cfg.RateLimit, cfg.RateBurst)
+	if err != nil {
+		log.Error("failed to initialize rate limiter", "type", cfg.Limiter, "error", err)
+		os.Exit(1)
+	}
+	if len(methodLimits) > 0 {
+		methods := make(map[string]limit.RateLimiter, len(methodLimits))
+		for method, ml := range methodLimits {
+			methods[method], err = newRateLimiter(cfg, method+":", ml.Limit, ml.Burst)
+			if err != nil {
+				log.Error("failed to initialize rate limiter", "type", cfg.Limiter, "method", method, "error", err)
+				os.Exit(1)
+			}
+		}
+		rateLimiter = limit.NewMethodRateLimiter(rateLimiter, methods)
+	}
+	log.Info("rate limiter initialized", "type", cfg.Limiter)
 	defer rateLimiter.Close()
 
 	// --- 3. Inference Engine Initialization ---
 	var inferenceHandler *handlers.InferenceHandler
+	var inferenceQueues *queue.ModelQueues
+	var inferenceRouter *router.Router
 
-	if workerAddrs != "" {
-		// 1. Create Priority Queue
-		pq := queue.NewPriorityQueue()
+	if cfg.WorkerAddrs != "" || cfg.ModelWorkers != "" {
+		modelWorkers, err := parseModelWorkers(cfg.ModelWorkers)
+		if err != nil {
+			log.Error("invalid -model-workers", "error", err)
+			os.Exit(1)
+		}
+
+		// 1. Create Priority Queues (one per model pool, plus the shared default)
+		var addrs []string
+		var defaultQueue *queue.PriorityQueue
+		if cfg.WorkerAddrs != "" {
+			addrs = strings.Split(cfg.WorkerAddrs, ",")
+			defaultQueue = queue.NewPriorityQueue(cfg.QueueSize)
+		}
+		queues := queue.NewModelQueues(defaultQueue)
+		for model := range modelWorkers {
+			queues.Add(model, queue.NewPriorityQueue(cfg.QueueSize))
+		}
 
 		// 2. Create and Start Router (Manages Workers)
-		addrs := strings.Split(workerAddrs, ",")
-		routerInstance, err := router.NewRouter(addrs, pq)
+		balancer, err := router.NewBalancer(cfg.Balancer)
+		if err != nil {
+			log.Error("invalid -balancer", "error", err)
+			os.Exit(1)
+		}
+		routerInstance, err := router.NewModelRouter(modelWorkers, addrs, queues, balancer)
 		if err != nil {
 			log.Error("failed to initialize inference router", "error", err)
 			os.Exit(1)
 		}
+		if cfg.WorkerModels != "" {
+			routerInstance.SetDefaultModels(strings.Split(cfg.WorkerModels, ","))
+		}
 		routerInstance.Start()
-		defer routerInstance.Close()
 
 		// 3. Create HTTP Handler
-		inferenceHandler = handlers.NewInferenceHandler(pq)
-		log.Info("inference gateway initialized", "workers", len(addrs))
+		inferenceHandler = handlers.NewModelInferenceHandler(queues)
+		inferenceHandler.SetConfig(handlers.InferenceConfig{
+			DefaultModel:       cfg.DefaultModel,
+			DefaultMaxTokens:   cfg.DefaultMaxTokens,
+			DefaultTemperature: float32(cfg.DefaultTemperature),
+			DefaultPriority:    cfg.DefaultPriority,
+
+			MaxPromptBytes:   cfg.MaxPromptBytes,
+			MaxTokens:        cfg.MaxTokens,
+			MinPriority:      cfg.MinPriority,
+			MaxPriority:      cfg.MaxPriority,
+			StrictPriority:   cfg.StrictPriority,
+			MaxStopSequences: cfg.MaxStopSequences,
+			Heartbeat:        cfg.SSEHeartbeat,
+		})
+		inferenceHandler.SetAvailability(func(pq *queue.PriorityQueue) bool {
+			return routerInstance.HealthyWorkers(pq) > 0
+		})
+		inferenceHandler.SetAdmission(routerInstance, cfg.AdmissionMaxWait)
+		inferenceQueues = queues
+		inferenceRouter = routerInstance
+		if cfg.InferenceCacheTTL > 0 {
+			inferenceHandler.SetCache(cache.New(cfg.InferenceCacheTTL, cfg.InferenceCacheSize))
+			log.Info("inference cache enabled", "ttl", cfg.InferenceCacheTTL, "size", cfg.InferenceCacheSize)
+		}
+		if cfg.InferenceQuotas != "" {
+			quotaCfg, err := quota.Load(cfg.InferenceQuotas)
+			if err != nil {
+				log.Error("failed to load -inference-quotas", "error", err)
+				os.Exit(1)
+			}
+			quotaCfg.Timeout = cfg.RedisTimeout
+			quotaCfg.FailOpen = cfg.RedisFailOpen
+			client, err := limit.NewRedisClient(redisConfig(cfg))
+			if err != nil {
+				log.Error("failed to connect to redis for quotas", "error", err)
+				os.Exit(1)
+			}
+			defer client.Close()
+			inferenceHandler.SetQuota(quota.New(client, quotaCfg))
+			log.Info("inference token quotas enabled", "keys", len(quotaCfg.Keys), "models", len(quotaCfg.Models))
+		}
+		if cfg.APIKeyTiers != "" {
+			tiers, err := loadAPIKeyTiers(cfg.APIKeyTiers)
+			if err != nil {
+				log.Error("failed to load -api-key-tiers", "error", err)
+				os.Exit(1)
+			}
+			inferenceHandler.SetPriorityFunc(handlers.APIKeyPriority(tiers))
+			log.Info("api key priority tiers loaded", "keys", len(tiers))
+		}
+		log.Info("inference gateway initialized", "workers", len(addrs), "models", queues.Models())
 	}
 
 	// --- 4. Setup Handlers & Routing ---
 
 	mux := http.NewServeMux()
 
-	// A. Observability
-	mux.Handle("/metrics", promhttp.Handler())
+	// A. Observability and admin: on the public mux, or on a private
+	// listener (without rate limiting) with -metrics-addr
+	adminMux := mux
+	var metricsServer *http.Server
+	if cfg.MetricsAddr != "" {
+		adminMux = http.NewServeMux()
+		metricsServer = &http.Server{
+			Addr: cfg.MetricsAddr,
+			Handler: middleware.Chain(
+				adminMux,
+				middleware.WithRecovery(log),
+				middleware.WithLogging(accessLog),
+				middleware.WithRequestID(),
+			),
+			ReadTimeout: cfg.ReadTimeout,
+			IdleTimeout: cfg.IdleTimeout,
+		}
+	}
+	adminMux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("GET /readyz", readyzHandler(inferenceRouter))
+	adminMux.Handle("GET /version", versionHandler(build))
+	if cfg.PProf {
+		// Validate guarantees adminMux is the private listener's here
+		adminMux.HandleFunc("/debug/pprof/", pprof.Index)
+		adminMux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		adminMux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		adminMux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		adminMux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		log.Info("pprof enabled", "addr", cfg.MetricsAddr)
+	}
 
 	// B. Inference Endpoint
 	if inferenceHandler != nil {
-		mux.Handle("/v1/inference", inferenceHandler)
+		var api http.Handler = inferenceHandler
+		var estimate http.Handler = handlers.EstimateHandler(inferenceQueues, inferenceRouter, cfg.DefaultModel)
+		var models http.Handler = handlers.ModelsHandler(inferenceRouter)
+		if cfg.CORSOrigins != "" {
+			cors := middleware.DefaultCORSConfig()
+			cors.AllowedOrigins = strings.Split(cfg.CORSOrigins, ",")
+			api = middleware.WithCORS(cors)(api)
+			estimate = middleware.WithCORS(cors)(estimate)
+			models = middleware.WithCORS(cors)(models)
+		}
+		mux.Handle("/v1/inference", api)
+		mux.Handle("/v1/inference/estimate", estimate)
+		mux.Handle("/v1/models", models)
+	}
+	if !registerPrivateRoutes(mux, adminMux, inferenceQueues, inferenceRouter) {
+		log.Info("private admin endpoints are off; set -metrics-addr to serve them")
 	}
 
 	// C. Forward Proxy (Catch-all)
@@ -163,44 +414,238 @@ func main() {
 	// Wrap Proxy with Blocklist
 	blockedProxy := middleware.WithBlocklist(bm)(proxyHandler)
 
+	// CONNECT needs to hijack the connection, so with HTTP/2 enabled the
+	// proxy path still only accepts HTTP/1.1
+	if cfg.HTTP2 {
+		blockedProxy = middleware.WithHTTP1Only()(blockedProxy)
+	}
+
+	// Require proxy credentials if configured (API routes are unaffected)
+	if cfg.ProxyAuthFile != "" {
+		creds, err := auth.LoadHtpasswd(cfg.ProxyAuthFile)
+		if err != nil {
+			log.Error("failed to load -proxy-auth-file", "error", err)
+			os.Exit(1)
+		}
+		blockedProxy = middleware.WithProxyAuth(creds, cfg.ProxyAuthRealm)(blockedProxy)
+		log.Info("proxy authentication enabled", "users", len(creds))
+	}
+
 	mux.Handle("/", blockedProxy)
 
+	// ServeMux never matches CONNECT's empty path, so tunnels bypass it
+	routes := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodConnect {
+			blockedProxy.ServeHTTP(w, r)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+
 	// --- 4. Apply Global Middleware ---
+	accessLogSample := middleware.LogSampling{Rate: cfg.AccessLogSampleRate, SlowThreshold: cfg.AccessLogSlowThreshold}
+	if cfg.AccessLogInclude != "" || cfg.AccessLogExclude != "" {
+		include, err := middleware.ParseLogRules(cfg.AccessLogInclude)
+		if err != nil {
+			log.Error("invalid -access-log-include", "error", err)
+			os.Exit(1)
+		}
+		exclude, err := middleware.ParseLogRules(cfg.AccessLogExclude)
+		if err != nil {
+			log.Error("invalid -access-log-exclude", "error", err)
+			os.Exit(1)
+		}
+		accessLogSample.LogIf = middleware.LogFilter(include, exclude)
+	}
+
+	responseHeaders, err := middleware.ParseHeaders(cfg.ResponseHeaders)
+	if err != nil {
+		log.Error("invalid -response-headers", "error", err)
+		os.Exit(1)
+	}
+	headerOverrides, err := middleware.ParseHeaders(cfg.ResponseHeaderOverrides)
+	if err != nil {
+		log.Error("invalid -response-header-overrides", "error", err)
+		os.Exit(1)
+	}
+
+	// MITM: decrypted tunnel requests get their own, smaller chain
+	if cfg.MITMCACert != "" {
+		ca, err := tls.LoadX509KeyPair(cfg.MITMCACert, cfg.MITMCAKey)
+		if err != nil {
+			log.Error("failed to load -mitm-ca-cert", "error", err)
+			os.Exit(1)
+		}
+		decrypted := middleware.Chain(
+			http.HandlerFunc(handlers.HandleHTTP),
+			middleware.WithResponseHeaderOverrides(headerOverrides),
+			middleware.WithResponseHeaders(responseHeaders),
+			middleware.WithBlocklist(bm),
+			middleware.WithRecovery(log),
+			middleware.WithSampledLogging(accessLog, accessLogSample),
+			middleware.WithTracing(),
+			middleware.WithRequestID(),
+		)
+		interceptor, err := tunnel.NewInterceptor(ca, decrypted)
+		if err != nil {
+			log.Error("invalid -mitm-ca-cert", "error", err)
+			os.Exit(1)
+		}
+		tunnel.SetInterceptor(interceptor)
+		log.Warn("HTTPS interception enabled: CONNECT tunnels are decrypted", "ca", cfg.MITMCACert)
+	}
+
+	var rateLimitExempt func(*http.Request) bool
+	if cfg.RateLimitExempt != "" {
+		rateLimitExempt = middleware.ExemptPaths(strings.Split(cfg.RateLimitExempt, ","))
+	}
+
+	// A tunnel or WebSocket would hold a concurrency slot for its whole lifetime
+	var noSlot func(*http.Request) bool
+	if !cfg.MaxInFlightConnect {
+		isConnect := middleware.ExemptMethodsAndPaths([]string{http.MethodConnect}, nil)
+		noSlot = func(r *http.Request) bool { return isConnect(r) || middleware.IsUpgrade(r) }
+	}
+
+	// Tunnels, WebSockets and SSE inference streams are long-lived by design
+	longLived := middleware.ExemptMethodsAndPaths([]string{http.MethodConnect}, []string{"/v1/inference"})
+	noTimeout := func(r *http.Request) bool { return longLived(r) || middleware.IsUpgrade(r) }
+
 	// Chain applies in reverse order: last listed runs first
 	finalHandler := middleware.Chain(
-		mux,
-		middleware.WithRateLimit(rateLimiter), // 3. Check rate limit
-		middleware.WithLogging(log),           // 2. Log request (needs request_id)
-		middleware.WithRequestID(),            // 1. Generate request ID first
+		routes,
+		middleware.WithResponseHeaderOverrides(headerOverrides),   // 11. Replace upstream response headers
+		middleware.WithResponseHeaders(responseHeaders),           // 10. Add missing response headers
+		middleware.WithTimeout(cfg.RequestTimeout, noTimeout),     // 9. Bound request time
+		middleware.WithCompression(cfg.CompressionMinSize),        // 8. Compress responses
+		middleware.WithMaxBodySize(cfg.MaxBodySize),               // 7. Cap request body size
+		middleware.WithConcurrencyLimit(cfg.MaxInFlight, noSlot),  // 6. Cap requests in flight
+		middleware.WithRateLimit(rateLimiter, rateLimitExempt),    // 5. Check rate limit
+		middleware.WithRecovery(log),                              // 4. Recover panics (logged to app log)
+		middleware.WithSampledLogging(accessLog, accessLogSample), // 3. Log request (needs request_id)
+		middleware.WithTracing(),                                  // 2. Start span (records request_id)
+		middleware.WithRequestID(),                                // 1. Generate request ID first
 	)
 
 	server := &http.Server{
-		Addr:         ":8080",
+		Addr:         cfg.Addr,
 		Handler:      finalHandler,
-		ReadTimeout:  readTimeout,
-		WriteTimeout: writeTimeout,
-		IdleTimeout:  idleTimeout,
-		TLSNextProto: make(map[string]func(*http.Server, *tls.Conn, http.Handler)),
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+	}
+	if cfg.HTTP2 {
+		server.Protocols = new(http.Protocols)
+		server.Protocols.SetHTTP1(true)
+		server.Protocols.SetHTTP2(true)
+		server.Protocols.SetUnencryptedHTTP2(true)
+	} else {
+		// HTTP/2 off by default: clients negotiating h2 could not CONNECT
+		server.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+	}
+	if cfg.Proto == "https" {
+		tlsCfg := tlsconfig.DefaultConfig()
+		tlsCfg.MinVersion = cfg.TLSMinVersion
+		if cfg.TLSCiphers != "" {
+			tlsCfg.CipherSuites = strings.Split(cfg.TLSCiphers, ",")
+		}
+		tlsCfg.PreferServerCipherSuites = cfg.TLSServerOrder
+		server.TLSConfig, err = tlsconfig.New(tlsCfg)
+		if err != nil {
+			log.Error("invalid TLS settings", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// ACME: certificates are obtained on the first handshake for each domain
+	// and renewed ahead of expiry
+	var acmeServer *http.Server
+	if cfg.ACMEDomains != "" {
+		var domains []string
+		for _, d := range strings.Split(cfg.ACMEDomains, ",") {
+			if d = strings.TrimSpace(d); d != "" {
+				domains = append(domains, d)
+			}
+		}
+		certManager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(domains...),
+			Cache:      autocert.DirCache(cfg.ACMECacheDir),
+			Email:      cfg.ACMEEmail,
+		}
+		if cfg.ACMEDirectory != "" {
+			certManager.Client = &acme.Client{DirectoryURL: cfg.ACMEDirectory}
+		}
+		server.TLSConfig.GetCertificate = certManager.GetCertificate
+		acmeServer = &http.Server{
+			Addr:              cfg.ACMEHTTPAddr,
+			Handler:           certManager.HTTPHandler(nil), // HTTP-01 challenges, else redirect to HTTPS
+			ReadHeaderTimeout: cfg.ReadTimeout,
+		}
+		log.Info("acme enabled", "domains", domains, "cache_dir", cfg.ACMECacheDir)
+	} else if cfg.Proto == "https" {
+		// -pem/-key are reloaded on SIGHUP, so rotating them drops no tunnels
+		certs, err := tlsconfig.NewCertReloader(cfg.PEMPath, cfg.KeyPath)
+		if err != nil {
+			log.Error("failed to load TLS certificate", "pem", cfg.PEMPath, "key", cfg.KeyPath, "error", err)
+			os.Exit(1)
+		}
+		server.TLSConfig.GetCertificate = certs.GetCertificate
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				if err := certs.Reload(); err != nil {
+					log.Error("TLS certificate reload failed, keeping the current one", "error", err)
+					continue
+				}
+				log.Info("TLS certificate reloaded", "pem", cfg.PEMPath, "not_after", certs.Certificate().Leaf.NotAfter)
+			}
+		}()
 	}
 
 	// --- 5. Start Server ---
 	log.Info("starting server",
+		"version", build.Version,
+		"commit", build.Commit,
 		"addr", server.Addr,
-		"proto", proto,
-		"read_timeout", readTimeout,
-		"write_timeout", writeTimeout,
-		"idle_timeout", idleTimeout,
-		"shutdown_timeout", shutdownTimeout,
+		"proto", cfg.Proto,
+		"http2", cfg.HTTP2,
+		"proxy_protocol", cfg.ProxyProto,
+		"tls_min_version", cfg.TLSMinVersion,
+		"read_timeout", cfg.ReadTimeout,
+		"write_timeout", cfg.WriteTimeout,
+		"idle_timeout", cfg.IdleTimeout,
+		"shutdown_timeout", cfg.ShutdownTimeout,
 	)
 
 	// Channel to receive server errors
-	serverErr := make(chan error, 1)
+	serverErr := make(chan error, 3)
 
+	if metricsServer != nil {
+		log.Info("starting metrics/admin server", "addr", metricsServer.Addr)
+		go func() {
+			serverErr <- metricsServer.ListenAndServe()
+		}()
+	}
+	if acmeServer != nil {
+		log.Info("starting acme challenge server", "addr", acmeServer.Addr)
+		go func() {
+			serverErr <- acmeServer.ListenAndServe()
+		}()
+	}
+
+	ln, err := listen(cfg.Addr, cfg.ProxyProto)
+	if err != nil {
+		log.Error("failed to listen", "addr", cfg.Addr, "error", err)
+		os.Exit(1)
+	}
 	go func() {
-		if proto == "http" {
-			serverErr <- server.ListenAndServe()
+		if cfg.Proto == "http" {
+			serverErr <- server.Serve(ln)
 		} else {
-			serverErr <- server.ListenAndServeTLS(pemPath, keyPath)
+			// Certificates come from TLSConfig.GetCertificate
+			serverErr <- server.ServeTLS(ln, "", "")
 		}
 	}()
 
@@ -219,15 +664,178 @@ func main() {
 	}
 
 	// Create shutdown context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer cancel()
 
-	log.Info("shutting down server", "timeout", shutdownTimeout)
+	log.Info("shutting down server", "timeout", cfg.ShutdownTimeout)
+
+	// Turn new inference requests away first, so clients fail over while the
+	// accepted ones finish
+	if inferenceHandler != nil {
+		inferenceHandler.Shutdown()
+	}
 
 	// Shutdown HTTP server (stops accepting new connections, waits for existing)
 	if err := server.Shutdown(ctx); err != nil {
 		log.Error("server shutdown error", "error", err)
 	}
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(ctx); err != nil {
+			log.Error("metrics/admin server shutdown error", "error", err)
+		}
+	}
+	if acmeServer != nil {
+		if err := acmeServer.Shutdown(ctx); err != nil {
+			log.Error("acme challenge server shutdown error", "error", err)
+		}
+	}
+
+	// Drain the inference queues within whatever is left of the timeout
+	if inferenceRouter != nil {
+		if err := inferenceRouter.Shutdown(ctx); err != nil {
+			log.Error("inference drain incomplete", "error", err)
+		}
+	}
 
 	log.Info("server stopped gracefully")
 }
+
+// listen opens the main listener: TCP, or a Unix socket for a "unix:/path"
+// addr. With proxyProtocol every connection must start with a PROXY protocol
+// v1/v2 header, whose source address becomes the connection's RemoteAddr (and
+// so limit.GetIP and the logs see the real client); connections without one
+// are rejected.
+func listen(addr string, proxyProtocol bool) (net.Listener, error) {
+	network := "tcp"
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		network, addr = "unix", path
+		// A socket left behind by a crash would make Listen fail
+		if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			os.Remove(path)
+		}
+	}
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if ul, ok := ln.(*net.UnixListener); ok {
+		// Shutdown closes the listener, which then removes the socket file
+		ul.SetUnlinkOnClose(true)
+	}
+	if !proxyProtocol {
+		return ln, nil
+	}
+	return &proxyproto.Listener{
+		Listener: ln,
+		Policy: func(net.Addr) (proxyproto.Policy, error) {
+			return proxyproto.REQUIRE, nil
+		},
+	}, nil
+}
+
+// newLogger builds a logger for the given destination, format and level; an
+// empty level follows the shared runtime level. File destinations rotate at
+// maxSize bytes (0 = never), keeping maxBackups files.
+func newLogger(output, format, level string, maxSize int64, maxBackups int) (*logger.Logger, func() error, error) {
+	var lvl slog.Leveler
+	if level != "" {
+		l, err := logger.ParseLevel(level)
+		if err != nil {
+			return nil, nil, err
+		}
+		lvl = l
+	}
+	out, err := logger.OpenRotatingOutput(output, maxSize, maxBackups)
+	if err != nil {
+		return nil, nil, err
+	}
+	return logger.NewWithOptions(logger.Options{
+		Format: format,
+		Output: out,
+		Level:  lvl,
+	}), out.Close, nil
+}
+
+// parseModelWorkers parses "model=addr1,addr2;model2=addr3" into model -> addresses
+func parseModelWorkers(spec string) (map[string][]string, error) {
+	models := make(map[string][]string)
+	if spec == "" {
+		return models, nil
+	}
+
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		model, addrs, ok := strings.Cut(entry, "=")
+		model = strings.TrimSpace(model)
+		if !ok || model == "" || strings.TrimSpace(addrs) == "" {
+			return nil, fmt.Errorf("expected model=addr[,addr...], got %q", entry)
+		}
+		for _, addr := range strings.Split(addrs, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				models[model] = append(models[model], addr)
+			}
+		}
+	}
+	return models, nil
+}
+
+// redisConfig returns the Redis connection settings shared by the rate
+// limiter and inference quotas
+func redisConfig(cfg config.Config) limit.RedisConfig {
+	redisCfg := limit.DefaultRedisConfig()
+	redisCfg.Mode = cfg.RedisMode
+	redisCfg.Addr = cfg.RedisAddr
+	if cfg.RedisMode != limit.RedisModeStandalone {
+		redisCfg.Addrs = strings.Split(cfg.RedisAddr, ",")
+	}
+	redisCfg.MasterName = cfg.RedisMaster
+	redisCfg.Password = cfg.RedisPassword
+	redisCfg.DB = cfg.RedisDB
+	redisCfg.PoolSize = cfg.RedisPoolSize
+	return redisCfg
+}
+
+// newRateLimiter builds a limiter of the configured type allowing perMinute
+// requests with the given burst. keySuffix separates its Redis buckets from
+// other limiters' (see limit.RedisConfig for the key format).
+func newRateLimiter(cfg config.Config, keySuffix string, perMinute, burst int) (limit.RateLimiter, error) {
+	switch cfg.Limiter {
+	case "redis":
+		redisCfg := redisConfig(cfg)
+		redisCfg.KeyPrefix = cfg.RedisPrefix + keySuffix
+		redisCfg.Limit = perMinute
+		redisCfg.Window = time.Minute
+		redisCfg.Burst = burst
+		redisCfg.Timeout = cfg.RedisTimeout
+		redisCfg.FailOpen = cfg.RedisFailOpen
+		redisCfg.BreakerThreshold = cfg.RedisBreakerThreshold
+		redisCfg.BreakerCooldown = cfg.RedisBreakerCooldown
+		return limit.NewRedisRateLimiterWithConfig(redisCfg)
+	case "memory":
+		memoryCfg := limit.DefaultMemoryConfig()
+		memoryCfg.Limit = rate.Limit(float64(perMinute) / 60)
+		memoryCfg.Burst = burst
+		memoryCfg.CleanupInterval = cfg.MemoryCleanupInterval
+		memoryCfg.IdleTimeout = cfg.MemoryIdleTimeout
+		memoryCfg.MaxEntries = cfg.MemoryMaxEntries
+		return limit.NewMemoryRateLimiterWithConfig(memoryCfg), nil
+	default:
+		return nil, fmt.Errorf("invalid limiter type %q", cfg.Limiter)
+	}
+}
+
+// loadAPIKeyTiers reads a JSON object of API key -> priority
+func loadAPIKeyTiers(path string) (map[string]int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tiers map[string]int
+	if err := json.Unmarshal(data, &tiers); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return tiers, nil
+}
@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"sync"
+	"time"
+
+	pb "github.com/aluko123/go-network-proxy/inference/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+// Cache stores completed token streams for deterministic inference requests.
+// Entries expire after the configured TTL and the least recently used entry is
+// evicted once the size cap is reached.
+type Cache struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type entry struct {
+	key     string
+	tokens  []*pb.TokenResponse
+	expires time.Time
+}
+
+// New creates a cache with the given entry TTL and maximum number of entries
+func New(ttl time.Duration, maxEntries int) *Cache {
+	return &Cache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+// Key returns the cache key for a deterministic (temperature 0) request.
+// Requests without stop sequences keep the key they had before stop existed.
+func Key(model, prompt string, maxTokens int, stop ...string) string {
+	h := sha256.New()
+	h.Write([]byte(model))
+	h.Write([]byte{0})
+	h.Write([]byte(prompt))
+	h.Write([]byte{0})
+	h.Write([]byte(strconv.Itoa(maxTokens)))
+	for _, s := range stop {
+		h.Write([]byte{0})
+		h.Write([]byte(strconv.Quote(s))) // quoted so no stop can forge a separator
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Get returns a copy of the cached token stream for key, if present and not expired
+func (c *Cache) Get(key string) ([]*pb.TokenResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	e := el.Value.(*entry)
+	if time.Now().After(e.expires) {
+		c.removeElement(el)
+		return nil, false
+	}
+
+	c.ll.MoveToFront(el)
+	return cloneTokens(e.tokens), true
+}
+
+// Set stores a completed token stream under key, evicting the oldest entry if full
+func (c *Cache) Set(key string, tokens []*pb.TokenResponse) {
+	if c.maxEntries <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry)
+		e.tokens = cloneTokens(tokens)
+		e.expires = time.Now().Add(c.ttl)
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	el := c.ll.PushFront(&entry{
+		key:     key,
+		tokens:  cloneTokens(tokens),
+		expires: time.Now().Add(c.ttl),
+	})
+	c.items[key] = el
+
+	for c.ll.Len() > c.maxEntries {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+// Len returns the number of cached entries (including expired ones not yet evicted)
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+func (c *Cache) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*entry).key)
+}
+
+func cloneTokens(tokens []*pb.TokenResponse) []*pb.TokenResponse {
+	out := make([]*pb.TokenResponse, len(tokens))
+	for i, t := range tokens {
+		out[i] = proto.Clone(t).(*pb.TokenResponse)
+	}
+	return out
+}
@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	pb "github.com/aluko123/go-network-proxy/inference/pb"
+)
+
+func TestCache_GetSet(t *testing.T) {
+	c := New(time.Minute, 10)
+	key := Key("gpt2", "hello", 10)
+
+	if _, ok := c.Get(key); ok {
+		t.Fatal("expected miss on empty cache")
+	}
+
+	c.Set(key, []*pb.TokenResponse{{Token: "hi", TokenCount: 1}})
+
+	tokens, ok := c.Get(key)
+	if !ok {
+		t.Fatal("expected hit after Set")
+	}
+	if len(tokens) != 1 || tokens[0].Token != "hi" {
+		t.Errorf("unexpected cached tokens: %v", tokens)
+	}
+}
+
+func TestCache_KeyDependsOnAllFields(t *testing.T) {
+	base := Key("gpt2", "hello", 10)
+	if base == Key("gpt2", "hello", 11) {
+		t.Error("max_tokens should change the key")
+	}
+	if base == Key("llama", "hello", 10) {
+		t.Error("model should change the key")
+	}
+	if base == Key("gpt2", "hello!", 10) {
+		t.Error("prompt should change the key")
+	}
+	if base == Key("gpt2", "hello", 10, ".") {
+		t.Error("stop sequences should change the key")
+	}
+	if Key("gpt2", "hello", 10, "a", "b") == Key("gpt2", "hello", 10, "a\x00b") {
+		t.Error("stop sequences should not run together")
+	}
+}
+
+func TestCache_Expiry(t *testing.T) {
+	c := New(10*time.Millisecond, 10)
+	key := Key("gpt2", "hello", 10)
+	c.Set(key, []*pb.TokenResponse{{Token: "hi"}})
+
+	time.Sleep(20 * time.Millisecond)
+
+	if _, ok := c.Get(key); ok {
+		t.Error("expected expired entry to miss")
+	}
+	if c.Len() != 0 {
+		t.Errorf("expected expired entry to be evicted, len=%d", c.Len())
+	}
+}
+
+func TestCache_SizeCap(t *testing.T) {
+	c := New(time.Minute, 2)
+	c.Set("a", nil)
+	c.Set("b", nil)
+	c.Get("a") // "b" is now least recently used
+	c.Set("c", nil)
+
+	if c.Len() != 2 {
+		t.Fatalf("expected len 2, got %d", c.Len())
+	}
+	if _, ok := c.Get("b"); ok {
+		t.Error("expected least recently used entry to be evicted")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Error("expected recently used entry to survive")
+	}
+}
@@ -29,6 +29,8 @@ type GenerateRequest struct {
 	Temperature   float32                `protobuf:"fixed32,4,opt,name=temperature,proto3" json:"temperature,omitempty"`
 	MaxTokens     int32                  `protobuf:"varint,5,opt,name=max_tokens,json=maxTokens,proto3" json:"max_tokens,omitempty"`
 	Priority      int32                  `protobuf:"varint,6,opt,name=priority,proto3" json:"priority,omitempty"` // 0=Low, 1=High (For Priority Queue)
+	Stop          []string               `protobuf:"bytes,7,rep,name=stop,proto3" json:"stop,omitempty"`          // Stop generating once any of these is produced
+	Seed          *int64                 `protobuf:"varint,8,opt,name=seed,proto3,oneof" json:"seed,omitempty"`   // Sampling seed; unset = worker's choice
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -105,20 +107,80 @@ func (x *GenerateRequest) GetPriority() int32 {
 	return 0
 }
 
+func (x *GenerateRequest) GetStop() []string {
+	if x != nil {
+		return x.Stop
+	}
+	return nil
+}
+
+func (x *GenerateRequest) GetSeed() int64 {
+	if x != nil && x.Seed != nil {
+		return *x.Seed
+	}
+	return 0
+}
+
+type BatchGenerateRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Requests      []*GenerateRequest     `protobuf:"bytes,1,rep,name=requests,proto3" json:"requests,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchGenerateRequest) Reset() {
+	*x = BatchGenerateRequest{}
+	mi := &file_inference_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchGenerateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchGenerateRequest) ProtoMessage() {}
+
+func (x *BatchGenerateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_inference_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchGenerateRequest.ProtoReflect.Descriptor instead.
+func (*BatchGenerateRequest) Descriptor() ([]byte, []int) {
+	return file_inference_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *BatchGenerateRequest) GetRequests() []*GenerateRequest {
+	if x != nil {
+		return x.Requests
+	}
+	return nil
+}
+
 type TokenResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	RequestId     string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
 	Token         string                 `protobuf:"bytes,2,opt,name=token,proto3" json:"token,omitempty"`
 	Finished      bool                   `protobuf:"varint,3,opt,name=finished,proto3" json:"finished,omitempty"`
 	Error         string                 `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
-	TokenCount    int32                  `protobuf:"varint,5,opt,name=token_count,json=tokenCount,proto3" json:"token_count,omitempty"` // Cumulative tokens generated so far
+	TokenCount    int32                  `protobuf:"varint,5,opt,name=token_count,json=tokenCount,proto3" json:"token_count,omitempty"`       // Cumulative tokens generated so far
+	FinishReason  string                 `protobuf:"bytes,6,opt,name=finish_reason,json=finishReason,proto3" json:"finish_reason,omitempty"`  // Why generation stopped ("stop" or "length"); final message only
+	PromptTokens  int32                  `protobuf:"varint,7,opt,name=prompt_tokens,json=promptTokens,proto3" json:"prompt_tokens,omitempty"` // Prompt length in tokens; final message only
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *TokenResponse) Reset() {
 	*x = TokenResponse{}
-	mi := &file_inference_proto_msgTypes[1]
+	mi := &file_inference_proto_msgTypes[2]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -130,7 +192,7 @@ func (x *TokenResponse) String() string {
 func (*TokenResponse) ProtoMessage() {}
 
 func (x *TokenResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_inference_proto_msgTypes[1]
+	mi := &file_inference_proto_msgTypes[2]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -143,7 +205,7 @@ func (x *TokenResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use TokenResponse.ProtoReflect.Descriptor instead.
 func (*TokenResponse) Descriptor() ([]byte, []int) {
-	return file_inference_proto_rawDescGZIP(), []int{1}
+	return file_inference_proto_rawDescGZIP(), []int{2}
 }
 
 func (x *TokenResponse) GetRequestId() string {
@@ -181,6 +243,20 @@ func (x *TokenResponse) GetTokenCount() int32 {
 	return 0
 }
 
+func (x *TokenResponse) GetFinishReason() string {
+	if x != nil {
+		return x.FinishReason
+	}
+	return ""
+}
+
+func (x *TokenResponse) GetPromptTokens() int32 {
+	if x != nil {
+		return x.PromptTokens
+	}
+	return 0
+}
+
 type HealthRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	unknownFields protoimpl.UnknownFields
@@ -189,7 +265,7 @@ type HealthRequest struct {
 
 func (x *HealthRequest) Reset() {
 	*x = HealthRequest{}
-	mi := &file_inference_proto_msgTypes[2]
+	mi := &file_inference_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -201,7 +277,7 @@ func (x *HealthRequest) String() string {
 func (*HealthRequest) ProtoMessage() {}
 
 func (x *HealthRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_inference_proto_msgTypes[2]
+	mi := &file_inference_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -214,7 +290,7 @@ func (x *HealthRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use HealthRequest.ProtoReflect.Descriptor instead.
 func (*HealthRequest) Descriptor() ([]byte, []int) {
-	return file_inference_proto_rawDescGZIP(), []int{2}
+	return file_inference_proto_rawDescGZIP(), []int{3}
 }
 
 type HealthResponse struct {
@@ -228,7 +304,7 @@ type HealthResponse struct {
 
 func (x *HealthResponse) Reset() {
 	*x = HealthResponse{}
-	mi := &file_inference_proto_msgTypes[3]
+	mi := &file_inference_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -240,7 +316,7 @@ func (x *HealthResponse) String() string {
 func (*HealthResponse) ProtoMessage() {}
 
 func (x *HealthResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_inference_proto_msgTypes[3]
+	mi := &file_inference_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -253,7 +329,7 @@ func (x *HealthResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use HealthResponse.ProtoReflect.Descriptor instead.
 func (*HealthResponse) Descriptor() ([]byte, []int) {
-	return file_inference_proto_rawDescGZIP(), []int{3}
+	return file_inference_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *HealthResponse) GetHealthy() bool {
@@ -277,11 +353,131 @@ func (x *HealthResponse) GetGpuUtilization() float32 {
 	return 0
 }
 
+type InfoRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *InfoRequest) Reset() {
+	*x = InfoRequest{}
+	mi := &file_inference_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InfoRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InfoRequest) ProtoMessage() {}
+
+func (x *InfoRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_inference_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InfoRequest.ProtoReflect.Descriptor instead.
+func (*InfoRequest) Descriptor() ([]byte, []int) {
+	return file_inference_proto_rawDescGZIP(), []int{5}
+}
+
+type InfoResponse struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Healthy          bool                   `protobuf:"varint,1,opt,name=healthy,proto3" json:"healthy,omitempty"`
+	Models           []string               `protobuf:"bytes,2,rep,name=models,proto3" json:"models,omitempty"`                                                // Model names this worker can serve
+	InFlight         int32                  `protobuf:"varint,3,opt,name=in_flight,json=inFlight,proto3" json:"in_flight,omitempty"`                           // Requests currently generating
+	CurrentQueueSize int32                  `protobuf:"varint,4,opt,name=current_queue_size,json=currentQueueSize,proto3" json:"current_queue_size,omitempty"` // Requests waiting on the worker
+	MaxConcurrent    int32                  `protobuf:"varint,5,opt,name=max_concurrent,json=maxConcurrent,proto3" json:"max_concurrent,omitempty"`            // Requests the worker runs at once (0 = unknown)
+	GpuUtilization   float32                `protobuf:"fixed32,6,opt,name=gpu_utilization,json=gpuUtilization,proto3" json:"gpu_utilization,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *InfoResponse) Reset() {
+	*x = InfoResponse{}
+	mi := &file_inference_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InfoResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InfoResponse) ProtoMessage() {}
+
+func (x *InfoResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_inference_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InfoResponse.ProtoReflect.Descriptor instead.
+func (*InfoResponse) Descriptor() ([]byte, []int) {
+	return file_inference_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *InfoResponse) GetHealthy() bool {
+	if x != nil {
+		return x.Healthy
+	}
+	return false
+}
+
+func (x *InfoResponse) GetModels() []string {
+	if x != nil {
+		return x.Models
+	}
+	return nil
+}
+
+func (x *InfoResponse) GetInFlight() int32 {
+	if x != nil {
+		return x.InFlight
+	}
+	return 0
+}
+
+func (x *InfoResponse) GetCurrentQueueSize() int32 {
+	if x != nil {
+		return x.CurrentQueueSize
+	}
+	return 0
+}
+
+func (x *InfoResponse) GetMaxConcurrent() int32 {
+	if x != nil {
+		return x.MaxConcurrent
+	}
+	return 0
+}
+
+func (x *InfoResponse) GetGpuUtilization() float32 {
+	if x != nil {
+		return x.GpuUtilization
+	}
+	return 0
+}
+
 var File_inference_proto protoreflect.FileDescriptor
 
 const file_inference_proto_rawDesc = "" +
 	"\n" +
-	"\x0finference.proto\x12\tinference\"\xbb\x01\n" +
+	"\x0finference.proto\x12\tinference\"\xf1\x01\n" +
 	"\x0fGenerateRequest\x12\x1d\n" +
 	"\n" +
 	"request_id\x18\x01 \x01(\tR\trequestId\x12\x14\n" +
@@ -290,7 +486,12 @@ const file_inference_proto_rawDesc = "" +
 	"\vtemperature\x18\x04 \x01(\x02R\vtemperature\x12\x1d\n" +
 	"\n" +
 	"max_tokens\x18\x05 \x01(\x05R\tmaxTokens\x12\x1a\n" +
-	"\bpriority\x18\x06 \x01(\x05R\bpriority\"\x97\x01\n" +
+	"\bpriority\x18\x06 \x01(\x05R\bpriority\x12\x12\n" +
+	"\x04stop\x18\a \x03(\tR\x04stop\x12\x17\n" +
+	"\x04seed\x18\b \x01(\x03H\x00R\x04seed\x88\x01\x01B\a\n" +
+	"\x05_seed\"N\n" +
+	"\x14BatchGenerateRequest\x126\n" +
+	"\brequests\x18\x01 \x03(\v2\x1a.inference.GenerateRequestR\brequests\"\xe1\x01\n" +
 	"\rTokenResponse\x12\x1d\n" +
 	"\n" +
 	"request_id\x18\x01 \x01(\tR\trequestId\x12\x14\n" +
@@ -298,15 +499,27 @@ const file_inference_proto_rawDesc = "" +
 	"\bfinished\x18\x03 \x01(\bR\bfinished\x12\x14\n" +
 	"\x05error\x18\x04 \x01(\tR\x05error\x12\x1f\n" +
 	"\vtoken_count\x18\x05 \x01(\x05R\n" +
-	"tokenCount\"\x0f\n" +
+	"tokenCount\x12#\n" +
+	"\rfinish_reason\x18\x06 \x01(\tR\ffinishReason\x12#\n" +
+	"\rprompt_tokens\x18\a \x01(\x05R\fpromptTokens\"\x0f\n" +
 	"\rHealthRequest\"\x81\x01\n" +
 	"\x0eHealthResponse\x12\x18\n" +
 	"\ahealthy\x18\x01 \x01(\bR\ahealthy\x12,\n" +
 	"\x12current_queue_size\x18\x02 \x01(\x05R\x10currentQueueSize\x12'\n" +
-	"\x0fgpu_utilization\x18\x03 \x01(\x02R\x0egpuUtilization2\x91\x01\n" +
+	"\x0fgpu_utilization\x18\x03 \x01(\x02R\x0egpuUtilization\"\r\n" +
+	"\vInfoRequest\"\xdb\x01\n" +
+	"\fInfoResponse\x12\x18\n" +
+	"\ahealthy\x18\x01 \x01(\bR\ahealthy\x12\x16\n" +
+	"\x06models\x18\x02 \x03(\tR\x06models\x12\x1b\n" +
+	"\tin_flight\x18\x03 \x01(\x05R\binFlight\x12,\n" +
+	"\x12current_queue_size\x18\x04 \x01(\x05R\x10currentQueueSize\x12%\n" +
+	"\x0emax_concurrent\x18\x05 \x01(\x05R\rmaxConcurrent\x12'\n" +
+	"\x0fgpu_utilization\x18\x06 \x01(\x02R\x0egpuUtilization2\x9b\x02\n" +
 	"\fModelService\x12B\n" +
-	"\bGenerate\x12\x1a.inference.GenerateRequest\x1a\x18.inference.TokenResponse0\x01\x12=\n" +
-	"\x06Health\x12\x18.inference.HealthRequest\x1a\x19.inference.HealthResponseB3Z1github.com/aluko123/go-network-proxy/inference/pbb\x06proto3"
+	"\bGenerate\x12\x1a.inference.GenerateRequest\x1a\x18.inference.TokenResponse0\x01\x12L\n" +
+	"\rBatchGenerate\x12\x1f.inference.BatchGenerateRequest\x1a\x18.inference.TokenResponse0\x01\x12=\n" +
+	"\x06Health\x12\x18.inference.HealthRequest\x1a\x19.inference.HealthResponse\x12:\n" +
+	"\aGetInfo\x12\x16.inference.InfoRequest\x1a\x17.inference.InfoResponseB3Z1github.com/aluko123/go-network-proxy/inference/pbb\x06proto3"
 
 var (
 	file_inference_proto_rawDescOnce sync.Once
@@ -320,23 +533,31 @@ func file_inference_proto_rawDescGZIP() []byte {
 	return file_inference_proto_rawDescData
 }
 
-var file_inference_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_inference_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
 var file_inference_proto_goTypes = []any{
-	(*GenerateRequest)(nil), // 0: inference.GenerateRequest
-	(*TokenResponse)(nil),   // 1: inference.TokenResponse
-	(*HealthRequest)(nil),   // 2: inference.HealthRequest
-	(*HealthResponse)(nil),  // 3: inference.HealthResponse
+	(*GenerateRequest)(nil),      // 0: inference.GenerateRequest
+	(*BatchGenerateRequest)(nil), // 1: inference.BatchGenerateRequest
+	(*TokenResponse)(nil),        // 2: inference.TokenResponse
+	(*HealthRequest)(nil),        // 3: inference.HealthRequest
+	(*HealthResponse)(nil),       // 4: inference.HealthResponse
+	(*InfoRequest)(nil),          // 5: inference.InfoRequest
+	(*InfoResponse)(nil),         // 6: inference.InfoResponse
 }
 var file_inference_proto_depIdxs = []int32{
-	0, // 0: inference.ModelService.Generate:input_type -> inference.GenerateRequest
-	2, // 1: inference.ModelService.Health:input_type -> inference.HealthRequest
-	1, // 2: inference.ModelService.Generate:output_type -> inference.TokenResponse
-	3, // 3: inference.ModelService.Health:output_type -> inference.HealthResponse
-	2, // [2:4] is the sub-list for method output_type
-	0, // [0:2] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	0, // 0: inference.BatchGenerateRequest.requests:type_name -> inference.GenerateRequest
+	0, // 1: inference.ModelService.Generate:input_type -> inference.GenerateRequest
+	1, // 2: inference.ModelService.BatchGenerate:input_type -> inference.BatchGenerateRequest
+	3, // 3: inference.ModelService.Health:input_type -> inference.HealthRequest
+	5, // 4: inference.ModelService.GetInfo:input_type -> inference.InfoRequest
+	2, // 5: inference.ModelService.Generate:output_type -> inference.TokenResponse
+	2, // 6: inference.ModelService.BatchGenerate:output_type -> inference.TokenResponse
+	4, // 7: inference.ModelService.Health:output_type -> inference.HealthResponse
+	6, // 8: inference.ModelService.GetInfo:output_type -> inference.InfoResponse
+	5, // [5:9] is the sub-list for method output_type
+	1, // [1:5] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
 }
 
 func init() { file_inference_proto_init() }
@@ -344,13 +565,14 @@ func file_inference_proto_init() {
 	if File_inference_proto != nil {
 		return
 	}
+	file_inference_proto_msgTypes[0].OneofWrappers = []any{}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_inference_proto_rawDesc), len(file_inference_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   4,
+			NumMessages:   7,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
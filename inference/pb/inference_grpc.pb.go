@@ -19,8 +19,10 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	ModelService_Generate_FullMethodName = "/inference.ModelService/Generate"
-	ModelService_Health_FullMethodName   = "/inference.ModelService/Health"
+	ModelService_Generate_FullMethodName      = "/inference.ModelService/Generate"
+	ModelService_BatchGenerate_FullMethodName = "/inference.ModelService/BatchGenerate"
+	ModelService_Health_FullMethodName        = "/inference.ModelService/Health"
+	ModelService_GetInfo_FullMethodName       = "/inference.ModelService/GetInfo"
 )
 
 // ModelServiceClient is the client API for ModelService service.
@@ -29,8 +31,13 @@ const (
 type ModelServiceClient interface {
 	// Stream tokens back to the gateway
 	Generate(ctx context.Context, in *GenerateRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TokenResponse], error)
+	// Generate several prompts of one model in a single pass, interleaving
+	// their tokens; each response carries its request's request_id
+	BatchGenerate(ctx context.Context, in *BatchGenerateRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TokenResponse], error)
 	// Check worker health and load
 	Health(ctx context.Context, in *HealthRequest, opts ...grpc.CallOption) (*HealthResponse, error)
+	// Report status, the models served and current load
+	GetInfo(ctx context.Context, in *InfoRequest, opts ...grpc.CallOption) (*InfoResponse, error)
 }
 
 type modelServiceClient struct {
@@ -60,6 +67,25 @@ func (c *modelServiceClient) Generate(ctx context.Context, in *GenerateRequest,
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type ModelService_GenerateClient = grpc.ServerStreamingClient[TokenResponse]
 
+func (c *modelServiceClient) BatchGenerate(ctx context.Context, in *BatchGenerateRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TokenResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ModelService_ServiceDesc.Streams[1], ModelService_BatchGenerate_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[BatchGenerateRequest, TokenResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ModelService_BatchGenerateClient = grpc.ServerStreamingClient[TokenResponse]
+
 func (c *modelServiceClient) Health(ctx context.Context, in *HealthRequest, opts ...grpc.CallOption) (*HealthResponse, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	out := new(HealthResponse)
@@ -70,14 +96,29 @@ func (c *modelServiceClient) Health(ctx context.Context, in *HealthRequest, opts
 	return out, nil
 }
 
+func (c *modelServiceClient) GetInfo(ctx context.Context, in *InfoRequest, opts ...grpc.CallOption) (*InfoResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(InfoResponse)
+	err := c.cc.Invoke(ctx, ModelService_GetInfo_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ModelServiceServer is the server API for ModelService service.
 // All implementations must embed UnimplementedModelServiceServer
 // for forward compatibility.
 type ModelServiceServer interface {
 	// Stream tokens back to the gateway
 	Generate(*GenerateRequest, grpc.ServerStreamingServer[TokenResponse]) error
+	// Generate several prompts of one model in a single pass, interleaving
+	// their tokens; each response carries its request's request_id
+	BatchGenerate(*BatchGenerateRequest, grpc.ServerStreamingServer[TokenResponse]) error
 	// Check worker health and load
 	Health(context.Context, *HealthRequest) (*HealthResponse, error)
+	// Report status, the models served and current load
+	GetInfo(context.Context, *InfoRequest) (*InfoResponse, error)
 	mustEmbedUnimplementedModelServiceServer()
 }
 
@@ -91,9 +132,15 @@ type UnimplementedModelServiceServer struct{}
 func (UnimplementedModelServiceServer) Generate(*GenerateRequest, grpc.ServerStreamingServer[TokenResponse]) error {
 	return status.Errorf(codes.Unimplemented, "method Generate not implemented")
 }
+func (UnimplementedModelServiceServer) BatchGenerate(*BatchGenerateRequest, grpc.ServerStreamingServer[TokenResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method BatchGenerate not implemented")
+}
 func (UnimplementedModelServiceServer) Health(context.Context, *HealthRequest) (*HealthResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Health not implemented")
 }
+func (UnimplementedModelServiceServer) GetInfo(context.Context, *InfoRequest) (*InfoResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetInfo not implemented")
+}
 func (UnimplementedModelServiceServer) mustEmbedUnimplementedModelServiceServer() {}
 func (UnimplementedModelServiceServer) testEmbeddedByValue()                      {}
 
@@ -126,6 +173,17 @@ func _ModelService_Generate_Handler(srv interface{}, stream grpc.ServerStream) e
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type ModelService_GenerateServer = grpc.ServerStreamingServer[TokenResponse]
 
+func _ModelService_BatchGenerate_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(BatchGenerateRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ModelServiceServer).BatchGenerate(m, &grpc.GenericServerStream[BatchGenerateRequest, TokenResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ModelService_BatchGenerateServer = grpc.ServerStreamingServer[TokenResponse]
+
 func _ModelService_Health_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(HealthRequest)
 	if err := dec(in); err != nil {
@@ -144,6 +202,24 @@ func _ModelService_Health_Handler(srv interface{}, ctx context.Context, dec func
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ModelService_GetInfo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InfoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ModelServiceServer).GetInfo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ModelService_GetInfo_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ModelServiceServer).GetInfo(ctx, req.(*InfoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // ModelService_ServiceDesc is the grpc.ServiceDesc for ModelService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -155,6 +231,10 @@ var ModelService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Health",
 			Handler:    _ModelService_Health_Handler,
 		},
+		{
+			MethodName: "GetInfo",
+			Handler:    _ModelService_GetInfo_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -162,6 +242,11 @@ var ModelService_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _ModelService_Generate_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "BatchGenerate",
+			Handler:       _ModelService_BatchGenerate_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "inference.proto",
 }
@@ -0,0 +1,105 @@
+package queue
+
+import (
+	"sort"
+	"sync"
+)
+
+// DefaultQueueName labels the shared queue used for models without a dedicated pool
+const DefaultQueueName = "default"
+
+// ModelQueues maps model names to their own PriorityQueue so a slow model's
+// backlog can't block fast ones. Models without a dedicated queue fall back
+// to the default queue, if one is configured.
+type ModelQueues struct {
+	mu       sync.RWMutex
+	byModel  map[string]*PriorityQueue
+	fallback *PriorityQueue
+}
+
+// NewModelQueues creates a set of per-model queues. fallback may be nil, in
+// which case only models added with Add are served.
+func NewModelQueues(fallback *PriorityQueue) *ModelQueues {
+	if fallback != nil {
+		fallback.setName(DefaultQueueName)
+	}
+	return &ModelQueues{
+		byModel:  make(map[string]*PriorityQueue),
+		fallback: fallback,
+	}
+}
+
+// Add registers a dedicated queue for model
+func (m *ModelQueues) Add(model string, pq *PriorityQueue) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pq.setName(model)
+	m.byModel[model] = pq
+}
+
+// For returns the queue serving model, or nil if no queue can serve it
+func (m *ModelQueues) For(model string) *PriorityQueue {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if pq, ok := m.byModel[model]; ok {
+		return pq
+	}
+	return m.fallback
+}
+
+// Default returns the shared fallback queue (may be nil)
+func (m *ModelQueues) Default() *PriorityQueue {
+	return m.fallback
+}
+
+// Models returns the names of models with a dedicated queue, sorted
+func (m *ModelQueues) Models() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	models := make([]string, 0, len(m.byModel))
+	for model := range m.byModel {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	return models
+}
+
+// All returns every queue, dedicated ones first and the fallback last
+func (m *ModelQueues) All() []*PriorityQueue {
+	models := m.Models()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	all := make([]*PriorityQueue, 0, len(models)+1)
+	for _, model := range models {
+		all = append(all, m.byModel[model])
+	}
+	if m.fallback != nil {
+		all = append(all, m.fallback)
+	}
+	return all
+}
+
+// Close stops every queue from accepting new requests
+func (m *ModelQueues) Close() {
+	for _, pq := range m.All() {
+		pq.Close()
+	}
+}
+
+// Wait blocks until every queue has drained its in-flight requests
+func (m *ModelQueues) Wait() {
+	for _, pq := range m.All() {
+		pq.Wait()
+	}
+}
+
+// Abort fails the requests still waiting in every queue with err, returning
+// how many were aborted
+func (m *ModelQueues) Abort(err error) int {
+	n := 0
+	for _, pq := range m.All() {
+		n += pq.Abort(err)
+	}
+	return n
+}
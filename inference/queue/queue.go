@@ -2,9 +2,13 @@ package queue
 
 import (
 	"container/heap"
+	"context"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+
 	pb "github.com/aluko123/go-network-proxy/inference/pb"
 	"github.com/aluko123/go-network-proxy/pkg/metrics"
 )
@@ -16,9 +20,16 @@ type Request struct {
 	Prompt      string
 	MaxTokens   int
 	Temperature float32
-	Priority    int // Higher number = Higher priority
+	Stop        []string // Generation ends at the first of these; nil = none
+	Seed        *int64   // Sampling seed; nil lets the worker choose
+	Priority    int      // Higher number = Higher priority
 	SubmitTime  time.Time
 	StartTime   time.Time // When worker began processing
+	Retries     int       // Times requeued after a worker failed before streaming
+
+	// Ctx is cancelled when the client goes away; the worker stream is bound
+	// to it. Nil means the request is never cancelled.
+	Ctx context.Context
 
 	// Channels for response handling
 	ResponseCh chan *pb.TokenResponse
@@ -67,23 +78,40 @@ func (h *RequestHeap) Pop() interface{} {
 
 // PriorityQueue manages the request heap in a thread-safe way
 type PriorityQueue struct {
+	name     string           // metrics label; set when registered in ModelQueues
+	depth    prometheus.Gauge // InferenceQueueDepth for name, resolved once
 	items    RequestHeap
+	maxSize  int // 0 = unbounded
 	mu       sync.Mutex
 	cond     *sync.Cond
+	waiting  int    // consumers blocked in Pop
+	wakeups  uint64 // Signal/Broadcast calls, for tests
 	closed   bool
 	inflight sync.WaitGroup
+
+	// PopBatch callers waiting for more requests; every push wakes them all
+	// as each wants only its own model
+	batchCond *sync.Cond
+	batchers  int
 }
 
-func NewPriorityQueue() *PriorityQueue {
+// NewPriorityQueue creates a queue holding at most maxSize waiting requests.
+// A maxSize <= 0 means unbounded.
+func NewPriorityQueue(maxSize int) *PriorityQueue {
 	pq := &PriorityQueue{
-		items: make(RequestHeap, 0),
+		name:    DefaultQueueName,
+		items:   make(RequestHeap, 0),
+		maxSize: maxSize,
 	}
 	pq.cond = sync.NewCond(&pq.mu)
+	pq.batchCond = sync.NewCond(&pq.mu)
+	pq.depth = metrics.InferenceQueueDepth.WithLabelValues(pq.name)
 	heap.Init(&pq.items)
 	return pq
 }
 
-// Push adds a request to the queue
+// Push adds a request to the queue. It returns false without enqueuing if the
+// queue is closed or already holds maxSize waiting requests (backpressure).
 func (pq *PriorityQueue) Push(req *Request) bool {
 	pq.mu.Lock()
 	defer pq.mu.Unlock()
@@ -92,10 +120,15 @@ func (pq *PriorityQueue) Push(req *Request) bool {
 		return false
 	}
 
+	if pq.maxSize > 0 && len(pq.items) >= pq.maxSize {
+		metrics.InferenceQueueRejectedTotal.WithLabelValues(pq.name, "full").Inc()
+		return false
+	}
+
 	pq.inflight.Add(1)
 	heap.Push(&pq.items, req)
-	metrics.InferenceQueueDepth.Set(float64(len(pq.items)))
-	pq.cond.Signal() // Wake up a worker
+	pq.depth.Set(float64(len(pq.items)))
+	pq.wake()
 	return true
 }
 
@@ -103,22 +136,158 @@ func (pq *PriorityQueue) Push(req *Request) bool {
 // Returns nil if the queue is closed and empty
 func (pq *PriorityQueue) Pop() *Request {
 	pq.mu.Lock()
-	defer pq.mu.Unlock()
-
 	for len(pq.items) == 0 && !pq.closed {
+		pq.waiting++
 		pq.cond.Wait()
+		pq.waiting--
 	}
 
 	if len(pq.items) == 0 {
+		pq.mu.Unlock()
 		return nil
 	}
 
 	item := heap.Pop(&pq.items).(*Request)
-	metrics.InferenceQueueDepth.Set(float64(len(pq.items)))
+	pq.depth.Set(float64(len(pq.items)))
+	pq.mu.Unlock()
+
+	// The gauge is atomic, so keep it out of the critical section
 	metrics.InferenceInFlight.Inc()
 	return item
 }
 
+// wake signals one blocked consumer, if any, and any PopBatch callers (mu
+// must be held). With a backlog every worker is busy, so most pushes have no
+// one to wake.
+func (pq *PriorityQueue) wake() {
+	if pq.waiting > 0 {
+		pq.wakeups++
+		pq.cond.Signal()
+	}
+	if pq.batchers > 0 {
+		pq.batchCond.Broadcast()
+	}
+}
+
+// PopBatch removes up to n more waiting requests for model, in priority
+// order, to run in one worker call with a request already popped. It waits
+// up to window for them to arrive, returning early once it has n or the
+// queue closes.
+func (pq *PriorityQueue) PopBatch(model string, n int, window time.Duration) []*Request {
+	deadline := time.Now().Add(window)
+	if window > 0 {
+		// Wake the wait below at the deadline should no push come first
+		timer := time.AfterFunc(window, func() {
+			pq.mu.Lock()
+			pq.batchCond.Broadcast()
+			pq.mu.Unlock()
+		})
+		defer timer.Stop()
+	}
+
+	var batch []*Request
+	pq.mu.Lock()
+	for {
+		for len(batch) < n {
+			req := pq.popModel(model)
+			if req == nil {
+				break
+			}
+			batch = append(batch, req)
+		}
+		if len(batch) >= n || pq.closed || !time.Now().Before(deadline) {
+			break
+		}
+		pq.batchers++
+		pq.batchCond.Wait()
+		pq.batchers--
+	}
+	pq.depth.Set(float64(len(pq.items)))
+	pq.mu.Unlock()
+
+	metrics.InferenceInFlight.Add(float64(len(batch)))
+	return batch
+}
+
+// popModel removes the highest priority waiting request for model, or
+// returns nil if there is none (mu must be held)
+func (pq *PriorityQueue) popModel(model string) *Request {
+	best := -1
+	for i, req := range pq.items {
+		if req.Model == model && (best < 0 || pq.items.Less(i, best)) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return nil
+	}
+	return heap.Remove(&pq.items, best).(*Request)
+}
+
+// Requeue puts a popped request back in the queue (e.g. its worker went
+// unhealthy before starting it). The request keeps its SubmitTime, so it
+// retains its place among equal-priority requests. Capacity is not enforced
+// since the request was already admitted. Returns false if the queue is closed,
+// in which case the caller still owns the request and must call Done.
+func (pq *PriorityQueue) Requeue(req *Request) bool {
+	pq.mu.Lock()
+	defer pq.mu.Unlock()
+
+	if pq.closed {
+		return false
+	}
+
+	heap.Push(&pq.items, req)
+	pq.depth.Set(float64(len(pq.items)))
+	metrics.InferenceInFlight.Dec()
+	pq.wake()
+	return true
+}
+
+// Remove cancels req if it is still waiting in the queue, closing its
+// channels. It returns false if req is not queued here (e.g. a worker already
+// picked it up). Requests are matched by identity, not ID: IDs may come from
+// clients (X-Request-ID), so two queued requests can share one.
+func (pq *PriorityQueue) Remove(req *Request) bool {
+	pq.mu.Lock()
+	defer pq.mu.Unlock()
+
+	if req.index < 0 || req.index >= len(pq.items) || pq.items[req.index] != req {
+		return false
+	}
+
+	heap.Remove(&pq.items, req.index)
+	pq.depth.Set(float64(len(pq.items)))
+
+	close(req.ResponseCh)
+	close(req.ErrorCh)
+
+	// Never reached a worker, so balance Push without touching the in-flight gauge
+	pq.inflight.Done()
+	return true
+}
+
+// Abort fails every request still waiting in the queue with err, so their
+// clients get an answer without a worker ever seeing them. It returns how
+// many were aborted. Requests already handed to a worker are unaffected.
+func (pq *PriorityQueue) Abort(err error) int {
+	pq.mu.Lock()
+	defer pq.mu.Unlock()
+
+	n := len(pq.items)
+	for len(pq.items) > 0 {
+		req := heap.Pop(&pq.items).(*Request)
+		// ErrorCh is buffered and nothing else answers a queued request
+		select {
+		case req.ErrorCh <- err:
+		default:
+		}
+		pq.inflight.Done()
+	}
+	pq.depth.Set(0)
+	return n
+}
+
 // Done marks a request as completed (call after processing)
 func (pq *PriorityQueue) Done() {
 	metrics.InferenceInFlight.Dec()
@@ -132,11 +301,71 @@ func (pq *PriorityQueue) Len() int {
 	return len(pq.items)
 }
 
+// Name returns the queue's name (the model it serves, or "default")
+func (pq *PriorityQueue) Name() string {
+	pq.mu.Lock()
+	defer pq.mu.Unlock()
+	return pq.name
+}
+
+func (pq *PriorityQueue) setName(name string) {
+	pq.mu.Lock()
+	defer pq.mu.Unlock()
+	pq.name = name
+	pq.depth = metrics.InferenceQueueDepth.WithLabelValues(name)
+}
+
+// RequestInfo is a read-only view of a queued request (no channels exposed)
+type RequestInfo struct {
+	ID         string        `json:"id"`
+	Model      string        `json:"model"`
+	Priority   int           `json:"priority"`
+	SubmitTime time.Time     `json:"submit_time"`
+	WaitTime   time.Duration `json:"-"`
+}
+
+// Snapshot returns a copy of the queued requests in the order they would be
+// popped. The heap itself is left untouched.
+func (pq *PriorityQueue) Snapshot() []RequestInfo {
+	pq.mu.Lock()
+	items := make(RequestHeap, len(pq.items))
+	copy(items, pq.items)
+	pq.mu.Unlock()
+
+	// Sort the copy with the heap's own ordering; Swap would rewrite the
+	// shared index fields, so sort by Less on a plain slice instead
+	sort.Slice(items, func(i, j int) bool { return items.Less(i, j) })
+
+	now := time.Now()
+	infos := make([]RequestInfo, len(items))
+	for i, req := range items {
+		infos[i] = RequestInfo{
+			ID:         req.ID,
+			Model:      req.Model,
+			Priority:   req.Priority,
+			SubmitTime: req.SubmitTime,
+			WaitTime:   now.Sub(req.SubmitTime),
+		}
+	}
+	return infos
+}
+
+// Closed reports whether the queue has stopped accepting requests
+func (pq *PriorityQueue) Closed() bool {
+	pq.mu.Lock()
+	defer pq.mu.Unlock()
+	return pq.closed
+}
+
 // Close stops accepting new requests and signals workers to drain
 func (pq *PriorityQueue) Close() {
 	pq.mu.Lock()
 	pq.closed = true
-	pq.cond.Broadcast() // Wake up all waiting workers
+	if pq.waiting > 0 {
+		pq.wakeups++
+		pq.cond.Broadcast() // Wake up all waiting workers
+	}
+	pq.batchCond.Broadcast()
 	pq.mu.Unlock()
 }
 
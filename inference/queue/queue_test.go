@@ -1,13 +1,19 @@
 package queue
 
 import (
+	"errors"
+	"fmt"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	pb "github.com/aluko123/go-network-proxy/inference/pb"
 )
 
 func TestPriorityQueue_BasicOrdering(t *testing.T) {
-	pq := NewPriorityQueue()
+	pq := NewPriorityQueue(0)
 
 	// Push requests with different priorities
 	pq.Push(&Request{ID: "low", Priority: 1, SubmitTime: time.Now()})
@@ -32,7 +38,7 @@ func TestPriorityQueue_BasicOrdering(t *testing.T) {
 }
 
 func TestPriorityQueue_FIFOForEqualPriority(t *testing.T) {
-	pq := NewPriorityQueue()
+	pq := NewPriorityQueue(0)
 
 	// Push requests with same priority but different times
 	t1 := time.Now()
@@ -61,7 +67,7 @@ func TestPriorityQueue_FIFOForEqualPriority(t *testing.T) {
 }
 
 func TestPriorityQueue_MixedPriorityAndTime(t *testing.T) {
-	pq := NewPriorityQueue()
+	pq := NewPriorityQueue(0)
 
 	now := time.Now()
 
@@ -88,7 +94,7 @@ func TestPriorityQueue_MixedPriorityAndTime(t *testing.T) {
 }
 
 func TestPriorityQueue_Len(t *testing.T) {
-	pq := NewPriorityQueue()
+	pq := NewPriorityQueue(0)
 
 	if pq.Len() != 0 {
 		t.Errorf("expected len 0, got %d", pq.Len())
@@ -108,7 +114,7 @@ func TestPriorityQueue_Len(t *testing.T) {
 }
 
 func TestPriorityQueue_BlockingPop(t *testing.T) {
-	pq := NewPriorityQueue()
+	pq := NewPriorityQueue(0)
 
 	done := make(chan bool)
 
@@ -135,8 +141,82 @@ func TestPriorityQueue_BlockingPop(t *testing.T) {
 	}
 }
 
+func TestPriorityQueue_PopBatch(t *testing.T) {
+	pq := NewPriorityQueue(0)
+	now := time.Now()
+	pq.Push(&Request{ID: "a", Model: "m1", Priority: 1, SubmitTime: now})
+	pq.Push(&Request{ID: "b", Model: "m2", Priority: 5, SubmitTime: now})
+	pq.Push(&Request{ID: "c", Model: "m1", Priority: 3, SubmitTime: now})
+	pq.Push(&Request{ID: "d", Model: "m1", Priority: 1, SubmitTime: now.Add(time.Second)})
+
+	if first := pq.Pop(); first.ID != "b" {
+		t.Fatalf("expected 'b' first, got %s", first.ID)
+	}
+	// Only m1 requests, in priority order, and no more than asked for
+	batch := pq.PopBatch("m1", 2, 0)
+	if len(batch) != 2 || batch[0].ID != "c" || batch[1].ID != "a" {
+		t.Fatalf("expected [c a], got %v", batch)
+	}
+	if pq.Len() != 1 {
+		t.Errorf("expected 'd' to stay queued, got depth %d", pq.Len())
+	}
+
+	// Waits within the window for a request to arrive
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		pq.Push(&Request{ID: "e", Model: "m1", Priority: 1, SubmitTime: time.Now()})
+	}()
+	start := time.Now()
+	batch = pq.PopBatch("m1", 2, 5*time.Second)
+	if len(batch) != 2 || batch[0].ID != "d" || batch[1].ID != "e" {
+		t.Fatalf("expected [d e], got %v", batch)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("PopBatch waited %s after filling the batch", elapsed)
+	}
+
+	// An empty window comes back with nothing once it has passed
+	start = time.Now()
+	if batch := pq.PopBatch("m1", 2, 30*time.Millisecond); len(batch) != 0 {
+		t.Errorf("expected an empty batch, got %v", batch)
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("PopBatch returned after %s, before its window", elapsed)
+	}
+}
+
+func TestPriorityQueue_PopBatchLeavesOtherModelsForPop(t *testing.T) {
+	pq := NewPriorityQueue(0)
+	popped := make(chan *Request, 1)
+	go func() { popped <- pq.Pop() }()
+	batched := make(chan []*Request, 1)
+	go func() { batched <- pq.PopBatch("m1", 1, 5*time.Second) }()
+	time.Sleep(50 * time.Millisecond)
+
+	// The batcher must not swallow the wakeup meant for the blocked Pop
+	pq.Push(&Request{ID: "other", Model: "m2", Priority: 1, SubmitTime: time.Now()})
+	select {
+	case req := <-popped:
+		if req.ID != "other" {
+			t.Errorf("Pop got %s", req.ID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Pop was not woken for a request the batcher did not want")
+	}
+
+	pq.Push(&Request{ID: "mine", Model: "m1", Priority: 1, SubmitTime: time.Now()})
+	select {
+	case batch := <-batched:
+		if len(batch) != 1 || batch[0].ID != "mine" {
+			t.Errorf("PopBatch got %v", batch)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("PopBatch was not woken for its model")
+	}
+}
+
 func TestPriorityQueue_ConcurrentPush(t *testing.T) {
-	pq := NewPriorityQueue()
+	pq := NewPriorityQueue(0)
 	numProducers := 5
 	itemsPerProducer := 100
 
@@ -176,7 +256,7 @@ func TestPriorityQueue_ConcurrentPush(t *testing.T) {
 }
 
 func TestPriorityQueue_MultipleBlockingConsumers(t *testing.T) {
-	pq := NewPriorityQueue()
+	pq := NewPriorityQueue(0)
 	numConsumers := 3
 	numItems := numConsumers // Exactly one item per consumer
 
@@ -218,3 +298,436 @@ func TestPriorityQueue_MultipleBlockingConsumers(t *testing.T) {
 		t.Errorf("expected queue to be empty, got %d items", pq.Len())
 	}
 }
+
+func TestPriorityQueue_BoundedCapacity(t *testing.T) {
+	pq := NewPriorityQueue(2)
+
+	if !pq.Push(&Request{ID: "1", Priority: 1, SubmitTime: time.Now()}) {
+		t.Fatal("expected first push to succeed")
+	}
+	if !pq.Push(&Request{ID: "2", Priority: 1, SubmitTime: time.Now()}) {
+		t.Fatal("expected second push to succeed")
+	}
+	if pq.Push(&Request{ID: "3", Priority: 10, SubmitTime: time.Now()}) {
+		t.Fatal("expected push to be rejected when queue is full")
+	}
+	if pq.Len() != 2 {
+		t.Errorf("expected len 2, got %d", pq.Len())
+	}
+
+	// Draining below capacity accepts new requests again
+	pq.Pop()
+	if !pq.Push(&Request{ID: "4", Priority: 1, SubmitTime: time.Now()}) {
+		t.Error("expected push to succeed after draining below capacity")
+	}
+}
+
+func TestPriorityQueue_RemoveSharedID(t *testing.T) {
+	pq := NewPriorityQueue(0)
+	newReq := func(priority int) *Request {
+		return &Request{
+			ID:         "same-x-request-id",
+			Priority:   priority,
+			SubmitTime: time.Now(),
+			ResponseCh: make(chan *pb.TokenResponse, 1),
+			ErrorCh:    make(chan error, 1),
+		}
+	}
+	first, second := newReq(5), newReq(1)
+	pq.Push(first)
+	pq.Push(second)
+
+	if !pq.Remove(first) {
+		t.Fatal("expected Remove to find the first request")
+	}
+	if pq.Len() != 1 {
+		t.Fatalf("expected the other request to stay queued, len %d", pq.Len())
+	}
+	select {
+	case _, ok := <-second.ResponseCh:
+		if !ok {
+			t.Fatal("removing one request closed the other's ResponseCh")
+		}
+	default:
+	}
+
+	// One with a worker, one queued: cancelling the first must not touch the second
+	third := newReq(1)
+	pq.Push(third)
+	if got := pq.Pop(); got != second {
+		t.Fatalf("popped %p, want the second request", got)
+	}
+	if pq.Remove(second) {
+		t.Error("Remove took a request a worker already has")
+	}
+	if pq.Len() != 1 || !pq.Remove(third) {
+		t.Error("the queued request with the same ID was not left in place")
+	}
+}
+
+func TestPriorityQueue_Remove(t *testing.T) {
+	pq := NewPriorityQueue(0)
+
+	target := &Request{
+		ID:         "cancel-me",
+		Priority:   10,
+		SubmitTime: time.Now(),
+		ResponseCh: make(chan *pb.TokenResponse, 1),
+		ErrorCh:    make(chan error, 1),
+	}
+	keep := &Request{ID: "keep", Priority: 1, SubmitTime: time.Now()}
+	pq.Push(keep)
+	pq.Push(target)
+
+	if !pq.Remove(target) {
+		t.Fatal("expected Remove to find queued request")
+	}
+	if pq.Remove(target) {
+		t.Error("expected second Remove to return false")
+	}
+	if pq.Len() != 1 {
+		t.Errorf("expected len 1, got %d", pq.Len())
+	}
+
+	if _, ok := <-target.ResponseCh; ok {
+		t.Error("expected ResponseCh to be closed")
+	}
+
+	if req := pq.Pop(); req.ID != "keep" {
+		t.Errorf("expected 'keep', got '%s'", req.ID)
+	}
+	if pq.Remove(keep) {
+		t.Error("expected Remove to return false for a popped request")
+	}
+
+	// Removed request must not hold up Wait
+	pq.Done()
+	pq.Close()
+	done := make(chan struct{})
+	go func() {
+		pq.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Wait blocked after Remove")
+	}
+}
+
+func TestModelQueues_RoutesByModel(t *testing.T) {
+	fallback := NewPriorityQueue(0)
+	fast := NewPriorityQueue(0)
+
+	qs := NewModelQueues(fallback)
+	qs.Add("fast-model", fast)
+
+	if qs.For("fast-model") != fast {
+		t.Error("expected dedicated queue for fast-model")
+	}
+	if qs.For("other-model") != fallback {
+		t.Error("expected fallback queue for unknown model")
+	}
+	if fast.Name() != "fast-model" || fallback.Name() != DefaultQueueName {
+		t.Errorf("unexpected queue names: %q, %q", fast.Name(), fallback.Name())
+	}
+
+	// Without a fallback, unknown models have no queue
+	if NewModelQueues(nil).For("other-model") != nil {
+		t.Error("expected nil queue without fallback")
+	}
+}
+
+func TestPriorityQueue_SnapshotDoesNotMutate(t *testing.T) {
+	pq := NewPriorityQueue(0)
+	now := time.Now()
+
+	pq.Push(&Request{ID: "low", Model: "m", Priority: 1, SubmitTime: now})
+	pq.Push(&Request{ID: "high", Model: "m", Priority: 10, SubmitTime: now})
+	pq.Push(&Request{ID: "mid", Model: "m", Priority: 5, SubmitTime: now})
+
+	snap := pq.Snapshot()
+	want := []string{"high", "mid", "low"}
+	if len(snap) != len(want) {
+		t.Fatalf("expected %d entries, got %d", len(want), len(snap))
+	}
+	for i, id := range want {
+		if snap[i].ID != id {
+			t.Errorf("snapshot[%d]: expected %q, got %q", i, id, snap[i].ID)
+		}
+	}
+
+	// Queue contents and pop order are unchanged
+	if pq.Len() != 3 {
+		t.Errorf("expected len 3 after snapshot, got %d", pq.Len())
+	}
+	for _, id := range want {
+		if req := pq.Pop(); req.ID != id {
+			t.Errorf("expected pop %q, got %q", id, req.ID)
+		}
+	}
+}
+
+// BenchmarkPriorityQueue_PushPop measures throughput with n producers and n
+// consumers sharing one queue; each op is one Push and one Pop.
+func BenchmarkPriorityQueue_PushPop(b *testing.B) {
+	for _, n := range []int{1, 4, 16, 64} {
+		b.Run(fmt.Sprintf("goroutines=%d", n), func(b *testing.B) {
+			pq := NewPriorityQueue(0)
+			reqs := make([]*Request, b.N)
+			now := time.Now()
+			for i := range reqs {
+				reqs[i] = &Request{ID: strconv.Itoa(i), Priority: i % 10, SubmitTime: now}
+			}
+
+			var popped atomic.Int64
+			var consumers sync.WaitGroup
+			for c := 0; c < n; c++ {
+				consumers.Add(1)
+				go func() {
+					defer consumers.Done()
+					for pq.Pop() != nil {
+						pq.Done()
+						popped.Add(1)
+					}
+				}()
+			}
+
+			b.ResetTimer()
+			var producers sync.WaitGroup
+			for p := 0; p < n; p++ {
+				producers.Add(1)
+				go func(p int) {
+					defer producers.Done()
+					for i := p; i < b.N; i += n {
+						pq.Push(reqs[i])
+					}
+				}(p)
+			}
+			producers.Wait()
+			pq.Close()
+			consumers.Wait()
+			b.StopTimer()
+
+			if got := popped.Load(); got != int64(b.N) {
+				b.Fatalf("popped %d of %d", got, b.N)
+			}
+		})
+	}
+}
+
+func TestPriorityQueue_SignalsOnlyWaitingConsumers(t *testing.T) {
+	pq := NewPriorityQueue(0)
+	stats := func() (waiting int, wakeups uint64) {
+		pq.mu.Lock()
+		defer pq.mu.Unlock()
+		return pq.waiting, pq.wakeups
+	}
+
+	// All workers busy: a backlog builds without any wakeups
+	for i := 0; i < 100; i++ {
+		pq.Push(&Request{ID: strconv.Itoa(i), SubmitTime: time.Now()})
+	}
+	if _, wakeups := stats(); wakeups != 0 {
+		t.Fatalf("expected no wakeups with no waiting consumers, got %d", wakeups)
+	}
+	for pq.Len() > 0 {
+		pq.Pop()
+		pq.Done()
+	}
+
+	// Blocked consumers are still woken, once per item
+	const consumers = 3
+	got := make(chan *Request, consumers)
+	for i := 0; i < consumers; i++ {
+		go func() { got <- pq.Pop() }()
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for waiting, _ := stats(); waiting < consumers; waiting, _ = stats() {
+		if time.Now().After(deadline) {
+			t.Fatalf("only %d consumers blocked", waiting)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < consumers; i++ {
+		pq.Push(&Request{ID: "w" + strconv.Itoa(i), SubmitTime: time.Now()})
+	}
+	for i := 0; i < consumers; i++ {
+		select {
+		case req := <-got:
+			if req == nil {
+				t.Fatal("consumer woke without an item")
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("blocked consumer was not woken")
+		}
+	}
+	if _, wakeups := stats(); wakeups > consumers {
+		t.Errorf("expected at most %d wakeups, got %d", consumers, wakeups)
+	}
+
+	// Close wakes consumers blocked on an empty queue
+	done := make(chan *Request)
+	go func() { done <- pq.Pop() }()
+	for waiting, _ := stats(); waiting == 0; waiting, _ = stats() {
+		time.Sleep(time.Millisecond)
+	}
+	pq.Close()
+	select {
+	case req := <-done:
+		if req != nil {
+			t.Errorf("expected nil from closed queue, got %v", req.ID)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close did not wake the blocked consumer")
+	}
+}
+
+func TestPriorityQueue_AbortFailsQueuedRequests(t *testing.T) {
+	pq := NewPriorityQueue(0)
+	var reqs []*Request
+	for i := range 3 {
+		req := &Request{ID: strconv.Itoa(i), SubmitTime: time.Now(), ErrorCh: make(chan error, 1)}
+		pq.Push(req)
+		reqs = append(reqs, req)
+	}
+	pq.Close()
+
+	errGone := errors.New("gone")
+	if n := pq.Abort(errGone); n != 3 {
+		t.Errorf("expected 3 aborted, got %d", n)
+	}
+	for _, req := range reqs {
+		if err := <-req.ErrorCh; err != errGone {
+			t.Errorf("request %s: expected the abort error, got %v", req.ID, err)
+		}
+	}
+	if pq.Pop() != nil {
+		t.Error("expected an empty queue after Abort")
+	}
+
+	// Nothing is in flight any more, so Wait returns
+	done := make(chan struct{})
+	go func() {
+		pq.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Wait blocked after Abort")
+	}
+}
+
+// TestPriorityQueue_CloseStress interleaves Push, Pop, Remove, Len, Snapshot
+// and Close, then checks that once the consumers stop and leftovers are
+// aborted, Wait returns and every accepted request was answered exactly once
+func TestPriorityQueue_CloseStress(t *testing.T) {
+	errClosed := errors.New("closed")
+	for iter := range 50 {
+		pq := NewPriorityQueue(0)
+
+		var mu sync.Mutex
+		var accepted []*Request
+
+		var pushers sync.WaitGroup
+		for p := range 4 {
+			pushers.Add(1)
+			go func() {
+				defer pushers.Done()
+				for i := range 50 {
+					req := &Request{
+						ID:         fmt.Sprintf("%d-%d", p, i),
+						Priority:   i % 3,
+						SubmitTime: time.Now(),
+						ResponseCh: make(chan *pb.TokenResponse),
+						ErrorCh:    make(chan error, 1),
+					}
+					if pq.Push(req) {
+						mu.Lock()
+						accepted = append(accepted, req)
+						mu.Unlock()
+					}
+					// Clients cancelling while queued
+					if i%7 == 0 {
+						pq.Remove(req)
+					}
+				}
+			}()
+		}
+
+		// Consumers that may stop before the queue is empty, like workers
+		// leaving at shutdown
+		var consumers sync.WaitGroup
+		for c := range 3 {
+			consumers.Add(1)
+			go func() {
+				defer consumers.Done()
+				for range 20 * (c + 1) {
+					req := pq.Pop()
+					if req == nil {
+						return
+					}
+					close(req.ResponseCh)
+					pq.Done()
+				}
+			}()
+		}
+
+		stop := make(chan struct{})
+		var readers sync.WaitGroup
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					pq.Len()
+					pq.Snapshot()
+				}
+			}
+		}()
+
+		time.Sleep(time.Duration(iter%5) * 100 * time.Microsecond)
+		pq.Close()
+		pushers.Wait()
+		consumers.Wait()
+		pq.Abort(errClosed)
+		close(stop)
+		readers.Wait()
+
+		done := make(chan struct{})
+		go func() {
+			pq.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("iteration %d: Wait blocked with %d requests queued", iter, pq.Len())
+		}
+
+		for _, req := range accepted {
+			// Aborted: the error is waiting. Removed: both channels closed.
+			select {
+			case err, ok := <-req.ErrorCh:
+				if ok && err != errClosed {
+					t.Fatalf("iteration %d: request %s got %v", iter, req.ID, err)
+				}
+				continue
+			default:
+			}
+			// Popped: the consumer closed ResponseCh
+			select {
+			case _, ok := <-req.ResponseCh:
+				if !ok {
+					continue
+				}
+			default:
+			}
+			t.Fatalf("iteration %d: request %s was never answered", iter, req.ID)
+		}
+	}
+}
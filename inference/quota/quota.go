@@ -0,0 +1,227 @@
+package quota
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/aluko123/go-network-proxy/pkg/metrics"
+	"github.com/redis/go-redis/v9"
+)
+
+// Period names, also used as metric labels
+const (
+	Daily   = "daily"
+	Monthly = "monthly"
+)
+
+// Scopes a quota can apply to
+const (
+	ScopeKey   = "key"
+	ScopeModel = "model"
+)
+
+// AnyKey is the Keys entry applied to API keys without an entry of their own
+const AnyKey = "*"
+
+// Limits caps the tokens used per UTC calendar day and month. Zero means
+// unlimited.
+type Limits struct {
+	Daily   int64 `json:"daily"`
+	Monthly int64 `json:"monthly"`
+}
+
+// Config holds the token quotas per API key and per model
+type Config struct {
+	Keys   map[string]Limits `json:"keys"`
+	Models map[string]Limits `json:"models"`
+
+	KeyPrefix string        `json:"-"` // prepended to every Redis counter key
+	Timeout   time.Duration `json:"-"` // per-call deadline for Redis round trips
+	FailOpen  bool          `json:"-"` // admit requests when Redis is unavailable
+}
+
+// DefaultConfig returns a configuration with no quotas
+func DefaultConfig() Config {
+	return Config{
+		KeyPrefix: "proxy:quota:",
+		Timeout:   100 * time.Millisecond,
+		FailOpen:  true,
+	}
+}
+
+// Load reads the Keys and Models of a JSON quota file into DefaultConfig:
+//
+//	{"keys": {"team-a": {"daily": 100000}, "*": {"monthly": 1000000}},
+//	 "models": {"llama": {"daily": 5000000}}}
+func Load(path string) (Config, error) {
+	cfg := DefaultConfig()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Quota enforces token quotas with Redis counters shared by every gateway
+type Quota struct {
+	client redis.UniversalClient
+	cfg    Config
+	now    func() time.Time
+}
+
+// New creates a quota checker storing its counters through client
+func New(client redis.UniversalClient, cfg Config) *Quota {
+	return &Quota{client: client, cfg: cfg, now: time.Now}
+}
+
+// Status is the quota closest to running out for a request
+type Status struct {
+	Scope  string // ScopeKey or ScopeModel; empty when no quota applies
+	Period string // Daily or Monthly
+	Limit  int64
+	Used   int64
+	Reset  time.Time // when the period's counter starts over
+}
+
+// Remaining is how many tokens are left in the period
+func (s Status) Remaining() int64 {
+	return max(s.Limit-s.Used, 0)
+}
+
+// Exceeded reports whether the quota is used up
+func (s Status) Exceeded() bool {
+	return s.Scope != "" && s.Used >= s.Limit
+}
+
+// counter is one Redis usage counter that applies to a request
+type counter struct {
+	scope  string
+	name   string
+	period string
+	limit  int64
+	key    string
+	reset  time.Time
+	ttl    time.Duration // until a day after reset; relative, so Redis' clock doesn't matter
+}
+
+// counters lists the quotas that apply to a request. Requests without an
+// API key are only subject to model quotas.
+func (q *Quota) counters(apiKey, model string) []counter {
+	now := q.now().UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	var out []counter
+	add := func(scope, name, tag string, l Limits) {
+		// The tag is a Redis Cluster hash tag, so one subject's counters
+		// share a slot
+		base := q.cfg.KeyPrefix + scope + ":{" + tag + "}:"
+		if l.Daily > 0 {
+			reset := day.AddDate(0, 0, 1)
+			out = append(out, counter{scope, name, Daily, l.Daily, base + day.Format("2006-01-02"), reset, reset.Sub(now) + 24*time.Hour})
+		}
+		if l.Monthly > 0 {
+			reset := month.AddDate(0, 1, 0)
+			out = append(out, counter{scope, name, Monthly, l.Monthly, base + month.Format("2006-01"), reset, reset.Sub(now) + 24*time.Hour})
+		}
+	}
+
+	if apiKey != "" {
+		l, ok := q.cfg.Keys[apiKey]
+		if !ok {
+			l = q.cfg.Keys[AnyKey]
+		}
+		add(ScopeKey, apiKey, hashKey(apiKey), l)
+	}
+	add(ScopeModel, model, model, q.cfg.Models[model])
+	return out
+}
+
+// hashKey names an API key's counters without putting the key itself in
+// Redis, where anyone who can list keys would see it
+func hashKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:16])
+}
+
+// callContext derives a bounded context for a single Redis round trip
+func (q *Quota) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if q.cfg.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, q.cfg.Timeout)
+}
+
+// Check returns the applicable quota with the fewest tokens remaining, or a
+// zero Status if none applies. If Redis fails and FailOpen is set, the
+// request is let through with a zero Status.
+func (q *Quota) Check(ctx context.Context, apiKey, model string) (Status, error) {
+	counters := q.counters(apiKey, model)
+	if len(counters) == 0 {
+		return Status{}, nil
+	}
+
+	callCtx, cancel := q.callContext(ctx)
+	defer cancel()
+
+	pipe := q.client.Pipeline()
+	gets := make([]*redis.StringCmd, len(counters))
+	for i, c := range counters {
+		gets[i] = pipe.Get(callCtx, c.key)
+	}
+	if _, err := pipe.Exec(callCtx); err != nil && err != redis.Nil {
+		if q.cfg.FailOpen {
+			slog.Error("quota check failed, allowing request", "error", err)
+			return Status{}, nil
+		}
+		return Status{}, fmt.Errorf("quota check: %w", err)
+	}
+
+	var tightest Status
+	for i, c := range counters {
+		used, _ := gets[i].Int64() // redis.Nil: nothing used yet
+		s := Status{Scope: c.scope, Period: c.period, Limit: c.limit, Used: used, Reset: c.reset}
+		if tightest.Scope == "" || s.Remaining() < tightest.Remaining() {
+			tightest = s
+		}
+	}
+	return tightest, nil
+}
+
+// Add charges n tokens to every quota that applies to the request. Counters
+// expire a day after their period ends.
+func (q *Quota) Add(ctx context.Context, apiKey, model string, n int64) error {
+	counters := q.counters(apiKey, model)
+	if len(counters) == 0 || n <= 0 {
+		return nil
+	}
+
+	callCtx, cancel := q.callContext(ctx)
+	defer cancel()
+
+	pipe := q.client.Pipeline()
+	incrs := make([]*redis.IntCmd, len(counters))
+	for i, c := range counters {
+		incrs[i] = pipe.IncrBy(callCtx, c.key, n)
+		pipe.Expire(callCtx, c.key, c.ttl)
+	}
+	if _, err := pipe.Exec(callCtx); err != nil {
+		return fmt.Errorf("quota add: %w", err)
+	}
+
+	for i, c := range counters {
+		if c.scope == ScopeModel {
+			metrics.InferenceQuotaUsedTokens.WithLabelValues(c.name, c.period).Set(float64(incrs[i].Val()))
+		}
+	}
+	return nil
+}
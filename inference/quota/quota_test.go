@@ -0,0 +1,103 @@
+package quota
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestQuota(t *testing.T, cfg Config) (*Quota, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return New(client, cfg), mr
+}
+
+func TestQuota_CheckAndAdd(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Keys = map[string]Limits{"team-a": {Daily: 100}, AnyKey: {Monthly: 1000}}
+	cfg.Models = map[string]Limits{"llama": {Daily: 150}}
+	q, _ := newTestQuota(t, cfg)
+	now := time.Date(2026, 3, 31, 23, 0, 0, 0, time.UTC)
+	q.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	st, err := q.Check(ctx, "team-a", "llama")
+	if err != nil || st.Scope != ScopeKey || st.Period != Daily || st.Remaining() != 100 {
+		t.Fatalf("expected team-a's daily 100 to be tightest, got %+v, %v", st, err)
+	}
+	if want := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC); !st.Reset.Equal(want) {
+		t.Errorf("expected reset at %v, got %v", want, st.Reset)
+	}
+
+	// Another key's use counts against the shared model quota only
+	if err := q.Add(ctx, "team-b", "llama", 80); err != nil {
+		t.Fatal(err)
+	}
+	st, _ = q.Check(ctx, "team-a", "llama")
+	if st.Scope != ScopeModel || st.Remaining() != 70 {
+		t.Errorf("expected the model quota with 70 left, got %+v", st)
+	}
+	st, _ = q.Check(ctx, "team-b", "gpt2")
+	if st.Scope != ScopeKey || st.Period != Monthly || st.Used != 80 {
+		t.Errorf("expected team-b on the * monthly quota with 80 used, got %+v", st)
+	}
+
+	if err := q.Add(ctx, "team-a", "gpt2", 100); err != nil {
+		t.Fatal(err)
+	}
+	if st, _ = q.Check(ctx, "team-a", "gpt2"); !st.Exceeded() {
+		t.Errorf("expected team-a's daily quota exhausted, got %+v", st)
+	}
+
+	// A new day starts a new daily counter
+	now = now.Add(2 * time.Hour)
+	if st, _ = q.Check(ctx, "team-a", "gpt2"); st.Exceeded() || st.Used != 0 {
+		t.Errorf("expected a fresh day, got %+v", st)
+	}
+
+	if st, _ = q.Check(ctx, "", "gpt2"); st.Scope != "" {
+		t.Errorf("expected no quota without a key or model limit, got %+v", st)
+	}
+}
+
+func TestQuota_RedisDown(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Models = map[string]Limits{"llama": {Daily: 10}}
+	q, mr := newTestQuota(t, cfg)
+	q.cfg.Timeout = 50 * time.Millisecond
+	mr.Close()
+
+	if st, err := q.Check(context.Background(), "", "llama"); err != nil || st.Scope != "" {
+		t.Errorf("fail-open: expected the request through, got %+v, %v", st, err)
+	}
+	q.cfg.FailOpen = false
+	if _, err := q.Check(context.Background(), "", "llama"); err == nil {
+		t.Error("fail-closed: expected an error")
+	}
+}
+
+func TestQuota_KeysNotStoredInRedis(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Keys = map[string]Limits{AnyKey: {Daily: 100}}
+	q, mr := newTestQuota(t, cfg)
+
+	if err := q.Add(context.Background(), "sk-secret-123", "llama", 10); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	keys := mr.Keys()
+	if len(keys) != 1 {
+		t.Fatalf("keys = %v, want one counter", keys)
+	}
+	if strings.Contains(keys[0], "sk-secret-123") {
+		t.Errorf("counter key %q contains the raw API key", keys[0])
+	}
+	if st, _ := q.Check(context.Background(), "sk-secret-123", "llama"); st.Used != 10 {
+		t.Errorf("Used = %d, want 10", st.Used)
+	}
+}
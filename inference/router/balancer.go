@@ -0,0 +1,70 @@
+package router
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/aluko123/go-network-proxy/inference/queue"
+)
+
+// Candidate describes a healthy worker with free capacity for a request
+type Candidate struct {
+	ID       string
+	Address  string
+	Capacity int // requests the worker may run at once (weight x MaxConcurrent)
+	InFlight int // requests currently being processed by this worker
+	// Load is the worker's own last report of running plus queued requests,
+	// counting work from other gateways too; -1 before the first report
+	Load int
+}
+
+// Balancer chooses which worker runs a popped request.
+//
+// With no Balancer (nil) the router uses its pull model: every worker pops
+// from its queue independently, so whichever free worker wakes first wins.
+// With a Balancer, one dispatcher per queue pops requests and hands each to
+// the worker picked from the currently idle, healthy candidates.
+type Balancer interface {
+	// Pick returns the index in candidates (never empty) of the worker to use
+	Pick(req *queue.Request, candidates []Candidate) int
+}
+
+// NewBalancer returns the balancer for a strategy name:
+// "pull" (nil, the default), "least-conn" or "round-robin"
+func NewBalancer(name string) (Balancer, error) {
+	switch name {
+	case "", "pull":
+		return nil, nil
+	case "least-conn":
+		return LeastConnections{}, nil
+	case "round-robin":
+		return &RoundRobin{}, nil
+	default:
+		return nil, fmt.Errorf("unknown balancer %q", name)
+	}
+}
+
+// LeastConnections picks the candidate with the fewest in-flight requests
+// relative to its capacity, preferring the earliest one on ties
+type LeastConnections struct{}
+
+func (LeastConnections) Pick(_ *queue.Request, candidates []Candidate) int {
+	best := 0
+	for i, c := range candidates {
+		b := candidates[best]
+		// c.InFlight/c.Capacity < b.InFlight/b.Capacity without division
+		if c.InFlight*max(b.Capacity, 1) < b.InFlight*max(c.Capacity, 1) {
+			best = i
+		}
+	}
+	return best
+}
+
+// RoundRobin cycles through the candidates in turn
+type RoundRobin struct {
+	next atomic.Uint64
+}
+
+func (b *RoundRobin) Pick(_ *queue.Request, candidates []Candidate) int {
+	return int((b.next.Add(1) - 1) % uint64(len(candidates)))
+}
@@ -0,0 +1,121 @@
+package router
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aluko123/go-network-proxy/inference/queue"
+)
+
+func TestLeastConnections_PicksLeastLoaded(t *testing.T) {
+	candidates := []Candidate{
+		{ID: "a", InFlight: 2},
+		{ID: "b", InFlight: 0},
+		{ID: "c", InFlight: 0},
+	}
+	if got := (LeastConnections{}).Pick(nil, candidates); got != 1 {
+		t.Errorf("expected index 1 (first least-loaded), got %d", got)
+	}
+}
+
+func TestNewBalancer(t *testing.T) {
+	for _, name := range []string{"", "pull", "least-conn", "round-robin"} {
+		if _, err := NewBalancer(name); err != nil {
+			t.Errorf("NewBalancer(%q): %v", name, err)
+		}
+	}
+	if _, err := NewBalancer("random"); err == nil {
+		t.Error("expected error for unknown balancer")
+	}
+}
+
+func TestRouter_RoundRobinSpreadsRequests(t *testing.T) {
+	SetConfig(Config{})
+	defer SetConfig(DefaultConfig())
+
+	fws := []*fakeWorker{{}, {}}
+	var addrs []string
+	for _, fw := range fws {
+		fw.healthy.Store(true)
+		addrs = append(addrs, startFakeWorker(t, fw))
+	}
+
+	pq := queue.NewPriorityQueue(0)
+	r, err := NewRouter(addrs, pq, &RoundRobin{})
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+	r.Start()
+	defer r.Close()
+
+	// One at a time, so both workers are idle for every pick
+	for i := 0; i < 4; i++ {
+		req := newTestRequest(fmt.Sprintf("req-%d", i))
+		pq.Push(req)
+		select {
+		case _, ok := <-req.ResponseCh:
+			if !ok {
+				t.Fatalf("request %s: stream closed without tokens", req.ID)
+			}
+		case err := <-req.ErrorCh:
+			t.Fatalf("request %s: %v", req.ID, err)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("request %s: timed out", req.ID)
+		}
+		// Let the worker report itself free before the next pick
+		waitFor(t, time.Second, func() bool { return r.workers[0].inflight.Load()+r.workers[1].inflight.Load() == 0 })
+	}
+
+	for i, fw := range fws {
+		if got := fw.calls.Load(); got != 2 {
+			t.Errorf("worker %d: expected 2 requests, got %d", i, got)
+		}
+	}
+}
+
+func TestLeastConnections_ComparesLoadRelativeToCapacity(t *testing.T) {
+	candidates := []Candidate{
+		{ID: "cpu", Capacity: 2, InFlight: 0},
+		{ID: "gpu", Capacity: 4, InFlight: 0},
+		{ID: "busy-gpu", Capacity: 4, InFlight: 3},
+	}
+	// cpu and gpu are both empty: the earliest wins
+	if got := (LeastConnections{}).Pick(nil, candidates); got != 0 {
+		t.Errorf("expected index 0, got %d", got)
+	}
+
+	// cpu at 1/2 is busier than gpu at 1/4
+	candidates[0].InFlight = 1
+	candidates[1].InFlight = 1
+	if got := (LeastConnections{}).Pick(nil, candidates); got != 1 {
+		t.Errorf("expected index 1 (gpu at quarter load), got %d", got)
+	}
+}
+
+func TestParseWorkerAddr(t *testing.T) {
+	tests := []struct {
+		spec    string
+		addr    string
+		weight  int
+		wantErr bool
+	}{
+		{spec: "localhost:50051", addr: "localhost:50051", weight: 1},
+		{spec: "gpu:50051=4", addr: "gpu:50051", weight: 4},
+		{spec: " gpu:50051=2 ", addr: "gpu:50051", weight: 2},
+		{spec: "gpu:50051=0", wantErr: true},
+		{spec: "gpu:50051=fast", wantErr: true},
+	}
+	for _, tt := range tests {
+		addr, weight, err := ParseWorkerAddr(tt.spec)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseWorkerAddr(%q): expected error", tt.spec)
+			}
+			continue
+		}
+		if err != nil || addr != tt.addr || weight != tt.weight {
+			t.Errorf("ParseWorkerAddr(%q) = %q, %d, %v; want %q, %d", tt.spec, addr, weight, err, tt.addr, tt.weight)
+		}
+	}
+}
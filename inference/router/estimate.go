@@ -0,0 +1,105 @@
+package router
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aluko123/go-network-proxy/inference/queue"
+)
+
+// ewmaAlpha weights the newest processing time; ~10 requests dominate the average
+const ewmaAlpha = 0.2
+
+// ewma is an exponentially weighted moving average of processing times
+type ewma struct {
+	mu    sync.Mutex
+	value float64 // seconds
+	set   bool
+}
+
+func (e *ewma) observe(d time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.set {
+		e.value, e.set = d.Seconds(), true
+		return
+	}
+	e.value = ewmaAlpha*d.Seconds() + (1-ewmaAlpha)*e.value
+}
+
+func (e *ewma) get() (time.Duration, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return time.Duration(e.value * float64(time.Second)), e.set
+}
+
+// observeProcessing records how long a completed request took on pq's workers
+func (r *Router) observeProcessing(pq *queue.PriorityQueue, d time.Duration) {
+	e, _ := r.latency.LoadOrStore(pq, &ewma{})
+	e.(*ewma).observe(d)
+}
+
+// Estimate is a rough forecast of how long a new request on a queue would
+// wait before a worker starts it
+type Estimate struct {
+	Queue          string `json:"queue"`
+	QueueDepth     int    `json:"queue_depth"`
+	InFlight       int    `json:"in_flight"`
+	HealthyWorkers int    `json:"healthy_workers"`
+	Slots          int    `json:"slots"` // concurrent requests the healthy workers can run
+	// Nil until a request has completed on the queue
+	AvgProcessingMs *int64 `json:"avg_processing_ms"`
+	// Nil when it can't be estimated (no healthy workers or no history yet)
+	EstimatedWaitMs *int64 `json:"estimated_wait_ms"`
+}
+
+// Estimate reports pq's load and, from the rolling average processing time,
+// the expected wait: requests ahead of a new one (queued plus running) beyond
+// the free slots, spread over all slots. Priorities are ignored, so it is the
+// wait for a request at the back of the queue.
+func (r *Router) Estimate(pq *queue.PriorityQueue) Estimate {
+	est := Estimate{Queue: pq.Name(), QueueDepth: pq.Len()}
+
+	r.mu.RLock()
+	for _, w := range r.workers {
+		if w.queue != pq {
+			continue
+		}
+		est.InFlight += int(w.inflight.Load())
+		if w.Healthy() && !w.draining.Load() {
+			est.HealthyWorkers++
+			est.Slots += w.capacity()
+		}
+	}
+	r.mu.RUnlock()
+
+	var avg time.Duration
+	if e, ok := r.latency.Load(pq); ok {
+		if d, ok := e.(*ewma).get(); ok {
+			avg = d
+			ms := d.Milliseconds()
+			est.AvgProcessingMs = &ms
+		}
+	}
+
+	if est.Slots == 0 || est.AvgProcessingMs == nil {
+		return est
+	}
+	var wait time.Duration
+	if ahead := est.QueueDepth + est.InFlight - est.Slots + 1; ahead > 0 {
+		wait = time.Duration(float64(avg) * float64(ahead) / float64(est.Slots))
+	}
+	ms := wait.Milliseconds()
+	est.EstimatedWaitMs = &ms
+	return est
+}
+
+// EstimateWait returns the expected wait for a new request on pq, or false
+// when Estimate can't produce one
+func (r *Router) EstimateWait(pq *queue.PriorityQueue) (time.Duration, bool) {
+	est := r.Estimate(pq)
+	if est.EstimatedWaitMs == nil {
+		return 0, false
+	}
+	return time.Duration(*est.EstimatedWaitMs) * time.Millisecond, true
+}
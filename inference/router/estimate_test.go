@@ -0,0 +1,55 @@
+package router
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aluko123/go-network-proxy/inference/queue"
+)
+
+func TestRouter_Estimate(t *testing.T) {
+	fw := &fakeWorker{}
+	fw.healthy.Store(true)
+	addr := startFakeWorker(t, fw)
+
+	pq := queue.NewPriorityQueue(0)
+	r, err := NewRouter([]string{addr + "=2"}, pq, nil) // 2 slots; not started, so nothing drains
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+	defer r.Close()
+
+	est := r.Estimate(pq)
+	if est.HealthyWorkers != 1 || est.Slots != 2 {
+		t.Fatalf("expected 1 worker with 2 slots, got %+v", est)
+	}
+	if est.AvgProcessingMs != nil || est.EstimatedWaitMs != nil {
+		t.Errorf("expected no estimate without history, got %+v", est)
+	}
+
+	r.observeProcessing(pq, 100*time.Millisecond)
+	r.observeProcessing(pq, 200*time.Millisecond) // 0.2*200 + 0.8*100 = 120ms
+	if est := r.Estimate(pq); est.EstimatedWaitMs == nil || *est.EstimatedWaitMs != 0 || *est.AvgProcessingMs != 120 {
+		t.Errorf("expected 120ms average and no wait with free slots, got %+v", est)
+	}
+
+	var queued []*queue.Request
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		req := newTestRequest(id)
+		pq.Push(req)
+		queued = append(queued, req)
+	}
+	defer func() { // Close waits for queued requests, and nothing drains them
+		for _, req := range queued {
+			pq.Remove(req)
+		}
+	}()
+	// 5 queued, 2 slots: a new request is 4th in line per slot -> 4/2 * 120ms
+	est = r.Estimate(pq)
+	if est.QueueDepth != 5 || est.EstimatedWaitMs == nil || *est.EstimatedWaitMs != 240 {
+		t.Errorf("expected 240ms wait behind 5 requests, got %+v (wait %v)", est, est.EstimatedWaitMs)
+	}
+	if wait, ok := r.EstimateWait(pq); !ok || wait != 240*time.Millisecond {
+		t.Errorf("EstimateWait = %v, %v; want 240ms", wait, ok)
+	}
+}
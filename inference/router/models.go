@@ -0,0 +1,71 @@
+package router
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// ModelInfo describes a model at least one worker hosts
+type ModelInfo struct {
+	ID      string
+	Created time.Time // when the first worker still hosting it joined
+}
+
+// SetDefaultModels declares the models hosted by the workers on the shared
+// default queue. Dedicated pools host the model they are named after. Names
+// are trimmed and empty ones skipped.
+func (r *Router) SetDefaultModels(models []string) {
+	names := make([]string, 0, len(models))
+	for _, m := range models {
+		if m = strings.TrimSpace(m); m != "" {
+			names = append(names, m)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.defaultModels = names
+}
+
+// Models returns the models served by the router's workers, sorted by ID.
+// A worker's own GetInfo report wins; without one, default-queue workers host
+// the default models and dedicated ones their queue's model. Workers being
+// drained are left out, unhealthy ones are not: their models are still served
+// once they recover.
+func (r *Router) Models() []ModelInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	created := make(map[string]time.Time)
+	add := func(model string, at time.Time) {
+		if t, ok := created[model]; !ok || at.Before(t) {
+			created[model] = at
+		}
+	}
+	for _, w := range r.workers {
+		if w.draining.Load() {
+			continue
+		}
+		if info := w.Info(); info != nil && len(info.Models) > 0 {
+			for _, model := range info.Models {
+				add(model, w.added)
+			}
+			continue
+		}
+		if w.queue == r.queues.Default() {
+			for _, model := range r.defaultModels {
+				add(model, w.added)
+			}
+			continue
+		}
+		add(w.queue.Name(), w.added)
+	}
+
+	models := make([]ModelInfo, 0, len(created))
+	for id, at := range created {
+		models = append(models, ModelInfo{ID: id, Created: at})
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].ID < models[j].ID })
+	return models
+}
@@ -0,0 +1,104 @@
+package router
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	pb "github.com/aluko123/go-network-proxy/inference/pb"
+	"github.com/aluko123/go-network-proxy/inference/queue"
+)
+
+func TestRouter_Models(t *testing.T) {
+	fw := &fakeWorker{}
+	fw.healthy.Store(true)
+	addr := startFakeWorker(t, fw)
+
+	qs := queue.NewModelQueues(queue.NewPriorityQueue(0))
+	qs.Add("llama", queue.NewPriorityQueue(0))
+	qs.Add("gpt2", queue.NewPriorityQueue(0))
+	r, err := NewModelRouter(map[string][]string{"llama": {addr}, "gpt2": {addr}}, []string{addr}, qs, nil)
+	if err != nil {
+		t.Fatalf("NewModelRouter: %v", err)
+	}
+	defer r.Close()
+
+	ids := func() []string {
+		var out []string
+		for _, m := range r.Models() {
+			out = append(out, m.ID)
+		}
+		return out
+	}
+
+	if got := ids(); !slices.Equal(got, []string{"gpt2", "llama"}) {
+		t.Errorf("dedicated pools only: got %v", got)
+	}
+
+	r.SetDefaultModels([]string{"mistral", " gpt2", ""})
+	if got := ids(); !slices.Equal(got, []string{"gpt2", "llama", "mistral"}) {
+		t.Errorf("with default models: got %v", got)
+	}
+
+	if err := r.DrainWorker("llama-worker-0"); err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(); !slices.Equal(got, []string{"gpt2", "mistral"}) {
+		t.Errorf("after draining the llama pool: got %v", got)
+	}
+	for _, m := range r.Models() {
+		if m.Created.IsZero() {
+			t.Errorf("%s has no created time", m.ID)
+		}
+	}
+}
+
+// infoWorker is a fakeWorker that also answers GetInfo
+type infoWorker struct {
+	fakeWorker
+	models []string
+}
+
+func (f *infoWorker) GetInfo(context.Context, *pb.InfoRequest) (*pb.InfoResponse, error) {
+	return &pb.InfoResponse{Healthy: f.healthy.Load(), Models: f.models, InFlight: 2, CurrentQueueSize: 3}, nil
+}
+
+func TestRouter_ModelsFromWorkerInfo(t *testing.T) {
+	iw := &infoWorker{models: []string{"phi", "qwen"}}
+	iw.healthy.Store(true)
+	legacy := &fakeWorker{}
+	legacy.healthy.Store(true)
+
+	pq := queue.NewPriorityQueue(0)
+	r, err := NewRouter([]string{startFakeWorker(t, iw), startFakeWorker(t, legacy)}, pq, nil)
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+	defer r.Close()
+	r.SetDefaultModels([]string{"mistral"})
+	r.Start()
+
+	ids := func() []string {
+		var out []string
+		for _, m := range r.Models() {
+			out = append(out, m.ID)
+		}
+		return out
+	}
+	// Both are probed as soon as they start: the reporting worker lists its
+	// own models, the one without GetInfo falls back to the defaults
+	want := []string{"mistral", "phi", "qwen"}
+	if !waitFor(t, time.Second, func() bool { return slices.Equal(ids(), want) }) {
+		t.Fatalf("expected %v, got %v", want, ids())
+	}
+	if got := r.workers[0].reportedLoad(); got != 5 {
+		t.Errorf("expected reported load 5, got %d", got)
+	}
+	if !waitFor(t, time.Second, func() bool { return r.workers[1].Info() != nil }) {
+		t.Fatal("legacy worker was never probed")
+	}
+	if info := r.workers[1].Info(); !info.Healthy || len(info.Models) != 0 {
+		t.Errorf("expected a Health-based report for the legacy worker, got %v", info)
+	}
+}
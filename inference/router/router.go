@@ -1,74 +1,888 @@
 package router
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"math/rand/v2"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/aluko123/go-network-proxy/inference/queue"
 	"github.com/aluko123/go-network-proxy/inference/worker"
+	"github.com/aluko123/go-network-proxy/pkg/metrics"
 )
 
-// Router manages the worker pool and request distribution
+// Config holds router configuration
+type Config struct {
+	HealthCheckInterval time.Duration // 0 disables health checks
+	HealthCheckTimeout  time.Duration
+	UnhealthyThreshold  int // consecutive failed probes before a worker leaves rotation
+
+	// After ReconnectThreshold consecutive request failures the worker's
+	// connection is rebuilt, retrying with jittered exponential backoff
+	// (starting at ReconnectBackoff, capped at ReconnectMaxBackoff) until it
+	// answers a health probe. A threshold of 0 disables reconnection.
+	ReconnectThreshold  int
+	ReconnectBackoff    time.Duration
+	ReconnectMaxBackoff time.Duration
+
+	// With BatchSize above 1, a worker that pops a request takes up to
+	// BatchSize-1 more for the same model, waiting up to BatchWindow for
+	// them, and runs them all in one BatchGenerate call. Balanced mode
+	// assigns one request at a time and does not batch.
+	BatchSize   int
+	BatchWindow time.Duration
+}
+
+// DefaultConfig returns the default router configuration
+func DefaultConfig() Config {
+	return Config{
+		HealthCheckInterval: 10 * time.Second,
+		HealthCheckTimeout:  2 * time.Second,
+		UnhealthyThreshold:  3,
+		ReconnectThreshold:  3,
+		ReconnectBackoff:    time.Second,
+		ReconnectMaxBackoff: 30 * time.Second,
+		BatchSize:           1,
+		BatchWindow:         10 * time.Millisecond,
+	}
+}
+
+var config = DefaultConfig()
+
+// SetConfig updates the router configuration (applies to routers created afterwards)
+func SetConfig(c Config) {
+	config = c
+}
+
+// Router manages the worker pools and request distribution.
+// Each model with dedicated workers has its own queue; all other workers
+// drain the shared default queue.
 type Router struct {
-	workers []*worker.Client
+	cfg      Config
+	balancer Balancer // nil = pull model
+	queues   *queue.ModelQueues
+	done     chan struct{} // closed on Close to stop health checks and idle loops
+	latency  sync.Map      // *queue.PriorityQueue -> *ewma of processing time, for Estimate
+
+	// loops counts the processing loops and dispatchers, i.e. everything
+	// that pops, so Shutdown knows when nothing will drain the queues
+	loops sync.WaitGroup
+
+	mu            sync.RWMutex // guards workers, pools, started, nextID and defaultModels
+	workers       []*managedWorker
+	defaultModels []string // models the default queue's workers host, for Models
+	pools         map[*queue.PriorityQueue]*pool
+	started       bool
+	nextID        int // suffix for the next worker-N ID on the default queue
+}
+
+// managedWorker is a worker client bound to the queue it pulls from
+type managedWorker struct {
+	*worker.Client
+	queue    *queue.PriorityQueue
+	weight   int       // share of the worker's queue relative to other workers
+	added    time.Time // when the worker joined the router
+	inflight atomic.Int32
+	finished atomic.Int64  // requests run to an outcome, for Workers
+	slots    chan struct{} // semaphore capping concurrent requests at capacity()
+
+	reconnecting atomic.Bool   // one slot rebuilds the connection at a time
+	recovered    chan struct{} // healthLoop's signal that a reconnecting worker answered
+
+	// Set by DrainWorker: loops stop taking requests and exit once idle
+	draining atomic.Bool
+	stop     chan struct{}
+
+	// Balanced mode only: requests handed over by the dispatcher, and the
+	// pool's signal that a worker has freed up
+	assign chan *queue.Request
+	freed  chan struct{}
+}
+
+// capacity is how many requests the worker runs at once
+func (w *managedWorker) capacity() int {
+	return max(w.weight, 1) * max(w.MaxConcurrent, 1)
+}
+
+// reportedLoad is the running plus queued requests the worker last reported,
+// or -1 if it has not reported yet
+func (w *managedWorker) reportedLoad() int {
+	info := w.Info()
+	if info == nil {
+		return -1
+	}
+	return int(info.InFlight + info.CurrentQueueSize)
+}
+
+// begin and end track a request assigned to the worker
+func (w *managedWorker) begin() {
+	n := w.inflight.Add(1)
+	metrics.InferenceWorkerInFlight.WithLabelValues(w.ID).Set(float64(n))
+}
+
+func (w *managedWorker) end() {
+	n := w.inflight.Add(-1)
+	metrics.InferenceWorkerInFlight.WithLabelValues(w.ID).Set(float64(n))
+}
+
+// pool is the set of workers draining one queue
+type pool struct {
 	queue   *queue.PriorityQueue
+	workers []*managedWorker
+	free    chan struct{}
 }
 
-// NewRouter creates a router with the given worker addresses
-func NewRouter(addresses []string, pq *queue.PriorityQueue) (*Router, error) {
+// NewRouter creates a router with the given worker addresses, all serving one
+// shared queue. A nil balancer keeps the pull model.
+func NewRouter(addresses []string, pq *queue.PriorityQueue, balancer Balancer) (*Router, error) {
+	return NewModelRouter(nil, addresses, queue.NewModelQueues(pq), balancer)
+}
+
+// NewModelRouter creates a router with a dedicated worker pool per model.
+// Addresses may carry a weight as "addr=weight" (see ParseWorkerAddr).
+// - models: model name -> worker addresses serving only that model
+// - defaultAddrs: workers draining the shared default queue (any model)
+// - qs: must have a queue registered for every model in models, and a default
+// queue if defaultAddrs is non-empty
+// - balancer: worker selection strategy; nil keeps the pull model
+func NewModelRouter(models map[string][]string, defaultAddrs []string, qs *queue.ModelQueues, balancer Balancer) (*Router, error) {
 	r := &Router{
-		workers: make([]*worker.Client, 0, len(addresses)),
-		queue:   pq,
+		cfg:      config,
+		balancer: balancer,
+		queues:   qs,
+		done:     make(chan struct{}),
+	}
+
+	// Deterministic worker IDs regardless of map iteration order
+	names := make([]string, 0, len(models))
+	for model := range models {
+		names = append(names, model)
+	}
+	sort.Strings(names)
+
+	for _, model := range names {
+		pq := qs.For(model)
+		if pq == nil || pq == qs.Default() {
+			return nil, fmt.Errorf("no queue registered for model %s", model)
+		}
+		for i, addr := range models[model] {
+			if err := r.addWorker(fmt.Sprintf("%s-worker-%d", model, i), addr, pq); err != nil {
+				return nil, err
+			}
+		}
 	}
 
-	for i, addr := range addresses {
-		id := fmt.Sprintf("worker-%d", i)
-		w, err := worker.NewClient(id, addr)
-		if err != nil {
-			return nil, fmt.Errorf("failed to connect to worker %s: %v", addr, err)
+	if len(defaultAddrs) > 0 && qs.Default() == nil {
+		return nil, fmt.Errorf("default workers configured without a default queue")
+	}
+	for _, addr := range defaultAddrs {
+		if err := r.addWorker(fmt.Sprintf("worker-%d", r.nextID), addr, qs.Default()); err != nil {
+			return nil, err
 		}
-		r.workers = append(r.workers, w)
-		slog.Info("connected to worker", "worker_id", id, "addr", addr)
+		r.nextID++
 	}
 
 	return r, nil
 }
 
-// Start begins the worker loops
+// addWorker connects to a worker and adds it to the pool draining pq,
+// starting its loops if the router is already running
+func (r *Router) addWorker(id, spec string, pq *queue.PriorityQueue) error {
+	addr, weight, err := ParseWorkerAddr(spec)
+	if err != nil {
+		return err
+	}
+	w, err := worker.NewClient(id, addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to worker %s: %v", addr, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.workers {
+		if existing.ID == id {
+			w.Close()
+			return fmt.Errorf("%w: %s", ErrDuplicateWorker, id)
+		}
+	}
+	mw := &managedWorker{Client: w, queue: pq, weight: weight, added: time.Now()}
+	r.workers = append(r.workers, mw)
+	if r.started {
+		r.launch(mw)
+	}
+	slog.Info("connected to worker", "worker_id", id, "addr", addr, "weight", weight, "queue", pq.Name())
+	return nil
+}
+
+// Errors returned by AddWorker and RemoveWorker
+var (
+	ErrUnknownWorker   = errors.New("unknown worker")
+	ErrDuplicateWorker = errors.New("worker ID already in use")
+)
+
+// ErrShutdown is delivered to requests still queued when Shutdown gives up
+// waiting for the drain
+var ErrShutdown = errors.New("gateway shutting down")
+
+// AddWorker connects a new worker to the shared default queue while the
+// router is running. An empty id picks the next free "worker-N". The address
+// may carry a weight ("addr=weight"). It returns the worker's ID.
+func (r *Router) AddWorker(id, addr string) (string, error) {
+	select {
+	case <-r.done:
+		return "", fmt.Errorf("router is closed")
+	default:
+	}
+	if r.queues.Default() == nil {
+		return "", fmt.Errorf("no default queue to attach the worker to")
+	}
+
+	if id == "" {
+		r.mu.Lock()
+		id = fmt.Sprintf("worker-%d", r.nextID)
+		r.nextID++
+		r.mu.Unlock()
+	}
+
+	if err := r.addWorker(id, addr, r.queues.Default()); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// DrainWorker takes a worker out of rotation: it receives no new requests,
+// requests it was handed but had not started go back to its queue, and once
+// its in-flight requests complete the worker is removed and its connection
+// closed. The queue itself stays open. DrainWorker blocks until then.
+func (r *Router) DrainWorker(id string) error {
+	w, err := r.detach(id)
+	if err != nil {
+		return err
+	}
+	r.drain(w)
+	return nil
+}
+
+// RemoveWorker takes a worker out of rotation like DrainWorker but returns
+// immediately, finishing the drain in the background
+func (r *Router) RemoveWorker(id string) error {
+	w, err := r.detach(id)
+	if err != nil {
+		return err
+	}
+	go r.drain(w)
+	return nil
+}
+
+// detach removes a worker from the router and stops it taking new requests
+func (r *Router) detach(id string) (*managedWorker, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var w *managedWorker
+	for i, mw := range r.workers {
+		if mw.ID == id {
+			w = mw
+			r.workers = append(r.workers[:i], r.workers[i+1:]...)
+			break
+		}
+	}
+	if w == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownWorker, id)
+	}
+
+	w.draining.Store(true)
+	if w.stop != nil {
+		close(w.stop)
+	}
+	// The dispatcher may already have exited and closed its workers' channels
+	if p := r.pools[w.queue]; p != nil && p.remove(w) {
+		close(w.assign)
+	}
+	return w, nil
+}
+
+// drain waits for a detached worker's in-flight requests, then closes it
+func (r *Router) drain(w *managedWorker) {
+	slog.Info("draining worker", "worker_id", w.ID, "in_flight", w.inflight.Load())
+
+	// Holding every slot means nothing is running on the worker any more
+	if w.slots != nil {
+		for range w.capacity() {
+			w.slots <- struct{}{}
+		}
+	}
+
+	w.Close()
+	metrics.InferenceWorkerHealthy.DeleteLabelValues(w.ID)
+	metrics.InferenceWorkerInFlight.DeleteLabelValues(w.ID)
+	slog.Info("worker drained", "worker_id", w.ID)
+}
+
+// ParseWorkerAddr splits a worker spec of the form "addr" or "addr=weight".
+// The weight is the number of requests the worker runs at once and defaults to 1.
+func ParseWorkerAddr(spec string) (string, int, error) {
+	addr, w, ok := strings.Cut(strings.TrimSpace(spec), "=")
+	if !ok {
+		return addr, 1, nil
+	}
+	weight, err := strconv.Atoi(w)
+	if err != nil || weight < 1 {
+		return "", 0, fmt.Errorf("invalid weight in worker address %q: must be a positive integer", spec)
+	}
+	return addr, weight, nil
+}
+
+// HealthyWorkers counts the healthy workers draining pq that are not being
+// removed; a nil pq counts every pool
+func (r *Router) HealthyWorkers(pq *queue.PriorityQueue) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	n := 0
+	for _, w := range r.workers {
+		if (pq == nil || w.queue == pq) && w.Healthy() && !w.draining.Load() {
+			n++
+		}
+	}
+	return n
+}
+
+// Queues returns the per-model queues the router's workers drain
+func (r *Router) Queues() *queue.ModelQueues {
+	return r.queues
+}
+
+// Start begins the worker loops and, if configured, periodic health checks
 func (r *Router) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.started = true
 	for _, w := range r.workers {
-		go r.workerLoop(w)
+		r.launch(w)
 	}
 }
 
-// workerLoop constantly pulls from the queue and processes requests
-func (r *Router) workerLoop(w *worker.Client) {
-	slog.Info("starting processing loop", "worker_id", w.ID)
+// launch starts a worker's processing loops (one per concurrent slot), its
+// health checks, and its pool's dispatcher if this is the pool's first
+// worker in balanced mode (mu must be held)
+func (r *Router) launch(w *managedWorker) {
+	w.slots = make(chan struct{}, w.capacity())
+	w.stop = make(chan struct{})
+	w.recovered = make(chan struct{}, 1)
+	w.assign = make(chan *queue.Request, w.capacity())
+
+	if r.pools == nil {
+		r.pools = make(map[*queue.PriorityQueue]*pool)
+	}
+	p, ok := r.pools[w.queue]
+	if !ok {
+		p = &pool{queue: w.queue, free: make(chan struct{}, 1)}
+		r.pools[w.queue] = p
+		if r.balancer != nil {
+			r.loops.Add(1)
+			go r.dispatchLoop(p)
+		}
+	}
+	w.freed = p.free
+	p.workers = append(p.workers, w)
+
+	for range w.capacity() {
+		r.loops.Add(1)
+		if r.balancer == nil {
+			go r.workerLoop(w)
+		} else {
+			go r.assignedLoop(w)
+		}
+	}
+
+	if r.cfg.HealthCheckInterval > 0 {
+		go r.healthLoop(w)
+	}
+}
+
+// remove drops w from the pool, reporting whether it was a member
+func (p *pool) remove(w *managedWorker) bool {
+	for i, mw := range p.workers {
+		if mw == w {
+			p.workers = append(p.workers[:i], p.workers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// workerLoop constantly pulls from the worker's queue and processes requests
+func (r *Router) workerLoop(w *managedWorker) {
+	defer r.loops.Done()
+	slog.Info("starting processing loop", "worker_id", w.ID, "queue", w.queue.Name())
+	failures := 0
 	for {
+		// 0. Unhealthy workers stop pulling until a health probe succeeds
+		if w.draining.Load() || !r.waitHealthy(w) {
+			slog.Info("worker stopping", "worker_id", w.ID)
+			return
+		}
+
 		// 1. Block until a request is available (nil if queue closed)
-		req := r.queue.Pop()
+		req := w.queue.Pop()
 		if req == nil {
 			slog.Info("worker stopping", "worker_id", w.ID)
 			return
 		}
 
-		// 2. Process it
-		w.ProcessRequest(req)
-		r.queue.Done()
+		// Went unhealthy while blocked in Pop: hand the request to another worker
+		if !w.Healthy() && r.cfg.HealthCheckInterval > 0 && w.queue.Requeue(req) {
+			continue
+		}
+
+		// 2. Process it, along with compatible requests if batching
+		batch := []*queue.Request{req}
+		if r.cfg.BatchSize > 1 {
+			batch = append(batch, w.queue.PopBatch(req.Model, r.cfg.BatchSize-1, r.cfg.BatchWindow)...)
+		}
+		for range batch {
+			w.begin()
+		}
+		ok := r.handle(w, batch, &failures)
+		for range batch {
+			w.end()
+		}
+		if !ok {
+			slog.Info("worker stopping", "worker_id", w.ID)
+			return
+		}
+	}
+}
+
+// assignedLoop processes requests handed to the worker by its pool's dispatcher
+func (r *Router) assignedLoop(w *managedWorker) {
+	defer r.loops.Done()
+	slog.Info("starting processing loop", "worker_id", w.ID, "queue", w.queue.Name())
+	failures := 0
+	// Keep ranging even if handle says stop: requests already assigned must
+	// still be processed or handed back, and the channel closes on drain/shutdown
+	for req := range w.assign {
+		r.handle(w, []*queue.Request{req}, &failures)
+		w.end()
+		select {
+		case w.freed <- struct{}{}:
+		default:
+		}
+	}
+	slog.Info("worker stopping", "worker_id", w.ID)
+}
+
+// dispatchLoop pops requests from a pool's queue and assigns each to the
+// worker chosen by the balancer. It only pops once some worker is idle, so
+// waiting requests stay in the priority queue rather than with the dispatcher.
+func (r *Router) dispatchLoop(p *pool) {
+	defer r.loops.Done()
+	defer func() {
+		r.mu.Lock()
+		for _, w := range p.workers {
+			close(w.assign)
+		}
+		p.workers = nil
+		r.mu.Unlock()
+	}()
+
+	for {
+		if !r.waitIdle(p) {
+			return
+		}
+
+		req := p.queue.Pop()
+		if req == nil {
+			return
+		}
+
+		// Idle workers may have gone unhealthy or been drained while we were
+		// blocked in Pop
+		if r.dispatch(p, req) || p.queue.Requeue(req) {
+			continue
+		}
+		// Queue closed and nobody to run it: still owe this request an answer
+		req.ErrorCh <- fmt.Errorf("no worker available for queue %s", p.queue.Name())
+		p.queue.Done()
+	}
+}
+
+// dispatch hands req to the worker the balancer picks among the idle ones,
+// returning false if there are none. The lock keeps DrainWorker from closing
+// the chosen worker's channel mid-send; the send never blocks because the
+// channel has room for a full worker's capacity.
+func (r *Router) dispatch(p *pool, req *queue.Request) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	workers, candidates := r.idleWorkers(p)
+	if len(candidates) == 0 {
+		return false
+	}
+	w := workers[r.balancer.Pick(req, candidates)]
+	w.begin()
+	w.assign <- req
+	return true
+}
+
+// idleWorkers returns the pool's healthy workers with free capacity and their
+// balancer view (mu must be held)
+func (r *Router) idleWorkers(p *pool) ([]*managedWorker, []Candidate) {
+	var workers []*managedWorker
+	var candidates []Candidate
+	for _, w := range p.workers {
+		inflight := int(w.inflight.Load())
+		if !w.Healthy() || inflight >= w.capacity() {
+			continue
+		}
+		workers = append(workers, w)
+		candidates = append(candidates, Candidate{ID: w.ID, Address: w.Address, Capacity: w.capacity(), InFlight: inflight, Load: w.reportedLoad()})
+	}
+	return workers, candidates
+}
+
+// waitIdle blocks until the pool has an idle, healthy worker. Once the router
+// shuts down it keeps waiting only while a healthy worker is busy, since that
+// one can still take the backlog; otherwise it returns false.
+func (r *Router) waitIdle(p *pool) bool {
+	done := r.done
+	for {
+		r.mu.RLock()
+		_, candidates := r.idleWorkers(p)
+		healthy := 0
+		for _, w := range p.workers {
+			if w.Healthy() {
+				healthy++
+			}
+		}
+		r.mu.RUnlock()
+		if len(candidates) > 0 {
+			return true
+		}
+		if done == nil && healthy == 0 {
+			return false
+		}
+		// Health changes don't signal the pool, so re-check periodically
+		select {
+		case <-done:
+			done = nil
+		case <-p.free:
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// handle processes a request, or a batch of them in one worker call, and
+// applies the reconnect policy. It returns false if the worker should stop
+// (draining, or router shutting down mid-reconnect).
+func (r *Router) handle(w *managedWorker, reqs []*queue.Request, failures *int) bool {
+	select {
+	case w.slots <- struct{}{}:
+	case <-w.stop:
+		for _, req := range reqs {
+			r.release(w, req)
+		}
+		return false
+	}
+	defer func() { <-w.slots }()
+
+	if w.draining.Load() {
+		for _, req := range reqs {
+			r.release(w, req)
+		}
+		return false
+	}
+
+	// A panic must not kill the loop or leak inflight accounting
+	failed, succeeded := false, false
+	for _, err := range r.process(w, reqs) {
+		switch {
+		case err == nil:
+			succeeded = true
+		// Client cancellations and slow generations say nothing about the
+		// worker's connection
+		case errors.Is(err, context.Canceled) || errors.Is(err, worker.ErrTimeout):
+		default:
+			failed = true
+		}
+	}
+	if !failed {
+		if succeeded {
+			*failures = 0
+		}
+		return true
+	}
+
+	// Repeated failures usually mean the worker restarted: rebuild the connection
+	*failures++
+	if r.cfg.ReconnectThreshold > 0 && *failures >= r.cfg.ReconnectThreshold {
+		*failures = 0
+		// Another slot of this worker may already be reconnecting
+		if !w.reconnecting.CompareAndSwap(false, true) {
+			return true
+		}
+		defer w.reconnecting.Store(false)
+		if !r.reconnect(w) {
+			return false
+		}
+	}
+	return true
+}
+
+// release hands a request a draining worker won't run back to its queue
+func (r *Router) release(w *managedWorker, req *queue.Request) {
+	if w.queue.Requeue(req) {
+		return
+	}
+	req.ErrorCh <- fmt.Errorf("worker %s drained while queue closed", w.ID)
+	w.queue.Done()
+}
+
+// reconnect takes the worker out of rotation and rebuilds its connection with
+// jittered exponential backoff until a health probe succeeds. A success of
+// the regular health checks ends the wait early, so a worker that comes back
+// is not left out for a long backoff. It returns false if the router shuts
+// down first.
+func (r *Router) reconnect(w *managedWorker) bool {
+	w.SetHealthy(false)
+	select {
+	case <-w.recovered: // left over from an earlier outage
+	default:
+	}
+	backoff := r.cfg.ReconnectBackoff
+
+	for attempt := 1; ; attempt++ {
+		slog.Warn("reconnecting to worker", "worker_id", w.ID, "addr", w.Address, "attempt", attempt)
+
+		err := w.Reconnect()
+		if err == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), r.cfg.HealthCheckTimeout)
+			_, err = w.CheckHealth(ctx)
+			cancel()
+		}
+		if err == nil {
+			w.SetHealthy(true)
+			slog.Info("worker reconnected", "worker_id", w.ID, "attempts", attempt)
+			return true
+		}
+
+		wait := jitter(backoff)
+		slog.Warn("worker reconnect failed", "worker_id", w.ID, "error", err, "attempt", attempt,
+			"backoff", backoff, "max_backoff", r.cfg.ReconnectMaxBackoff, "retry_in", wait)
+		select {
+		case <-r.done:
+			return false
+		case <-w.stop:
+			return false
+		case <-w.recovered:
+			slog.Info("worker reconnected", "worker_id", w.ID, "attempts", attempt)
+			return true
+		case <-time.After(wait):
+		}
+
+		backoff *= 2
+		if r.cfg.ReconnectMaxBackoff > 0 && backoff > r.cfg.ReconnectMaxBackoff {
+			backoff = r.cfg.ReconnectMaxBackoff
+		}
+	}
+}
+
+// jitter picks a wait in [d/2, d], so workers that went down together are not
+// all re-dialed in the same instant
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return d
+	}
+	return d/2 + rand.N(d-d/2)
+}
+
+// waitHealthy blocks while the worker is out of rotation. It returns false if
+// the router is shutting down. Without health checks nothing could bring the
+// worker back, so it is never held out of rotation.
+func (r *Router) waitHealthy(w *managedWorker) bool {
+	for !w.Healthy() && r.cfg.HealthCheckInterval > 0 {
+		select {
+		case <-r.done:
+			return false
+		case <-w.stop:
+			return false
+		case <-time.After(r.cfg.HealthCheckInterval):
+		}
+	}
+	return true
+}
+
+// healthLoop probes a worker on an interval, taking it out of rotation after
+// UnhealthyThreshold consecutive failures and restoring it on the next success
+func (r *Router) healthLoop(w *managedWorker) {
+	ticker := time.NewTicker(r.cfg.HealthCheckInterval)
+	defer ticker.Stop()
+
+	// Learn the worker's models and load right away rather than one interval
+	// in; rotation is left alone until the regular probes
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.HealthCheckTimeout)
+	w.GetInfo(ctx)
+	cancel()
+
+	failures := 0
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), r.cfg.HealthCheckTimeout)
+		_, err := w.CheckHealth(ctx)
+		cancel()
+
+		if err == nil {
+			failures = 0
+			if !w.Healthy() {
+				w.SetHealthy(true)
+				slog.Info("worker recovered", "worker_id", w.ID, "addr", w.Address)
+			}
+			if w.reconnecting.Load() {
+				select {
+				case w.recovered <- struct{}{}:
+				default:
+				}
+			}
+			continue
+		}
+
+		failures++
+		slog.Debug("worker health check failed", "worker_id", w.ID, "failures", failures, "error", err)
+		if failures >= r.cfg.UnhealthyThreshold && w.Healthy() {
+			w.SetHealthy(false)
+			slog.Warn("worker removed from rotation", "worker_id", w.ID, "addr", w.Address, "error", err)
+		}
 	}
 }
 
-// Close shuts down all workers
+// process runs a request, or a batch of them in one call, on a worker,
+// recovering from panics so the worker loop keeps running and queue.Done()
+// is always called. It returns each request's processing error, if any.
+func (r *Router) process(w *managedWorker, reqs []*queue.Request) (errs []error) {
+	requeued := make([]bool, len(reqs))
+	defer func() {
+		for i := range reqs {
+			if !requeued[i] {
+				w.queue.Done()
+				w.finished.Add(1)
+			}
+		}
+	}()
+	defer func() {
+		rec := recover()
+		if rec == nil {
+			return
+		}
+
+		slog.Error("worker panicked while processing request",
+			"worker_id", w.ID,
+			"request_id", reqs[0].ID,
+			"batch_size", len(reqs),
+			"panic", rec,
+			"stack", string(debug.Stack()),
+		)
+		w.SetHealthy(false)
+
+		// Don't leave the clients waiting; ErrorCh is buffered so this won't block
+		errs = make([]error, len(reqs))
+		for i, req := range reqs {
+			errs[i] = fmt.Errorf("worker %s failed: %v", w.ID, rec)
+			select {
+			case req.ErrorCh <- errs[i]:
+			default:
+			}
+		}
+	}()
+
+	start := time.Now()
+	errs = w.ProcessBatch(reqs)
+	// The requests of a batch share one slot, so for the wait estimate each
+	// took its share of the time
+	elapsed := time.Since(start) / time.Duration(len(reqs))
+	for i, req := range reqs {
+		switch errs[i] {
+		case nil:
+			r.observeProcessing(w.queue, elapsed)
+		case worker.ErrRequeue:
+			// Nothing reached the client yet: let another worker try
+			req.Retries++
+			if w.queue.Requeue(req) {
+				requeued[i] = true
+				metrics.InferenceRequeuedTotal.WithLabelValues(req.Model, w.ID).Inc()
+				slog.Info("request requeued after worker failure", "worker_id", w.ID, "request_id", req.ID, "retries", req.Retries)
+				continue
+			}
+			req.ErrorCh <- fmt.Errorf("worker %s failed and queue is closed", w.ID)
+		}
+	}
+	return errs
+}
+
+// Close shuts down all workers, waiting as long as in-flight requests take
 func (r *Router) Close() {
-	// Close the queue first (stops accepting, signals workers)
-	r.queue.Close()
+	r.Shutdown(context.Background())
+}
 
-	// Wait for in-flight requests to complete
-	r.queue.Wait()
+// Shutdown stops accepting requests and waits for the queued and in-flight
+// ones to finish, then closes the worker connections. If ctx ends first, the
+// requests still queued fail with ErrShutdown and the connections are closed
+// anyway, erroring the streams still running; Shutdown then returns ctx's
+// error without waiting further.
+func (r *Router) Shutdown(ctx context.Context) error {
+	// Stop health checks and release workers idling while unhealthy
+	close(r.done)
+
+	// Close the queues first (stops accepting, signals workers)
+	r.queues.Close()
+
+	// Barrier: launch holds mu, so no loop starts after this point
+	r.mu.Lock()
+	r.mu.Unlock()
+
+	// Wait for in-flight requests to complete. Once every loop has stopped
+	// nothing pops any more, so requests left behind (e.g. all of a queue's
+	// workers were unhealthy) would otherwise wait forever.
+	drained := make(chan struct{})
+	go func() {
+		r.loops.Wait()
+		if n := r.queues.Abort(ErrShutdown); n > 0 {
+			slog.Warn("no workers left to drain queued requests", "aborted", n)
+		}
+		r.queues.Wait()
+		close(drained)
+	}()
+
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+		aborted := r.queues.Abort(ErrShutdown)
+		slog.Warn("drain timed out, closing workers with requests in flight", "aborted", aborted, "error", err)
+	}
 
 	// Close worker connections
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	for _, w := range r.workers {
 		w.Close()
 	}
 	slog.Info("all workers stopped")
+	return err
 }
@@ -0,0 +1,780 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/aluko123/go-network-proxy/inference/pb"
+	"github.com/aluko123/go-network-proxy/inference/queue"
+	"github.com/aluko123/go-network-proxy/inference/worker"
+	"github.com/aluko123/go-network-proxy/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeWorker is an in-process gRPC model server whose health can be toggled
+type fakeWorker struct {
+	pb.UnimplementedModelServiceServer
+	healthy  atomic.Bool
+	failures atomic.Int32  // Generate calls left to fail before streaming
+	calls    atomic.Int32  // Generate calls received
+	release  chan struct{} // if set, Generate blocks until it is closed
+	aborted  atomic.Int32  // blocked Generate calls ended by the caller cancelling
+}
+
+func (f *fakeWorker) Health(context.Context, *pb.HealthRequest) (*pb.HealthResponse, error) {
+	return &pb.HealthResponse{Healthy: f.healthy.Load()}, nil
+}
+
+func (f *fakeWorker) Generate(req *pb.GenerateRequest, stream grpc.ServerStreamingServer[pb.TokenResponse]) error {
+	f.calls.Add(1)
+	if f.release != nil {
+		select {
+		case <-f.release:
+		case <-stream.Context().Done():
+			f.aborted.Add(1)
+			return stream.Context().Err()
+		}
+	}
+	if f.failures.Load() > 0 {
+		f.failures.Add(-1)
+		return status.Error(codes.Unavailable, "worker overloaded")
+	}
+	return stream.Send(&pb.TokenResponse{RequestId: req.RequestId, Token: "ok", TokenCount: 1, Finished: true})
+}
+
+// startFakeWorker serves f on a random localhost port and returns its address
+func startFakeWorker(t *testing.T, f pb.ModelServiceServer) string {
+	t.Helper()
+	addr, _ := serveFakeWorker(t, f, "127.0.0.1:0")
+	return addr
+}
+
+// serveFakeWorker serves f on addr and returns the bound address and server
+func serveFakeWorker(t *testing.T, f pb.ModelServiceServer, addr string) (string, *grpc.Server) {
+	t.Helper()
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := grpc.NewServer()
+	pb.RegisterModelServiceServer(srv, f)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return lis.Addr().String(), srv
+}
+
+// waitFor polls cond until it holds or the timeout expires
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) bool {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return cond()
+}
+
+func newTestRequest(id string) *queue.Request {
+	return &queue.Request{
+		ID:         id,
+		Priority:   1,
+		SubmitTime: time.Now(),
+		ResponseCh: make(chan *pb.TokenResponse, 10),
+		ErrorCh:    make(chan error, 1),
+	}
+}
+
+func TestRouter_WorkerLoopRecoversFromPanic(t *testing.T) {
+	pq := queue.NewPriorityQueue(0)
+
+	// A client without a gRPC connection panics inside ProcessRequest
+	w := &worker.Client{ID: "broken"}
+	w.SetHealthy(true)
+
+	r := &Router{
+		workers: []*managedWorker{{Client: w, queue: pq, weight: 1}},
+		queues:  queue.NewModelQueues(pq),
+	}
+	r.Start()
+
+	reqs := []*queue.Request{newTestRequest("a"), newTestRequest("b")}
+	for _, req := range reqs {
+		pq.Push(req)
+	}
+
+	// Both requests must get an error: the loop survives the first panic
+	for _, req := range reqs {
+		select {
+		case err := <-req.ErrorCh:
+			if err == nil {
+				t.Errorf("request %s: expected error, got nil", req.ID)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("request %s: no error delivered after worker panic", req.ID)
+		}
+	}
+
+	if w.Healthy() {
+		t.Error("expected worker to be marked unhealthy after panic")
+	}
+
+	// Inflight accounting must be balanced so Wait returns
+	pq.Close()
+	done := make(chan struct{})
+	go func() {
+		pq.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("queue.Wait blocked: Done was not called for panicked requests")
+	}
+}
+
+func TestRouter_HealthChecksRemoveAndRestoreWorker(t *testing.T) {
+	fw := &fakeWorker{}
+	fw.healthy.Store(true)
+	addr := startFakeWorker(t, fw)
+
+	SetConfig(Config{
+		HealthCheckInterval: 10 * time.Millisecond,
+		HealthCheckTimeout:  time.Second,
+		UnhealthyThreshold:  2,
+	})
+	defer SetConfig(DefaultConfig())
+
+	pq := queue.NewPriorityQueue(0)
+	r, err := NewRouter([]string{addr}, pq, nil)
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+	r.Start()
+	defer r.Close()
+
+	w := r.workers[0]
+	if r.HealthyWorkers(pq) != 1 {
+		t.Fatalf("expected 1 healthy worker, got %d", r.HealthyWorkers(pq))
+	}
+	healthyGauge := testutil.ToFloat64(metrics.InferenceHealthyWorkers)
+
+	fw.healthy.Store(false)
+	if !waitFor(t, time.Second, func() bool { return !w.Healthy() }) {
+		t.Fatal("expected worker to be marked unhealthy after failed probes")
+	}
+	if n := r.HealthyWorkers(nil); n != 0 {
+		t.Errorf("expected no healthy workers, got %d", n)
+	}
+	if got := testutil.ToFloat64(metrics.InferenceHealthyWorkers); got != healthyGauge-1 {
+		t.Errorf("inference_healthy_workers = %v, want %v", got, healthyGauge-1)
+	}
+
+	// While unhealthy the worker must not pull from the queue
+	req := newTestRequest("queued")
+	pq.Push(req)
+	time.Sleep(50 * time.Millisecond)
+	if pq.Len() != 1 {
+		t.Fatalf("unhealthy worker pulled a request (len=%d)", pq.Len())
+	}
+
+	fw.healthy.Store(true)
+	if !waitFor(t, time.Second, func() bool { return w.Healthy() }) {
+		t.Fatal("expected worker to recover after a successful probe")
+	}
+	if n := r.HealthyWorkers(pq); n != 1 {
+		t.Errorf("expected the recovered worker to count as healthy, got %d", n)
+	}
+
+	select {
+	case resp := <-req.ResponseCh:
+		if resp == nil || resp.Token != "ok" {
+			t.Errorf("unexpected response: %v", resp)
+		}
+	case err := <-req.ErrorCh:
+		t.Fatalf("unexpected error: %v", err)
+	case <-time.After(time.Second):
+		t.Fatal("recovered worker did not process the queued request")
+	}
+}
+
+func TestRouter_ReconnectsAfterWorkerRestart(t *testing.T) {
+	fw := &fakeWorker{}
+	fw.healthy.Store(true)
+	addr, srv := serveFakeWorker(t, fw, "127.0.0.1:0")
+
+	SetConfig(Config{
+		HealthCheckTimeout:  time.Second,
+		ReconnectThreshold:  2,
+		ReconnectBackoff:    10 * time.Millisecond,
+		ReconnectMaxBackoff: 20 * time.Millisecond,
+	})
+	defer SetConfig(DefaultConfig())
+
+	// Surface every failure to the client so the test can count them
+	worker.SetConfig(worker.Config{InferenceTimeout: time.Second})
+	defer worker.SetConfig(worker.DefaultConfig())
+
+	pq := queue.NewPriorityQueue(0)
+	r, err := NewRouter([]string{addr}, pq, nil)
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+	r.Start()
+	defer r.Close()
+	w := r.workers[0]
+
+	// Worker goes away: requests fail until the reconnect threshold is hit
+	srv.Stop()
+	for _, id := range []string{"fail-1", "fail-2"} {
+		req := newTestRequest(id)
+		pq.Push(req)
+		select {
+		case <-req.ErrorCh:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("request %s: expected error while worker is down", id)
+		}
+	}
+	if !waitFor(t, time.Second, func() bool { return !w.Healthy() }) {
+		t.Fatal("expected worker to leave rotation while reconnecting")
+	}
+
+	// Worker comes back on the same address
+	serveFakeWorker(t, fw, addr)
+	if !waitFor(t, 2*time.Second, func() bool { return w.Healthy() }) {
+		t.Fatal("expected worker to reconnect after restart")
+	}
+
+	req := newTestRequest("after-restart")
+	pq.Push(req)
+	select {
+	case resp := <-req.ResponseCh:
+		if resp == nil || resp.Token != "ok" {
+			t.Errorf("unexpected response: %v", resp)
+		}
+	case err := <-req.ErrorCh:
+		t.Fatalf("unexpected error after reconnect: %v", err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("reconnected worker did not process request")
+	}
+}
+
+func TestRouter_HealthCheckEndsReconnectBackoff(t *testing.T) {
+	fw := &fakeWorker{}
+	fw.healthy.Store(true)
+	addr, srv := serveFakeWorker(t, fw, "127.0.0.1:0")
+
+	// A backoff far longer than the test: only the health checks can end it
+	SetConfig(Config{
+		HealthCheckInterval: 20 * time.Millisecond,
+		HealthCheckTimeout:  time.Second,
+		UnhealthyThreshold:  100,
+		ReconnectThreshold:  1,
+		ReconnectBackoff:    time.Hour,
+		ReconnectMaxBackoff: time.Hour,
+	})
+	defer SetConfig(DefaultConfig())
+	worker.SetConfig(worker.Config{InferenceTimeout: time.Second})
+	defer worker.SetConfig(worker.DefaultConfig())
+
+	pq := queue.NewPriorityQueue(0)
+	r, err := NewRouter([]string{addr}, pq, nil)
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+	r.Start()
+	defer r.Close()
+	w := r.workers[0]
+
+	srv.Stop()
+	req := newTestRequest("fail")
+	pq.Push(req)
+	select {
+	case <-req.ErrorCh:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected error while worker is down")
+	}
+	if !waitFor(t, time.Second, func() bool { return w.reconnecting.Load() && !w.Healthy() }) {
+		t.Fatal("expected worker to be reconnecting")
+	}
+
+	// The only loop is waiting out the backoff; the request runs once the
+	// worker is back only if the health check cuts the wait short
+	serveFakeWorker(t, fw, addr)
+	req = newTestRequest("after-restart")
+	pq.Push(req)
+	select {
+	case resp := <-req.ResponseCh:
+		if resp == nil || resp.Token != "ok" {
+			t.Errorf("unexpected response: %v", resp)
+		}
+	case err := <-req.ErrorCh:
+		t.Fatalf("unexpected error after recovery: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("recovered worker was left waiting out its backoff")
+	}
+}
+
+func TestJitter(t *testing.T) {
+	for range 100 {
+		if d := jitter(time.Second); d < 500*time.Millisecond || d > time.Second {
+			t.Fatalf("jitter(1s) = %s, want within [500ms, 1s]", d)
+		}
+	}
+	if d := jitter(0); d != 0 {
+		t.Errorf("jitter(0) = %s", d)
+	}
+}
+
+// batchWorker is a fakeWorker that also serves BatchGenerate, reporting the
+// size of each batch
+type batchWorker struct {
+	*fakeWorker
+	sizes chan int
+}
+
+func (b *batchWorker) BatchGenerate(batch *pb.BatchGenerateRequest, stream grpc.ServerStreamingServer[pb.TokenResponse]) error {
+	b.sizes <- len(batch.Requests)
+	for _, req := range batch.Requests {
+		if err := stream.Send(&pb.TokenResponse{RequestId: req.RequestId, Token: "ok", TokenCount: 1, Finished: true}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestRouter_BatchesRequestsForOneModel(t *testing.T) {
+	bw := &batchWorker{fakeWorker: &fakeWorker{}, sizes: make(chan int, 10)}
+	bw.healthy.Store(true)
+	addr := startFakeWorker(t, bw)
+
+	SetConfig(Config{BatchSize: 4, BatchWindow: 50 * time.Millisecond})
+	defer SetConfig(DefaultConfig())
+
+	pq := queue.NewPriorityQueue(0)
+	r, err := NewRouter([]string{addr}, pq, nil)
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+	var reqs []*queue.Request
+	for _, id := range []string{"a", "b", "c"} {
+		req := newTestRequest(id)
+		req.Model = "m"
+		pq.Push(req)
+		reqs = append(reqs, req)
+	}
+	r.Start()
+	defer r.Close()
+
+	for _, req := range reqs {
+		select {
+		case resp := <-req.ResponseCh:
+			if resp == nil || resp.RequestId != req.ID {
+				t.Errorf("request %s got %v", req.ID, resp)
+			}
+		case err := <-req.ErrorCh:
+			t.Fatalf("request %s: %v", req.ID, err)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("request %s not answered", req.ID)
+		}
+	}
+	if size := <-bw.sizes; size != 3 {
+		t.Errorf("expected one batch of 3, got a batch of %d", size)
+	}
+	if calls := bw.calls.Load(); calls != 0 {
+		t.Errorf("expected no single Generate calls, got %d", calls)
+	}
+}
+
+// newRetryRouter starts a single-worker router against fw with reconnection
+// disabled and the given retry budget
+func newRetryRouter(t *testing.T, fw *fakeWorker, maxRetries int) (*Router, *queue.PriorityQueue) {
+	t.Helper()
+	addr := startFakeWorker(t, fw)
+
+	SetConfig(Config{ReconnectThreshold: 0})
+	t.Cleanup(func() { SetConfig(DefaultConfig()) })
+	worker.SetConfig(worker.Config{InferenceTimeout: time.Second, MaxRetries: maxRetries})
+	t.Cleanup(func() { worker.SetConfig(worker.DefaultConfig()) })
+
+	pq := queue.NewPriorityQueue(0)
+	r, err := NewRouter([]string{addr}, pq, nil)
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+	r.Start()
+	t.Cleanup(r.Close)
+	return r, pq
+}
+
+func TestRouter_RequeuesFailureBeforeFirstToken(t *testing.T) {
+	fw := &fakeWorker{}
+	fw.healthy.Store(true)
+	fw.failures.Store(1)
+	_, pq := newRetryRouter(t, fw, 2)
+
+	req := newTestRequest("retry-me")
+	pq.Push(req)
+
+	select {
+	case resp := <-req.ResponseCh:
+		if resp == nil || resp.Token != "ok" {
+			t.Errorf("unexpected response: %v", resp)
+		}
+	case err := <-req.ErrorCh:
+		t.Fatalf("client saw an error despite retries left: %v", err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("requeued request was never processed")
+	}
+	if req.Retries != 1 {
+		t.Errorf("expected 1 retry, got %d", req.Retries)
+	}
+}
+
+func TestRouter_RetriesAreBounded(t *testing.T) {
+	fw := &fakeWorker{}
+	fw.healthy.Store(true)
+	fw.failures.Store(100)
+	_, pq := newRetryRouter(t, fw, 2)
+
+	req := newTestRequest("always-fails")
+	pq.Push(req)
+
+	select {
+	case err := <-req.ErrorCh:
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("request was retried forever")
+	}
+	if req.Retries != 2 {
+		t.Errorf("expected 2 retries before giving up, got %d", req.Retries)
+	}
+}
+
+func TestRouter_MaxConcurrentCapsWorkerSlots(t *testing.T) {
+	SetConfig(Config{})
+	defer SetConfig(DefaultConfig())
+	worker.SetConfig(worker.Config{InferenceTimeout: 5 * time.Second, MaxConcurrent: 2})
+	defer worker.SetConfig(worker.DefaultConfig())
+
+	fw := &fakeWorker{release: make(chan struct{})}
+	fw.healthy.Store(true)
+	addr := startFakeWorker(t, fw)
+
+	pq := queue.NewPriorityQueue(0)
+	r, err := NewRouter([]string{addr}, pq, nil)
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+	r.Start()
+	defer r.Close()
+
+	reqs := []*queue.Request{newTestRequest("a"), newTestRequest("b"), newTestRequest("c")}
+	for _, req := range reqs {
+		pq.Push(req)
+	}
+
+	if !waitFor(t, 2*time.Second, func() bool { return fw.calls.Load() == 2 }) {
+		t.Fatalf("expected 2 concurrent requests, got %d", fw.calls.Load())
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := fw.calls.Load(); got != 2 {
+		t.Fatalf("expected third request to wait for a free slot, got %d calls", got)
+	}
+
+	close(fw.release)
+	for _, req := range reqs {
+		select {
+		case <-req.ResponseCh:
+		case err := <-req.ErrorCh:
+			t.Fatalf("request %s: %v", req.ID, err)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("request %s: timed out", req.ID)
+		}
+	}
+}
+
+func TestRouter_DrainWorkerFinishesInFlightAndHotSwaps(t *testing.T) {
+	SetConfig(Config{})
+	defer SetConfig(DefaultConfig())
+
+	t.Run("pull", func(t *testing.T) { testDrainAndHotSwap(t, nil) })
+	t.Run("least-conn", func(t *testing.T) { testDrainAndHotSwap(t, LeastConnections{}) })
+}
+
+func testDrainAndHotSwap(t *testing.T, balancer Balancer) {
+
+	old := &fakeWorker{release: make(chan struct{})}
+	old.healthy.Store(true)
+	oldAddr := startFakeWorker(t, old)
+
+	pq := queue.NewPriorityQueue(0)
+	r, err := NewRouter([]string{oldAddr}, pq, balancer)
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+	r.Start()
+	defer r.Close()
+
+	inflight := newTestRequest("in-flight")
+	pq.Push(inflight)
+	if !waitFor(t, 2*time.Second, func() bool { return old.calls.Load() == 1 }) {
+		t.Fatal("old worker never received the request")
+	}
+
+	drained := make(chan error, 1)
+	go func() { drained <- r.DrainWorker("worker-0") }()
+
+	// New requests go to the replacement while the old worker finishes
+	replacement := &fakeWorker{}
+	replacement.healthy.Store(true)
+	id, err := r.AddWorker("", startFakeWorker(t, replacement))
+	if err != nil {
+		t.Fatalf("AddWorker: %v", err)
+	}
+	if id != "worker-1" {
+		t.Errorf("expected ID worker-1, got %s", id)
+	}
+
+	next := newTestRequest("next")
+	pq.Push(next)
+	select {
+	case <-next.ResponseCh:
+	case err := <-next.ErrorCh:
+		t.Fatalf("next request: %v", err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("next request was not served by the replacement worker")
+	}
+
+	select {
+	case err := <-drained:
+		t.Fatalf("DrainWorker returned before in-flight request finished: %v", err)
+	default:
+	}
+
+	close(old.release)
+	select {
+	case <-inflight.ResponseCh:
+	case err := <-inflight.ErrorCh:
+		t.Fatalf("in-flight request: %v", err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("in-flight request did not complete")
+	}
+	select {
+	case err := <-drained:
+		if err != nil {
+			t.Fatalf("DrainWorker: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("DrainWorker did not return after in-flight request finished")
+	}
+
+	if got := old.calls.Load(); got != 1 {
+		t.Errorf("expected drained worker to get no new requests, got %d calls", got)
+	}
+	if err := r.DrainWorker("worker-0"); err == nil {
+		t.Error("expected error draining an already removed worker")
+	}
+}
+
+func TestRouter_AddRemoveWorkerErrors(t *testing.T) {
+	SetConfig(Config{})
+	defer SetConfig(DefaultConfig())
+
+	fw := &fakeWorker{}
+	fw.healthy.Store(true)
+	addr := startFakeWorker(t, fw)
+
+	pq := queue.NewPriorityQueue(0)
+	r, err := NewRouter([]string{addr}, pq, nil)
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+	r.Start()
+	defer r.Close()
+
+	if _, err := r.AddWorker("worker-0", addr); !errors.Is(err, ErrDuplicateWorker) {
+		t.Errorf("expected ErrDuplicateWorker, got %v", err)
+	}
+	if err := r.RemoveWorker("missing"); !errors.Is(err, ErrUnknownWorker) {
+		t.Errorf("expected ErrUnknownWorker, got %v", err)
+	}
+
+	if _, err := r.AddWorker("extra", addr); err != nil {
+		t.Fatalf("AddWorker: %v", err)
+	}
+	if err := r.RemoveWorker("extra"); err != nil {
+		t.Fatalf("RemoveWorker: %v", err)
+	}
+
+	// The remaining worker still serves requests
+	req := newTestRequest("after-remove")
+	pq.Push(req)
+	select {
+	case <-req.ResponseCh:
+	case err := <-req.ErrorCh:
+		t.Fatalf("request: %v", err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("request not served after removing a worker")
+	}
+}
+
+func TestRouter_ClientCancelAbortsWorkerStream(t *testing.T) {
+	SetConfig(Config{ReconnectThreshold: 1})
+	defer SetConfig(DefaultConfig())
+
+	fw := &fakeWorker{release: make(chan struct{})}
+	fw.healthy.Store(true)
+	addr := startFakeWorker(t, fw)
+
+	pq := queue.NewPriorityQueue(0)
+	r, err := NewRouter([]string{addr}, pq, nil)
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+	r.Start()
+	defer r.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := newTestRequest("cancel-me")
+	req.Ctx = ctx
+	pq.Push(req)
+
+	if !waitFor(t, 2*time.Second, func() bool { return fw.calls.Load() == 1 }) {
+		t.Fatal("worker never received the request")
+	}
+	cancel()
+
+	if !waitFor(t, 2*time.Second, func() bool { return fw.aborted.Load() == 1 }) {
+		t.Fatal("worker stream was not cancelled after the client went away")
+	}
+	select {
+	case err := <-req.ErrorCh:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no error delivered for cancelled request")
+	}
+
+	// Not requeued, and not counted against the worker
+	if got := fw.calls.Load(); got != 1 {
+		t.Errorf("expected cancelled request not to be retried, got %d calls", got)
+	}
+	if !r.workers[0].Healthy() {
+		t.Error("client cancellation should not trigger a reconnect")
+	}
+}
+
+func TestRouter_ShutdownGivesUpAfterDeadline(t *testing.T) {
+	// A worker that never finishes: without a deadline the drain hangs
+	fw := &fakeWorker{release: make(chan struct{})}
+	fw.healthy.Store(true)
+	addr := startFakeWorker(t, fw)
+
+	pq := queue.NewPriorityQueue(0)
+	r, err := NewRouter([]string{addr}, pq, nil)
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+	r.Start()
+
+	running := newTestRequest("running")
+	queued := newTestRequest("queued")
+	pq.Push(running)
+	if !waitFor(t, 2*time.Second, func() bool { return fw.calls.Load() == 1 }) {
+		t.Fatal("worker never received the request")
+	}
+	pq.Push(queued)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- r.Shutdown(ctx) }()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected DeadlineExceeded, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Shutdown did not return after its deadline")
+	}
+
+	select {
+	case err := <-queued.ErrorCh:
+		if !errors.Is(err, ErrShutdown) {
+			t.Errorf("expected ErrShutdown for the queued request, got %v", err)
+		}
+	default:
+		t.Error("queued request was not failed")
+	}
+	select {
+	case err := <-running.ErrorCh:
+		if err == nil {
+			t.Error("expected an error for the in-flight request")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("in-flight request was not failed after its worker was closed")
+	}
+	if pq.Len() != 0 {
+		t.Errorf("expected an empty queue, %d left", pq.Len())
+	}
+}
+
+func TestRouter_CloseFailsRequestsNoWorkerCanTake(t *testing.T) {
+	for _, balancer := range []Balancer{nil, &RoundRobin{}} {
+		fw := &fakeWorker{}
+		addr := startFakeWorker(t, fw)
+
+		SetConfig(Config{
+			HealthCheckInterval: 10 * time.Millisecond,
+			HealthCheckTimeout:  time.Second,
+			UnhealthyThreshold:  1,
+		})
+
+		pq := queue.NewPriorityQueue(0)
+		r, err := NewRouter([]string{addr}, pq, balancer)
+		if err != nil {
+			t.Fatalf("NewRouter: %v", err)
+		}
+		// Out of rotation from the start, and its probes keep it there
+		r.workers[0].SetHealthy(false)
+		r.Start()
+
+		// Nobody will ever pop this one: Close must answer it rather than
+		// wait for it forever
+		req := newTestRequest("stranded")
+		pq.Push(req)
+
+		closed := make(chan struct{})
+		go func() {
+			r.Close()
+			close(closed)
+		}()
+		select {
+		case <-closed:
+		case <-time.After(2 * time.Second):
+			t.Fatal("Close hung on a request no worker could take")
+		}
+		select {
+		case err := <-req.ErrorCh:
+			if !errors.Is(err, ErrShutdown) {
+				t.Errorf("expected ErrShutdown, got %v", err)
+			}
+		default:
+			t.Error("stranded request was not failed")
+		}
+		SetConfig(DefaultConfig())
+	}
+}
@@ -0,0 +1,35 @@
+package router
+
+// WorkerStatus is a read-only view of one worker, for dashboards
+type WorkerStatus struct {
+	ID       string `json:"id"`
+	Address  string `json:"address"`
+	Queue    string `json:"queue"`
+	Healthy  bool   `json:"healthy"`
+	InFlight int    `json:"in_flight"` // requests the worker is running now
+	Capacity int    `json:"capacity"`  // requests it may run at once (weight x MaxConcurrent)
+	// Requests the worker has finished since it joined, whatever their
+	// outcome; those handed back to the queue for another worker don't count
+	Processed int64 `json:"processed"`
+}
+
+// Workers reports every worker in the order they were added. Workers being
+// drained are left out.
+func (r *Router) Workers() []WorkerStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	out := make([]WorkerStatus, 0, len(r.workers))
+	for _, w := range r.workers {
+		out = append(out, WorkerStatus{
+			ID:        w.ID,
+			Address:   w.Address,
+			Queue:     w.queue.Name(),
+			Healthy:   w.Healthy(),
+			InFlight:  int(w.inflight.Load()),
+			Capacity:  w.capacity(),
+			Processed: w.finished.Load(),
+		})
+	}
+	return out
+}
@@ -0,0 +1,63 @@
+package router
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aluko123/go-network-proxy/inference/queue"
+)
+
+func TestRouter_Workers(t *testing.T) {
+	fw := &fakeWorker{}
+	fw.healthy.Store(true)
+	addr := startFakeWorker(t, fw)
+
+	SetConfig(Config{})
+	defer SetConfig(DefaultConfig())
+
+	pq := queue.NewPriorityQueue(0)
+	r, err := NewRouter([]string{addr, addr + "=2"}, pq, nil)
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+	r.Start()
+	defer r.Close()
+
+	ws := r.Workers()
+	if len(ws) != 2 {
+		t.Fatalf("expected 2 workers, got %+v", ws)
+	}
+	want := WorkerStatus{ID: "worker-1", Address: addr, Queue: "default", Healthy: true, Capacity: 2}
+	if ws[1] != want {
+		t.Errorf("second worker = %+v, want %+v", ws[1], want)
+	}
+
+	for _, id := range []string{"r1", "r2", "r3"} {
+		req := newTestRequest(id)
+		pq.Push(req)
+		select {
+		case <-req.ResponseCh:
+		case err := <-req.ErrorCh:
+			t.Fatalf("request %s: %v", id, err)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("request %s not answered", id)
+		}
+	}
+	total := func() int64 {
+		var n int64
+		for _, w := range r.Workers() {
+			n += w.Processed
+		}
+		return n
+	}
+	if !waitFor(t, time.Second, func() bool { return total() == 3 }) {
+		t.Errorf("expected 3 processed across workers, got %d", total())
+	}
+
+	if err := r.RemoveWorker("worker-0"); err != nil {
+		t.Fatal(err)
+	}
+	if ws := r.Workers(); len(ws) != 1 || ws[0].ID != "worker-1" {
+		t.Errorf("removed worker still listed: %+v", ws)
+	}
+}
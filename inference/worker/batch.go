@@ -0,0 +1,221 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/aluko123/go-network-proxy/inference/pb"
+	"github.com/aluko123/go-network-proxy/inference/queue"
+	"github.com/aluko123/go-network-proxy/pkg/metrics"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// batchItem is one request of a BatchGenerate call
+type batchItem struct {
+	req    *queue.Request
+	parent context.Context // the client's context
+	err    *error          // the request's entry in ProcessBatch's result
+	status string          // metrics status, once the outcome is known
+	sent   bool            // a token reached the client
+	done   bool            // the outcome was delivered
+}
+
+// ProcessBatch runs requests for one model in a single BatchGenerate call,
+// handing each streamed token to its request by request_id. It returns one
+// error per request, with the meaning ProcessRequest's has. A lone request,
+// and every request for a worker without BatchGenerate, goes through
+// ProcessRequest instead.
+func (c *Client) ProcessBatch(reqs []*queue.Request) []error {
+	errs := make([]error, len(reqs))
+	if len(reqs) == 1 {
+		errs[0] = c.ProcessRequest(reqs[0])
+		return errs
+	}
+	if c.single.Load() {
+		c.processEach(reqs, errs)
+		return errs
+	}
+
+	var items []*batchItem
+	byID := make(map[string]*batchItem, len(reqs))
+	var rest []int // requests that share an ID with another: their tokens could not be told apart
+	for i, req := range reqs {
+		parent := req.Ctx
+		if parent == nil {
+			parent = context.Background()
+		}
+		req.StartTime = time.Now()
+		if parent.Err() != nil {
+			// Client already gone while the request waited in the queue
+			errs[i] = c.cancelled(req, parent)
+			metrics.InferenceQueueWaitDuration.WithLabelValues(req.Model, metrics.PriorityLabel(req.Priority), "cancelled").Observe(req.StartTime.Sub(req.SubmitTime).Seconds())
+			continue
+		}
+		if _, dup := byID[req.ID]; dup {
+			rest = append(rest, i)
+			continue
+		}
+		it := &batchItem{req: req, parent: parent, err: &errs[i]}
+		items = append(items, it)
+		byID[req.ID] = it
+	}
+	if len(rest) > 0 {
+		defer func() {
+			more := make([]*queue.Request, len(rest))
+			for j, i := range rest {
+				more[j] = reqs[i]
+			}
+			moreErrs := make([]error, len(more))
+			c.processEach(more, moreErrs)
+			for j, i := range rest {
+				errs[i] = moreErrs[j]
+			}
+		}()
+	}
+	if len(items) == 0 {
+		return errs
+	}
+
+	model := items[0].req.Model
+	timeout := timeoutFor(model)
+	// The call joins the first request's trace but outlives its client: it is
+	// only cancelled once every client has gone
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(items[0].parent), timeout)
+	defer cancel()
+	var remaining atomic.Int32
+	remaining.Store(int32(len(items)))
+	rpcReq := &pb.BatchGenerateRequest{}
+	for _, it := range items {
+		stop := context.AfterFunc(it.parent, func() {
+			if remaining.Add(-1) == 0 {
+				cancel()
+			}
+		})
+		defer stop()
+		rpcReq.Requests = append(rpcReq.Requests, &pb.GenerateRequest{
+			RequestId:   it.req.ID,
+			Model:       it.req.Model,
+			Prompt:      it.req.Prompt,
+			MaxTokens:   int32(it.req.MaxTokens),
+			Temperature: it.req.Temperature,
+			Priority:    int32(it.req.Priority),
+			Stop:        it.req.Stop,
+			Seed:        it.req.Seed,
+		})
+	}
+
+	received := false
+	stream, err := c.rpc().BatchGenerate(ctx, rpcReq)
+	for err == nil {
+		var resp *pb.TokenResponse
+		if resp, err = stream.Recv(); err != nil {
+			break
+		}
+		received = true
+		it := byID[resp.RequestId]
+		if it == nil {
+			slog.Warn("batch response for unknown request", "worker_id", c.ID, "request_id", resp.RequestId)
+			continue
+		}
+		if it.done {
+			continue
+		}
+		// Forward token; drop the request if its client left. A client that
+		// reads slowly holds up the batch only once its ResponseCh is full.
+		select {
+		case it.req.ResponseCh <- resp:
+			it.sent = true
+		case <-it.parent.Done():
+		}
+		if it.parent.Err() != nil {
+			it.status = "cancelled"
+			*it.err = c.cancelled(it.req, it.parent)
+			it.done = true
+			continue
+		}
+		if resp.Finished {
+			close(it.req.ResponseCh)
+			it.status = "success"
+			it.done = true
+		}
+	}
+
+	// Workers that predate BatchGenerate get the requests one at a time
+	if !received && status.Code(err) == codes.Unimplemented {
+		slog.Info("worker does not implement BatchGenerate, sending requests one at a time", "worker_id", c.ID)
+		c.single.Store(true)
+		pending := make([]*queue.Request, len(items))
+		pendingErrs := make([]error, len(items))
+		for j, it := range items {
+			pending[j] = it.req
+		}
+		c.processEach(pending, pendingErrs)
+		for j, it := range items {
+			*it.err = pendingErrs[j]
+		}
+		return errs
+	}
+
+	metrics.InferenceBatchSize.WithLabelValues(model, c.ID).Observe(float64(len(items)))
+	code := errorCode(err)
+	logged := false
+	for _, it := range items {
+		if !it.done {
+			switch {
+			case it.parent.Err() != nil:
+				it.status = "cancelled"
+				*it.err = c.cancelled(it.req, it.parent)
+			case err == io.EOF:
+				close(it.req.ResponseCh)
+				it.status = "success"
+			case errors.Is(ctx.Err(), context.DeadlineExceeded):
+				it.status = "timeout"
+				*it.err = c.timedOut(it.req, timeout)
+			default:
+				if !logged {
+					slog.Error("batch stream broken", "worker_id", c.ID, "code", code, "batch_size", len(items), "error", err)
+					logged = true
+				}
+				metrics.InferenceWorkerErrors.WithLabelValues(c.ID, code).Inc()
+				*it.err = c.fail(it.req, err, it.sent)
+				it.status = failureStatus(*it.err, code)
+			}
+		}
+		req := it.req
+		metrics.InferenceQueueWaitDuration.WithLabelValues(req.Model, metrics.PriorityLabel(req.Priority), it.status).Observe(req.StartTime.Sub(req.SubmitTime).Seconds())
+		metrics.InferenceProcessingDuration.WithLabelValues(req.Model, c.ID, it.status).Observe(time.Since(req.StartTime).Seconds())
+		metrics.InferenceWorkerRequestsTotal.WithLabelValues(c.ID, it.status).Inc()
+	}
+	return errs
+}
+
+// processEach runs reqs side by side, one ProcessRequest call each, storing
+// their errors in errs. A panic in any call is raised again in the caller's
+// goroutine once all have returned.
+func (c *Client) processEach(reqs []*queue.Request, errs []error) {
+	var wg sync.WaitGroup
+	var once sync.Once
+	var panicked any
+	for i, req := range reqs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if rec := recover(); rec != nil {
+					once.Do(func() { panicked = rec })
+				}
+			}()
+			errs[i] = c.ProcessRequest(req)
+		}()
+	}
+	wg.Wait()
+	if panicked != nil {
+		panic(panicked)
+	}
+}
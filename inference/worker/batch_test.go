@@ -0,0 +1,149 @@
+package worker
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	pb "github.com/aluko123/go-network-proxy/inference/pb"
+	"github.com/aluko123/go-network-proxy/inference/queue"
+	"github.com/aluko123/go-network-proxy/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// batchServer answers BatchGenerate with each request's prompt as its token,
+// interleaving the requests and finishing them in reverse order. For the
+// "broken" model it fails after the first request's token.
+type batchServer struct {
+	pb.UnimplementedModelServiceServer
+}
+
+func (s *batchServer) BatchGenerate(batch *pb.BatchGenerateRequest, stream pb.ModelService_BatchGenerateServer) error {
+	for i, req := range batch.Requests {
+		if err := stream.Send(&pb.TokenResponse{RequestId: req.RequestId, Token: req.Prompt}); err != nil {
+			return err
+		}
+		if i == 0 && req.Model == "broken" {
+			return status.Error(codes.Internal, "model failed")
+		}
+	}
+	for i := len(batch.Requests) - 1; i >= 0; i-- {
+		if err := stream.Send(&pb.TokenResponse{RequestId: batch.Requests[i].RequestId, Finished: true}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serve starts srv on a random localhost port and returns a client for it
+func serve(t *testing.T, id string, srv pb.ModelServiceServer) *Client {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := grpc.NewServer()
+	pb.RegisterModelServiceServer(s, srv)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	c, err := NewClient(id, lis.Addr().String())
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func newBatch(model string, ids ...string) []*queue.Request {
+	var reqs []*queue.Request
+	for _, id := range ids {
+		reqs = append(reqs, &queue.Request{
+			ID:         id,
+			Model:      model,
+			Prompt:     "prompt-" + id,
+			SubmitTime: time.Now(),
+			ResponseCh: make(chan *pb.TokenResponse, 10),
+			ErrorCh:    make(chan error, 1),
+		})
+	}
+	return reqs
+}
+
+// tokens drains a finished request's ResponseCh
+func tokens(req *queue.Request) []string {
+	var out []string
+	for resp := range req.ResponseCh {
+		out = append(out, resp.Token)
+	}
+	return out
+}
+
+func TestProcessBatch_DemuxesByRequestID(t *testing.T) {
+	c := serve(t, "batch-w", &batchServer{})
+
+	reqs := newBatch("m", "a", "b", "c")
+	for i, err := range c.ProcessBatch(reqs) {
+		if err != nil {
+			t.Errorf("request %d: %v", i, err)
+		}
+	}
+	for _, req := range reqs {
+		got := tokens(req)
+		if len(got) != 2 || got[0] != req.Prompt || got[1] != "" {
+			t.Errorf("request %s got tokens %q", req.ID, got)
+		}
+	}
+	if got := testutil.ToFloat64(metrics.InferenceWorkerRequestsTotal.WithLabelValues("batch-w", "success")); got != 3 {
+		t.Errorf("expected 3 successes in metrics, got %v", got)
+	}
+}
+
+func TestProcessBatch_FailureRequeuesUnstartedRequests(t *testing.T) {
+	c := serve(t, "batch-fail-w", &batchServer{})
+
+	reqs := newBatch("broken", "a", "b")
+	errs := c.ProcessBatch(reqs)
+	// "a" streamed a token before the failure, so only "b" can be retried
+	if status.Code(errs[0]) != codes.Internal {
+		t.Errorf("started request: expected an Internal error, got %v", errs[0])
+	}
+	select {
+	case err := <-reqs[0].ErrorCh:
+		if status.Code(err) != codes.Internal {
+			t.Errorf("started request's ErrorCh got %v", err)
+		}
+	default:
+		t.Error("started request's failure not reported on ErrorCh")
+	}
+	if !errors.Is(errs[1], ErrRequeue) {
+		t.Errorf("unstarted request: expected ErrRequeue, got %v", errs[1])
+	}
+	if got := testutil.ToFloat64(metrics.InferenceWorkerErrors.WithLabelValues("batch-fail-w", "internal")); got != 2 {
+		t.Errorf("code=internal errors = %v, want 2", got)
+	}
+}
+
+func TestProcessBatch_FallsBackWithoutBatchGenerate(t *testing.T) {
+	// slowServer only implements Generate
+	c := serve(t, "single-w", &slowServer{})
+
+	reqs := newBatch("fast", "a", "b")
+	for i, err := range c.ProcessBatch(reqs) {
+		if err != nil {
+			t.Errorf("request %d: %v", i, err)
+		}
+	}
+	for _, req := range reqs {
+		if got := tokens(req); len(got) != 1 || got[0] != "hi" {
+			t.Errorf("request %s got tokens %q", req.ID, got)
+		}
+	}
+	if !c.single.Load() {
+		t.Error("expected the client to stop trying BatchGenerate")
+	}
+}
@@ -2,27 +2,105 @@ package worker
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
 
 	pb "github.com/aluko123/go-network-proxy/inference/pb"
 	"github.com/aluko123/go-network-proxy/inference/queue"
 	"github.com/aluko123/go-network-proxy/pkg/metrics"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc/filters"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 )
 
 // Config holds worker client configuration
 type Config struct {
 	InferenceTimeout time.Duration
+	// ModelTimeouts overrides InferenceTimeout for specific models, e.g. a
+	// long timeout for summarization and a short one for a classifier
+	ModelTimeouts map[string]time.Duration
+	// MaxRetries is how many times a request whose stream fails before any
+	// token was sent is handed back to the router (ErrRequeue) for another
+	// worker, instead of erroring the client. 0 disables requeueing.
+	MaxRetries int
+
+	// MaxConcurrent is how many requests the router runs on one worker at
+	// once (per unit of weight), for workers that batch
+	MaxConcurrent int
+
+	// TLS for worker connections. Without a CA file traffic is plaintext.
+	// Setting a client cert and key as well enables mutual TLS.
+	TLSCAFile     string
+	TLSCertFile   string
+	TLSKeyFile    string
+	TLSServerName string // overrides the name checked against the worker cert
+
+	// AuthToken, if set, is sent on every RPC as "authorization: Bearer <token>"
+	AuthToken string
 }
 
 // DefaultConfig returns the default worker configuration
 func DefaultConfig() Config {
 	return Config{
 		InferenceTimeout: 5 * time.Minute,
+		MaxRetries:       2,
+		MaxConcurrent:    1,
+	}
+}
+
+// ErrRequeue is returned by ProcessRequest when the stream failed before any
+// output reached the client and nothing was written to ErrorCh, so the
+// request can safely be retried on another worker
+var ErrRequeue = errors.New("worker failed before streaming; request can be requeued")
+
+// ErrTimeout is sent (wrapped, with the limit) on ErrorCh when a request
+// runs past its model's inference timeout. Timed out requests are not
+// requeued.
+var ErrTimeout = errors.New("inference timed out")
+
+// ParseModelTimeouts parses "model=duration" pairs separated by commas, e.g.
+// "summarize=5m,classify=10s"
+func ParseModelTimeouts(s string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		model, value, ok := strings.Cut(pair, "=")
+		model = strings.TrimSpace(model)
+		if !ok || model == "" {
+			return nil, fmt.Errorf("model timeout %q: want model=duration", pair)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("model timeout %q: want a positive duration", pair)
+		}
+		timeouts[model] = d
+	}
+	return timeouts, nil
+}
+
+// timeoutFor returns the inference timeout for model
+func timeoutFor(model string) time.Duration {
+	if d, ok := config.ModelTimeouts[model]; ok {
+		return d
 	}
+	return config.InferenceTimeout
 }
 
 var config = DefaultConfig()
@@ -34,48 +112,250 @@ func SetConfig(c Config) {
 
 // Client manages a connection to a single Python worker
 type Client struct {
-	ID        string
+	ID            string
+	Address       string
+	MaxConcurrent int // from Config at creation
+	healthy       atomic.Bool
+
+	info   atomic.Pointer[pb.InfoResponse] // last GetInfo report, nil until the first probe
+	legacy atomic.Bool                     // worker predates GetInfo; probe Health instead
+	single atomic.Bool                     // worker predates BatchGenerate; batches go one request per call
+
+	mu        sync.RWMutex // guards conn/rpcClient across Reconnect
 	conn      *grpc.ClientConn
 	rpcClient pb.ModelServiceClient
-	Address   string
-	Healthy   bool
 }
 
 // NewClient creates a new worker client
 func NewClient(id, address string) (*Client, error) {
-	// Connect to the Python worker
+	conn, err := dial(address)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		ID:            id,
+		conn:          conn,
+		rpcClient:     pb.NewModelServiceClient(conn),
+		Address:       address,
+		MaxConcurrent: max(config.MaxConcurrent, 1),
+	}
+	c.SetHealthy(true)
+	return c, nil
+}
+
+// dial connects to a Python worker
+func dial(address string) (*grpc.ClientConn, error) {
+	opts, err := dialOptions(config)
+	if err != nil {
+		return nil, err
+	}
 	// Modern gRPC uses NewClient and defaults to non-blocking (lazy) connection
-	conn, err := grpc.NewClient(address,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-	)
+	return grpc.NewClient(address, opts...)
+}
+
+// dialOptions builds the transport and per-RPC credentials for cfg
+func dialOptions(cfg Config) ([]grpc.DialOption, error) {
+	creds := insecure.NewCredentials()
+	if cfg.TLSCAFile != "" {
+		tlsCfg, err := tlsConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		creds = credentials.NewTLS(tlsCfg)
+	}
+
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		// Generate calls join the request's trace; health probes are not traced
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler(otelgrpc.WithFilter(filters.Not(filters.Any(
+			filters.MethodName("Health"),
+			filters.MethodName("GetInfo"),
+		))))),
+	}
+	if cfg.AuthToken != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(tokenAuth{
+			token:  cfg.AuthToken,
+			secure: cfg.TLSCAFile != "",
+		}))
+	}
+	return opts, nil
+}
+
+// tlsConfig loads the CA pool and optional client certificate for cfg
+func tlsConfig(cfg Config) (*tls.Config, error) {
+	pem, err := os.ReadFile(cfg.TLSCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("read worker CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in worker CA %s", cfg.TLSCAFile)
+	}
+
+	tlsCfg := &tls.Config{
+		RootCAs:    pool,
+		ServerName: cfg.TLSServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load worker client cert: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return tlsCfg, nil
+}
+
+// tokenAuth attaches a bearer token to every RPC
+type tokenAuth struct {
+	token  string
+	secure bool
+}
+
+func (t tokenAuth) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + t.token}, nil
+}
+
+// RequireTransportSecurity only insists on TLS when it is configured, so a
+// token can still be used against a plaintext worker on a trusted network
+func (t tokenAuth) RequireTransportSecurity() bool {
+	return t.secure
+}
+
+// Reconnect closes the current connection and builds a fresh one to the same
+// address. Calls already in progress on the old connection fail.
+func (c *Client) Reconnect() error {
+	conn, err := dial(c.Address)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	old := c.conn
+	c.conn = conn
+	c.rpcClient = pb.NewModelServiceClient(conn)
+	c.mu.Unlock()
+	c.legacy.Store(false) // the worker may have been upgraded while away
+	c.single.Store(false)
+
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// rpc returns the current gRPC client
+func (c *Client) rpc() pb.ModelServiceClient {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.rpcClient
+}
+
+// Healthy reports whether the worker is currently considered healthy
+func (c *Client) Healthy() bool {
+	return c.healthy.Load()
+}
+
+// SetHealthy marks the worker healthy or unhealthy
+func (c *Client) SetHealthy(healthy bool) {
+	if c.healthy.Swap(healthy) != healthy {
+		if healthy {
+			metrics.InferenceHealthyWorkers.Inc()
+		} else {
+			metrics.InferenceHealthyWorkers.Dec()
+		}
+	}
+	value := 0.0
+	if healthy {
+		value = 1
+	}
+	metrics.InferenceWorkerHealthy.WithLabelValues(c.ID).Set(value)
+}
+
+// errReportedUnhealthy is returned when the worker answers but reports itself unhealthy
+var errReportedUnhealthy = errors.New("worker reported unhealthy")
+
+// CheckHealth probes the worker with GetInfo. A nil error means the worker is
+// reachable and reports itself healthy.
+func (c *Client) CheckHealth(ctx context.Context) (*pb.InfoResponse, error) {
+	resp, err := c.GetInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Healthy {
+		return resp, errReportedUnhealthy
+	}
+	return resp, nil
+}
+
+// GetInfo asks the worker for its status, the models it serves and its
+// current load, and keeps the answer for Info. Workers that predate GetInfo
+// are probed with Health instead, so their report carries no models.
+func (c *Client) GetInfo(ctx context.Context) (*pb.InfoResponse, error) {
+	if !c.legacy.Load() {
+		resp, err := c.rpc().GetInfo(ctx, &pb.InfoRequest{})
+		if status.Code(err) != codes.Unimplemented {
+			if err != nil {
+				return nil, err
+			}
+			c.info.Store(resp)
+			return resp, nil
+		}
+		slog.Info("worker does not implement GetInfo, falling back to Health", "worker_id", c.ID)
+		c.legacy.Store(true)
+	}
+
+	health, err := c.rpc().Health(ctx, &pb.HealthRequest{})
 	if err != nil {
 		return nil, err
 	}
+	resp := &pb.InfoResponse{
+		Healthy:          health.Healthy,
+		CurrentQueueSize: health.CurrentQueueSize,
+		GpuUtilization:   health.GpuUtilization,
+	}
+	c.info.Store(resp)
+	return resp, nil
+}
 
-	return &Client{
-		ID:        id,
-		conn:      conn,
-		rpcClient: pb.NewModelServiceClient(conn),
-		Address:   address,
-		Healthy:   true,
-	}, nil
+// Info returns the worker's last GetInfo report, or nil if it has not been
+// probed yet
+func (c *Client) Info() *pb.InfoResponse {
+	return c.info.Load()
 }
 
-// ProcessRequest takes a request from the queue and streams it to the worker
-func (c *Client) ProcessRequest(req *queue.Request) {
-	ctx, cancel := context.WithTimeout(context.Background(), config.InferenceTimeout)
+// ProcessRequest takes a request from the queue and streams it to the worker.
+// It returns nil on success. On failure the error has normally been delivered
+// on req.ErrorCh; the exception is ErrRequeue, where the caller still owns the
+// request and must retry or fail it.
+func (c *Client) ProcessRequest(req *queue.Request) error {
+	parent := req.Ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	timeout := timeoutFor(req.Model)
+	ctx, cancel := context.WithTimeout(parent, timeout)
 	defer cancel()
 
-	// Mark processing start time and record queue wait
+	// Mark processing start time; queue wait is recorded once the outcome
+	// is known, so it can be broken down by status
 	req.StartTime = time.Now()
-	priorityLabel := metrics.PriorityLabel(req.Priority)
-	metrics.InferenceQueueWaitDuration.WithLabelValues(req.Model, priorityLabel).Observe(req.StartTime.Sub(req.SubmitTime).Seconds())
-
 	status := "success"
+	defer func() {
+		metrics.InferenceQueueWaitDuration.WithLabelValues(req.Model, metrics.PriorityLabel(req.Priority), status).Observe(req.StartTime.Sub(req.SubmitTime).Seconds())
+	}()
+
+	// Client already gone while the request waited in the queue
+	if parent.Err() != nil {
+		status = "cancelled"
+		return c.cancelled(req, parent)
+	}
 
 	defer func() {
 		// Record processing duration
-		metrics.InferenceProcessingDuration.WithLabelValues(req.Model, c.ID).Observe(time.Since(req.StartTime).Seconds())
+		metrics.InferenceProcessingDuration.WithLabelValues(req.Model, c.ID, status).Observe(time.Since(req.StartTime).Seconds())
 		// Record worker request count
 		metrics.InferenceWorkerRequestsTotal.WithLabelValues(c.ID, status).Inc()
 	}()
@@ -88,37 +368,130 @@ func (c *Client) ProcessRequest(req *queue.Request) {
 		MaxTokens:   int32(req.MaxTokens),
 		Temperature: req.Temperature,
 		Priority:    int32(req.Priority),
+		Stop:        req.Stop,
+		Seed:        req.Seed,
 	}
 
 	// Start streaming
-	stream, err := c.rpcClient.Generate(ctx, rpcReq)
+	stream, err := c.rpc().Generate(ctx, rpcReq)
 	if err != nil {
-		status = "error"
-		slog.Error("stream error", "worker_id", c.ID, "error", err)
-		req.ErrorCh <- err
-		return
+		if parent.Err() != nil {
+			status = "cancelled"
+			return c.cancelled(req, parent)
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			status = "timeout"
+			return c.timedOut(req, timeout)
+		}
+		code := errorCode(err)
+		slog.Error("stream error", "worker_id", c.ID, "code", code, "error", err)
+		metrics.InferenceWorkerErrors.WithLabelValues(c.ID, code).Inc()
+		err = c.fail(req, err, false)
+		status = failureStatus(err, code)
+		return err
 	}
 
 	// Read stream
+	sent := false
 	for {
 		resp, err := stream.Recv()
 		if err == io.EOF {
 			close(req.ResponseCh)
-			return
+			return nil
 		}
 		if err != nil {
-			status = "error"
-			slog.Error("stream broken", "worker_id", c.ID, "error", err)
-			req.ErrorCh <- err
-			return
+			if parent.Err() != nil {
+				status = "cancelled"
+				return c.cancelled(req, parent)
+			}
+			if ctx.Err() == context.DeadlineExceeded {
+				status = "timeout"
+				return c.timedOut(req, timeout)
+			}
+			code := errorCode(err)
+			slog.Error("stream broken", "worker_id", c.ID, "code", code, "error", err)
+			metrics.InferenceWorkerErrors.WithLabelValues(c.ID, code).Inc()
+			err = c.fail(req, err, sent)
+			status = failureStatus(err, code)
+			return err
 		}
 
-		// Forward token
-		req.ResponseCh <- resp
+		// Forward token; stop if the client left (nobody reads ResponseCh)
+		select {
+		case req.ResponseCh <- resp:
+		case <-parent.Done():
+			status = "cancelled"
+			return c.cancelled(req, parent)
+		}
+		sent = true
+	}
+}
+
+// cancelled reports a request whose client went away. Cancelling ctx (via the
+// deferred cancel) tears down the gRPC stream, freeing the worker. The
+// request is never requeued.
+func (c *Client) cancelled(req *queue.Request, parent context.Context) error {
+	slog.Debug("request cancelled by client", "worker_id", c.ID, "request_id", req.ID)
+	err := parent.Err()
+	select {
+	case req.ErrorCh <- err:
+	default:
+	}
+	return err
+}
+
+// timedOut reports a request that ran past its timeout. Another worker
+// would get no more time, so it is never requeued.
+func (c *Client) timedOut(req *queue.Request, timeout time.Duration) error {
+	slog.Warn("inference timed out", "worker_id", c.ID, "request_id", req.ID, "model", req.Model, "timeout", timeout)
+	err := fmt.Errorf("%w after %s", ErrTimeout, timeout)
+	req.ErrorCh <- err
+	return err
+}
+
+// fail reports a processing error. If nothing was streamed yet and the
+// request has retries left, it is handed back to the caller instead of the
+// client. Partial output is never retried: the client would see it twice.
+func (c *Client) fail(req *queue.Request, err error, sent bool) error {
+	if !sent && req.Retries < config.MaxRetries {
+		return ErrRequeue
+	}
+	req.ErrorCh <- err
+	return err
+}
+
+// failureStatus is the worker metrics status label for a failed request:
+// "requeued", or the gRPC code it failed with (see errorCode)
+func failureStatus(err error, code string) string {
+	if err == ErrRequeue {
+		return "requeued"
+	}
+	return code
+}
+
+// errorCode returns the metrics label for the gRPC code of a failed call, in
+// snake case: "unavailable" (the worker can't be reached), "internal" (the
+// model failed), "deadline_exceeded", "resource_exhausted", and so on. Errors
+// that carry no gRPC status read "unknown".
+func errorCode(err error) string {
+	name := status.Code(err).String()
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
 	}
+	return b.String()
 }
 
 // Close terminates the connection
 func (c *Client) Close() error {
+	c.SetHealthy(false) // a closed worker no longer counts as healthy
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.conn.Close()
 }
@@ -0,0 +1,223 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	pb "github.com/aluko123/go-network-proxy/inference/pb"
+	"github.com/aluko123/go-network-proxy/inference/queue"
+	"github.com/aluko123/go-network-proxy/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// tokenServer records the authorization metadata of Health calls
+type tokenServer struct {
+	pb.UnimplementedModelServiceServer
+	auth chan string
+}
+
+func (s *tokenServer) Health(ctx context.Context, _ *pb.HealthRequest) (*pb.HealthResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.auth <- firstOrEmpty(md.Get("authorization"))
+	return &pb.HealthResponse{Healthy: true}, nil
+}
+
+func firstOrEmpty(v []string) string {
+	if len(v) == 0 {
+		return ""
+	}
+	return v[0]
+}
+
+func TestClient_SendsAuthToken(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := grpc.NewServer()
+	ts := &tokenServer{auth: make(chan string, 1)}
+	pb.RegisterModelServiceServer(srv, ts)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	SetConfig(Config{AuthToken: "s3cret"})
+	defer SetConfig(DefaultConfig())
+
+	c, err := NewClient("w", lis.Addr().String())
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close()
+
+	if _, err := c.CheckHealth(context.Background()); err != nil {
+		t.Fatalf("CheckHealth: %v", err)
+	}
+	if got := <-ts.auth; got != "Bearer s3cret" {
+		t.Errorf("expected bearer token, got %q", got)
+	}
+}
+
+func TestDialOptions_MissingCA(t *testing.T) {
+	if _, err := dialOptions(Config{TLSCAFile: "/nonexistent/ca.pem"}); err == nil {
+		t.Error("expected error for unreadable CA file")
+	}
+}
+
+// slowServer streams one token, except that it holds "slow" requests open
+// until the caller gives up and fails "broken" ones
+type slowServer struct {
+	pb.UnimplementedModelServiceServer
+}
+
+func (s *slowServer) Generate(req *pb.GenerateRequest, stream pb.ModelService_GenerateServer) error {
+	switch req.Model {
+	case "slow":
+		<-stream.Context().Done()
+		return stream.Context().Err()
+	case "broken":
+		return status.Error(codes.Internal, "model failed")
+	}
+	return stream.Send(&pb.TokenResponse{RequestId: req.RequestId, Token: "hi", Finished: true})
+}
+
+func TestProcessRequest_ModelTimeout(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := grpc.NewServer()
+	pb.RegisterModelServiceServer(srv, &slowServer{})
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	cfg := DefaultConfig()
+	cfg.InferenceTimeout = 5 * time.Second
+	cfg.ModelTimeouts = map[string]time.Duration{"slow": 50 * time.Millisecond}
+	SetConfig(cfg)
+	defer SetConfig(DefaultConfig())
+
+	c, err := NewClient("timeout-w", lis.Addr().String())
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close()
+
+	newRequest := func(model string) *queue.Request {
+		return &queue.Request{
+			ID:         model,
+			Model:      model,
+			SubmitTime: time.Now(),
+			ResponseCh: make(chan *pb.TokenResponse, 10),
+			ErrorCh:    make(chan error, 1),
+		}
+	}
+	timeouts := func() float64 {
+		return testutil.ToFloat64(metrics.InferenceWorkerRequestsTotal.WithLabelValues("timeout-w", "timeout"))
+	}
+	before := timeouts()
+
+	// Other models keep the default timeout
+	if err := c.ProcessRequest(newRequest("fast")); err != nil {
+		t.Fatalf("fast model: %v", err)
+	}
+
+	start := time.Now()
+	req := newRequest("slow")
+	err = c.ProcessRequest(req)
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout (not a requeue), got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("per-model timeout not applied: took %s", elapsed)
+	}
+	select {
+	case sent := <-req.ErrorCh:
+		if !errors.Is(sent, ErrTimeout) {
+			t.Errorf("ErrorCh got %v", sent)
+		}
+	default:
+		t.Error("timeout not reported on ErrorCh")
+	}
+	if got := timeouts() - before; got != 1 {
+		t.Errorf("expected 1 timeout in metrics, got %v", got)
+	}
+}
+
+func TestProcessRequest_LabelsErrorCode(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := grpc.NewServer()
+	pb.RegisterModelServiceServer(srv, &slowServer{})
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	cfg := DefaultConfig()
+	cfg.MaxRetries = 0
+	SetConfig(cfg)
+	defer SetConfig(DefaultConfig())
+
+	c, err := NewClient("code-w", lis.Addr().String())
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close()
+
+	req := &queue.Request{
+		ID:         "r1",
+		Model:      "broken",
+		SubmitTime: time.Now(),
+		ResponseCh: make(chan *pb.TokenResponse, 1),
+		ErrorCh:    make(chan error, 1),
+	}
+	if err := c.ProcessRequest(req); status.Code(err) != codes.Internal {
+		t.Fatalf("expected an Internal error, got %v", err)
+	}
+	if got := testutil.ToFloat64(metrics.InferenceWorkerRequestsTotal.WithLabelValues("code-w", "internal")); got != 1 {
+		t.Errorf("status=internal count = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.InferenceWorkerErrors.WithLabelValues("code-w", "internal")); got != 1 {
+		t.Errorf("code=internal errors = %v, want 1", got)
+	}
+}
+
+func TestParseModelTimeouts(t *testing.T) {
+	got, err := ParseModelTimeouts(" summarize=5m, classify=10s ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["summarize"] != 5*time.Minute || got["classify"] != 10*time.Second {
+		t.Errorf("got %v", got)
+	}
+	for _, bad := range []string{"summarize", "=5m", "classify=fast", "classify=0s", "classify=-1s"} {
+		if _, err := ParseModelTimeouts(bad); err == nil {
+			t.Errorf("ParseModelTimeouts(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	tests := map[error]string{
+		status.Error(codes.Unavailable, "connection refused"): "unavailable",
+		status.Error(codes.Internal, "CUDA out of memory"):    "internal",
+		status.Error(codes.DeadlineExceeded, "too slow"):      "deadline_exceeded",
+		status.Error(codes.ResourceExhausted, "busy"):         "resource_exhausted",
+		errors.New("not a gRPC error"):                        "unknown",
+	}
+	for err, want := range tests {
+		if got := errorCode(err); got != want {
+			t.Errorf("errorCode(%v) = %q, want %q", err, got, want)
+		}
+	}
+	if got := failureStatus(ErrRequeue, "unavailable"); got != "requeued" {
+		t.Errorf("requeued failure labeled %q", got)
+	}
+}
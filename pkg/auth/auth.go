@@ -0,0 +1,183 @@
+// Package auth verifies client credentials for the forward proxy
+package auth
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Credentials checks a username and password
+type Credentials interface {
+	Verify(user, password string) bool
+}
+
+// StaticCredentials is a plaintext user -> password map
+type StaticCredentials map[string]string
+
+func (s StaticCredentials) Verify(user, password string) bool {
+	want, ok := s[user]
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(want), []byte(password)) == 1
+}
+
+// Htpasswd holds users and password hashes loaded from an htpasswd file.
+// Supported hashes are Apache MD5 ($apr1$, the htpasswd default), SHA-1
+// ({SHA}, htpasswd -s) and plaintext. Other schemes (bcrypt, $1$, $5$, $6$,
+// DES crypt) are rejected at load, since they would otherwise be compared as
+// plaintext. A plaintext password that looks like one of them can be marked
+// with a {PLAIN} prefix.
+type Htpasswd map[string]string
+
+// plainPrefix marks an entry as plaintext, whatever it looks like
+const plainPrefix = "{PLAIN}"
+
+// LoadHtpasswd reads an htpasswd file of "user:hash" lines
+func LoadHtpasswd(path string) (Htpasswd, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	users := make(Htpasswd)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("%s:%d: expected user:hash", path, n)
+		}
+		if err := checkScheme(hash); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		users[user] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// checkScheme refuses hashes Verify can't compute, which it would otherwise
+// take for plaintext: the stored hash would then work as the password
+func checkScheme(hash string) error {
+	switch {
+	case strings.HasPrefix(hash, plainPrefix), strings.HasPrefix(hash, "$apr1$"), strings.HasPrefix(hash, "{SHA}"):
+		return nil
+	case strings.HasPrefix(hash, "$2"):
+		return fmt.Errorf("bcrypt hashes are not supported; use htpasswd -m or -s")
+	case strings.HasPrefix(hash, "$") && strings.Count(hash, "$") >= 2:
+		scheme, _, _ := strings.Cut(hash[1:], "$")
+		return fmt.Errorf("$%s$ hashes are not supported; use htpasswd -m or -s, or prefix a plaintext password with %s", scheme, plainPrefix)
+	case isCrypt(hash):
+		return fmt.Errorf("DES crypt hashes are not supported; use htpasswd -m or -s, or prefix a plaintext password with %s", plainPrefix)
+	}
+	return nil
+}
+
+// isCrypt reports whether s looks like a traditional DES crypt hash: 13
+// characters of the crypt alphabet
+func isCrypt(s string) bool {
+	if len(s) != 13 {
+		return false
+	}
+	for _, c := range []byte(s) {
+		if !(c == '.' || c == '/' || '0' <= c && c <= '9' || 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z') {
+			return false
+		}
+	}
+	return true
+}
+
+func (h Htpasswd) Verify(user, password string) bool {
+	hash, ok := h[user]
+	if !ok {
+		return false
+	}
+
+	var computed string
+	switch {
+	case strings.HasPrefix(hash, "$apr1$"):
+		salt, _, _ := strings.Cut(strings.TrimPrefix(hash, "$apr1$"), "$")
+		computed = apr1(password, salt)
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		computed = "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+	case strings.HasPrefix(hash, plainPrefix):
+		computed = plainPrefix + password
+	default:
+		computed = password
+	}
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(computed)) == 1
+}
+
+// apr1 computes Apache's MD5-based password hash ("$apr1$salt$digest")
+func apr1(password, salt string) string {
+	const magic = "$apr1$"
+	pw := []byte(password)
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+
+	alt := md5.Sum([]byte(password + salt + password))
+	h := md5.New()
+	h.Write([]byte(password + magic + salt))
+	for i := len(pw); i > 0; i -= 16 {
+		h.Write(alt[:min(16, i)])
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			h.Write([]byte{0})
+		} else {
+			h.Write(pw[:1])
+		}
+	}
+	final := h.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		r := md5.New()
+		if i&1 != 0 {
+			r.Write(pw)
+		} else {
+			r.Write(final)
+		}
+		if i%3 != 0 {
+			r.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			r.Write(pw)
+		}
+		if i&1 != 0 {
+			r.Write(final)
+		} else {
+			r.Write(pw)
+		}
+		final = r.Sum(nil)
+	}
+
+	const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	var out strings.Builder
+	encode := func(v, n int) {
+		for ; n > 0; n-- {
+			out.WriteByte(itoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+	for _, g := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		encode(int(final[g[0]])<<16|int(final[g[1]])<<8|int(final[g[2]]), 4)
+	}
+	encode(int(final[11]), 2)
+
+	return magic + salt + "$" + out.String()
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHtpasswd_Verify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	content := "# users\n" +
+		"alice:$apr1$r31abcde$SZEN.U5sWGGNcv9YsUrqI.\n" + // openssl passwd -apr1 -salt r31abcde secret
+		"bob:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n" + // htpasswd -s: "secret"
+		"carol:plain\n" +
+		"erin:{PLAIN}abcdefghijklm\n" // 13 characters, like DES crypt
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := LoadHtpasswd(path)
+	if err != nil {
+		t.Fatalf("LoadHtpasswd: %v", err)
+	}
+
+	tests := []struct {
+		user, password string
+		want           bool
+	}{
+		{"alice", "secret", true},
+		{"alice", "wrong", false},
+		{"bob", "secret", true},
+		{"bob", "Secret", false},
+		{"carol", "plain", true},
+		{"erin", "abcdefghijklm", true},
+		{"erin", "{PLAIN}abcdefghijklm", false},
+		{"dave", "secret", false},
+	}
+	for _, tt := range tests {
+		if got := h.Verify(tt.user, tt.password); got != tt.want {
+			t.Errorf("Verify(%q, %q) = %v, want %v", tt.user, tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestLoadHtpasswd_RejectsBcrypt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	os.WriteFile(path, []byte("alice:$2y$05$abcdefghijklmnopqrstuv\n"), 0o600)
+	if _, err := LoadHtpasswd(path); err == nil {
+		t.Error("expected bcrypt entry to be rejected")
+	}
+}
+
+func TestLoadHtpasswd_RejectsUnsupportedSchemes(t *testing.T) {
+	for _, entry := range []string{
+		"alice:$6$saltsalt$Fq9gH2mK1pL0rS3tU4vW5xY6zA7bC8dE9fG0hI1jK2lM3nO4pQ5rS6tU7vW8xY9zA0bC1dE2fG3hI4jK5lM6n",
+		"alice:$5$saltsalt$abcdefghijklmnopqrstuvwxyz0123456789ABCDEF",
+		"alice:$1$saltsalt$abcdefghijklmnopqrstuv",
+		"alice:abJnggxhB/yWI", // DES crypt
+	} {
+		path := filepath.Join(t.TempDir(), "htpasswd")
+		os.WriteFile(path, []byte(entry+"\n"), 0o600)
+		if _, err := LoadHtpasswd(path); err == nil {
+			t.Errorf("expected %q to be rejected", entry)
+		}
+	}
+}
@@ -2,21 +2,32 @@ package blocklist
 
 import (
 	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net"
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
+
+	"github.com/aluko123/go-network-proxy/pkg/metrics"
+	"golang.org/x/net/idna"
+	"golang.org/x/text/unicode/norm"
 )
 
 // Manager manages domain blocking with efficient O(1) lookups
 type Manager struct {
 	exactDomains    map[string]bool // exact domain matches
 	wildcardDomains []string        // wildcard patterns like *.ads.com
+	blockedNets     []*net.IPNet    // addresses no upstream connection may reach
 	mu              sync.RWMutex    // thread-safe concurrent access
 }
 
 // Config represents the JSON structure
 type Config struct {
 	BlockedDomains []string `json:"blocked_domains"`
+	BlockedIPs     []string `json:"blocked_ips"` // IPs or CIDRs, checked after DNS resolution
 }
 
 // NewManager creates a new blocklist manager
@@ -41,6 +52,11 @@ func (m *Manager) LoadFromFile(filepath string) error {
 	if err := json.Unmarshal(data, &config); err != nil {
 		return err
 	}
+	nets, err := parseNets(config.BlockedIPs)
+	if err != nil {
+		return err
+	}
+	m.blockedNets = nets
 
 	// Clear existing entries
 	m.exactDomains = make(map[string]bool)
@@ -48,46 +64,123 @@ func (m *Manager) LoadFromFile(filepath string) error {
 
 	// Populate blocklist
 	for _, domain := range config.BlockedDomains {
-		domain = strings.ToLower(strings.TrimSpace(domain))
+		domain = strings.TrimSpace(domain)
 		if strings.HasPrefix(domain, "*.") {
 			// Wildcard domain
-			m.wildcardDomains = append(m.wildcardDomains, domain[2:]) // remove "*."
+			m.wildcardDomains = append(m.wildcardDomains, normalize(domain[2:])) // remove "*."
 		} else {
 			// Exact match
-			m.exactDomains[domain] = true
+			m.exactDomains[normalize(domain)] = true
 		}
 	}
 
+	metrics.BlocklistEntries.WithLabelValues("exact").Set(float64(len(m.exactDomains)))
+	metrics.BlocklistEntries.WithLabelValues("wildcard").Set(float64(len(m.wildcardDomains)))
+	metrics.BlocklistEntries.WithLabelValues("ip").Set(float64(len(m.blockedNets)))
+	metrics.BlocklistLastReload.SetToCurrentTime()
 	return nil
 }
 
 // IsBlocked checks if a domain is blocked (O(1) for exact, O(k) for wildcards)
 func (m *Manager) IsBlocked(domain string) bool {
+	_, blocked := m.Match(domain)
+	return blocked
+}
+
+// Match reports whether a domain is blocked and by which blocklist entry
+// (e.g. "ads.com" or "*.ads.com"). A wildcard entry covers the domain itself
+// and every subdomain, on label boundaries: "*.ads.com" matches "ads.com" and
+// "x.ads.com" but not "notads.com".
+func (m *Manager) Match(domain string) (string, bool) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	domain = strings.ToLower(strings.TrimSpace(domain))
+	domain = normalize(domain)
 
 	// Check exact match first (O(1))
 	if m.exactDomains[domain] {
-		return true
+		return domain, true
 	}
 
 	// Check wildcard patterns (O(k) where k = number of wildcards)
 	for _, wildcardDomain := range m.wildcardDomains {
-		if strings.HasSuffix(domain, wildcardDomain) {
-			return true
+		if domain == wildcardDomain || strings.HasSuffix(domain, "."+wildcardDomain) {
+			return "*." + wildcardDomain, true
 		}
 	}
 
+	return "", false
+}
+
+// IsBlockedIP reports whether ip falls in one of the blocked_ips entries.
+// Dialers check every resolved address, so a name that passes Match still
+// cannot reach, say, a metadata endpoint or an internal network.
+func (m *Manager) IsBlockedIP(ip net.IP) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, n := range m.blockedNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
 	return false
 }
 
-// GetBlockedResponse returns a custom blocked page response
-func GetBlockedResponse() string {
-	return `<!DOCTYPE html>
+// parseNets parses blocked_ips entries; a bare IP blocks just that address
+func parseNets(entries []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(entries))
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if !strings.Contains(e, "/") {
+			ip := net.ParseIP(e)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid blocked IP %q", e)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(e)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blocked IP %q: %w", e, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// idnaProfile maps a domain to its lookup form (UTS #46: case folding and
+// punycode) without STD3's hostname rules, so names with underscores still
+// normalize
+var idnaProfile = idna.New(idna.MapForLookup(), idna.StrictDomainName(false))
+
+// normalize returns the form domains are stored and compared in: lowercase
+// ASCII, with internationalized labels NFC-normalized and punycode-encoded.
+// "München.de", "münchen.de" and "xn--mnchen-3ya.de" all normalize alike.
+// Names idna rejects (IP literals, say) are only lowercased.
+func normalize(domain string) string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if ascii, err := idnaProfile.ToASCII(norm.NFC.String(domain)); err == nil {
+		return ascii
+	}
+	return domain
+}
+
+// BlockedPage is what the blocked-page template is executed with
+type BlockedPage struct {
+	Host string // the host the client asked for
+	Rule string // the blocklist entry it matched
+}
+
+// defaultBlockedTemplate is the page served until SetBlockedTemplate is
+// called. The emoji is an entity so it survives any charset mix-up.
+var defaultBlockedTemplate = template.Must(template.New("blocked").Parse(`<!DOCTYPE html>
 <html>
 <head>
+    <meta charset="utf-8">
     <title>Domain Blocked</title>
     <style>
         body { font-family: Arial, sans-serif; text-align: center; padding: 50px; background: #f5f5f5; }
@@ -98,10 +191,26 @@ func GetBlockedResponse() string {
 </head>
 <body>
     <div class="container">
-        <h1>🚫 Domain Blocked</h1>
-        <p>Access to this domain has been blocked by network policy.</p>
+        <h1>&#x1F6AB; Domain Blocked</h1>
+        <p>Access to {{if .Host}}<strong>{{.Host}}</strong>{{else}}this domain{{end}} has been blocked by network policy.</p>
         <p>If you believe this is an error, please contact your network administrator.</p>
     </div>
 </body>
-</html>`
+</html>`))
+
+var blockedTemplate atomic.Pointer[template.Template]
+
+// SetBlockedTemplate replaces the page served for blocked requests. The
+// template is executed with a BlockedPage. Passing nil restores the default.
+func SetBlockedTemplate(tmpl *template.Template) {
+	blockedTemplate.Store(tmpl)
+}
+
+// WriteBlockedPage renders the blocked page for page into w
+func WriteBlockedPage(w io.Writer, page BlockedPage) error {
+	tmpl := blockedTemplate.Load()
+	if tmpl == nil {
+		tmpl = defaultBlockedTemplate
+	}
+	return tmpl.Execute(w, page)
 }
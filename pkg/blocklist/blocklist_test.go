@@ -0,0 +1,152 @@
+package blocklist
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aluko123/go-network-proxy/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestManager_WildcardMatchesOnLabelBoundary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.json")
+	if err := os.WriteFile(path, []byte(`{"blocked_domains": ["*.ads.com", "tracker.net"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager()
+	if err := m.LoadFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		domain string
+		rule   string // "" = not blocked
+	}{
+		{"ads.com", "*.ads.com"}, // the apex is covered too
+		{"x.ads.com", "*.ads.com"},
+		{"a.b.ads.com", "*.ads.com"},
+		{"X.Ads.COM", "*.ads.com"},
+		{"notads.com", ""},
+		{"ads.com.evil.org", ""},
+		{"tracker.net", "tracker.net"},
+		{"sub.tracker.net", ""}, // exact entries don't cover subdomains
+	}
+	for _, tt := range tests {
+		rule, blocked := m.Match(tt.domain)
+		if blocked != (tt.rule != "") || rule != tt.rule {
+			t.Errorf("Match(%q) = %q, %v; want %q", tt.domain, rule, blocked, tt.rule)
+		}
+		if m.IsBlocked(tt.domain) != blocked {
+			t.Errorf("IsBlocked(%q) disagrees with Match", tt.domain)
+		}
+	}
+}
+
+func TestManager_UnicodeAndPunycodeMatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.json")
+	// One entry stored in each form
+	if err := os.WriteFile(path, []byte(`{"blocked_domains": ["münchen.de", "*.xn--bcher-kva.example"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager()
+	if err := m.LoadFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, domain := range []string{
+		"münchen.de",
+		"MÜNCHEN.DE",
+		"mu\u0308nchen.de", // decomposed ü (NFD)
+		"xn--mnchen-3ya.de",
+		"XN--MNCHEN-3YA.DE",
+		"bücher.example",
+		"shop.bücher.example",
+		"shop.xn--bcher-kva.example",
+	} {
+		if !m.IsBlocked(domain) {
+			t.Errorf("expected %q to be blocked", domain)
+		}
+	}
+	for _, domain := range []string{"munchen.de", "bucher.example", "2001:db8::1"} {
+		if m.IsBlocked(domain) {
+			t.Errorf("expected %q not to be blocked", domain)
+		}
+	}
+}
+
+func TestManager_LoadUpdatesMetrics(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.json")
+	if err := os.WriteFile(path, []byte(`{"blocked_domains": ["a.com", "b.com", "*.ads.com"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager()
+	start := float64(time.Now().Unix())
+	if err := m.LoadFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(metrics.BlocklistEntries.WithLabelValues("exact")); got != 2 {
+		t.Errorf("expected 2 exact entries, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.BlocklistEntries.WithLabelValues("wildcard")); got != 1 {
+		t.Errorf("expected 1 wildcard entry, got %v", got)
+	}
+	loaded := testutil.ToFloat64(metrics.BlocklistLastReload)
+	if loaded < start {
+		t.Errorf("expected a reload timestamp of at least %v, got %v", start, loaded)
+	}
+
+	// A failed reload keeps the list, so it must not look like a fresh one
+	os.WriteFile(path, []byte(`not json`), 0o644)
+	if err := m.LoadFromFile(path); err == nil {
+		t.Fatal("expected an error for a broken file")
+	}
+	if got := testutil.ToFloat64(metrics.BlocklistEntries.WithLabelValues("exact")); got != 2 {
+		t.Errorf("expected the exact count kept after a failed reload, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.BlocklistLastReload); got != loaded {
+		t.Errorf("expected the timestamp kept after a failed reload, got %v", got)
+	}
+}
+
+func TestManager_IsBlockedIP(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.json")
+	if err := os.WriteFile(path, []byte(`{"blocked_ips": ["169.254.169.254", "10.0.0.0/8", "fd00::/8"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager()
+	if err := m.LoadFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]bool{
+		"169.254.169.254":        true,
+		"::ffff:169.254.169.254": true, // IPv4-mapped
+		"169.254.169.253":        false,
+		"10.20.30.40":            true,
+		"11.0.0.1":               false,
+		"fd12::1":                true,
+		"2001:db8::1":            false,
+	}
+	for ip, want := range tests {
+		if got := m.IsBlockedIP(net.ParseIP(ip)); got != want {
+			t.Errorf("IsBlockedIP(%s) = %v, want %v", ip, got, want)
+		}
+	}
+	if got := testutil.ToFloat64(metrics.BlocklistEntries.WithLabelValues("ip")); got != 3 {
+		t.Errorf("ip entries gauge = %v, want 3", got)
+	}
+
+	// A bad entry fails the load and keeps the previous list
+	if err := os.WriteFile(path, []byte(`{"blocked_ips": ["10.0.0.0/33"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.LoadFromFile(path); err == nil {
+		t.Error("expected an error for an invalid CIDR")
+	}
+	if !m.IsBlockedIP(net.ParseIP("10.1.1.1")) {
+		t.Error("failed load dropped the previous list")
+	}
+}
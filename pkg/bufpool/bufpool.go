@@ -0,0 +1,44 @@
+// Package bufpool provides pooled copy buffers for proxying bodies and
+// tunnels without allocating a buffer per request.
+package bufpool
+
+import (
+	"io"
+	"sync"
+)
+
+// DefaultSize matches io.Copy's internal buffer
+const DefaultSize = 32 * 1024
+
+// Pool hands out copy buffers of a fixed size
+type Pool struct {
+	size int
+	pool sync.Pool
+}
+
+// New returns a pool of size-byte buffers; size <= 0 uses DefaultSize
+func New(size int) *Pool {
+	if size <= 0 {
+		size = DefaultSize
+	}
+	p := &Pool{size: size}
+	p.pool.New = func() any {
+		b := make([]byte, size)
+		return &b
+	}
+	return p
+}
+
+// Size returns the buffer size
+func (p *Pool) Size() int {
+	return p.size
+}
+
+// Copy is io.CopyBuffer with a pooled buffer. As with io.CopyBuffer, the
+// buffer is skipped when src implements io.WriterTo or dst io.ReaderFrom
+// (e.g. TCP to TCP, which the kernel splices directly).
+func (p *Pool) Copy(dst io.Writer, src io.Reader) (int64, error) {
+	bp := p.pool.Get().(*[]byte)
+	defer p.pool.Put(bp)
+	return io.CopyBuffer(dst, src, *bp)
+}
@@ -0,0 +1,586 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v2"
+)
+
+// Config holds every gateway option. Each field is bound to the flag named in
+// RegisterFlags, and config files use the same names as keys.
+type Config struct {
+	// Server
+	Addr           string
+	MetricsAddr    string // empty serves /metrics and /admin/* on Addr
+	PProf          bool   // serve /debug/pprof/* on MetricsAddr
+	Proto          string
+	HTTP2          bool   // serve the API over HTTP/2; the forward proxy stays HTTP/1.1
+	ProxyProto     bool   // require a PROXY protocol header on every connection to Addr
+	Transparent    bool   // proxy origin-form requests to their Host header
+	TrustedProxies string // comma-separated CIDRs whose X-Forwarded-For is believed
+	ForwardHeaders string // comma-separated forwarding headers, most preferred first
+	SocketClientID string // client IP stand-in for Unix socket connections
+	PEMPath        string
+	KeyPath        string
+	TLSMinVersion  string
+	TLSCiphers     string // comma-separated IANA suite names; empty uses Go's defaults
+	TLSServerOrder bool
+	ACMEDomains    string // comma-separated; non-empty obtains certificates via ACME instead of PEMPath/KeyPath
+	ACMECacheDir   string
+	ACMEEmail      string
+	ACMEHTTPAddr   string // HTTP-01 challenge listener
+	ACMEDirectory  string // empty = Let's Encrypt production
+	Blocklist      string
+	BlockedPage    string
+	MITMCACert     string // CA signing certificates for intercepted tunnels; empty disables MITM
+	MITMCAKey      string
+
+	// Logging
+	Debug                  bool
+	LogFormat              string
+	LogOutput              string
+	LogLevel               string
+	AccessLogOutput        string
+	AccessLogFormat        string
+	AccessLogLevel         string
+	AccessLogMaxSize       int // MB
+	AccessLogMaxBackups    int
+	AccessLogSampleRate    int
+	AccessLogSlowThreshold time.Duration
+	AccessLogInclude       string // status@host rules; empty logs every request
+	AccessLogExclude       string
+	RedactHeaders          string // comma-separated; their values are logged as [REDACTED]
+
+	// Rate limiting
+	Limiter               string
+	RateLimit             int // per minute per IP
+	RateBurst             int
+	RateLimitExempt       string
+	RateLimitMethods      string // per-method overrides, e.g. POST=20:5,CONNECT=10:2
+	MemoryCleanupInterval time.Duration
+	MemoryIdleTimeout     time.Duration
+	MemoryMaxEntries      int
+	MaxInFlight           int  // global cap on concurrent requests (0 = unlimited)
+	MaxInFlightConnect    bool // count CONNECT tunnels against MaxInFlight
+	RedisAddr             string
+	RedisMode             string
+	RedisMaster           string
+	RedisPassword         string
+	RedisDB               int
+	RedisPrefix           string
+	RedisPoolSize         int
+	RedisTimeout          time.Duration
+	RedisFailOpen         bool
+	RedisBreakerThreshold int
+	RedisBreakerCooldown  time.Duration
+
+	// Inference
+	WorkerAddrs        string
+	ModelWorkers       string
+	WorkerModels       string
+	QueueSize          int
+	InferenceCacheTTL  time.Duration
+	InferenceCacheSize int
+	APIKeyTiers        string
+	InferenceQuotas    string
+	DefaultModel       string
+	DefaultMaxTokens   int
+	DefaultTemperature float64
+	DefaultPriority    int
+	MinPriority        int
+	MaxPriority        int
+	StrictPriority     bool
+	MaxPromptBytes     int
+	MaxTokens          int
+	MaxStopSequences   int
+	AdmissionMaxWait   time.Duration
+	SSEHeartbeat       time.Duration
+
+	// Request handling
+	CopyBufferSize     int
+	MaxBodySize        int64
+	CompressionMinSize int
+	ProxyAuthFile      string
+	ProxyAuthRealm     string
+	CORSOrigins        string
+
+	// Header rewriting
+	ResponseHeaders         string // added unless the handler or upstream set them
+	ResponseHeaderOverrides string // always set, replacing the handler's
+	RequestHeaderRemove     string // dropped from forwarded requests
+	RequestHeaderSet        string // set on forwarded requests
+
+	// Timeouts
+	ReadTimeout      time.Duration
+	WriteTimeout     time.Duration
+	IdleTimeout      time.Duration
+	DialTimeout      time.Duration
+	TunnelKeepAlive  time.Duration
+	TunnelFallback   time.Duration
+	TunnelLocalAddr  string
+	DNSCacheTTL      time.Duration // 0 resolves upstream hosts on every dial
+	DNSCacheSize     int
+	InferenceTimeout time.Duration
+	ModelTimeouts    string // per-model overrides, e.g. summarize=5m,classify=10s
+	ShutdownTimeout  time.Duration
+	RequestTimeout   time.Duration
+
+	// Workers
+	HealthCheckInterval time.Duration
+	HealthCheckTimeout  time.Duration
+	UnhealthyThreshold  int
+	ReconnectThreshold  int
+	ReconnectBackoff    time.Duration
+	ReconnectMaxBackoff time.Duration
+	MaxRetries          int
+	WorkerMaxConcurrent int
+	BatchSize           int
+	BatchWindow         time.Duration
+	Balancer            string
+	WorkerTLSCA         string
+	WorkerTLSCert       string
+	WorkerTLSKey        string
+	WorkerTLSServerName string
+	WorkerAuthToken     string
+
+	// Per-host metrics
+	HostMetricsAllow   string
+	HostMetricsMax     int
+	HostMetricsLatency bool
+
+	// Tracing
+	OTelEndpoint    string
+	OTelInsecure    bool
+	OTelServiceName string
+	OTelSampleRatio float64
+}
+
+// Default returns the default gateway configuration
+func Default() Config {
+	return Config{
+		Addr:      ":8080",
+		Proto:     "http",
+		PEMPath:   "server.pem",
+		KeyPath:   "server.key",
+		Blocklist: "configs/blocklist.json",
+
+		ForwardHeaders: "X-Forwarded-For,X-Real-IP",
+		SocketClientID: "unix",
+		TLSMinVersion:  "1.2",
+		ACMECacheDir:   "acme-cache",
+		ACMEHTTPAddr:   ":80",
+
+		LogFormat:              "json",
+		LogOutput:              "stdout",
+		LogLevel:               "info",
+		RedactHeaders:          "Authorization,Cookie,Proxy-Authorization,X-API-Key",
+		AccessLogMaxBackups:    5,
+		AccessLogSampleRate:    1,
+		AccessLogSlowThreshold: time.Second,
+
+		Limiter:               "redis",
+		RateLimit:             100,
+		RateBurst:             20,
+		RateLimitExempt:       "/metrics,/readyz",
+		MemoryCleanupInterval: time.Minute,
+		MemoryIdleTimeout:     5 * time.Minute,
+		MemoryMaxEntries:      100000,
+		RedisAddr:             "localhost:6379",
+		RedisMode:             "standalone",
+		RedisPrefix:           "proxy:ratelimit:",
+		RedisPoolSize:         100,
+		RedisTimeout:          100 * time.Millisecond,
+		RedisFailOpen:         true,
+		RedisBreakerThreshold: 5,
+		RedisBreakerCooldown:  30 * time.Second,
+
+		QueueSize:          10000,
+		InferenceCacheSize: 1000,
+		DefaultModel:       "default-model",
+		DefaultMaxTokens:   100,
+		DefaultTemperature: 0.7,
+		DefaultPriority:    1,
+		MinPriority:        1,
+		MaxPriority:        10,
+		MaxPromptBytes:     64 << 10,
+		MaxTokens:          4096,
+		MaxStopSequences:   4,
+
+		MaxBodySize:        10 << 20,
+		CopyBufferSize:     32 * 1024,
+		CompressionMinSize: 1024,
+		ProxyAuthRealm:     "go-network-proxy",
+
+		ReadTimeout:      30 * time.Second,
+		WriteTimeout:     60 * time.Second,
+		IdleTimeout:      120 * time.Second,
+		DialTimeout:      10 * time.Second,
+		TunnelKeepAlive:  30 * time.Second,
+		DNSCacheTTL:      30 * time.Second,
+		DNSCacheSize:     10000,
+		InferenceTimeout: 5 * time.Minute,
+		ShutdownTimeout:  30 * time.Second,
+		RequestTimeout:   60 * time.Second,
+
+		HealthCheckInterval: 10 * time.Second,
+		HealthCheckTimeout:  2 * time.Second,
+		UnhealthyThreshold:  3,
+		ReconnectThreshold:  3,
+		ReconnectBackoff:    time.Second,
+		ReconnectMaxBackoff: 30 * time.Second,
+		MaxRetries:          2,
+		WorkerMaxConcurrent: 1,
+		BatchSize:           1,
+		BatchWindow:         10 * time.Millisecond,
+		Balancer:            "pull",
+		WorkerAuthToken:     os.Getenv("WORKER_AUTH_TOKEN"),
+
+		HostMetricsMax: 100,
+
+		OTelEndpoint:    os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
+		OTelInsecure:    true,
+		OTelServiceName: "go-network-proxy",
+		OTelSampleRatio: 1,
+	}
+}
+
+// RegisterFlags binds every option to a flag on fs, using the current values
+// of c as the flag defaults
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Addr, "addr", c.Addr, "Listen address for the proxy and inference API (unix:/path/to.sock for a Unix socket)")
+	fs.StringVar(&c.MetricsAddr, "metrics-addr", c.MetricsAddr, "Separate (e.g. private) listen address for /metrics and /admin/*, without rate limiting; empty serves them on -addr")
+	fs.BoolVar(&c.PProf, "pprof", c.PProf, "Serve net/http/pprof profiles under /debug/pprof/ on -metrics-addr (never on -addr)")
+	fs.StringVar(&c.PEMPath, "pem", c.PEMPath, "path to pem file")
+	fs.StringVar(&c.KeyPath, "key", c.KeyPath, "path to key file")
+	fs.StringVar(&c.Proto, "proto", c.Proto, "protocol to use: http or https")
+	fs.StringVar(&c.TLSMinVersion, "tls-min-version", c.TLSMinVersion, "Minimum TLS version for -proto https: 1.0, 1.1, 1.2 or 1.3")
+	fs.StringVar(&c.TLSCiphers, "tls-ciphers", c.TLSCiphers, "Comma-separated TLS 1.0-1.2 cipher suites for -proto https, by IANA name (empty = Go defaults)")
+	fs.StringVar(&c.ACMEDomains, "acme-domains", c.ACMEDomains, "Comma-separated domains to obtain and renew certificates for via ACME (Let's Encrypt) with -proto https, instead of -pem/-key")
+	fs.StringVar(&c.ACMECacheDir, "acme-cache-dir", c.ACMECacheDir, "Directory ACME certificates and the account key are cached in")
+	fs.StringVar(&c.ACMEEmail, "acme-email", c.ACMEEmail, "Contact email for the ACME account (optional)")
+	fs.StringVar(&c.ACMEHTTPAddr, "acme-http-addr", c.ACMEHTTPAddr, "Listen address answering ACME HTTP-01 challenges; other requests are redirected to HTTPS")
+	fs.StringVar(&c.ACMEDirectory, "acme-directory", c.ACMEDirectory, "ACME directory URL, e.g. Let's Encrypt staging (empty = Let's Encrypt production)")
+	fs.BoolVar(&c.TLSServerOrder, "tls-prefer-server-ciphers", c.TLSServerOrder, "Set PreferServerCipherSuites (ignored by Go 1.18+, which orders suites itself)")
+	fs.BoolVar(&c.Transparent, "transparent", c.Transparent, "Transparent (intercepting) mode: proxy origin-form requests, which lack an absolute URL, to their Host header over the listener's scheme")
+	fs.BoolVar(&c.ProxyProto, "proxy-protocol", c.ProxyProto, "Require a PROXY protocol v1/v2 header on connections to -addr and use its client address (only behind a load balancer that sends it)")
+	fs.StringVar(&c.TrustedProxies, "trusted-proxies", c.TrustedProxies, "Comma-separated CIDRs or IPs of proxies whose X-Forwarded-For/X-Real-IP are trusted; empty ignores those headers")
+	fs.StringVar(&c.ForwardHeaders, "client-ip-headers", c.ForwardHeaders, "Comma-separated forwarding headers to read the client IP from, most preferred first: Forwarded, X-Forwarded-For, X-Real-IP")
+	fs.StringVar(&c.SocketClientID, "socket-client-id", c.SocketClientID, "Client identifier for rate limiting and logs on connections without a peer address (-addr unix:...)")
+	fs.BoolVar(&c.HTTP2, "http2", c.HTTP2, "Serve HTTP/2 (ALPN with https, prior-knowledge h2c with http) for /v1/inference and admin routes; forward proxy requests over HTTP/2 get 505")
+	fs.StringVar(&c.Blocklist, "blocklist", c.Blocklist, "Blocklist JSON file")
+	fs.StringVar(&c.BlockedPage, "blocked-page", c.BlockedPage, "HTML template file served to blocked requests, given .Host and .Rule (empty = built-in page)")
+	fs.StringVar(&c.MITMCACert, "mitm-ca-cert", c.MITMCACert, "CA certificate (PEM) to intercept CONNECT tunnels with: clients get certificates it signs and their decrypted requests are filtered, logged and forwarded (empty = tunnels are not decrypted)")
+	fs.StringVar(&c.MITMCAKey, "mitm-ca-key", c.MITMCAKey, "Private key (PEM) for -mitm-ca-cert")
+	fs.BoolVar(&c.Debug, "debug", c.Debug, "enable debug logging (same as -log-level debug)")
+
+	fs.StringVar(&c.Limiter, "limiter", c.Limiter, "Rate limiter type: memory or redis")
+	fs.StringVar(&c.RedisAddr, "redis-addr", c.RedisAddr, "Redis server address (comma-separated nodes or sentinels for cluster/sentinel mode)")
+	fs.StringVar(&c.RedisMode, "redis-mode", c.RedisMode, "Redis mode: standalone, cluster or sentinel")
+	fs.StringVar(&c.RedisMaster, "redis-master", c.RedisMaster, "Redis sentinel master name")
+	fs.StringVar(&c.RedisPassword, "redis-password", c.RedisPassword, "Redis password")
+	fs.IntVar(&c.RedisDB, "redis-db", c.RedisDB, "Redis database number")
+	fs.StringVar(&c.RedisPrefix, "redis-prefix", c.RedisPrefix, "Key prefix for rate limit buckets in Redis")
+	fs.IntVar(&c.RedisPoolSize, "redis-pool-size", c.RedisPoolSize, "Redis connection pool size")
+	fs.DurationVar(&c.RedisTimeout, "redis-timeout", c.RedisTimeout, "Per-call Redis timeout for rate limit checks")
+	fs.BoolVar(&c.RedisFailOpen, "redis-fail-open", c.RedisFailOpen, "Allow requests when Redis is unavailable (false = reject)")
+	fs.IntVar(&c.RedisBreakerThreshold, "redis-breaker-threshold", c.RedisBreakerThreshold, "Consecutive Redis errors before the circuit breaker opens (0 disables)")
+	fs.DurationVar(&c.RedisBreakerCooldown, "redis-breaker-cooldown", c.RedisBreakerCooldown, "How long the circuit breaker stays open before probing Redis")
+	fs.IntVar(&c.RateLimit, "rate-limit", c.RateLimit, "Requests per minute per IP")
+	fs.IntVar(&c.RateBurst, "rate-burst", c.RateBurst, "Burst size for rate limiter")
+	fs.StringVar(&c.RateLimitExempt, "rate-limit-exempt", c.RateLimitExempt, "Comma-separated gateway paths that skip rate limiting; a trailing / exempts the whole subtree (e.g. /admin/)")
+	fs.StringVar(&c.RateLimitMethods, "rate-limit-methods", c.RateLimitMethods, "Per-method rate limits with their own buckets, as method=limit:burst (limit per minute), e.g. POST=20:5,CONNECT=10:2; other methods use -rate-limit")
+	fs.DurationVar(&c.MemoryCleanupInterval, "memory-cleanup-interval", c.MemoryCleanupInterval, "How often the memory limiter evicts idle per-IP buckets")
+	fs.DurationVar(&c.MemoryIdleTimeout, "memory-idle-timeout", c.MemoryIdleTimeout, "How long a per-IP bucket must go unused before the memory limiter evicts it")
+	fs.IntVar(&c.MemoryMaxEntries, "memory-max-entries", c.MemoryMaxEntries, "Max per-IP buckets the memory limiter holds; the least recently used is evicted at the cap (0 = unbounded)")
+	fs.IntVar(&c.MaxInFlight, "max-in-flight", c.MaxInFlight, "Max concurrent requests across all clients; more get 503 with Retry-After (0 = unlimited)")
+	fs.BoolVar(&c.MaxInFlightConnect, "max-in-flight-connect", c.MaxInFlightConnect, "Count CONNECT tunnels and WebSocket upgrades against -max-in-flight for their whole lifetime (default exempts them)")
+
+	fs.StringVar(&c.WorkerAddrs, "worker-addrs", c.WorkerAddrs, "Comma-separated list of inference worker addresses, each optionally addr=weight")
+	fs.StringVar(&c.WorkerModels, "worker-models", c.WorkerModels, "Comma-separated models the -worker-addrs workers host, listed by /v1/models")
+	fs.StringVar(&c.ModelWorkers, "model-workers", c.ModelWorkers, "Per-model worker pools: model=addr1,addr2=weight;model2=addr3 (each model gets its own queue)")
+	fs.IntVar(&c.QueueSize, "queue-size", c.QueueSize, "Maximum number of queued inference requests (0 = unbounded)")
+	fs.DurationVar(&c.InferenceCacheTTL, "inference-cache-ttl", c.InferenceCacheTTL, "TTL for cached deterministic (temperature 0) completions; 0 disables caching")
+	fs.IntVar(&c.InferenceCacheSize, "inference-cache-size", c.InferenceCacheSize, "Maximum number of cached completions")
+	fs.StringVar(&c.CORSOrigins, "cors-origins", c.CORSOrigins, "Comma-separated origins allowed to call the inference API from browsers (\"*\" for any; empty disables CORS)")
+	fs.StringVar(&c.ProxyAuthFile, "proxy-auth-file", c.ProxyAuthFile, "htpasswd file (apr1, SHA or plaintext) required for forward proxy use; empty disables proxy auth")
+	fs.StringVar(&c.ProxyAuthRealm, "proxy-auth-realm", c.ProxyAuthRealm, "Realm sent in the Proxy-Authenticate challenge")
+	fs.StringVar(&c.ResponseHeaders, "response-headers", c.ResponseHeaders, "Headers added to every response that doesn't already set them, as comma-separated Name: value pairs (e.g. \"X-Proxy-Node: node-3\")")
+	fs.StringVar(&c.ResponseHeaderOverrides, "response-header-overrides", c.ResponseHeaderOverrides, "Headers set on every response, replacing any the upstream or handler set, as comma-separated Name: value pairs")
+	fs.StringVar(&c.RequestHeaderRemove, "request-header-remove", c.RequestHeaderRemove, "Comma-separated headers removed from requests before they are forwarded (e.g. X-Client-Data,Referer)")
+	fs.StringVar(&c.RequestHeaderSet, "request-header-set", c.RequestHeaderSet, "Headers set on requests before they are forwarded, replacing the client's, as comma-separated Name: value pairs (e.g. \"User-Agent: Mozilla/5.0\")")
+	fs.IntVar(&c.CompressionMinSize, "compression-min-size", c.CompressionMinSize, "Gzip/deflate responses of at least this many bytes for clients that accept it (-1 disables)")
+	fs.IntVar(&c.CopyBufferSize, "copy-buffer-size", c.CopyBufferSize, "Pooled buffer size for copying proxied responses and tunnel data; larger means fewer syscalls on big transfers")
+	fs.Int64Var(&c.MaxBodySize, "max-body-size", c.MaxBodySize, "Max request body bytes, including forwarded uploads; larger bodies get 413 (0 = unlimited)")
+	fs.StringVar(&c.DefaultModel, "default-model", c.DefaultModel, "Model for inference requests that don't name one")
+	fs.IntVar(&c.DefaultMaxTokens, "default-max-tokens", c.DefaultMaxTokens, "max_tokens for inference requests that don't set it")
+	fs.Float64Var(&c.DefaultTemperature, "default-temperature", c.DefaultTemperature, "Temperature for inference requests that don't set it (0 = deterministic, and cacheable)")
+	fs.IntVar(&c.DefaultPriority, "default-priority", c.DefaultPriority, "Priority (1-10) for inference requests that don't set one and have no API key tier")
+	fs.IntVar(&c.MinPriority, "min-priority", c.MinPriority, "Lowest inference priority; lower values are raised to it")
+	fs.IntVar(&c.MaxPriority, "max-priority", c.MaxPriority, "Highest inference priority; higher values are lowered to it")
+	fs.BoolVar(&c.StrictPriority, "strict-priority", c.StrictPriority, "Reject inference requests whose priority is outside -min-priority..-max-priority with 400 instead of clamping it")
+	fs.IntVar(&c.MaxPromptBytes, "max-prompt-bytes", c.MaxPromptBytes, "Reject inference prompts larger than this with 413 (0 = unlimited)")
+	fs.IntVar(&c.MaxTokens, "max-tokens", c.MaxTokens, "Clamp requested max_tokens to this ceiling (0 = unlimited)")
+	fs.DurationVar(&c.AdmissionMaxWait, "admission-max-wait", c.AdmissionMaxWait, "Reject inference requests with 503 when the estimated queue wait exceeds this (0 = only the client's X-Request-Timeout)")
+	fs.DurationVar(&c.SSEHeartbeat, "sse-heartbeat", c.SSEHeartbeat, "Send an SSE \": ping\" comment this often while a stream waits for its first token (0 disables)")
+	fs.IntVar(&c.MaxStopSequences, "max-stop-sequences", c.MaxStopSequences, "Reject inference requests with more stop sequences than this with 400 (0 = unlimited)")
+	fs.StringVar(&c.InferenceQuotas, "inference-quotas", c.InferenceQuotas, "JSON file of daily/monthly token quotas per API key and model, counted in Redis (-redis-* flags)")
+	fs.StringVar(&c.APIKeyTiers, "api-key-tiers", c.APIKeyTiers, "JSON file mapping API keys to inference priority; when set, the request body's priority is ignored")
+
+	fs.StringVar(&c.LogFormat, "log-format", c.LogFormat, "Log format: json or text")
+	fs.StringVar(&c.LogOutput, "log-output", c.LogOutput, "Application log destination: stdout, stderr or a file path")
+	fs.StringVar(&c.LogLevel, "log-level", c.LogLevel, "Application log level: debug, info, warn or error")
+	fs.StringVar(&c.AccessLogOutput, "access-log-output", c.AccessLogOutput, "Access log destination: stdout, stderr or a file path (default: same as application log)")
+	fs.StringVar(&c.AccessLogFormat, "access-log-format", c.AccessLogFormat, "Access log format: json or text (default: -log-format)")
+	fs.StringVar(&c.RedactHeaders, "log-redact-headers", c.RedactHeaders, "Comma-separated headers whose values are replaced with [REDACTED] wherever headers are logged (e.g. debug request dumps)")
+	fs.StringVar(&c.AccessLogLevel, "access-log-level", c.AccessLogLevel, "Access log level (default: -log-level)")
+	fs.IntVar(&c.AccessLogMaxSize, "access-log-max-size", c.AccessLogMaxSize, "Rotate a file access log once it reaches this many MB (0 = never)")
+	fs.IntVar(&c.AccessLogMaxBackups, "access-log-max-backups", c.AccessLogMaxBackups, "Rotated access log files to keep")
+	fs.IntVar(&c.AccessLogSampleRate, "access-log-sample-rate", c.AccessLogSampleRate, "Log 1 in N fast successful requests; errors and slow requests are always logged")
+	fs.DurationVar(&c.AccessLogSlowThreshold, "access-log-slow-threshold", c.AccessLogSlowThreshold, "Always log requests at least this slow when sampling (0 = none)")
+	fs.StringVar(&c.AccessLogInclude, "access-log-include", c.AccessLogInclude, "Only log requests matching one of these comma-separated status@host rules, e.g. 4xx,@*.example.com (5xx is always logged)")
+	fs.StringVar(&c.AccessLogExclude, "access-log-exclude", c.AccessLogExclude, "Don't log requests matching any of these comma-separated status@host rules, e.g. 2xx@*.internal,304 (5xx is always logged)")
+
+	// Timeouts
+	fs.DurationVar(&c.ReadTimeout, "read-timeout", c.ReadTimeout, "HTTP read timeout")
+	fs.DurationVar(&c.WriteTimeout, "write-timeout", c.WriteTimeout, "HTTP write timeout")
+	fs.DurationVar(&c.IdleTimeout, "idle-timeout", c.IdleTimeout, "HTTP idle timeout")
+	fs.DurationVar(&c.DialTimeout, "dial-timeout", c.DialTimeout, "Upstream connection dial timeout")
+	fs.DurationVar(&c.TunnelKeepAlive, "tunnel-keepalive", c.TunnelKeepAlive, "TCP keep-alive period for CONNECT tunnels (negative disables)")
+	fs.DurationVar(&c.TunnelFallback, "tunnel-fallback-delay", c.TunnelFallback, "Happy Eyeballs delay before falling back from IPv6 to IPv4 when dialing tunnels (0 = 300ms, negative disables)")
+	fs.StringVar(&c.TunnelLocalAddr, "tunnel-local-addr", c.TunnelLocalAddr, "Source IP for outbound tunnel connections (empty = any)")
+	fs.DurationVar(&c.DNSCacheTTL, "dns-cache-ttl", c.DNSCacheTTL, "How long resolved upstream addresses are reused by the proxy's dialers (0 = resolve on every dial)")
+	fs.IntVar(&c.DNSCacheSize, "dns-cache-size", c.DNSCacheSize, "Max upstream hostnames kept in the DNS cache")
+	fs.DurationVar(&c.InferenceTimeout, "inference-timeout", c.InferenceTimeout, "Max inference request duration")
+	fs.StringVar(&c.ModelTimeouts, "model-timeouts", c.ModelTimeouts, "Per-model inference timeouts overriding -inference-timeout: model=duration,... (e.g. summarize=5m,classify=10s)")
+	fs.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", c.ShutdownTimeout, "Graceful shutdown timeout")
+	fs.DurationVar(&c.RequestTimeout, "request-timeout", c.RequestTimeout, "Max time to start a response before 504; CONNECT, upgrades (WebSocket) and /v1/inference are exempt (0 disables)")
+
+	// Workers
+	fs.DurationVar(&c.HealthCheckInterval, "health-check-interval", c.HealthCheckInterval, "Interval between worker health probes (0 disables)")
+	fs.DurationVar(&c.HealthCheckTimeout, "health-check-timeout", c.HealthCheckTimeout, "Timeout for a single worker health probe")
+	fs.IntVar(&c.UnhealthyThreshold, "unhealthy-threshold", c.UnhealthyThreshold, "Consecutive failed probes before a worker leaves rotation")
+	fs.IntVar(&c.ReconnectThreshold, "reconnect-threshold", c.ReconnectThreshold, "Consecutive request failures before a worker connection is rebuilt (0 disables)")
+	fs.DurationVar(&c.ReconnectBackoff, "reconnect-backoff", c.ReconnectBackoff, "Wait before the first retry of a failed worker reconnect; doubles per attempt, with jitter")
+	fs.DurationVar(&c.ReconnectMaxBackoff, "reconnect-max-backoff", c.ReconnectMaxBackoff, "Cap on the wait between worker reconnect attempts")
+	fs.IntVar(&c.MaxRetries, "max-retries", c.MaxRetries, "Times a request is requeued when its worker fails before streaming any tokens (0 disables)")
+	fs.IntVar(&c.WorkerMaxConcurrent, "worker-max-concurrent", c.WorkerMaxConcurrent, "Concurrent requests per worker (per unit of weight)")
+	fs.IntVar(&c.BatchSize, "batch-size", c.BatchSize, "Max requests for one model sent to a worker in a single BatchGenerate call (1 disables batching; pull balancer only)")
+	fs.DurationVar(&c.BatchWindow, "batch-window", c.BatchWindow, "How long a worker waits for more requests to fill a batch")
+	fs.StringVar(&c.WorkerTLSCA, "worker-tls-ca", c.WorkerTLSCA, "CA certificate for worker gRPC TLS (empty = plaintext)")
+	fs.StringVar(&c.WorkerTLSCert, "worker-tls-cert", c.WorkerTLSCert, "Client certificate for worker mTLS")
+	fs.StringVar(&c.WorkerTLSKey, "worker-tls-key", c.WorkerTLSKey, "Client key for worker mTLS")
+	fs.StringVar(&c.WorkerTLSServerName, "worker-tls-server-name", c.WorkerTLSServerName, "Override the server name verified in worker certificates")
+	fs.StringVar(&c.WorkerAuthToken, "worker-auth-token", c.WorkerAuthToken, "Bearer token sent to workers on every RPC (default $WORKER_AUTH_TOKEN)")
+	fs.StringVar(&c.Balancer, "balancer", c.Balancer, "Worker selection strategy: pull, least-conn or round-robin")
+
+	// Per-host metrics
+	fs.StringVar(&c.HostMetricsAllow, "host-metrics-allow", c.HostMetricsAllow, "Comma-separated hosts that get their own proxy_requests_by_host_total label (empty = first -host-metrics-max hosts seen)")
+	fs.IntVar(&c.HostMetricsMax, "host-metrics-max", c.HostMetricsMax, "Distinct host labels before the rest count as \"other\" (0 = unlimited)")
+	fs.BoolVar(&c.HostMetricsLatency, "host-metrics-latency", c.HostMetricsLatency, "Also record per-host upstream latency histograms")
+
+	// Tracing
+	fs.StringVar(&c.OTelEndpoint, "otel-endpoint", c.OTelEndpoint, "OTLP gRPC collector address for traces (default $OTEL_EXPORTER_OTLP_ENDPOINT; empty disables)")
+	fs.BoolVar(&c.OTelInsecure, "otel-insecure", c.OTelInsecure, "Connect to the OTLP collector without TLS")
+	fs.StringVar(&c.OTelServiceName, "otel-service-name", c.OTelServiceName, "service.name reported on spans")
+	fs.Float64Var(&c.OTelSampleRatio, "otel-sample-ratio", c.OTelSampleRatio, "Fraction of new traces to sample (incoming sampled traces are always kept)")
+}
+
+// LoadFile applies a JSON or YAML config file (chosen by extension; .yaml or
+// .yml is YAML, anything else JSON) to the flags in fs. Keys are flag names,
+// e.g. {"rate-limit": 200, "read-timeout": "15s", "worker-addrs": ["a:1", "b:2"]};
+// lists are joined with commas. Flags already set on the command line keep
+// their values, so flags override the file. Unknown keys are an error.
+func LoadFile(fs *flag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	values := map[string]any{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	default:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		err = dec.Decode(&values)
+	}
+	if err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	for _, name := range keys {
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("%s: unknown option %q", path, name)
+		}
+		if set[name] {
+			continue
+		}
+		s, err := flagValue(values[name])
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", path, name, err)
+		}
+		if err := fs.Set(name, s); err != nil {
+			return fmt.Errorf("%s: %s: %w", path, name, err)
+		}
+	}
+	return nil
+}
+
+// EnvPrefix starts the environment variable name of every option
+const EnvPrefix = "PROXY_"
+
+// EnvName returns the environment variable for a flag, e.g. rate-limit ->
+// PROXY_RATE_LIMIT
+func EnvName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// LoadEnv sets every flag in fs not given on the command line from its
+// PROXY_* environment variable, if present. Call it before LoadFile so the
+// precedence is flags > environment > config file > defaults.
+func LoadEnv(fs *flag.FlagSet) error {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] {
+			return
+		}
+		name := EnvName(f.Name)
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return
+		}
+		if err := fs.Set(f.Name, v); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// flagValue renders a decoded file value in the string form its flag parses
+func flagValue(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case json.Number:
+		return v.String(), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []any:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			s, err := flagValue(item)
+			if err != nil {
+				return "", err
+			}
+			parts[i] = s
+		}
+		return strings.Join(parts, ","), nil
+	case nil:
+		return "", nil
+	default:
+		return "", fmt.Errorf("unsupported value %v (%T)", v, v)
+	}
+}
+
+// Validate reports every invalid option at once so startup fails fast
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Addr != "" && c.Addr != "unix:", "addr is required")
+	check(c.SocketClientID != "", "socket-client-id is required")
+	check(c.MetricsAddr == "" || c.MetricsAddr != c.Addr, "metrics-addr must differ from addr (leave it empty to share)")
+	check(!c.PProf || c.MetricsAddr != "", "pprof requires metrics-addr, so profiles are not served on the public listener")
+	check(c.Proto == "http" || c.Proto == "https", "proto must be http or https, got %q", c.Proto)
+	if c.ACMEDomains != "" {
+		check(c.Proto == "https", "acme-domains requires -proto https")
+		check(c.ACMECacheDir != "", "acme-cache-dir is required with acme-domains")
+		check(c.ACMEHTTPAddr != "", "acme-http-addr is required with acme-domains")
+	}
+	if c.Proto == "https" {
+		check(c.ACMEDomains != "" || c.PEMPath != "" && c.KeyPath != "", "https requires pem and key")
+		check(slices.Contains([]string{"1.0", "1.1", "1.2", "1.3"}, c.TLSMinVersion), "tls-min-version must be 1.0, 1.1, 1.2 or 1.3, got %q", c.TLSMinVersion)
+	}
+	check((c.MITMCACert == "") == (c.MITMCAKey == ""), "mitm-ca-cert and mitm-ca-key must be set together")
+	check(c.LogFormat == "json" || c.LogFormat == "text", "log-format must be json or text, got %q", c.LogFormat)
+	check(slices.Contains([]string{"memory", "redis"}, c.Limiter), "limiter must be memory or redis, got %q", c.Limiter)
+	if c.Limiter == "redis" {
+		check(c.RedisAddr != "", "redis-addr is required with the redis limiter")
+	}
+	if c.Limiter == "memory" {
+		check(c.MemoryCleanupInterval > 0, "memory-cleanup-interval must be positive, got %s", c.MemoryCleanupInterval)
+		check(c.MemoryIdleTimeout > 0, "memory-idle-timeout must be positive, got %s", c.MemoryIdleTimeout)
+		check(c.MemoryMaxEntries >= 0, "memory-max-entries must not be negative, got %d", c.MemoryMaxEntries)
+	}
+	check(c.RateLimit > 0, "rate-limit must be positive, got %d", c.RateLimit)
+	check(c.RateBurst > 0, "rate-burst must be positive, got %d", c.RateBurst)
+	check(c.MaxInFlight >= 0, "max-in-flight must not be negative, got %d", c.MaxInFlight)
+	check(slices.Contains([]string{"", "pull", "least-conn", "round-robin"}, c.Balancer),
+		"balancer must be pull, least-conn or round-robin, got %q", c.Balancer)
+	check(c.CopyBufferSize > 0, "copy-buffer-size must be positive, got %d", c.CopyBufferSize)
+	check(c.DefaultModel != "", "default-model is required")
+	check(c.DefaultMaxTokens >= 1, "default-max-tokens must be at least 1, got %d", c.DefaultMaxTokens)
+	check(c.DefaultTemperature >= 0, "default-temperature must not be negative, got %v", c.DefaultTemperature)
+	check(c.DefaultPriority >= 1 && c.DefaultPriority <= 10, "default-priority must be between 1 and 10, got %d", c.DefaultPriority)
+	check(c.MinPriority >= 1 && c.MinPriority <= c.MaxPriority, "min-priority must be at least 1 and at most max-priority, got %d..%d", c.MinPriority, c.MaxPriority)
+	check(c.DefaultPriority >= c.MinPriority && c.DefaultPriority <= c.MaxPriority, "default-priority must be between min-priority and max-priority, got %d", c.DefaultPriority)
+	check(c.WorkerMaxConcurrent >= 1, "worker-max-concurrent must be at least 1, got %d", c.WorkerMaxConcurrent)
+	check(c.BatchSize >= 1, "batch-size must be at least 1, got %d", c.BatchSize)
+	check(c.BatchSize == 1 || c.Balancer == "" || c.Balancer == "pull", "batch-size requires the pull balancer, got %q", c.Balancer)
+	check(c.ReconnectBackoff > 0, "reconnect-backoff must be positive, got %s", c.ReconnectBackoff)
+	check(c.ReconnectMaxBackoff >= c.ReconnectBackoff, "reconnect-max-backoff must be at least reconnect-backoff, got %s", c.ReconnectMaxBackoff)
+	check(c.DNSCacheSize >= 0, "dns-cache-size must not be negative, got %d", c.DNSCacheSize)
+	check(c.TunnelLocalAddr == "" || net.ParseIP(c.TunnelLocalAddr) != nil, "tunnel-local-addr must be an IP address, got %q", c.TunnelLocalAddr)
+	check(c.OTelSampleRatio >= 0 && c.OTelSampleRatio <= 1, "otel-sample-ratio must be between 0 and 1, got %v", c.OTelSampleRatio)
+
+	for _, t := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{"read-timeout", c.ReadTimeout},
+		{"write-timeout", c.WriteTimeout},
+		{"idle-timeout", c.IdleTimeout},
+		{"dial-timeout", c.DialTimeout},
+		{"dns-cache-ttl", c.DNSCacheTTL},
+		{"inference-timeout", c.InferenceTimeout},
+		{"shutdown-timeout", c.ShutdownTimeout},
+		{"request-timeout", c.RequestTimeout},
+		{"batch-window", c.BatchWindow},
+	} {
+		check(t.d >= 0, "%s must not be negative, got %s", t.name, t.d)
+	}
+
+	return errors.Join(errs...)
+}
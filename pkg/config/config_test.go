@@ -0,0 +1,150 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func load(t *testing.T, name, content string, args ...string) (Config, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Default()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg.RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	err := LoadFile(fs, path)
+	return cfg, err
+}
+
+func TestLoadFile_JSON(t *testing.T) {
+	cfg, err := load(t, "gateway.json", `{
+		"rate-limit": 250,
+		"read-timeout": "15s",
+		"max-body-size": 20971520,
+		"redis-fail-open": false,
+		"otel-sample-ratio": 0.25,
+		"worker-addrs": ["a:50051", "b:50051=2"]
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.RateLimit != 250 || cfg.ReadTimeout != 15*time.Second || cfg.MaxBodySize != 20<<20 {
+		t.Errorf("numbers not applied: %+v", cfg)
+	}
+	if cfg.RedisFailOpen || cfg.OTelSampleRatio != 0.25 {
+		t.Errorf("bool/float not applied: fail-open=%v ratio=%v", cfg.RedisFailOpen, cfg.OTelSampleRatio)
+	}
+	if cfg.WorkerAddrs != "a:50051,b:50051=2" {
+		t.Errorf("list not joined: %q", cfg.WorkerAddrs)
+	}
+	if cfg.RateBurst != Default().RateBurst {
+		t.Errorf("unset option changed: burst %d", cfg.RateBurst)
+	}
+}
+
+func TestLoadFile_YAMLFlagsOverride(t *testing.T) {
+	cfg, err := load(t, "gateway.yaml", "limiter: memory\nrate-limit: 50\nlog-format: text\n",
+		"-rate-limit", "75")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.RateLimit != 75 {
+		t.Errorf("command-line flag should win over the file, got %d", cfg.RateLimit)
+	}
+	if cfg.Limiter != "memory" || cfg.LogFormat != "text" {
+		t.Errorf("file values not applied: limiter=%q format=%q", cfg.Limiter, cfg.LogFormat)
+	}
+}
+
+func TestLoadFile_Errors(t *testing.T) {
+	if _, err := load(t, "gateway.json", `{"rate-limt": 5}`); err == nil || !strings.Contains(err.Error(), "rate-limt") {
+		t.Errorf("expected unknown option error, got %v", err)
+	}
+	if _, err := load(t, "gateway.json", `{"read-timeout": "soon"}`); err == nil || !strings.Contains(err.Error(), "read-timeout") {
+		t.Errorf("expected invalid duration error, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Fatalf("defaults should be valid: %v", err)
+	}
+
+	cfg := Default()
+	cfg.Proto = "ftp"
+	cfg.RateLimit = 0
+	cfg.Limiter = "redis"
+	cfg.RedisAddr = ""
+	cfg.DefaultPriority = 11
+	cfg.ACMEDomains = "example.com"
+	cfg.PProf = true
+	cfg.ReconnectMaxBackoff = time.Millisecond
+	cfg.BatchSize = 0
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, want := range []string{"proto", "rate-limit", "redis-addr", "default-priority", "acme-domains", "pprof", "reconnect-max-backoff", "batch-size"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+}
+
+func TestPrecedence_FlagsEnvFileDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gateway.json")
+	if err := os.WriteFile(path, []byte(`{"rate-limit": 10, "rate-burst": 11, "queue-size": 12}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PROXY_RATE_LIMIT", "20")
+	t.Setenv("PROXY_RATE_BURST", "21")
+
+	cfg := Default()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg.RegisterFlags(fs)
+	if err := fs.Parse([]string{"-rate-limit", "30"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadEnv(fs); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadFile(fs, path); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.RateLimit != 30 {
+		t.Errorf("flag should beat env and file: rate-limit %d", cfg.RateLimit)
+	}
+	if cfg.RateBurst != 21 {
+		t.Errorf("env should beat file: rate-burst %d", cfg.RateBurst)
+	}
+	if cfg.QueueSize != 12 {
+		t.Errorf("file should beat default: queue-size %d", cfg.QueueSize)
+	}
+	if cfg.MaxTokens != Default().MaxTokens {
+		t.Errorf("default changed: max-tokens %d", cfg.MaxTokens)
+	}
+}
+
+func TestLoadEnv_InvalidValue(t *testing.T) {
+	t.Setenv("PROXY_READ_TIMEOUT", "soon")
+
+	cfg := Default()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg.RegisterFlags(fs)
+	if err := LoadEnv(fs); err == nil || !strings.Contains(err.Error(), "PROXY_READ_TIMEOUT") {
+		t.Errorf("expected error naming the variable, got %v", err)
+	}
+}
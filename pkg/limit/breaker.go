@@ -0,0 +1,144 @@
+package limit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aluko123/go-network-proxy/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Circuit breaker states (also the value of the rate_limiter_breaker_state gauge)
+const (
+	breakerClosed   = 0
+	breakerOpen     = 1
+	breakerHalfOpen = 2
+)
+
+// circuitBreaker trips after threshold consecutive failures within window and
+// short-circuits calls for cooldown before letting a single probe through
+type circuitBreaker struct {
+	threshold int
+	window    time.Duration
+	cooldown  time.Duration
+	gauge     prometheus.Gauge // this breaker's rate_limiter_breaker_state
+
+	mu           sync.Mutex
+	state        int
+	failures     int
+	firstFailure time.Time
+	openedAt     time.Time
+	probing      bool
+}
+
+// newCircuitBreaker reports its state under keyPrefix, its limiter's key
+// prefix, so limiters with their own breakers don't overwrite each other's
+func newCircuitBreaker(keyPrefix string, threshold int, window, cooldown time.Duration) *circuitBreaker {
+	b := &circuitBreaker{
+		threshold: threshold,
+		window:    window,
+		cooldown:  cooldown,
+		gauge:     metrics.RateLimiterBreakerState.WithLabelValues(keyPrefix),
+	}
+	b.gauge.Set(breakerClosed)
+	return b
+}
+
+// allow reports whether a call should be attempted
+func (b *circuitBreaker) allow() bool {
+	if b.threshold <= 0 {
+		return true // disabled
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.setState(breakerHalfOpen)
+		b.probing = true
+		return true
+	case breakerHalfOpen:
+		// Only one probe at a time
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// success records a successful call, closing the breaker
+func (b *circuitBreaker) success() {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probing = false
+	if b.state != breakerClosed {
+		b.setState(breakerClosed)
+	}
+}
+
+// failure records a failed call, tripping the breaker once the threshold is hit
+func (b *circuitBreaker) failure() {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.probing = false
+
+	if b.state == breakerHalfOpen {
+		b.openedAt = now
+		b.setState(breakerOpen)
+		return
+	}
+
+	if b.failures == 0 || now.Sub(b.firstFailure) > b.window {
+		b.failures = 0
+		b.firstFailure = now
+	}
+	b.failures++
+
+	if b.failures >= b.threshold {
+		b.openedAt = now
+		b.setState(breakerOpen)
+	}
+}
+
+// abort releases a half-open probe slot without recording an outcome
+// (e.g. the caller cancelled before Redis answered)
+func (b *circuitBreaker) abort() {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *circuitBreaker) currentState() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// setState must be called with mu held
+func (b *circuitBreaker) setState(state int) {
+	b.state = state
+	b.gauge.Set(float64(state))
+}
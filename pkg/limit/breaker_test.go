@@ -0,0 +1,89 @@
+package limit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aluko123/go-network-proxy/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCircuitBreaker_TripsAfterThreshold(t *testing.T) {
+	b := newCircuitBreaker("test:", 3, time.Minute, time.Hour)
+
+	for i := 0; i < 2; i++ {
+		b.failure()
+		if !b.allow() {
+			t.Fatalf("breaker opened after %d failures, threshold is 3", i+1)
+		}
+	}
+
+	b.failure()
+	if b.allow() {
+		t.Error("expected breaker to short-circuit after 3 consecutive failures")
+	}
+	if b.currentState() != breakerOpen {
+		t.Errorf("expected open state, got %d", b.currentState())
+	}
+}
+
+func TestCircuitBreaker_SuccessResetsFailures(t *testing.T) {
+	b := newCircuitBreaker("test:", 2, time.Minute, time.Hour)
+
+	b.failure()
+	b.success()
+	b.failure()
+
+	if !b.allow() {
+		t.Error("failures separated by a success should not trip the breaker")
+	}
+}
+
+func TestCircuitBreaker_HalfOpenProbe(t *testing.T) {
+	b := newCircuitBreaker("test:", 1, time.Minute, 10*time.Millisecond)
+
+	b.failure()
+	if b.allow() {
+		t.Fatal("expected breaker to be open")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	// First call after cooldown is the probe; concurrent calls stay short-circuited
+	if !b.allow() {
+		t.Fatal("expected a probe after cooldown")
+	}
+	if b.allow() {
+		t.Error("only one probe should be allowed while half-open")
+	}
+
+	// Failed probe re-opens
+	b.failure()
+	if b.currentState() != breakerOpen {
+		t.Fatalf("expected failed probe to re-open breaker, got %d", b.currentState())
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if !b.allow() {
+		t.Fatal("expected another probe after cooldown")
+	}
+	b.success()
+	if b.currentState() != breakerClosed {
+		t.Errorf("expected successful probe to close breaker, got %d", b.currentState())
+	}
+}
+
+func TestCircuitBreaker_GaugePerKeyPrefix(t *testing.T) {
+	post := newCircuitBreaker("gauge:POST:", 1, time.Minute, time.Hour)
+	post.failure()
+	// A limiter created later, or changing state later, must not hide it
+	shared := newCircuitBreaker("gauge:", 1, time.Minute, time.Hour)
+	shared.success()
+
+	if got := testutil.ToFloat64(metrics.RateLimiterBreakerState.WithLabelValues("gauge:POST:")); got != breakerOpen {
+		t.Errorf("POST breaker gauge = %v, want open", got)
+	}
+	if got := testutil.ToFloat64(metrics.RateLimiterBreakerState.WithLabelValues("gauge:")); got != breakerClosed {
+		t.Errorf("shared breaker gauge = %v, want closed", got)
+	}
+}
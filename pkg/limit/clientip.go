@@ -0,0 +1,231 @@
+package limit
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// trustedProxies are the peers whose forwarding headers GetIP believes.
+// Empty (the default) ignores them all.
+var trustedProxies []*net.IPNet
+
+// clientIPHeaders are the forwarding headers GetIP reads, most preferred
+// first, in canonical form. Forwarded is opt-in: a proxy that only maintains
+// X-Forwarded-For would pass a client's forged Forwarded header through.
+var clientIPHeaders = []string{"X-Forwarded-For", "X-Real-Ip"}
+
+// socketClientID stands in for the client IP of connections that have no
+// peer address, such as those accepted on a Unix socket
+var socketClientID = "unix"
+
+// SetSocketClientID sets the identifier GetIP returns for connections without
+// a peer address (Unix sockets). Those clients share one rate limit bucket.
+func SetSocketClientID(id string) {
+	socketClientID = id
+}
+
+// SetClientIPHeaders sets which forwarding headers GetIP reads, in order of
+// precedence: any of "Forwarded" (RFC 7239), "X-Forwarded-For" and
+// "X-Real-IP". The first one that yields an address wins. It is meant to be
+// called once at startup.
+func SetClientIPHeaders(names []string) error {
+	headers := make([]string, 0, len(names))
+	for _, name := range names {
+		name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+		switch name {
+		case "":
+			continue
+		case "Forwarded", "X-Forwarded-For", "X-Real-Ip":
+			headers = append(headers, name)
+		default:
+			return fmt.Errorf("unsupported client IP header %q", name)
+		}
+	}
+	clientIPHeaders = headers
+	return nil
+}
+
+// SetTrustedProxies sets the proxies allowed to report the client IP, as CIDRs
+// or bare IPs. It is meant to be called once at startup.
+func SetTrustedProxies(cidrs []string) error {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		if !strings.Contains(c, "/") {
+			ip := net.ParseIP(c)
+			if ip == nil {
+				return fmt.Errorf("invalid trusted proxy %q", c)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %q: %w", c, err)
+		}
+		nets = append(nets, n)
+	}
+	trustedProxies = nets
+	return nil
+}
+
+func isTrusted(ip net.IP) bool {
+	for _, n := range trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHop parses one forwarded address. Entries are normally bare IPs, but
+// some proxies append a port ("1.2.3.4:5678", "[2001:db8::1]:443"); a bare
+// IPv6 address is tried first since SplitHostPort would misread it.
+func parseHop(s string) net.IP {
+	s = strings.TrimSpace(s)
+	if ip := net.ParseIP(s); ip != nil {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		return net.ParseIP(host)
+	}
+	return nil
+}
+
+// GetIP extracts the client IP from the request. Forwarding headers are only
+// honored when the direct peer is a trusted proxy, and are tried in the
+// SetClientIPHeaders order. A hop chain (X-Forwarded-For or Forwarded) is
+// walked right to left, skipping trusted hops, so a client cannot spoof its
+// address by prepending entries.
+func GetIP(r *http.Request) string {
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+	if peer == "" || peer == "@" {
+		// Unix socket peers are unnamed ("" or "@" on Linux)
+		return socketClientID
+	}
+	peerIP := net.ParseIP(peer)
+	if peerIP == nil || !isTrusted(peerIP) {
+		return peer
+	}
+
+	for _, name := range clientIPHeaders {
+		var client string
+		switch name {
+		case "Forwarded":
+			client = walkHops(forwardedFor(r.Header.Values("Forwarded")))
+		case "X-Forwarded-For":
+			// Multiple X-Forwarded-For headers form one list, in order
+			var hops []string
+			for _, v := range r.Header.Values("X-Forwarded-For") {
+				hops = append(hops, strings.Split(v, ",")...)
+			}
+			client = walkHops(hops)
+		case "X-Real-Ip":
+			if ip := parseHop(r.Header.Get("X-Real-IP")); ip != nil {
+				client = ip.String()
+			}
+		}
+		if client != "" {
+			return client
+		}
+	}
+	return peer
+}
+
+// walkHops returns the client address from a hop chain: the rightmost
+// untrusted hop, or "" if the chain yields none
+func walkHops(hops []string) string {
+	client := ""
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := parseHop(hops[i])
+		if ip == nil {
+			// Nothing left of an unparseable hop can be trusted
+			break
+		}
+		client = ip.String()
+		if !isTrusted(ip) {
+			return client
+		}
+	}
+	// Every hop was a trusted proxy; the leftmost is the closest to the client
+	return client
+}
+
+// forwardedFor extracts the for= node of every element of RFC 7239
+// Forwarded headers, in order. Quoted values are unquoted and IPv6 brackets
+// dropped, so parseHop reads them; "unknown" and obfuscated nodes ("_hidden")
+// stay as they are and stop the walk. An element without for= yields "".
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, v := range values {
+		for _, elem := range splitQuoted(v, ',') {
+			node := ""
+			for _, pair := range splitQuoted(elem, ';') {
+				name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(name, "for") {
+					node = unquote(value)
+				}
+			}
+			if host, ok := strings.CutPrefix(node, "["); ok {
+				// "[2001:db8::1]" or "[2001:db8::1]:4711"
+				if addr, port, found := strings.Cut(host, "]"); found {
+					node = addr
+					if port != "" {
+						node = "[" + addr + "]" + port
+					}
+				}
+			}
+			hops = append(hops, node)
+		}
+	}
+	return hops
+}
+
+// splitQuoted splits s at sep, except inside quoted strings
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	quoted, escaped, start := false, false, 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case escaped:
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unquote returns a token as is, or the contents of a quoted string with its
+// backslash escapes resolved
+func unquote(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	var b strings.Builder
+	for i := 1; i < len(s)-1; i++ {
+		if s[i] == '\\' && i+1 < len(s)-1 {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,205 @@
+package limit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetIP_TrustedProxies(t *testing.T) {
+	if err := SetTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1"}); err != nil {
+		t.Fatal(err)
+	}
+	defer SetTrustedProxies(nil)
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    []string
+		realIP string
+		want   string
+	}{
+		{"untrusted peer ignores headers", "203.0.113.9:4000", []string{"1.1.1.1"}, "2.2.2.2", "203.0.113.9"},
+		{"trusted peer", "10.0.0.5:4000", []string{"198.51.100.7"}, "", "198.51.100.7"},
+		{"spoofed prefix is skipped", "10.0.0.5:4000", []string{"6.6.6.6, 198.51.100.7"}, "", "198.51.100.7"},
+		{"trusted hops are skipped", "10.0.0.5:4000", []string{"198.51.100.7, 10.1.1.1, 192.0.2.1"}, "", "198.51.100.7"},
+		{"multiple headers", "10.0.0.5:4000", []string{"6.6.6.6", "198.51.100.7"}, "", "198.51.100.7"},
+		{"all hops trusted", "10.0.0.5:4000", []string{"10.2.2.2, 10.1.1.1"}, "", "10.2.2.2"},
+		{"garbage hop stops the walk", "10.0.0.5:4000", []string{"198.51.100.7, junk, 10.1.1.1"}, "", "10.1.1.1"},
+		{"real ip fallback", "10.0.0.5:4000", nil, "198.51.100.8", "198.51.100.8"},
+		{"no headers", "10.0.0.5:4000", nil, "", "10.0.0.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if got := GetIP(r); got != tt.want {
+				t.Errorf("GetIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetIP_ForwardedForFormats(t *testing.T) {
+	if err := SetTrustedProxies([]string{"127.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	defer SetTrustedProxies(nil)
+
+	tests := []struct {
+		name string
+		xff  string
+		want string
+	}{
+		{"single", "198.51.100.7", "198.51.100.7"},
+		{"single with spaces", "  198.51.100.7 ", "198.51.100.7"},
+		{"list", "198.51.100.7, 203.0.113.4", "203.0.113.4"},
+		{"list without spaces", "198.51.100.7,203.0.113.4", "203.0.113.4"},
+		{"ipv4 with port", "198.51.100.7:5678", "198.51.100.7"},
+		{"ipv6", "2001:db8::1", "2001:db8::1"},
+		{"ipv6 list", "2001:db8::1, 2001:db8::2", "2001:db8::2"},
+		{"bracketed ipv6 with port", "[2001:db8::1]:443", "2001:db8::1"},
+		{"ipv6 normalized", "2001:DB8:0:0:0:0:0:1", "2001:db8::1"},
+		{"invalid", "unknown", "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = "127.0.0.1:4000"
+			r.Header.Set("X-Forwarded-For", tt.xff)
+			if got := GetIP(r); got != tt.want {
+				t.Errorf("GetIP(%q) = %q, want %q", tt.xff, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetIP_Forwarded(t *testing.T) {
+	if err := SetTrustedProxies([]string{"127.0.0.1", "203.0.113.43"}); err != nil {
+		t.Fatal(err)
+	}
+	defer SetTrustedProxies(nil)
+	if err := SetClientIPHeaders([]string{"Forwarded"}); err != nil {
+		t.Fatal(err)
+	}
+	defer SetClientIPHeaders([]string{"X-Forwarded-For", "X-Real-IP"})
+
+	tests := []struct {
+		name      string
+		forwarded []string
+		want      string
+	}{
+		{"token", []string{"for=192.0.2.60;proto=http;by=203.0.113.43"}, "192.0.2.60"},
+		{"case-insensitive name", []string{"For=192.0.2.60"}, "192.0.2.60"},
+		{"quoted ipv4 with port", []string{`for="192.0.2.43:47011"`}, "192.0.2.43"},
+		{"quoted ipv6", []string{`for="[2001:db8:cafe::17]"`}, "2001:db8:cafe::17"},
+		{"quoted ipv6 with port", []string{`For="[2001:db8:cafe::17]:4711"`}, "2001:db8:cafe::17"},
+		{"escaped quoted string", []string{`for="\[2001:db8::1\]"`}, "2001:db8::1"},
+		{"spaces around elements", []string{"for=192.0.2.43 , for=198.51.100.17"}, "198.51.100.17"},
+		{"trusted hops are skipped", []string{"for=192.0.2.43, for=203.0.113.43"}, "192.0.2.43"},
+		{"multiple headers", []string{"for=6.6.6.6", "for=192.0.2.43;by=203.0.113.43"}, "192.0.2.43"},
+		{"quoted comma", []string{`for=192.0.2.43;host="a,b", for=198.51.100.17`}, "198.51.100.17"},
+		{"unknown stops the walk", []string{"for=192.0.2.43, for=unknown"}, "127.0.0.1"},
+		{"obfuscated stops the walk", []string{`for=192.0.2.43, for="_gazonk"`}, "127.0.0.1"},
+		{"element without for", []string{"proto=https;by=203.0.113.43"}, "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = "127.0.0.1:4000"
+			for _, v := range tt.forwarded {
+				r.Header.Add("Forwarded", v)
+			}
+			if got := GetIP(r); got != tt.want {
+				t.Errorf("GetIP(%q) = %q, want %q", tt.forwarded, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetIP_HeaderPrecedence(t *testing.T) {
+	if err := SetTrustedProxies([]string{"127.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	defer SetTrustedProxies(nil)
+	defer SetClientIPHeaders([]string{"X-Forwarded-For", "X-Real-IP"})
+
+	tests := []struct {
+		name    string
+		headers []string
+		want    string
+	}{
+		{"default ignores forwarded", []string{"X-Forwarded-For", "X-Real-IP"}, "198.51.100.2"},
+		{"forwarded first", []string{"forwarded", "x-forwarded-for"}, "198.51.100.1"},
+		{"forwarded-for first", []string{"X-Forwarded-For", "Forwarded"}, "198.51.100.2"},
+		{"real ip only", []string{"X-Real-IP"}, "198.51.100.3"},
+		{"none", nil, "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SetClientIPHeaders(tt.headers); err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = "127.0.0.1:4000"
+			r.Header.Set("Forwarded", "for=198.51.100.1")
+			r.Header.Set("X-Forwarded-For", "198.51.100.2")
+			r.Header.Set("X-Real-IP", "198.51.100.3")
+			if got := GetIP(r); got != tt.want {
+				t.Errorf("GetIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// A header that yields nothing falls through to the next one
+	if err := SetClientIPHeaders([]string{"Forwarded", "X-Forwarded-For"}); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "127.0.0.1:4000"
+	r.Header.Set("X-Forwarded-For", "198.51.100.2")
+	if got := GetIP(r); got != "198.51.100.2" {
+		t.Errorf("GetIP() = %q, want fallback to X-Forwarded-For", got)
+	}
+}
+
+func TestSetClientIPHeaders_Invalid(t *testing.T) {
+	defer SetClientIPHeaders([]string{"X-Forwarded-For", "X-Real-IP"})
+	if err := SetClientIPHeaders([]string{"Forwarded", "X-Client-IP"}); err == nil {
+		t.Error("expected error for unsupported header")
+	}
+}
+
+func TestGetIP_SocketPeer(t *testing.T) {
+	defer SetSocketClientID("unix")
+	for _, remote := range []string{"", "@"} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = remote
+		r.Header.Set("X-Forwarded-For", "198.51.100.7")
+		if got := GetIP(r); got != "unix" {
+			t.Errorf("GetIP() with RemoteAddr %q = %q, want unix", remote, got)
+		}
+	}
+
+	SetSocketClientID("sidecar")
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = ""
+	if got := GetIP(r); got != "sidecar" {
+		t.Errorf("GetIP() = %q, want sidecar", got)
+	}
+}
+
+func TestSetTrustedProxies_Invalid(t *testing.T) {
+	defer SetTrustedProxies(nil)
+	for _, c := range []string{"10.0.0.0/33", "not-an-ip"} {
+		if err := SetTrustedProxies([]string{c}); err == nil {
+			t.Errorf("expected error for %q", c)
+		}
+	}
+}
@@ -1,32 +1,98 @@
 package limit
 
 import (
+	"container/list"
+	"context"
 	"log/slog"
-	"net"
 	"net/http"
 	"sync"
 	"time"
 
+	"github.com/aluko123/go-network-proxy/pkg/metrics"
 	"golang.org/x/time/rate"
 )
 
 // MemoryRateLimiter tracks rate limiters per IP
 type MemoryRateLimiter struct {
-	limiters map[string]*rate.Limiter
+	limiters map[string]*list.Element
+	lru      *list.List // of *memoryEntry, most recently used first
+	overflow *rate.Limiter
 	mu       sync.RWMutex
 	r        rate.Limit // requests per second
 	b        int        // burst size
+	max      int
+	interval time.Duration
+	idle     time.Duration
+	now      func() time.Time
 	done     chan struct{}
 }
 
+// memoryEntry is one IP's bucket and when it was last used
+type memoryEntry struct {
+	ip       string
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// MemoryConfig holds in-memory rate limiter configuration
+type MemoryConfig struct {
+	Limit rate.Limit // requests per second
+	Burst int        // bucket capacity
+
+	// Every CleanupInterval, buckets unused for IdleTimeout are dropped.
+	// A bucket that has not refilled yet is kept, so eviction never hands
+	// a client a fresh burst.
+	CleanupInterval time.Duration
+	IdleTimeout     time.Duration
+
+	// MaxEntries caps the number of buckets (0 = unbounded). At the cap the
+	// least recently used bucket is evicted, but only once it has refilled;
+	// until then new clients share one overflow bucket, so a client cannot
+	// reset its own bucket by churning the LRU with spoofed addresses.
+	MaxEntries int
+}
+
+// DefaultMemoryConfig returns the default in-memory rate limiter configuration
+func DefaultMemoryConfig() MemoryConfig {
+	return MemoryConfig{
+		Limit:           rate.Limit(100.0 / 60),
+		Burst:           20,
+		CleanupInterval: time.Minute,
+		IdleTimeout:     5 * time.Minute,
+		MaxEntries:      100000,
+	}
+}
+
 // NewMemoryRateLimiter creates a new IP-based rate limiter
 // r: requests per second (e.g., 100 = 100 req/s)
 // b: burst size (e.g., 10 = allow 10 requests immediately)
 func NewMemoryRateLimiter(r rate.Limit, b int) *MemoryRateLimiter {
+	cfg := DefaultMemoryConfig()
+	cfg.Limit = r
+	cfg.Burst = b
+	return NewMemoryRateLimiterWithConfig(cfg)
+}
+
+// NewMemoryRateLimiterWithConfig creates an IP-based rate limiter with the
+// given bucket and eviction settings. Zero durations take the defaults.
+func NewMemoryRateLimiterWithConfig(cfg MemoryConfig) *MemoryRateLimiter {
+	def := DefaultMemoryConfig()
+	if cfg.CleanupInterval <= 0 {
+		cfg.CleanupInterval = def.CleanupInterval
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = def.IdleTimeout
+	}
 	m := &MemoryRateLimiter{
-		limiters: make(map[string]*rate.Limiter),
-		r:        r,
-		b:        b,
+		limiters: make(map[string]*list.Element),
+		lru:      list.New(),
+		overflow: rate.NewLimiter(cfg.Limit, cfg.Burst),
+		r:        cfg.Limit,
+		b:        cfg.Burst,
+		max:      cfg.MaxEntries,
+		interval: cfg.CleanupInterval,
+		idle:     cfg.IdleTimeout,
+		now:      time.Now,
 		done:     make(chan struct{}),
 	}
 
@@ -40,23 +106,49 @@ func (m *MemoryRateLimiter) GetLimiter(ip string) *rate.Limiter {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	limiter, exists := m.limiters[ip]
-	if !exists {
-		limiter = rate.NewLimiter(m.r, m.b)
-		m.limiters[ip] = limiter
+	now := m.now()
+	if el, exists := m.limiters[ip]; exists {
+		e := el.Value.(*memoryEntry)
+		e.lastSeen = now
+		m.lru.MoveToFront(el)
+		return e.limiter
 	}
 
-	return limiter
+	if m.max > 0 && m.lru.Len() >= m.max {
+		oldest := m.lru.Back()
+		if !m.refilled(oldest.Value.(*memoryEntry), now) {
+			return m.overflow
+		}
+		m.remove(oldest)
+	}
+	e := &memoryEntry{ip: ip, limiter: rate.NewLimiter(m.r, m.b), lastSeen: now}
+	m.limiters[ip] = m.lru.PushFront(e)
+	// Inc/Dec rather than Set: per-method overrides run several limiters
+	metrics.RateLimiterMemoryEntries.Inc()
+
+	return e.limiter
+}
+
+// refilled reports whether e's bucket is full again, so dropping it is
+// indistinguishable from keeping it
+func (m *MemoryRateLimiter) refilled(e *memoryEntry, now time.Time) bool {
+	return e.limiter.TokensAt(now) >= float64(m.b)
+}
+
+func (m *MemoryRateLimiter) remove(el *list.Element) {
+	m.lru.Remove(el)
+	delete(m.limiters, el.Value.(*memoryEntry).ip)
+	metrics.RateLimiterMemoryEntries.Dec()
 }
 
-func (m *MemoryRateLimiter) Allow(ip string) bool {
+// Allow reports whether ip may proceed. The in-memory check never blocks, so ctx is unused.
+func (m *MemoryRateLimiter) Allow(_ context.Context, ip string) bool {
 	limiter := m.GetLimiter(ip)
 	return limiter.Allow()
 }
 
 func (m *MemoryRateLimiter) cleanupLoop() {
-
-	ticker := time.NewTicker(5 * time.Minute)
+	ticker := time.NewTicker(m.interval)
 	defer ticker.Stop()
 	for {
 		select {
@@ -68,13 +160,27 @@ func (m *MemoryRateLimiter) cleanupLoop() {
 	}
 }
 
-// CleanupStale removes limiters that haven't been used in the given duration
+// cleanup removes limiters idle for longer than the idle timeout whose
+// buckets have refilled
 func (m *MemoryRateLimiter) cleanup() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.limiters = make(map[string]*rate.Limiter)
-	slog.Debug("cleaned up stale rate limiters")
+	now := m.now()
+	evicted := 0
+	// Walk from the least recently used end until the entries are too fresh
+	for el := m.lru.Back(); el != nil; {
+		e, prev := el.Value.(*memoryEntry), el.Prev()
+		if now.Sub(e.lastSeen) < m.idle {
+			break
+		}
+		if m.refilled(e, now) {
+			m.remove(el)
+			evicted++
+		}
+		el = prev
+	}
+	slog.Debug("cleaned up stale rate limiters", "evicted", evicted, "remaining", m.lru.Len())
 }
 
 func (m *MemoryRateLimiter) Close() error {
@@ -82,33 +188,6 @@ func (m *MemoryRateLimiter) Close() error {
 	return nil
 }
 
-// GetIP extracts the client IP from the request
-func GetIP(r *http.Request) string {
-	// Try X-Forwarded-For first (if behind load balancer)
-	forwarded := r.Header.Get("X-Forwarded-For")
-	if forwarded != "" {
-		// Take first IP in the list
-		ip, _, _ := net.SplitHostPort(forwarded)
-		if ip != "" {
-			return ip
-		}
-		return forwarded
-	}
-
-	// Try X-Real-IP
-	realIP := r.Header.Get("X-Real-IP")
-	if realIP != "" {
-		return realIP
-	}
-
-	// Fall back to RemoteAddr
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		return r.RemoteAddr
-	}
-	return ip
-}
-
 // Middleware returns a middleware that rate limits by IP
 func (i *MemoryRateLimiter) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,113 @@
+package limit
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aluko123/go-network-proxy/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/time/rate"
+)
+
+func TestMemoryRateLimiter_EvictsIdleBuckets(t *testing.T) {
+	m := NewMemoryRateLimiterWithConfig(MemoryConfig{
+		Limit:           rate.Every(time.Minute),
+		Burst:           1,
+		CleanupInterval: time.Hour,
+		IdleTimeout:     time.Minute,
+	})
+	defer m.Close()
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	m.GetLimiter("198.51.100.1")
+	m.GetLimiter("198.51.100.2")
+
+	now = now.Add(90 * time.Second)
+	m.GetLimiter("198.51.100.2") // still active
+	m.cleanup()
+
+	if _, ok := m.limiters["198.51.100.1"]; ok {
+		t.Error("idle bucket was not evicted")
+	}
+	if _, ok := m.limiters["198.51.100.2"]; !ok {
+		t.Error("active bucket was evicted")
+	}
+}
+
+func TestMemoryRateLimiter_KeepsDrainedIdleBuckets(t *testing.T) {
+	m := NewMemoryRateLimiterWithConfig(MemoryConfig{
+		Limit:           rate.Every(time.Hour),
+		Burst:           1,
+		CleanupInterval: time.Hour,
+		IdleTimeout:     time.Minute,
+	})
+	defer m.Close()
+
+	if !m.Allow(context.Background(), "198.51.100.1") {
+		t.Fatal("first request should be allowed")
+	}
+	now := time.Now().Add(2 * time.Minute)
+	m.now = func() time.Time { return now }
+	m.cleanup()
+
+	// Idle, but evicting would hand the client a fresh burst
+	if m.Allow(context.Background(), "198.51.100.1") {
+		t.Error("bucket was reset by cleanup")
+	}
+}
+
+func TestMemoryRateLimiter_EvictsLeastRecentlyUsedAtCap(t *testing.T) {
+	m := NewMemoryRateLimiterWithConfig(MemoryConfig{
+		Limit:           rate.Every(time.Second),
+		Burst:           1,
+		CleanupInterval: time.Hour,
+		IdleTimeout:     time.Hour,
+		MaxEntries:      2,
+	})
+	defer m.Close()
+	before := testutil.ToFloat64(metrics.RateLimiterMemoryEntries)
+
+	m.GetLimiter("198.51.100.1")
+	m.GetLimiter("198.51.100.2")
+	m.GetLimiter("198.51.100.1") // .2 is now the least recently used
+	m.GetLimiter("198.51.100.3")
+
+	if len(m.limiters) != 2 {
+		t.Fatalf("limiter holds %d buckets, want 2", len(m.limiters))
+	}
+	if _, ok := m.limiters["198.51.100.2"]; ok {
+		t.Error("least recently used bucket was not evicted")
+	}
+	if got := testutil.ToFloat64(metrics.RateLimiterMemoryEntries) - before; got != 2 {
+		t.Errorf("entries gauge grew by %v, want 2", got)
+	}
+}
+
+func TestMemoryRateLimiter_ChurnDoesNotResetBucket(t *testing.T) {
+	m := NewMemoryRateLimiterWithConfig(MemoryConfig{
+		Limit:           rate.Every(time.Hour),
+		Burst:           1,
+		CleanupInterval: time.Hour,
+		IdleTimeout:     time.Hour,
+		MaxEntries:      2,
+	})
+	defer m.Close()
+	ctx := context.Background()
+
+	if !m.Allow(ctx, "198.51.100.1") {
+		t.Fatal("first request should be allowed")
+	}
+	// Flood from spoofed addresses to push the drained bucket out
+	for i := range 100 {
+		m.Allow(ctx, fmt.Sprintf("203.0.113.%d", i))
+	}
+	if len(m.limiters) > 2 {
+		t.Fatalf("limiter holds %d buckets, want at most 2", len(m.limiters))
+	}
+	if m.Allow(ctx, "198.51.100.1") {
+		t.Error("churning the LRU reset a drained bucket")
+	}
+}
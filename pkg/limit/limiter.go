@@ -1,6 +1,17 @@
 package limit
 
+import "context"
+
+// RateLimiter decides whether a request from the given IP may proceed.
+// Implementations must honor ctx cancellation for any remote calls.
 type RateLimiter interface {
-	Allow(ip string) bool
+	Allow(ctx context.Context, ip string) bool
 	Close() error
-}
\ No newline at end of file
+}
+
+// MethodLimiter is a RateLimiter that can keep separate buckets per HTTP
+// method. WithRateLimit calls AllowMethod when the limiter implements it.
+type MethodLimiter interface {
+	RateLimiter
+	AllowMethod(ctx context.Context, method, ip string) bool
+}
@@ -0,0 +1,79 @@
+package limit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MethodLimit is a per-method override of the default rate limit
+type MethodLimit struct {
+	Limit int // requests per minute
+	Burst int
+}
+
+// ParseMethodLimits parses "POST=20:5,CONNECT=10:2" (method=limit:burst,
+// limit per minute) into method -> limit. Methods are upper-cased.
+func ParseMethodLimits(spec string) (map[string]MethodLimit, error) {
+	limits := make(map[string]MethodLimit)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		method, rest, ok := strings.Cut(entry, "=")
+		perMinute, burst, ok2 := strings.Cut(rest, ":")
+		method = strings.ToUpper(strings.TrimSpace(method))
+		if !ok || !ok2 || method == "" {
+			return nil, fmt.Errorf("expected method=limit:burst, got %q", entry)
+		}
+		l, err := strconv.Atoi(strings.TrimSpace(perMinute))
+		if err != nil || l <= 0 {
+			return nil, fmt.Errorf("%s: limit must be a positive integer, got %q", method, perMinute)
+		}
+		b, err := strconv.Atoi(strings.TrimSpace(burst))
+		if err != nil || b <= 0 {
+			return nil, fmt.Errorf("%s: burst must be a positive integer, got %q", method, burst)
+		}
+		limits[method] = MethodLimit{Limit: l, Burst: b}
+	}
+	return limits, nil
+}
+
+// MethodRateLimiter keeps separate buckets for the HTTP methods that have an
+// override and applies the default limiter to every other method, so those
+// share one bucket per IP as before.
+type MethodRateLimiter struct {
+	def     RateLimiter
+	methods map[string]RateLimiter
+}
+
+// NewMethodRateLimiter combines a default limiter with per-method overrides,
+// keyed by upper-case method. Each override must use its own buckets (for
+// Redis, a KeyPrefix of its own); Close closes them all.
+func NewMethodRateLimiter(def RateLimiter, methods map[string]RateLimiter) *MethodRateLimiter {
+	return &MethodRateLimiter{def: def, methods: methods}
+}
+
+// Allow checks ip against the default limiter
+func (m *MethodRateLimiter) Allow(ctx context.Context, ip string) bool {
+	return m.def.Allow(ctx, ip)
+}
+
+// AllowMethod checks ip against the method's override, or the default limiter
+func (m *MethodRateLimiter) AllowMethod(ctx context.Context, method, ip string) bool {
+	if l, ok := m.methods[method]; ok {
+		return l.Allow(ctx, ip)
+	}
+	return m.def.Allow(ctx, ip)
+}
+
+func (m *MethodRateLimiter) Close() error {
+	errs := []error{m.def.Close()}
+	for _, l := range m.methods {
+		errs = append(errs, l.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,74 @@
+package limit
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestParseMethodLimits(t *testing.T) {
+	got, err := ParseMethodLimits(" post=20:5, CONNECT=10:2 ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]MethodLimit{"POST": {20, 5}, "CONNECT": {10, 2}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	for _, spec := range []string{"POST", "POST=20", "=20:5", "POST=0:5", "POST=20:x"} {
+		if _, err := ParseMethodLimits(spec); err == nil {
+			t.Errorf("expected error for %q", spec)
+		}
+	}
+}
+
+func TestMethodRateLimiter_SeparateBuckets(t *testing.T) {
+	mr := miniredis.RunT(t)
+	now := time.Unix(1_700_000_000, 0)
+	newLimiter := func(prefix string, burst int) RateLimiter {
+		cfg := DefaultRedisConfig()
+		cfg.Addr = mr.Addr()
+		cfg.KeyPrefix = prefix
+		cfg.Limit = 1
+		cfg.Window = time.Hour
+		cfg.Burst = burst
+		l, err := NewRedisRateLimiterWithConfig(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l.now = func() time.Time { return now }
+		return l
+	}
+	m := NewMethodRateLimiter(newLimiter("proxy:ratelimit:", 3), map[string]RateLimiter{
+		"POST": newLimiter("proxy:ratelimit:POST:", 1),
+	})
+	defer m.Close()
+	ctx := context.Background()
+
+	if !m.AllowMethod(ctx, "POST", "203.0.113.7") {
+		t.Fatal("first POST should be allowed")
+	}
+	if m.AllowMethod(ctx, "POST", "203.0.113.7") {
+		t.Error("second POST should exceed the override's burst")
+	}
+	// GET and PUT share the default bucket, untouched by the POSTs
+	for i, method := range []string{"GET", "PUT", "GET"} {
+		if !m.AllowMethod(ctx, method, "203.0.113.7") {
+			t.Errorf("request %d (%s) should be allowed", i, method)
+		}
+	}
+	if m.AllowMethod(ctx, "GET", "203.0.113.7") {
+		t.Error("fourth default request should exceed the default burst")
+	}
+
+	keys := mr.Keys()
+	slices.Sort(keys)
+	if want := []string{"proxy:ratelimit:203.0.113.7", "proxy:ratelimit:POST:203.0.113.7"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys = %q, want %q", keys, want)
+	}
+}
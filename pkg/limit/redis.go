@@ -16,31 +16,134 @@ import (
 var scriptFS embed.FS
 
 type RedisRateLimiter struct {
-	client    *redis.Client
+	client    redis.UniversalClient
 	script    *redis.Script
 	scriptSHA string
-	capacity  int64   // burst size (bucket capacity)
-	leakRate  float64 // tokens per second
-	ctx       context.Context
+	keyPrefix string
+	hashTag   bool          // wrap the IP in {} so its key maps to one cluster slot
+	capacity  int64         // burst size (bucket capacity)
+	leakRate  float64       // tokens per second
+	timeout   time.Duration // per-call deadline for Redis round trips
+	failOpen  bool          // allow requests when Redis is unavailable
+	breaker   *circuitBreaker
+	now       func() time.Time
 
 	// Performance tracking
 	evalShaHits   uint64
 	evalFallbacks uint64
 }
 
-// Remove RedisConfig - use simple constructor for Phase 1
+// Redis deployment modes
+const (
+	RedisModeStandalone = "standalone"
+	RedisModeCluster    = "cluster"
+	RedisModeSentinel   = "sentinel"
+)
 
-// NewRedisRateLimiter creates a Redis-based leaky bucket rate limiter with EVALSHA optimization
-// - addr: Redis server address
-// - ratePerMinute: tokens leaked per minute (sustained rate)
-// - burst: bucket capacity (max concurrent requests)
-func NewRedisRateLimiter(addr string, ratePerMinute int, burst int) (*RedisRateLimiter, error) {
-	client := redis.NewClient(&redis.Options{
-		Addr:         addr,
+// RedisConfig holds Redis rate limiter configuration
+//
+// Bucket keys are <KeyPrefix><ip> in standalone and sentinel mode. In cluster
+// mode they are built as <KeyPrefix>{<ip>} instead. The braces are a Redis
+// Cluster hash tag: only the part inside them is hashed, so the key (and the
+// EVALSHA that touches it) always lands on a single slot. Any future script
+// that touches more than one key per IP must use the same tag.
+//
+// The gateway's per-method overrides (see MethodRateLimiter) each get a
+// limiter whose KeyPrefix is the default prefix plus "<METHOD>:", so with the
+// default prefix the keys for a client read:
+//
+//	proxy:ratelimit:203.0.113.7       methods without an override
+//	proxy:ratelimit:POST:203.0.113.7  POST override
+//
+// and proxy:ratelimit:{203.0.113.7} and so on in cluster mode.
+type RedisConfig struct {
+	Mode         string   // standalone (default), cluster or sentinel
+	Addr         string   // standalone server address
+	Addrs        []string // cluster seed nodes or sentinel addresses
+	MasterName   string   // sentinel master name
+	Password     string
+	DB           int
+	PoolSize     int
+	MinIdleConns int
+	KeyPrefix    string        // prepended to the client IP to form the bucket key
+	Limit        int           // requests allowed per Window (sustained rate)
+	Window       time.Duration // period Limit applies to
+	Burst        int           // bucket capacity (max concurrent requests)
+
+	// Timeout bounds every Redis call so a stalled server can't wedge requests
+	Timeout time.Duration
+	// FailOpen allows requests when Redis errors or the breaker is open
+	FailOpen bool
+
+	// Circuit breaker: after BreakerThreshold consecutive errors within
+	// BreakerWindow, skip Redis for BreakerCooldown before probing again.
+	// A threshold of 0 disables the breaker.
+	BreakerThreshold int
+	BreakerWindow    time.Duration
+	BreakerCooldown  time.Duration
+}
+
+// DefaultRedisConfig returns the default Redis rate limiter configuration
+func DefaultRedisConfig() RedisConfig {
+	return RedisConfig{
+		Mode:         RedisModeStandalone,
+		Addr:         "localhost:6379",
 		DB:           0,
 		PoolSize:     100, // Optimize connection pool
 		MinIdleConns: 10,
-	})
+		KeyPrefix:    "proxy:ratelimit:",
+		Limit:        100,
+		Window:       time.Minute,
+		Burst:        20,
+
+		Timeout:  100 * time.Millisecond,
+		FailOpen: true,
+
+		BreakerThreshold: 5,
+		BreakerWindow:    10 * time.Second,
+		BreakerCooldown:  30 * time.Second,
+	}
+}
+
+// NewRedisRateLimiter creates a Redis-based leaky bucket rate limiter with EVALSHA optimization
+// - addr: Redis server address
+// - limit: requests allowed per window (sustained rate)
+// - window: period the limit applies to (e.g. time.Minute)
+// - burst: bucket capacity (max concurrent requests)
+func NewRedisRateLimiter(addr string, limit int, window time.Duration, burst int) (*RedisRateLimiter, error) {
+	cfg := DefaultRedisConfig()
+	cfg.Addr = addr
+	cfg.Limit = limit
+	cfg.Window = window
+	cfg.Burst = burst
+	return NewRedisRateLimiterWithConfig(cfg)
+}
+
+// NewRedisClusterRateLimiter creates a leaky bucket rate limiter backed by a Redis Cluster
+// - addrs: cluster seed node addresses
+// - limit, window, burst: as for NewRedisRateLimiter
+func NewRedisClusterRateLimiter(addrs []string, limit int, window time.Duration, burst int) (*RedisRateLimiter, error) {
+	cfg := DefaultRedisConfig()
+	cfg.Mode = RedisModeCluster
+	cfg.Addrs = addrs
+	cfg.Limit = limit
+	cfg.Window = window
+	cfg.Burst = burst
+	return NewRedisRateLimiterWithConfig(cfg)
+}
+
+// NewRedisRateLimiterWithConfig creates a Redis-based leaky bucket rate limiter
+// using the given connection, key prefix and bucket settings
+func NewRedisRateLimiterWithConfig(cfg RedisConfig) (*RedisRateLimiter, error) {
+	if cfg.Limit <= 0 || cfg.Window <= 0 || cfg.Burst <= 0 {
+		return nil, fmt.Errorf("redis rate limit needs positive limit, window and burst (got %d per %s, burst %d)",
+			cfg.Limit, cfg.Window, cfg.Burst)
+	}
+
+	client, err := NewRedisClient(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	ctx := context.Background()
 	if err := client.Ping(ctx).Err(); err != nil {
@@ -56,25 +159,80 @@ func NewRedisRateLimiter(addr string, ratePerMinute int, burst int) (*RedisRateL
 	script := redis.NewScript(string(scriptContent))
 
 	r := &RedisRateLimiter{
-		client:   client,
-		script:   script,
-		capacity: int64(burst),
-		leakRate: float64(ratePerMinute) / 60.0, // convert to per-second
-		ctx:      ctx,
+		client:    client,
+		script:    script,
+		keyPrefix: cfg.KeyPrefix,
+		hashTag:   cfg.Mode == RedisModeCluster,
+		capacity:  int64(cfg.Burst),
+		leakRate:  float64(cfg.Limit) / cfg.Window.Seconds(), // convert to per-second
+		timeout:   cfg.Timeout,
+		failOpen:  cfg.FailOpen,
+		breaker:   newCircuitBreaker(cfg.KeyPrefix, cfg.BreakerThreshold, cfg.BreakerWindow, cfg.BreakerCooldown),
+		now:       time.Now,
 	}
 
 	// Preload script and cache SHA (optimization)
-	if err := r.preloadScript(); err != nil {
+	if err := r.preloadScript(ctx); err != nil {
 		slog.Warn("could not preload script", "error", err)
 		// Continue anyway - will fallback to EVAL
 	}
 
-	slog.Info("redis leaky bucket initialized", "capacity", burst, "leak_rate", r.leakRate)
+	slog.Info("redis leaky bucket initialized",
+		"mode", cfg.Mode,
+		"capacity", cfg.Burst,
+		"leak_rate", r.leakRate,
+		"db", cfg.DB,
+		"key_prefix", cfg.KeyPrefix,
+	)
 	return r, nil
 }
 
-func (r *RedisRateLimiter) preloadScript() error {
-	sha, err := r.script.Load(r.ctx, r.client).Result()
+// NewRedisClient builds a standalone, cluster or sentinel-backed client for
+// cfg.Mode. Only the connection settings of cfg are used.
+func NewRedisClient(cfg RedisConfig) (redis.UniversalClient, error) {
+	addrs := cfg.Addrs
+	if len(addrs) == 0 && cfg.Addr != "" {
+		addrs = []string{cfg.Addr}
+	}
+
+	switch cfg.Mode {
+	case "", RedisModeStandalone:
+		return redis.NewClient(&redis.Options{
+			Addr:         cfg.Addr,
+			Password:     cfg.Password,
+			DB:           cfg.DB,
+			PoolSize:     cfg.PoolSize,
+			MinIdleConns: cfg.MinIdleConns,
+		}), nil
+	case RedisModeCluster:
+		if cfg.DB != 0 {
+			return nil, fmt.Errorf("redis cluster does not support DB %d", cfg.DB)
+		}
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        addrs,
+			Password:     cfg.Password,
+			PoolSize:     cfg.PoolSize,
+			MinIdleConns: cfg.MinIdleConns,
+		}), nil
+	case RedisModeSentinel:
+		if cfg.MasterName == "" {
+			return nil, fmt.Errorf("redis sentinel mode requires a master name")
+		}
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:    cfg.MasterName,
+			SentinelAddrs: addrs,
+			Password:      cfg.Password,
+			DB:            cfg.DB,
+			PoolSize:      cfg.PoolSize,
+			MinIdleConns:  cfg.MinIdleConns,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown redis mode %q", cfg.Mode)
+	}
+}
+
+func (r *RedisRateLimiter) preloadScript(ctx context.Context) error {
+	sha, err := r.script.Load(ctx, r.client).Result()
 	if err != nil {
 		return fmt.Errorf("failed to load script: %w", err)
 	}
@@ -83,56 +241,97 @@ func (r *RedisRateLimiter) preloadScript() error {
 	return nil
 }
 
-func (r *RedisRateLimiter) Allow(ip string) bool {
-	key := "proxy:ratelimit:" + ip
-	currentTime := time.Now().UnixMilli()
-	args := []any{r.capacity, r.leakRate, currentTime}
+// Allow checks the bucket for ip. The Redis call is bounded by both ctx (e.g. the
+// client's request context) and the configured per-call timeout.
+func (r *RedisRateLimiter) Allow(ctx context.Context, ip string) bool {
+	// Breaker open: don't touch Redis, apply the configured failure policy
+	if !r.breaker.allow() {
+		return r.failOpen
+	}
 
+	callCtx, cancel := r.callContext(ctx)
+	defer cancel()
+
+	result, err := r.run(callCtx, r.key(ip), []any{r.capacity, r.leakRate, r.now().UnixMilli()})
+	if err != nil {
+		// Caller gave up (client disconnected): not Redis' fault
+		if ctx.Err() != nil {
+			r.breaker.abort()
+			return r.failOpen
+		}
+		r.breaker.failure()
+		slog.Error("redis error", "error", err, "fail_open", r.failOpen)
+		return r.failOpen
+	}
+
+	r.breaker.success()
+	return result == 1
+}
+
+// callContext derives a bounded context for a single Redis round trip
+func (r *RedisRateLimiter) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, r.timeout)
+}
+
+// run executes the leaky bucket script, preferring EVALSHA and falling back to EVAL
+func (r *RedisRateLimiter) run(ctx context.Context, key string, args []any) (int64, error) {
 	// Try EVALSHA first (optimized path)
 	if r.scriptSHA != "" {
-		result, err := r.evalSHA(key, args)
+		result, err := r.evalSHA(ctx, key, args)
 		if err == nil {
 			atomic.AddUint64(&r.evalShaHits, 1)
-			return result == 1
+			return result, nil
 		}
 
 		// NOSCRIPT error? Reload and retry once
 		if isNoScriptErr(err) {
 			slog.Debug("script not cached, reloading")
-			r.preloadScript()
+			r.preloadScript(ctx)
 
-			result, err := r.evalSHA(key, args)
+			result, err := r.evalSHA(ctx, key, args)
 			if err == nil {
-				return result == 1
+				return result, nil
 			}
 		}
 
+		// Deadline already spent: don't pile an EVAL on top
+		if ctx.Err() != nil {
+			return 0, err
+		}
+
 		// EVALSHA failed, fallback to EVAL
 		atomic.AddUint64(&r.evalFallbacks, 1)
 	}
 
 	// Fallback: Use EVAL (sends full script)
-	result, err := r.eval(key, args)
-	if err != nil {
-		slog.Error("redis error", "error", err)
-		return true // Fail open
-	}
+	return r.eval(ctx, key, args)
+}
 
-	return result == 1
+// key returns the bucket key for ip. In cluster mode the IP is a hash tag, so
+// the key maps to one slot; elsewhere keys keep their original form, so
+// existing buckets carry over.
+func (r *RedisRateLimiter) key(ip string) string {
+	if r.hashTag {
+		return r.keyPrefix + "{" + ip + "}"
+	}
+	return r.keyPrefix + ip
 }
 
-func (r *RedisRateLimiter) evalSHA(key string, args []any) (int64, error) {
+func (r *RedisRateLimiter) evalSHA(ctx context.Context, key string, args []any) (int64, error) {
 	return r.client.EvalSha(
-		r.ctx,
+		ctx,
 		r.scriptSHA,
 		[]string{key},
 		args...,
 	).Int64()
 }
 
-func (r *RedisRateLimiter) eval(key string, args []any) (int64, error) {
+func (r *RedisRateLimiter) eval(ctx context.Context, key string, args []any) (int64, error) {
 	return r.script.Run(
-		r.ctx,
+		ctx,
 		r.client,
 		[]string{key},
 		args...,
@@ -1,5 +1,6 @@
 -- Leaky Bucket Rate Limiter
--- KEY[1]: Redis key (e.g. "proxy:ratelimit:<ip>")
+-- KEY[1]: Redis key (<key prefix><ip>, or <key prefix>{<ip>} in cluster mode)
+--         In cluster mode the {<ip>} hash tag pins the key to a single slot.
 -- ARGV[1]: bucket capacity (burst size)
 -- ARGV[2]: leak rate (tokens per second)
 -- ARGV[3]: current timestamp in milliseconds
@@ -29,7 +30,9 @@ if level < capacity then
     redis.call('EXPIRE', key, math.ceil(capacity / leak_rate) + 1)
     return 1 -- Allowed
 else
-    -- Bucket full, reject request
-    redis.call('HSET', key, 'last_update', now)
+    -- Bucket full, reject request. Store the drained level along with the
+    -- timestamp, or the leak since last_update would be lost and a client
+    -- retrying faster than the leak rate would never get through.
+    redis.call('HSET', key, 'level', level, 'last_update', now)
     return 0 -- Rate limited
 end
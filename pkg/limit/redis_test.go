@@ -0,0 +1,76 @@
+package limit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestRedisRateLimiter_EffectiveRate(t *testing.T) {
+	tests := []struct {
+		name   string
+		limit  int
+		window time.Duration
+		burst  int
+		every  time.Duration // client retry interval, faster than the limit
+		total  time.Duration
+		want   int // burst + limit * total / window
+	}{
+		{"60 per minute", 60, time.Minute, 5, 100 * time.Millisecond, 2 * time.Minute, 5 + 120},
+		{"60 per hour", 60, time.Hour, 1, time.Second, 10 * time.Minute, 1 + 10},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			r, err := NewRedisRateLimiter(mr.Addr(), tc.limit, tc.window, tc.burst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+
+			now := time.Unix(1_700_000_000, 0)
+			r.now = func() time.Time { return now }
+
+			allowed := 0
+			for elapsed := time.Duration(0); elapsed < tc.total; elapsed += tc.every {
+				if r.Allow(context.Background(), "10.0.0.1") {
+					allowed++
+				}
+				now = now.Add(tc.every)
+				mr.FastForward(tc.every)
+			}
+
+			// Allow one either way for where the window boundary falls
+			if allowed < tc.want-1 || allowed > tc.want+1 {
+				t.Errorf("allowed %d requests in %s, want about %d", allowed, tc.total, tc.want)
+			}
+		})
+	}
+}
+
+func TestNewRedisRateLimiter_RejectsZeroWindow(t *testing.T) {
+	if _, err := NewRedisRateLimiter("127.0.0.1:0", 60, 0, 5); err == nil {
+		t.Error("expected an error for a zero window")
+	}
+}
+
+func TestRedisRateLimiter_StandaloneKeys(t *testing.T) {
+	mr := miniredis.RunT(t)
+	r, err := NewRedisRateLimiter(mr.Addr(), 60, time.Minute, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	r.Allow(context.Background(), "10.0.0.1")
+	// Standalone keys keep the pre-cluster form, so buckets survive upgrades
+	if !mr.Exists("proxy:ratelimit:10.0.0.1") {
+		t.Errorf("bucket key not found, have %v", mr.Keys())
+	}
+	if r.hashTag = true; r.key("10.0.0.1") != "proxy:ratelimit:{10.0.0.1}" {
+		t.Errorf("cluster key = %q", r.key("10.0.0.1"))
+	}
+}
@@ -0,0 +1,42 @@
+package logger
+
+import (
+	"context"
+	"sync"
+)
+
+const fieldsKey ctxKey = "fields"
+
+// fields collects attributes that inner handlers add to the access log entry
+type fields struct {
+	mu    sync.Mutex
+	attrs []any
+}
+
+// WithFields returns a context that AddFields can annotate
+func WithFields(ctx context.Context) context.Context {
+	return context.WithValue(ctx, fieldsKey, &fields{})
+}
+
+// AddFields appends key/value pairs to the request's log fields. It is a
+// no-op when ctx was not prepared with WithFields.
+func AddFields(ctx context.Context, args ...any) {
+	f, ok := ctx.Value(fieldsKey).(*fields)
+	if !ok {
+		return
+	}
+	f.mu.Lock()
+	f.attrs = append(f.attrs, args...)
+	f.mu.Unlock()
+}
+
+// Fields returns the key/value pairs added to ctx so far
+func Fields(ctx context.Context) []any {
+	f, ok := ctx.Value(fieldsKey).(*fields)
+	if !ok {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]any(nil), f.attrs...)
+}
@@ -2,6 +2,7 @@ package logger
 
 import (
 	"context"
+	"io"
 	"log/slog"
 	"os"
 )
@@ -17,22 +18,91 @@ type Logger struct {
 	*slog.Logger
 }
 
+// Options configures the format, destination and level of a Logger
+type Options struct {
+	Format string       // json (default) or text
+	Output io.Writer    // defaults to os.Stdout
+	Level  slog.Leveler // defaults to the shared level (see SetLevel)
+}
+
+// level is the shared, runtime-adjustable level of loggers created without
+// an explicit Level
+var level = new(slog.LevelVar) // Info
+
+// SetLevel changes the level of every logger using the shared level, live
+func SetLevel(l slog.Level) {
+	level.Set(l)
+}
+
+// GetLevel returns the shared level
+func GetLevel() slog.Level {
+	return level.Level()
+}
+
 func New(format string) *Logger {
+	return NewWithOptions(Options{Format: format})
+}
+
+// NewWithOptions creates a logger with an explicit destination and level
+func NewWithOptions(o Options) *Logger {
 	var handler slog.Handler
 
+	out := o.Output
+	if out == nil {
+		out = os.Stdout
+	}
+
 	opts := &slog.HandlerOptions{
-		Level: slog.LevelInfo,
+		Level:       o.Level,
+		ReplaceAttr: redactAttr, // headers may carry credentials
+	}
+	if opts.Level == nil {
+		opts.Level = level
 	}
 
-	if format == "text" {
-		handler = slog.NewTextHandler(os.Stdout, opts)
+	if o.Format == "text" {
+		handler = slog.NewTextHandler(out, opts)
 	} else {
-		handler = slog.NewJSONHandler(os.Stdout, opts)
+		handler = slog.NewJSONHandler(out, opts)
 	}
 
 	return &Logger{slog.New(handler)}
 }
 
+// ParseLevel converts a level name (debug, info, warn, error) to a slog.Level
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(s))
+	return level, err
+}
+
+// OpenOutput returns a writer for "stdout", "stderr" or a file path (opened for append)
+func OpenOutput(dest string) (io.WriteCloser, error) {
+	return OpenRotatingOutput(dest, 0, 0)
+}
+
+// OpenRotatingOutput is like OpenOutput, but a file path rotates once it
+// reaches maxSize bytes, keeping maxBackups old files. maxSize <= 0 never
+// rotates.
+func OpenRotatingOutput(dest string, maxSize int64, maxBackups int) (io.WriteCloser, error) {
+	switch dest {
+	case "", "stdout":
+		return nopCloser{os.Stdout}, nil
+	case "stderr":
+		return nopCloser{os.Stderr}, nil
+	}
+	if maxSize > 0 {
+		return NewRotatingFile(dest, maxSize, maxBackups)
+	}
+	return os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
 func (l *Logger) With(key string, val any) *Logger {
 	return &Logger{l.Logger.With(key, val)}
 }
@@ -0,0 +1,54 @@
+package logger
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// Redacted stands in for the value of a redacted header
+const Redacted = "[REDACTED]"
+
+// redactedHeaders holds the canonical names of headers whose values are
+// never written to a log
+var redactedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Cookie":              true,
+	"Proxy-Authorization": true,
+	"X-Api-Key":           true,
+}
+
+// SetRedactedHeaders replaces the set of headers whose values are redacted
+// from logs. It is meant to be called once at startup.
+func SetRedactedHeaders(names []string) {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			set[http.CanonicalHeaderKey(name)] = true
+		}
+	}
+	redactedHeaders = set
+}
+
+// RedactHeaders returns a copy of h with the values of redacted headers
+// replaced by Redacted, safe to log
+func RedactHeaders(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+	for name, values := range h {
+		if redactedHeaders[http.CanonicalHeaderKey(name)] {
+			out[name] = []string{Redacted}
+			continue
+		}
+		out[name] = values
+	}
+	return out
+}
+
+// redactAttr is the handlers' ReplaceAttr: any http.Header logged, under
+// whatever key, has its redacted headers masked
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	if h, ok := a.Value.Any().(http.Header); ok {
+		a.Value = slog.AnyValue(RedactHeaders(h))
+	}
+	return a
+}
@@ -0,0 +1,27 @@
+package logger
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSetRedactedHeaders(t *testing.T) {
+	defer func(saved map[string]bool) { redactedHeaders = saved }(redactedHeaders)
+	SetRedactedHeaders([]string{"x-session", " Authorization ", ""})
+
+	h := http.Header{}
+	h.Set("X-Session", "abc")
+	h.Set("Authorization", "Bearer xyz")
+	h.Set("Cookie", "a=b") // no longer redacted
+	got := RedactHeaders(h)
+
+	want := map[string]string{"X-Session": Redacted, "Authorization": Redacted, "Cookie": "a=b"}
+	for name, v := range want {
+		if got.Get(name) != v {
+			t.Errorf("%s = %q, want %q", name, got.Get(name), v)
+		}
+	}
+	if h.Get("X-Session") != "abc" {
+		t.Error("RedactHeaders modified its argument")
+	}
+}
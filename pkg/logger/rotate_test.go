@@ -0,0 +1,101 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	rf, err := NewRotatingFile(path, 20, 2)
+	if err != nil {
+		t.Fatalf("NewRotatingFile: %v", err)
+	}
+	defer rf.Close()
+
+	// Each line is 10 bytes, so every third line starts a new file
+	for _, line := range []string{"aaaaaaaaa\n", "bbbbbbbbb\n", "ccccccccc\n", "ddddddddd\n", "eeeeeeeee\n", "fffffffff\n", "ggggggggg\n"} {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+
+	read := func(p string) string {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatalf("read %s: %v", p, err)
+		}
+		return string(b)
+	}
+	if got := read(path); got != "ggggggggg\n" {
+		t.Errorf("current file = %q", got)
+	}
+	if got := read(path + ".1"); got != "eeeeeeeee\nfffffffff\n" {
+		t.Errorf("backup 1 = %q", got)
+	}
+	if got := read(path + ".2"); got != "ccccccccc\nddddddddd\n" {
+		t.Errorf("backup 2 = %q", got)
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("expected only 2 backups to be kept")
+	}
+}
+
+func TestRotatingFile_AccessLogFields(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	out, err := OpenRotatingOutput(path, 1<<20, 1)
+	if err != nil {
+		t.Fatalf("OpenRotatingOutput: %v", err)
+	}
+	log := NewWithOptions(Options{Output: out})
+	log.Info("request completed", "request_id", "abc", "status", 200, "duration_ms", 3, "client_ip", "10.0.0.1")
+	out.Close()
+
+	b, _ := os.ReadFile(path)
+	for _, field := range []string{`"request_id":"abc"`, `"status":200`, `"duration_ms":3`, `"client_ip":"10.0.0.1"`} {
+		if !strings.Contains(string(b), field) {
+			t.Errorf("missing %s in %s", field, b)
+		}
+	}
+}
+
+func TestRotatingFile_RotateFailureKeepsWriting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	rf, err := NewRotatingFile(path, 20, 1)
+	if err != nil {
+		t.Fatalf("NewRotatingFile: %v", err)
+	}
+	defer rf.Close()
+
+	// A non-empty directory where the backup goes makes the rename fail,
+	// even for root (a read-only directory wouldn't)
+	if err := os.MkdirAll(filepath.Join(path+".1", "keep"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := rf.Write([]byte("aaaaaaaaa\nbbbbbbbbb\n")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if n, err := rf.Write([]byte("ccccccccc\n")); err == nil || n != 10 {
+		t.Fatalf("Write during failed rotation = %d, %v; want 10 and the rotation error", n, err)
+	}
+
+	// Once the backup slot is free again, rotation recovers
+	if err := os.RemoveAll(path + ".1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rf.Write([]byte("ddddddddd\n")); err != nil {
+		t.Fatalf("Write after recovery: %v", err)
+	}
+
+	backup, _ := os.ReadFile(path + ".1")
+	if string(backup) != "aaaaaaaaa\nbbbbbbbbb\nccccccccc\n" {
+		t.Errorf("backup = %q; the line written during the failure should be kept", backup)
+	}
+	current, _ := os.ReadFile(path)
+	if string(current) != "ddddddddd\n" {
+		t.Errorf("current file = %q", current)
+	}
+}
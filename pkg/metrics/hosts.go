@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// OtherHost is the label for destinations beyond the allowlist or cap
+const OtherHost = "other"
+
+var (
+	// Counter: Forward proxy requests per destination host
+	RequestsByHost = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_requests_by_host_total",
+			Help: "Forward proxy requests by destination host (bounded; excess hosts are \"other\")",
+		},
+		[]string{"host"},
+	)
+
+	// Histogram: Upstream latency per destination host (opt-in)
+	RequestDurationByHost = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "proxy_request_duration_by_host_seconds",
+			Help:    "Upstream response time by destination host in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"host"},
+	)
+)
+
+// HostConfig bounds the cardinality of the per-host metrics
+type HostConfig struct {
+	Allow    []string // only these hosts get their own label; empty allows any
+	MaxHosts int      // distinct host labels before the rest become "other" (0 = unlimited)
+	Latency  bool     // also record proxy_request_duration_by_host_seconds
+}
+
+// DefaultHostConfig returns the default per-host metrics configuration
+func DefaultHostConfig() HostConfig {
+	return HostConfig{MaxHosts: 100}
+}
+
+var hosts = struct {
+	sync.Mutex
+	cfg   HostConfig
+	allow map[string]bool
+	seen  map[string]bool
+}{cfg: DefaultHostConfig(), seen: map[string]bool{}}
+
+// SetHostConfig updates the per-host metrics configuration
+func SetHostConfig(c HostConfig) {
+	hosts.Lock()
+	defer hosts.Unlock()
+	hosts.cfg = c
+	hosts.allow = nil
+	if len(c.Allow) > 0 {
+		hosts.allow = make(map[string]bool, len(c.Allow))
+		for _, h := range c.Allow {
+			hosts.allow[normalizeHost(h)] = true
+		}
+	}
+	hosts.seen = map[string]bool{}
+}
+
+// HostLabel maps a destination (host or host:port) to its metric label. Hosts
+// keep their own label on first sight until MaxHosts is reached, so the
+// busiest destinations at startup are the ones tracked.
+func HostLabel(host string) string {
+	host = normalizeHost(host)
+
+	hosts.Lock()
+	defer hosts.Unlock()
+	if hosts.allow != nil {
+		if hosts.allow[host] {
+			return host
+		}
+		return OtherHost
+	}
+	if hosts.seen[host] {
+		return host
+	}
+	if hosts.cfg.MaxHosts > 0 && len(hosts.seen) >= hosts.cfg.MaxHosts {
+		return OtherHost
+	}
+	hosts.seen[host] = true
+	return host
+}
+
+// CountHost records a forward proxy request to host
+func CountHost(host string) {
+	RequestsByHost.WithLabelValues(HostLabel(host)).Inc()
+}
+
+// ObserveHostLatency records upstream latency for host when enabled
+func ObserveHostLatency(host string, d time.Duration) {
+	hosts.Lock()
+	enabled := hosts.cfg.Latency
+	hosts.Unlock()
+	if enabled {
+		RequestDurationByHost.WithLabelValues(HostLabel(host)).Observe(d.Seconds())
+	}
+}
+
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	return strings.ToLower(host)
+}
@@ -0,0 +1,27 @@
+package metrics
+
+import "testing"
+
+func TestHostLabel(t *testing.T) {
+	defer SetHostConfig(DefaultHostConfig())
+
+	SetHostConfig(HostConfig{MaxHosts: 2})
+	for _, tc := range []struct{ in, want string }{
+		{"a.example:443", "a.example"},
+		{"B.example", "b.example"},
+		{"c.example", OtherHost},
+		{"a.example:80", "a.example"},
+	} {
+		if got := HostLabel(tc.in); got != tc.want {
+			t.Errorf("capped HostLabel(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+
+	SetHostConfig(HostConfig{Allow: []string{"api.example"}})
+	if got := HostLabel("api.example:443"); got != "api.example" {
+		t.Errorf("allowlisted host labeled %q", got)
+	}
+	if got := HostLabel("other.example"); got != OtherHost {
+		t.Errorf("unlisted host labeled %q", got)
+	}
+}
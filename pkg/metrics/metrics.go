@@ -15,6 +15,15 @@ var (
 		[]string{"method", "status"},
 	)
 
+	// Gauge: Always 1, labeled with the running build
+	BuildInfo = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "proxy_build_info",
+			Help: "Build information of the running gateway (always 1)",
+		},
+		[]string{"version", "commit", "go_version"},
+	)
+
 	//Counter: Blocked requests
 	BlockedRequests = promauto.NewCounter(
 		prometheus.CounterOpts{
@@ -23,6 +32,40 @@ var (
 		},
 	)
 
+	// Gauge: Blocklist entries by kind (exact, wildcard, ip), as of the last load
+	BlocklistEntries = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "proxy_blocklist_entries",
+			Help: "Blocklist entries loaded, by kind",
+		},
+		[]string{"kind"},
+	)
+
+	// Gauge: When the blocklist was last loaded successfully
+	BlocklistLastReload = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "proxy_blocklist_last_reload_timestamp_seconds",
+			Help: "Unix time of the last successful blocklist load",
+		},
+	)
+
+	// Counter: TLS certificate reloads, by result (success, error)
+	TLSCertReloads = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_tls_cert_reloads_total",
+			Help: "TLS certificate reloads from disk, by result",
+		},
+		[]string{"result"},
+	)
+
+	// Gauge: Expiry of the certificate currently served
+	TLSCertExpiry = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "proxy_tls_cert_expiry_timestamp_seconds",
+			Help: "Unix time the served TLS certificate expires",
+		},
+	)
+
 	// Histogram: Request duration
 	RequestDuration = promauto.NewHistogramVec(
 		prometheus.HistogramOpts{
@@ -33,6 +76,36 @@ var (
 		[]string{"method"},
 	)
 
+	// Histogram: Time waiting on the origin (RoundTrip until response headers)
+	UpstreamDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "proxy_upstream_duration_seconds",
+			Help:    "Time spent waiting for upstream response headers in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"method"},
+	)
+
+	// Histogram: CONNECT tunnel lifetime, by how it ended (closed/error/intercepted)
+	TunnelDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "proxy_tunnel_duration_seconds",
+			Help:    "Duration of CONNECT tunnels from establishment to close",
+			Buckets: []float64{0.1, 0.5, 1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600},
+		},
+		[]string{"outcome"},
+	)
+
+	// Counter: Upstream hostname lookups by the dialers' resolver, by result
+	// (hit, miss = a DNS query was made)
+	DNSCacheLookups = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_dns_cache_lookups_total",
+			Help: "Upstream hostname lookups, by cache result",
+		},
+		[]string{"result"},
+	)
+
 	// Gauge: Active connections
 	ActiveConnections = promauto.NewGauge(
 		prometheus.GaugeOpts{
@@ -50,6 +123,22 @@ var (
 		[]string{"status_class"},
 	)
 
+	// Counter: Access log entries dropped by sampling
+	AccessLogSampledOut = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "proxy_access_log_sampled_out_total",
+			Help: "Successful requests not written to the access log because of sampling",
+		},
+	)
+
+	// Counter: Access log entries dropped by the include/exclude filters
+	AccessLogFiltered = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "proxy_access_log_filtered_total",
+			Help: "Requests not written to the access log because of the include/exclude filters",
+		},
+	)
+
 	// --- Inference Metrics ---
 
 	// Counter: Total inference requests
@@ -90,24 +179,25 @@ var (
 		[]string{"model"},
 	)
 
-	// Histogram: Worker processing time (gRPC call duration)
+	// Histogram: Worker processing time (gRPC call duration), by final status
 	InferenceProcessingDuration = promauto.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "inference_processing_seconds",
 			Help:    "Worker processing time for inference requests",
 			Buckets: []float64{0.1, 0.5, 1, 2, 5, 10, 30, 60, 120},
 		},
-		[]string{"model", "worker_id"},
+		[]string{"model", "worker_id", "status"},
 	)
 
-	// Histogram: Queue wait time (submit to worker pickup)
+	// Histogram: Queue wait time (submit to worker pickup, or to removal if
+	// the client left first), by final status
 	InferenceQueueWaitDuration = promauto.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "inference_queue_wait_seconds",
 			Help:    "Time request spent waiting in queue",
 			Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10},
 		},
-		[]string{"model", "priority"},
+		[]string{"model", "priority", "status"},
 	)
 
 	// Counter: Per-worker request counts
@@ -119,12 +209,68 @@ var (
 		[]string{"worker_id", "status"},
 	)
 
-	// Gauge: Current queue depth
-	InferenceQueueDepth = promauto.NewGauge(
+	// Counter: Failed worker streams by gRPC code (unavailable, internal, ...),
+	// including those requeued to another worker
+	InferenceWorkerErrors = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "inference_worker_errors_total",
+			Help: "Failed worker calls, by worker and gRPC status code",
+		},
+		[]string{"worker_id", "code"},
+	)
+
+	// Histogram: Requests sent together in one BatchGenerate call
+	InferenceBatchSize = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "inference_batch_size",
+			Help:    "Requests sent to a worker in one BatchGenerate call",
+			Buckets: []float64{2, 4, 8, 16, 32, 64},
+		},
+		[]string{"model", "worker_id"},
+	)
+
+	// Counter: Requests handed back to the queue after a worker failed before streaming
+	InferenceRequeuedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "inference_requeued_total",
+			Help: "Requests requeued after a worker failed before streaming any tokens",
+		},
+		[]string{"model", "worker_id"},
+	)
+
+	// Gauge: Worker health (1 = in rotation, 0 = removed after failed health checks)
+	InferenceWorkerHealthy = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "inference_worker_healthy",
+			Help: "Whether each inference worker is healthy (1) or out of rotation (0)",
+		},
+		[]string{"worker_id"},
+	)
+
+	// Gauge: Workers currently in rotation, across all pools
+	InferenceHealthyWorkers = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "inference_healthy_workers",
+			Help: "Number of connected inference workers that are healthy",
+		},
+	)
+
+	// Gauge: Current queue depth (per model queue)
+	InferenceQueueDepth = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "inference_queue_depth",
 			Help: "Current number of requests waiting in queue",
 		},
+		[]string{"queue"},
+	)
+
+	// Counter: Requests rejected at enqueue time
+	InferenceQueueRejectedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "inference_queue_rejected_total",
+			Help: "Total inference requests rejected by the queue",
+		},
+		[]string{"queue", "reason"},
 	)
 
 	// Gauge: In-flight requests (being processed by workers)
@@ -135,6 +281,69 @@ var (
 		},
 	)
 
+	// Gauge: Requests currently assigned to each worker
+	InferenceWorkerInFlight = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "inference_worker_in_flight",
+			Help: "Number of requests currently assigned to each worker",
+		},
+		[]string{"worker_id"},
+	)
+
+	// Counter: Inference cache lookups for deterministic requests
+	InferenceCacheLookupsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "inference_cache_lookups_total",
+			Help: "Inference cache lookups for deterministic requests by result (hit/miss)",
+		},
+		[]string{"model", "result"},
+	)
+
+	// Counter: Streams the gateway cut off because the worker overran max_tokens
+	InferenceMaxTokensEnforcedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "inference_max_tokens_enforced_total",
+			Help: "Inference streams cut off by the gateway after the worker sent max_tokens tokens without finishing",
+		},
+		[]string{"model"},
+	)
+
+	// Counter: Inference requests turned away by an exhausted token quota
+	InferenceQuotaRejectedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "inference_quota_rejected_total",
+			Help: "Inference requests rejected because a token quota was exhausted, by scope (key/model) and period",
+		},
+		[]string{"scope", "period"},
+	)
+
+	// Gauge: Tokens used against each model's quota in the current period
+	InferenceQuotaUsedTokens = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "inference_quota_used_tokens",
+			Help: "Tokens charged to a model's quota in the current day or month",
+		},
+		[]string{"model", "period"},
+	)
+
+	// Gauge: Redis rate limiter circuit breaker state, one per limiter (the
+	// shared one and each -rate-limit-methods override) by key prefix
+	RateLimiterBreakerState = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "rate_limiter_breaker_state",
+			Help: "Redis rate limiter circuit breaker state (0=closed, 1=open, 2=half-open)",
+		},
+		[]string{"key_prefix"},
+	)
+
+	// Gauge: Per-IP buckets held by the in-memory rate limiter
+	RateLimiterMemoryEntries = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "rate_limiter_memory_entries",
+			Help: "Per-IP buckets held by the in-memory rate limiter",
+		},
+	)
+
 	// Counter: Rate limited requests
 	RateLimitedTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -143,6 +352,14 @@ var (
 		},
 		[]string{"endpoint"},
 	)
+
+	// Counter: Requests turned away because every concurrency slot was taken
+	ConcurrencyLimitedTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "concurrency_limited_requests_total",
+			Help: "Total requests rejected by the global concurrency limit",
+		},
+	)
 )
 
 // PriorityLabel converts numeric priority (1-10) to low/medium/high
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+)
+
+// WithMaxBodySize caps request bodies at n bytes. Requests that declare a
+// larger Content-Length are rejected with 413 up front; streamed bodies are
+// wrapped in http.MaxBytesReader, so the handler's read fails with
+// *http.MaxBytesError once the limit is crossed. n <= 0 disables the limit.
+func WithMaxBodySize(n int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		if n <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// CONNECT bodies are the tunnel itself, not an upload
+			if r.Method == http.MethodConnect || r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if r.ContentLength > n {
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, n)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
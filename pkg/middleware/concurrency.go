@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aluko123/go-network-proxy/pkg/metrics"
+)
+
+// concurrencyRetryAfter is the Retry-After sent when every slot is taken;
+// ordinary requests finish well within it
+const concurrencyRetryAfter = time.Second
+
+// WithConcurrencyLimit caps the requests in flight across all clients at max.
+// A request that finds every slot taken is rejected at once with 503 and
+// Retry-After rather than queued; its slot is released when the handler
+// returns. Requests for which exempt returns true (e.g. CONNECT tunnels, which
+// would hold a slot for their whole lifetime) are neither counted nor limited.
+// max <= 0 disables the middleware.
+func WithConcurrencyLimit(max int, exempt func(*http.Request) bool) Middleware {
+	return func(next http.Handler) http.Handler {
+		if max <= 0 {
+			return next
+		}
+		sem := make(chan struct{}, max)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if exempt != nil && exempt(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			select {
+			case sem <- struct{}{}:
+			default:
+				metrics.ConcurrencyLimitedTotal.Inc()
+				w.Header().Set("Retry-After", strconv.Itoa(int(concurrencyRetryAfter.Seconds())))
+				http.Error(w, "Too many concurrent requests", http.StatusServiceUnavailable)
+				return
+			}
+			defer func() { <-sem }()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// CORSConfig holds cross-origin settings for browser clients
+type CORSConfig struct {
+	AllowedOrigins []string // exact origins, or "*" for any
+	AllowedMethods []string
+	AllowedHeaders []string
+	ExposedHeaders []string // response headers scripts may read
+	MaxAge         int      // seconds browsers may cache a preflight; 0 omits it
+}
+
+// DefaultCORSConfig returns settings suited to the inference API. No origins
+// are allowed until configured.
+func DefaultCORSConfig() CORSConfig {
+	return CORSConfig{
+		AllowedMethods: []string{http.MethodGet, http.MethodPost, http.MethodOptions},
+		AllowedHeaders: []string{"Content-Type", "Authorization", "X-API-Key", "X-Request-ID"},
+		ExposedHeaders: []string{"X-Request-ID", "X-Inference-Cache"},
+		MaxAge:         600,
+	}
+}
+
+// WithCORS adds Access-Control-* headers for allowed origins and answers
+// preflight requests with 204. It only adds headers, so streaming responses
+// (SSE) keep the Content-Type and Cache-Control set by the handler.
+func WithCORS(cfg CORSConfig) Middleware {
+	allowAny := false
+	origins := make(map[string]bool, len(cfg.AllowedOrigins))
+	for _, o := range cfg.AllowedOrigins {
+		if o == "*" {
+			allowAny = true
+		}
+		origins[o] = true
+	}
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	exposed := strings.Join(cfg.ExposedHeaders, ", ")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Add("Vary", "Origin")
+			if !allowAny && !origins[origin] {
+				// Not ours to allow: respond normally, the browser blocks it
+				next.ServeHTTP(w, r)
+				return
+			}
+			if allowAny {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
+
+			// Preflight
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+				h.Set("Access-Control-Allow-Methods", methods)
+				h.Set("Access-Control-Allow-Headers", headers)
+				if cfg.MaxAge > 0 {
+					h.Set("Access-Control-Max-Age", strconv.Itoa(cfg.MaxAge))
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			if exposed != "" {
+				h.Set("Access-Control-Expose-Headers", exposed)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
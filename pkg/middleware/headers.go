@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// ParseHeaders parses comma-separated "Name: value" pairs, e.g.
+// "X-Proxy-Node: node-3, Content-Security-Policy: default-src 'self'". A
+// comma only starts a new pair when a header name and colon follow it, so
+// values keep their own commas ("User-Agent: Mozilla/5.0 (KHTML, like Gecko)",
+// "Cache-Control: no-store, private"). A name given twice has its values
+// joined with ", " as HTTP allows.
+func ParseHeaders(s string) (map[string]string, error) {
+	var pairs []string
+	for _, part := range strings.Split(s, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		if len(pairs) == 0 || startsPair(part) {
+			pairs = append(pairs, part)
+		} else {
+			pairs[len(pairs)-1] += "," + part
+		}
+	}
+
+	headers := make(map[string]string)
+	for _, pair := range pairs {
+		pair = strings.TrimSpace(pair)
+		name, value, ok := strings.Cut(pair, ":")
+		name = strings.TrimSpace(name)
+		value = strings.TrimSpace(value)
+		if !ok || !httpguts.ValidHeaderFieldName(name) {
+			return nil, fmt.Errorf("header %q: want Name: value", pair)
+		}
+		if !httpguts.ValidHeaderFieldValue(value) {
+			return nil, fmt.Errorf("header %q: invalid value", pair)
+		}
+		name = http.CanonicalHeaderKey(name)
+		if prev, ok := headers[name]; ok {
+			value = prev + ", " + value
+		}
+		headers[name] = value
+	}
+	return headers, nil
+}
+
+// startsPair reports whether the text after a comma begins a new "Name:"
+// pair rather than continuing the previous value. A URL ("https://...") in a
+// value is not taken for a header name.
+func startsPair(part string) bool {
+	name, rest, ok := strings.Cut(part, ":")
+	return ok && httpguts.ValidHeaderFieldName(strings.TrimSpace(name)) && !strings.HasPrefix(rest, "//")
+}
+
+// WithResponseHeaders adds headers (e.g. X-Proxy-Node or a CSP) to every
+// response that doesn't already carry them, so a header set by the handler
+// or the upstream wins. They are applied when the response starts, once the
+// handler's own headers are known. CONNECT tunnels and protocol upgrades are
+// left alone. An empty map disables the middleware.
+func WithResponseHeaders(headers map[string]string) Middleware {
+	return withResponseHeaders(headers, false)
+}
+
+// WithResponseHeaderOverrides is WithResponseHeaders for headers that replace
+// whatever the handler or upstream set
+func WithResponseHeaderOverrides(headers map[string]string) Middleware {
+	return withResponseHeaders(headers, true)
+}
+
+func withResponseHeaders(headers map[string]string, override bool) Middleware {
+	return func(next http.Handler) http.Handler {
+		if len(headers) == 0 {
+			return next
+		}
+		canonical := make(map[string]string, len(headers))
+		for name, value := range headers {
+			canonical[http.CanonicalHeaderKey(name)] = value
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodConnect || IsUpgrade(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			hw := &headerWriter{ResponseWriter: w, headers: canonical, override: override}
+			next.ServeHTTP(hw, r)
+			// A handler that never wrote still gets an (empty) 200 with headers
+			hw.apply()
+		})
+	}
+}
+
+// headerWriter adds the configured headers just before the response starts
+type headerWriter struct {
+	http.ResponseWriter
+	headers  map[string]string // canonical names
+	override bool
+	applied  bool
+}
+
+func (hw *headerWriter) apply() {
+	if hw.applied {
+		return
+	}
+	hw.applied = true
+	h := hw.ResponseWriter.Header()
+	for name, value := range hw.headers {
+		if hw.override || len(h[name]) == 0 {
+			h.Set(name, value)
+		}
+	}
+}
+
+func (hw *headerWriter) WriteHeader(code int) {
+	// Informational responses go out before the handler's final headers
+	if code >= 200 {
+		hw.apply()
+	}
+	hw.ResponseWriter.WriteHeader(code)
+}
+
+func (hw *headerWriter) Write(b []byte) (int, error) {
+	hw.apply()
+	return hw.ResponseWriter.Write(b)
+}
+
+// Flush implements the http.Flusher interface
+func (hw *headerWriter) Flush() {
+	hw.apply()
+	if flusher, ok := hw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
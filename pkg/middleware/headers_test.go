@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseHeaders(t *testing.T) {
+	got, err := ParseHeaders(" x-proxy-node: node-3, Cache-Control: no-store ,Cache-Control: private,")
+	if err != nil {
+		t.Fatalf("ParseHeaders: %v", err)
+	}
+	if len(got) != 2 || got["X-Proxy-Node"] != "node-3" || got["Cache-Control"] != "no-store, private" {
+		t.Errorf("unexpected headers %q", got)
+	}
+
+	// Commas inside values stay there
+	const ua = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0"
+	got, err = ParseHeaders("User-Agent: " + ua + ", Cache-Control: no-store, private, Link: <https://a.example>, <https://b.example>")
+	if err != nil {
+		t.Fatalf("ParseHeaders: %v", err)
+	}
+	want := map[string]string{
+		"User-Agent":    ua,
+		"Cache-Control": "no-store, private",
+		"Link":          "<https://a.example>, <https://b.example>",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	for _, bad := range []string{"X-Proxy-Node", ": value", "Bad Name: x", "X-A: \x00"} {
+		if _, err := ParseHeaders(bad); err == nil {
+			t.Errorf("ParseHeaders(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestWithResponseHeaders(t *testing.T) {
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", "default-src 'none'")
+		w.Header().Set("Server", "upstream")
+		w.WriteHeader(http.StatusTeapot)
+	})
+	h := Chain(upstream,
+		WithResponseHeaderOverrides(map[string]string{"server": "gateway"}),
+		WithResponseHeaders(map[string]string{
+			"X-Proxy-Node":            "node-3",
+			"Content-Security-Policy": "default-src 'self'",
+		}),
+	)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusTeapot {
+		t.Errorf("expected 418, got %d", w.Code)
+	}
+	if got := w.Header().Get("X-Proxy-Node"); got != "node-3" {
+		t.Errorf("X-Proxy-Node = %q, want node-3", got)
+	}
+	if got := w.Header().Get("Content-Security-Policy"); got != "default-src 'none'" {
+		t.Errorf("upstream CSP overridden: %q", got)
+	}
+	if got := w.Header().Values("Server"); len(got) != 1 || got[0] != "gateway" {
+		t.Errorf("Server = %q, want the override", got)
+	}
+
+	// A handler that writes nothing still gets the headers
+	h = WithResponseHeaders(map[string]string{"X-Proxy-Node": "node-3"})(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := w.Header().Get("X-Proxy-Node"); got != "node-3" {
+		t.Errorf("empty response: X-Proxy-Node = %q", got)
+	}
+}
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// LogRule matches a completed request by response status and host, for
+// LogFilter
+type LogRule struct {
+	MinStatus, MaxStatus int    // inclusive; 0, 0 matches any status
+	Host                 string // exact host or "*.example.com" (the domain and its subdomains); empty matches any
+}
+
+// ParseLogRules parses comma-separated rules of the form status@host, where
+// status is a code ("404"), a class ("2xx") or a range ("200-399"), and
+// either part may be left out: "2xx@*.internal,304,@health.local".
+func ParseLogRules(s string) ([]LogRule, error) {
+	var rules []LogRule
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		status, host, _ := strings.Cut(field, "@")
+		rule := LogRule{Host: strings.ToLower(hostname(strings.TrimSpace(host)))}
+		if status = strings.TrimSpace(status); status != "" {
+			var err error
+			if rule.MinStatus, rule.MaxStatus, err = parseStatusRange(status); err != nil {
+				return nil, fmt.Errorf("log rule %q: %w", field, err)
+			}
+		}
+		if rule.MinStatus == 0 && rule.Host == "" {
+			return nil, fmt.Errorf("log rule %q matches everything", field)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// parseStatusRange parses "404", "2xx" or "200-399"
+func parseStatusRange(s string) (int, int, error) {
+	if len(s) == 3 && strings.HasSuffix(strings.ToLower(s), "xx") && s[0] >= '1' && s[0] <= '5' {
+		class := int(s[0]-'0') * 100
+		return class, class + 99, nil
+	}
+	lo, hi, isRange := strings.Cut(s, "-")
+	from, err := strconv.Atoi(lo)
+	if err != nil || from < 100 || from > 599 {
+		return 0, 0, fmt.Errorf("invalid status %q", lo)
+	}
+	if !isRange {
+		return from, from, nil
+	}
+	to, err := strconv.Atoi(hi)
+	if err != nil || to < from || to > 599 {
+		return 0, 0, fmt.Errorf("invalid status range %q", s)
+	}
+	return from, to, nil
+}
+
+// Matches reports whether the rule covers a request to host answered with status
+func (rule LogRule) Matches(status int, host string) bool {
+	if rule.MinStatus != 0 && (status < rule.MinStatus || status > rule.MaxStatus) {
+		return false
+	}
+	if rule.Host == "" {
+		return true
+	}
+	host = strings.ToLower(hostname(host))
+	if domain, ok := strings.CutPrefix(rule.Host, "*."); ok {
+		return host == domain || strings.HasSuffix(host, "."+domain)
+	}
+	return host == rule.Host
+}
+
+// LogFilter returns a LogSampling.LogIf predicate: a request is logged if it
+// matches one of include (or include is empty) and none of exclude
+func LogFilter(include, exclude []LogRule) func(status int, r *http.Request) bool {
+	return func(status int, r *http.Request) bool {
+		host := r.Host
+		if host == "" {
+			host = r.URL.Host
+		}
+		matches := func(rules []LogRule) bool {
+			for _, rule := range rules {
+				if rule.Matches(status, host) {
+					return true
+				}
+			}
+			return false
+		}
+		return (len(include) == 0 || matches(include)) && !matches(exclude)
+	}
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aluko123/go-network-proxy/pkg/logger"
+	"github.com/aluko123/go-network-proxy/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestParseLogRules(t *testing.T) {
+	rules, err := ParseLogRules("2xx@*.Internal, 304 ,200-399@api.example.com:8443,@health.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []LogRule{
+		{MinStatus: 200, MaxStatus: 299, Host: "*.internal"},
+		{MinStatus: 304, MaxStatus: 304},
+		{MinStatus: 200, MaxStatus: 399, Host: "api.example.com"}, // ports are ignored
+		{Host: "health.local"},
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("got %+v", rules)
+	}
+	for i := range want {
+		if rules[i] != want[i] {
+			t.Errorf("rule %d = %+v, want %+v", i, rules[i], want[i])
+		}
+	}
+
+	for _, bad := range []string{"6xx", "abc", "399-200", "200-", "@", "99"} {
+		if _, err := ParseLogRules(bad); err == nil {
+			t.Errorf("ParseLogRules(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestLogFilter(t *testing.T) {
+	include, _ := ParseLogRules("")
+	exclude, _ := ParseLogRules("2xx@*.internal,3xx")
+	logIf := LogFilter(include, exclude)
+
+	tests := []struct {
+		status int
+		host   string
+		want   bool
+	}{
+		{200, "svc.internal", false},
+		{200, "SVC.Internal:8080", false},
+		{200, "internal", false}, // wildcard covers the domain itself
+		{404, "svc.internal", true},
+		{200, "notinternal", true},
+		{301, "example.com", false},
+		{200, "example.com", true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "http://"+tt.host+"/", nil)
+		if got := logIf(tt.status, r); got != tt.want {
+			t.Errorf("logIf(%d, %s) = %v, want %v", tt.status, tt.host, got, tt.want)
+		}
+	}
+
+	// With include rules, only matching requests are logged
+	include, _ = ParseLogRules("4xx,@example.com")
+	logIf = LogFilter(include, nil)
+	for status, want := range map[int]bool{200: false, 404: true} {
+		if got := logIf(status, httptest.NewRequest(http.MethodGet, "http://other.com/", nil)); got != want {
+			t.Errorf("include: logIf(%d, other.com) = %v, want %v", status, got, want)
+		}
+	}
+	if !logIf(200, httptest.NewRequest(http.MethodGet, "http://example.com/", nil)) {
+		t.Error("include: request to example.com not logged")
+	}
+}
+
+func TestWithSampledLogging_LogIf(t *testing.T) {
+	var buf bytes.Buffer
+	log := logger.NewWithOptions(logger.Options{Format: "json", Output: &buf})
+	// Exclude everything: only 5xx should get through
+	sample := LogSampling{LogIf: func(int, *http.Request) bool { return false }}
+	h := WithSampledLogging(log, sample)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		w.WriteHeader(code)
+	}))
+
+	before := testutil.ToFloat64(metrics.AccessLogFiltered)
+	for _, path := range []string{"/200", "/404", "/502"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	out := buf.String()
+	if strings.Contains(out, `"path":"/200"`) || strings.Contains(out, `"path":"/404"`) {
+		t.Errorf("filtered request logged: %s", out)
+	}
+	if !strings.Contains(out, `"path":"/502"`) {
+		t.Errorf("5xx was filtered out: %s", out)
+	}
+	if got := testutil.ToFloat64(metrics.AccessLogFiltered) - before; got != 2 {
+		t.Errorf("expected 2 filtered, got %v", got)
+	}
+}
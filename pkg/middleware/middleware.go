@@ -1,8 +1,16 @@
 package middleware
 
 import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/aluko123/go-network-proxy/pkg/blocklist"
@@ -22,12 +30,25 @@ func Chain(h http.Handler, middlewares ...Middleware) http.Handler {
 	return h
 }
 
-// WithRateLimit returns a middleware that enforces rate limits
-func WithRateLimit(limiter limit.RateLimiter) Middleware {
+// WithRateLimit returns a middleware that enforces rate limits. Requests for
+// which exempt returns true (see ExemptPaths) skip the limiter entirely and
+// don't count against the client's budget. A limit.MethodLimiter is asked
+// about the request's method as well as its client IP.
+func WithRateLimit(limiter limit.RateLimiter, exempt func(*http.Request) bool) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if exempt != nil && exempt(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
 			ip := limit.GetIP(r)
-			if !limiter.Allow(ip) {
+			var allowed bool
+			if ml, ok := limiter.(limit.MethodLimiter); ok {
+				allowed = ml.AllowMethod(r.Context(), r.Method, ip)
+			} else {
+				allowed = limiter.Allow(r.Context(), ip)
+			}
+			if !allowed {
 				endpoint := r.URL.Path
 				if endpoint == "" {
 					endpoint = "proxy"
@@ -49,20 +70,15 @@ func WithBlocklist(bm *blocklist.Manager) Middleware {
 			if host == "" {
 				host = r.URL.Host
 			}
-			// Remove port if present
-			if colonIdx := strings.Index(host, ":"); colonIdx != -1 {
-				host = host[:colonIdx]
-			}
 
-			if bm.IsBlocked(host) {
+			if rule, blocked := bm.Match(hostname(host)); blocked {
 				metrics.BlockedRequests.Inc()
 
 				if r.Method == http.MethodConnect {
-					http.Error(w, "Forbidden", http.StatusForbidden)
+					SetOutcome(r.Context(), OutcomeBlocked)
+					refuseConnect(w)
 				} else {
-					w.Header().Set("Content-Type", "text/html")
-					w.WriteHeader(http.StatusForbidden)
-					w.Write([]byte(blocklist.GetBlockedResponse()))
+					writeBlockedPage(w, blocklist.BlockedPage{Host: hostname(host), Rule: rule})
 				}
 				return
 			}
@@ -71,8 +87,73 @@ func WithBlocklist(bm *blocklist.Manager) Middleware {
 	}
 }
 
+// writeBlockedPage serves the blocked page with 403. It is rendered up front
+// so a broken custom template still gets a clean (plain) 403 out.
+func writeBlockedPage(w http.ResponseWriter, page blocklist.BlockedPage) {
+	var buf bytes.Buffer
+	if err := blocklist.WriteBlockedPage(&buf, page); err != nil {
+		slog.Error("blocked page template failed", "error", err)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusForbidden)
+	w.Write(buf.Bytes())
+}
+
+// refuseConnect answers a CONNECT with a complete 403 and closes the
+// connection once it is sent. Left open, a client that ignores the status
+// would start its TLS handshake on it and read the server's 400 for that
+// instead.
+func refuseConnect(w http.ResponseWriter) {
+	const body = "Forbidden: destination blocked by proxy policy\n"
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Header().Set("Connection", "close")
+	w.WriteHeader(http.StatusForbidden)
+	io.WriteString(w, body)
+}
+
+// hostname strips the port from a Host value, including bracketed IPv6
+// literals such as "[2001:db8::1]:443"
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+}
+
+// LogSampling controls which successful requests WithSampledLogging writes
+type LogSampling struct {
+	Rate          int           // log 1 in Rate fast successful requests (<= 1 logs all)
+	SlowThreshold time.Duration // requests at least this slow are always logged (0 = none)
+
+	// LogIf, if set, is asked after the handler runs whether to log a
+	// request at all (see LogFilter). 5xx responses are logged regardless.
+	LogIf func(status int, r *http.Request) bool
+}
+
 // WithLogging returns a middleware that logs request details
 func WithLogging(log *logger.Logger) Middleware {
+	return WithSampledLogging(log, LogSampling{})
+}
+
+// WithSampledLogging is WithLogging with sampling: errors (status >= 400) and
+// slow requests are always logged, other requests 1 in sample.Rate. Skipped
+// entries are counted in proxy_access_log_sampled_out_total, and those
+// sample.LogIf rejects in proxy_access_log_filtered_total.
+func WithSampledLogging(log *logger.Logger, sample LogSampling) Middleware {
+	var seen atomic.Uint64
+	keep := func(status int, elapsed time.Duration) bool {
+		if sample.Rate <= 1 || status >= 400 {
+			return true
+		}
+		if sample.SlowThreshold > 0 && elapsed >= sample.SlowThreshold {
+			return true
+		}
+		return seen.Add(1)%uint64(sample.Rate) == 1
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Metrics: Active Connections
@@ -84,33 +165,54 @@ func WithLogging(log *logger.Logger) Middleware {
 			//get request ID from context
 			reqID, _ := r.Context().Value(logger.RequestIDKey).(string)
 
-			// if debug {
-			// 	log.Printf("[%s] %s %s", r.Method, r.Host, r.URL.String())
-			// } else {
-			// 	log.Printf("[%s] %s", r.Method, r.Host)
-			// }
+			// Debug level adds the full URL and headers
+			if log.Enabled(r.Context(), slog.LevelDebug) {
+				log.Debug("request received",
+					"request_id", reqID,
+					"method", r.Method,
+					"url", r.URL.String(),
+					"proto", r.Proto,
+					"headers", r.Header,
+				)
+			}
 
 			// Use our custom wrapper to capture status code
 			recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
 
-			next.ServeHTTP(recorder, r)
+			// Handlers annotate the entry via logger.AddFields (e.g. upstream_ms)
+			ctx := logger.WithFields(r.Context())
+			ctx, outcome := withOutcome(ctx)
+			next.ServeHTTP(recorder, r.WithContext(ctx))
 
-			log.Info("request completed",
-				"request_id", reqID,
-				"status", recorder.statusCode,
-				"path", r.URL.Path,
-				"method", r.Method,
-				"host", r.Host,
-				"duration_ms", time.Since(start).Milliseconds(),
-				"client_ip", limit.GetIP(r),
-			)
+			elapsed := time.Since(start)
+			if recorder.statusCode < 500 && sample.LogIf != nil && !sample.LogIf(recorder.statusCode, r) {
+				metrics.AccessLogFiltered.Inc()
+			} else if keep(recorder.statusCode, elapsed) {
+				attrs := []any{
+					"request_id", reqID,
+					"status", recorder.statusCode,
+					"path", r.URL.Path,
+					"method", r.Method,
+					"host", r.Host,
+					"duration_ms", elapsed.Milliseconds(),
+					"client_ip", limit.GetIP(r),
+				}
+				if *outcome != "" {
+					attrs = append(attrs, "outcome", *outcome)
+				}
+				log.Info("request completed", append(attrs, logger.Fields(ctx)...)...)
+			} else {
+				metrics.AccessLogSampledOut.Inc()
+			}
 
 			// Metrics: Duration and Status
-			duration := time.Since(start).Seconds()
-			metrics.RequestDuration.WithLabelValues(r.Method).Observe(duration)
-			// statusClass := fmt.Sprintf("%dxx", recorder.statusCode/100)
-			// metrics.StatusCodeCounter.WithLabelValues(statusClass).Inc()
-			// metrics.RequestsTotal.WithLabelValues(r.Method, http.StatusText(recorder.statusCode)).Inc()
+			metrics.RequestDuration.WithLabelValues(r.Method).Observe(elapsed.Seconds())
+			status, class := recorder.labels()
+			if *outcome != "" {
+				status = *outcome
+			}
+			metrics.StatusCodeCounter.WithLabelValues(class).Inc()
+			metrics.RequestsTotal.WithLabelValues(r.Method, status).Inc()
 		})
 	}
 }
@@ -120,6 +222,17 @@ type statusRecorder struct {
 	http.ResponseWriter
 	statusCode  int
 	wroteHeader bool
+	hijacked    bool
+}
+
+// labels returns the status and status class metric labels. A connection
+// hijacked before any status was written has no meaningful code, so both
+// labels read "hijacked" instead of the default 200.
+func (r *statusRecorder) labels() (status, class string) {
+	if r.hijacked && !r.wroteHeader {
+		return "hijacked", "hijacked"
+	}
+	return strconv.Itoa(r.statusCode), fmt.Sprintf("%dxx", r.statusCode/100)
 }
 
 func (r *statusRecorder) WriteHeader(code int) {
@@ -131,6 +244,20 @@ func (r *statusRecorder) WriteHeader(code int) {
 	r.ResponseWriter.WriteHeader(code)
 }
 
+// Hijack implements the http.Hijacker interface so CONNECT tunnels work
+// through the logging middleware
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T does not support hijacking", r.ResponseWriter)
+	}
+	conn, rw, err := hj.Hijack()
+	if err == nil {
+		r.hijacked = true
+	}
+	return conn, rw, err
+}
+
 // Flush implements the http.Flusher interface
 func (r *statusRecorder) Flush() {
 	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
@@ -0,0 +1,416 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aluko123/go-network-proxy/pkg/blocklist"
+	"github.com/aluko123/go-network-proxy/pkg/limit"
+	"github.com/aluko123/go-network-proxy/pkg/logger"
+	"github.com/aluko123/go-network-proxy/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/time/rate"
+)
+
+func TestWithLogging_SeparateAccessAndAppWriters(t *testing.T) {
+	var accessBuf, appBuf bytes.Buffer
+	accessLog := logger.NewWithOptions(logger.Options{Format: "json", Output: &accessBuf})
+	appLog := logger.NewWithOptions(logger.Options{Format: "text", Output: &appBuf})
+
+	panicky := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	h := Chain(
+		panicky,
+		WithRecovery(appLog),
+		WithLogging(accessLog),
+		WithRequestID(),
+	)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/boom", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500, got %d", w.Code)
+	}
+
+	access := accessBuf.String()
+	if !strings.Contains(access, `"msg":"request completed"`) || !strings.Contains(access, `"status":500`) {
+		t.Errorf("access log missing request entry: %q", access)
+	}
+	if strings.Contains(access, "panic") {
+		t.Errorf("panic leaked into access log: %q", access)
+	}
+
+	app := appBuf.String()
+	if !strings.Contains(app, "panic recovered") || !strings.Contains(app, "boom") {
+		t.Errorf("app log missing panic entry: %q", app)
+	}
+	if strings.Contains(app, "request completed") {
+		t.Errorf("access entry leaked into app log: %q", app)
+	}
+}
+
+func TestWithLogging_DebugFollowsRuntimeLevel(t *testing.T) {
+	defer logger.SetLevel(logger.GetLevel())
+
+	var buf bytes.Buffer
+	log := logger.NewWithOptions(logger.Options{Format: "json", Output: &buf})
+	h := WithLogging(log)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	send := func() {
+		r := httptest.NewRequest(http.MethodGet, "/path?q=1", nil)
+		r.Header.Set("X-Trace", "abc")
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	logger.SetLevel(slog.LevelInfo)
+	send()
+	if strings.Contains(buf.String(), "request received") {
+		t.Fatalf("debug entry logged at info level: %q", buf.String())
+	}
+
+	logger.SetLevel(slog.LevelDebug)
+	send()
+	out := buf.String()
+	if !strings.Contains(out, `"msg":"request received"`) || !strings.Contains(out, "/path?q=1") || !strings.Contains(out, "X-Trace") {
+		t.Errorf("debug entry missing url or headers: %q", out)
+	}
+}
+
+func TestWithLogging_DebugRedactsHeaders(t *testing.T) {
+	defer logger.SetLevel(logger.GetLevel())
+	logger.SetLevel(slog.LevelDebug)
+
+	for _, format := range []string{"json", "text"} {
+		var buf bytes.Buffer
+		log := logger.NewWithOptions(logger.Options{Format: format, Output: &buf})
+		h := WithLogging(log)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", "Bearer s3cret-token")
+		r.Header.Set("Proxy-Authorization", "Basic s3cret-basic")
+		r.Header.Set("Cookie", "session=s3cret-cookie")
+		r.Header.Set("X-Api-Key", "s3cret-key")
+		r.Header.Set("X-Trace", "abc")
+		h.ServeHTTP(httptest.NewRecorder(), r)
+
+		out := buf.String()
+		if strings.Contains(out, "s3cret") {
+			t.Errorf("%s: secret header value logged: %s", format, out)
+		}
+		if !strings.Contains(out, logger.Redacted) || !strings.Contains(out, "abc") {
+			t.Errorf("%s: expected redacted and plain headers: %s", format, out)
+		}
+		if r.Header.Get("Authorization") != "Bearer s3cret-token" {
+			t.Error("redaction modified the request")
+		}
+	}
+}
+
+func TestWithSampledLogging(t *testing.T) {
+	var buf bytes.Buffer
+	log := logger.NewWithOptions(logger.Options{Format: "json", Output: &buf})
+	h := WithSampledLogging(log, LogSampling{Rate: 10, SlowThreshold: time.Hour})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/missing" {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+	before := testutil.ToFloat64(metrics.AccessLogSampledOut)
+	for i := 0; i < 20; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ok", nil))
+	}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+	out := buf.String()
+	if n := strings.Count(out, `"path":"/ok"`); n != 2 {
+		t.Errorf("expected 2 of 20 successful requests logged, got %d", n)
+	}
+	if !strings.Contains(out, `"path":"/missing"`) {
+		t.Errorf("error response was sampled out: %q", out)
+	}
+	if got := testutil.ToFloat64(metrics.AccessLogSampledOut) - before; got != 18 {
+		t.Errorf("expected 18 sampled out, got %v", got)
+	}
+}
+
+func TestWithLogging_HandlerFields(t *testing.T) {
+	var buf bytes.Buffer
+	log := logger.NewWithOptions(logger.Options{Format: "json", Output: &buf})
+	h := WithLogging(log)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.AddFields(r.Context(), "upstream_ms", 42)
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+
+	if !strings.Contains(buf.String(), `"upstream_ms":42`) {
+		t.Errorf("access log missing handler field: %q", buf.String())
+	}
+}
+
+func TestWithLogging_StatusMetrics(t *testing.T) {
+	log := logger.NewWithOptions(logger.Options{Output: io.Discard})
+	h := WithLogging(log)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Host {
+		case "down.example:443":
+			http.Error(w, "dial failed", http.StatusServiceUnavailable)
+		default:
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Errorf("hijack through recorder: %v", err)
+				return
+			}
+			conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+			conn.Close()
+		}
+	}))
+	done := make(chan struct{}, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r)
+		done <- struct{}{}
+	}))
+	defer srv.Close()
+
+	connect := func(host string) string {
+		conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", host, host)
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		return line
+	}
+
+	hijacked := metrics.RequestsTotal.WithLabelValues(http.MethodConnect, "hijacked")
+	failed := metrics.RequestsTotal.WithLabelValues(http.MethodConnect, "503")
+	beforeHijacked, beforeFailed := testutil.ToFloat64(hijacked), testutil.ToFloat64(failed)
+
+	if line := connect("up.example:443"); !strings.Contains(line, "200") {
+		t.Errorf("tunnel response %q", line)
+	}
+	if line := connect("down.example:443"); !strings.Contains(line, "503") {
+		t.Errorf("failed tunnel response %q", line)
+	}
+	<-done
+	<-done
+
+	if got := testutil.ToFloat64(hijacked) - beforeHijacked; got != 1 {
+		t.Errorf("expected 1 hijacked CONNECT, got %v", got)
+	}
+	if got := testutil.ToFloat64(failed) - beforeFailed; got != 1 {
+		t.Errorf("expected 1 failed CONNECT, got %v", got)
+	}
+}
+
+func TestWithBlocklist_IPv6Host(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.json")
+	if err := os.WriteFile(path, []byte(`{"blocked_domains": ["2001:db8::1", "example.com"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	bm := blocklist.NewManager()
+	if err := bm.LoadFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	h := WithBlocklist(bm)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		method, target string
+		want           int
+	}{
+		{http.MethodConnect, "[2001:db8::1]:443", http.StatusForbidden},
+		{http.MethodGet, "http://[2001:db8::1]:8080/", http.StatusForbidden},
+		{http.MethodGet, "http://[2001:db8::1]/", http.StatusForbidden},
+		{http.MethodConnect, "[2001:db8::2]:443", http.StatusOK},
+		{http.MethodConnect, "example.com:443", http.StatusForbidden},
+		{http.MethodGet, "http://example.com/", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.target, nil)
+		if tt.method == http.MethodConnect {
+			r.Host = tt.target
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s %s: expected %d, got %d", tt.method, tt.target, tt.want, w.Code)
+		}
+	}
+}
+
+func TestWithBlocklist_RawConnectRefused(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.json")
+	if err := os.WriteFile(path, []byte(`{"blocked_domains": ["blocked.com"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	bm := blocklist.NewManager()
+	if err := bm.LoadFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// Stands in for the tunnel handler: reaching it means a tunnel was set up
+	var tunnels atomic.Int32
+	srv := httptest.NewServer(WithBlocklist(bm)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tunnels.Add(1)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+	})))
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	io.WriteString(conn, "CONNECT blocked.com:443 HTTP/1.1\r\nHost: blocked.com:443\r\n\r\n")
+
+	br := bufio.NewReader(conn)
+	line, err := br.ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading status line: %v", err)
+	}
+	if line != "HTTP/1.1 403 Forbidden\r\n" {
+		t.Errorf("expected the exact 403 status line, got %q", line)
+	}
+
+	// A client ignoring the 403 starts its TLS handshake anyway; the server
+	// must have closed the connection rather than parse that as HTTP
+	io.WriteString(conn, "\x16\x03\x01\x00\x05hello")
+	rest, err := io.ReadAll(br)
+	if err != nil {
+		t.Fatalf("expected the server to close the connection, got %v", err)
+	}
+	if !strings.Contains(string(rest), "Connection: close\r\n") {
+		t.Errorf("expected Connection: close, got %q", rest)
+	}
+	if strings.Contains(string(rest), "HTTP/1.1 400") || strings.Contains(string(rest), "200 Connection established") {
+		t.Errorf("expected nothing after the 403, got %q", rest)
+	}
+	if tunnels.Load() != 0 {
+		t.Error("blocked CONNECT reached the tunnel handler")
+	}
+}
+
+func TestWithBlocklist_BlockedPage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.json")
+	if err := os.WriteFile(path, []byte(`{"blocked_domains": ["*.ads.com"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	bm := blocklist.NewManager()
+	if err := bm.LoadFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	h := WithBlocklist(bm)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://x.ads.com:8080/", nil))
+		return w
+	}
+
+	w := get()
+	if w.Code != http.StatusForbidden || w.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Fatalf("expected a 403 UTF-8 HTML page, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(w.Body.String(), "<strong>x.ads.com</strong>") {
+		t.Errorf("expected the default page to name the host, got %q", w.Body)
+	}
+
+	blocklist.SetBlockedTemplate(template.Must(template.New("custom").Parse(`{{.Host}} blocked by {{.Rule}}`)))
+	defer blocklist.SetBlockedTemplate(nil)
+	if body := get().Body.String(); body != "x.ads.com blocked by *.ads.com" {
+		t.Errorf("expected the custom page, got %q", body)
+	}
+
+	// A template that fails to execute still yields a clean 403
+	blocklist.SetBlockedTemplate(template.Must(template.New("broken").Parse(`{{.Missing}}`)))
+	if w := get(); w.Code != http.StatusForbidden || strings.Contains(w.Body.String(), "<") {
+		t.Errorf("expected a plain 403, got %d %q", w.Code, w.Body)
+	}
+}
+
+// denyAll is a rate limiter that rejects everything, counting its calls
+type denyAll struct{ calls atomic.Int32 }
+
+func (d *denyAll) Allow(context.Context, string) bool { d.calls.Add(1); return false }
+func (d *denyAll) Close() error                       { return nil }
+
+func TestWithRateLimit_ExemptPaths(t *testing.T) {
+	limiter := &denyAll{}
+	h := WithRateLimit(limiter, ExemptPaths([]string{"/metrics", "/admin/"}))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		method, target string
+		want           int
+	}{
+		{http.MethodGet, "/metrics", http.StatusOK},
+		{http.MethodGet, "/admin/queue", http.StatusOK},
+		{http.MethodGet, "/admin/", http.StatusOK},
+		{http.MethodGet, "/metrics/extra", http.StatusTooManyRequests}, // exact entry
+		{http.MethodGet, "/administrator", http.StatusTooManyRequests},
+		{http.MethodGet, "/admin", http.StatusTooManyRequests},
+		{http.MethodPost, "/v1/inference", http.StatusTooManyRequests},
+		// Proxied requests are limited whatever their path
+		{http.MethodGet, "http://example.com/metrics", http.StatusTooManyRequests},
+		{http.MethodConnect, "example.com:443", http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, nil))
+		if w.Code != tt.want {
+			t.Errorf("%s %s: expected %d, got %d", tt.method, tt.target, tt.want, w.Code)
+		}
+	}
+	// Exempt requests never touch the limiter
+	if got := limiter.calls.Load(); got != 6 {
+		t.Errorf("expected 6 limiter calls, got %d", got)
+	}
+}
+
+func TestWithRateLimit_PerMethod(t *testing.T) {
+	limiter := limit.NewMethodRateLimiter(limit.NewMemoryRateLimiter(rate.Every(time.Hour), 3),
+		map[string]limit.RateLimiter{http.MethodPost: limit.NewMemoryRateLimiter(rate.Every(time.Hour), 1)})
+	defer limiter.Close()
+	h := WithRateLimit(limiter, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		method string
+		want   int
+	}{
+		{http.MethodPost, http.StatusOK},
+		{http.MethodPost, http.StatusTooManyRequests},
+		{http.MethodGet, http.StatusOK},
+		{http.MethodGet, http.StatusOK},
+		{http.MethodHead, http.StatusOK},
+		{http.MethodGet, http.StatusTooManyRequests},
+	}
+	for i, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(tt.method, "/v1/inference", nil))
+		if w.Code != tt.want {
+			t.Errorf("request %d (%s): expected %d, got %d", i, tt.method, tt.want, w.Code)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import "context"
+
+// Tunnel outcomes reported by CONNECT handlers via SetOutcome
+const (
+	OutcomeConnected   = "connected"
+	OutcomeFailed      = "failed"
+	OutcomeBlocked     = "blocked"
+	OutcomeIntercepted = "intercepted" // decrypted by the MITM interceptor
+)
+
+type outcomeKey struct{}
+
+// withOutcome returns a context a handler can report its outcome into
+func withOutcome(ctx context.Context) (context.Context, *string) {
+	outcome := new(string)
+	return context.WithValue(ctx, outcomeKey{}, outcome), outcome
+}
+
+// SetOutcome records how a hijacked request (a CONNECT tunnel) ended, since
+// the status code alone can't tell. WithLogging adds it to the access log
+// entry and uses it as the status label of proxy_requests_total. It is a
+// no-op outside WithLogging.
+func SetOutcome(ctx context.Context, outcome string) {
+	if p, ok := ctx.Value(outcomeKey{}).(*string); ok {
+		*p = outcome
+	}
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// IsUpgrade reports whether r asks to switch protocols (e.g. a WebSocket
+// handshake). If the origin agrees, the proxy hijacks the connection, so like
+// CONNECT it is long-lived and must not be buffered or compressed.
+func IsUpgrade(r *http.Request) bool {
+	return r.Header.Get("Upgrade") != "" && httpguts.HeaderValuesContainsToken(r.Header["Connection"], "upgrade")
+}
+
+// WithHTTP1Only rejects requests that arrive over HTTP/2 or later with 505.
+// The forward proxy needs HTTP/1.1: CONNECT tunnels hijack the connection,
+// which HTTP/2 streams do not support, so with -http2 it guards the proxy
+// path while API routes still multiplex.
+func WithHTTP1Only() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ProtoMajor >= 2 {
+				if r.Method == http.MethodConnect {
+					SetOutcome(r.Context(), OutcomeFailed)
+				}
+				http.Error(w, "Forward proxy requires HTTP/1.1", http.StatusHTTPVersionNotSupported)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithHTTP1Only(t *testing.T) {
+	h := WithHTTP1Only()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		major, minor int
+		want         int
+	}{
+		{1, 0, http.StatusOK},
+		{1, 1, http.StatusOK},
+		{2, 0, http.StatusHTTPVersionNotSupported},
+		{3, 0, http.StatusHTTPVersionNotSupported},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		r.ProtoMajor, r.ProtoMinor = tt.major, tt.minor
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("HTTP/%d.%d: expected %d, got %d", tt.major, tt.minor, tt.want, w.Code)
+		}
+	}
+}
+
+func TestIsUpgrade(t *testing.T) {
+	tests := []struct {
+		connection, upgrade string
+		want                bool
+	}{
+		{"Upgrade", "websocket", true},
+		{"keep-alive, upgrade", "websocket", true},
+		{"keep-alive", "websocket", false},
+		{"Upgrade", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "http://example.com/ws", nil)
+		r.Header.Set("Connection", tt.connection)
+		r.Header.Set("Upgrade", tt.upgrade)
+		if got := IsUpgrade(r); got != tt.want {
+			t.Errorf("Connection %q, Upgrade %q: IsUpgrade = %v, want %v", tt.connection, tt.upgrade, got, tt.want)
+		}
+	}
+}
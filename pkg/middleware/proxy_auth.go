@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aluko123/go-network-proxy/pkg/auth"
+)
+
+// WithProxyAuth requires valid Basic credentials in Proxy-Authorization for
+// both forwarded requests and CONNECT tunnels, answering 407 with a
+// Proxy-Authenticate challenge otherwise. The header is removed once
+// checked, so credentials are never forwarded upstream.
+func WithProxyAuth(creds auth.Credentials, realm string) Middleware {
+	challenge := fmt.Sprintf("Basic realm=%q", realm)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, password, ok := parseProxyBasicAuth(r.Header.Get("Proxy-Authorization"))
+			if !ok || !creds.Verify(user, password) {
+				w.Header().Set("Proxy-Authenticate", challenge)
+				http.Error(w, "Proxy Authentication Required", http.StatusProxyAuthRequired)
+				return
+			}
+			r.Header.Del("Proxy-Authorization")
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// parseProxyBasicAuth decodes "Basic base64(user:password)"
+func parseProxyBasicAuth(header string) (user, password string, ok bool) {
+	scheme, encoded, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Basic") {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return "", "", false
+	}
+	return strings.Cut(string(decoded), ":")
+}
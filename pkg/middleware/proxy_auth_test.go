@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aluko123/go-network-proxy/pkg/auth"
+)
+
+func TestWithProxyAuth(t *testing.T) {
+	var forwarded http.Header
+	h := WithProxyAuth(auth.StaticCredentials{"alice": "secret"}, "proxy")(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			forwarded = r.Header.Clone()
+		}))
+
+	basic := func(userpass string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(userpass))
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		header string
+		want   int
+	}{
+		{name: "missing", method: http.MethodGet, want: http.StatusProxyAuthRequired},
+		{name: "wrong password", method: http.MethodGet, header: basic("alice:nope"), want: http.StatusProxyAuthRequired},
+		{name: "not basic", method: http.MethodGet, header: "Bearer secret", want: http.StatusProxyAuthRequired},
+		{name: "valid", method: http.MethodGet, header: basic("alice:secret"), want: http.StatusOK},
+		{name: "valid connect", method: http.MethodConnect, header: basic("alice:secret"), want: http.StatusOK},
+		{name: "connect without creds", method: http.MethodConnect, want: http.StatusProxyAuthRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forwarded = nil
+			r := httptest.NewRequest(tt.method, "http://example.com/", nil)
+			if tt.header != "" {
+				r.Header.Set("Proxy-Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, w.Code)
+			}
+			if tt.want == http.StatusProxyAuthRequired {
+				if got := w.Header().Get("Proxy-Authenticate"); got != `Basic realm="proxy"` {
+					t.Errorf("unexpected challenge %q", got)
+				}
+				return
+			}
+			if forwarded.Get("Proxy-Authorization") != "" {
+				t.Error("Proxy-Authorization must be stripped before forwarding")
+			}
+		})
+	}
+}
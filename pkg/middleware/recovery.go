@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+	"runtime/debug"
+
+	"github.com/aluko123/go-network-proxy/pkg/logger"
+)
+
+// WithRecovery returns a middleware that turns handler panics into a 500 response
+// and reports them on the application logger (not the access log)
+func WithRecovery(log *logger.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+				// Let net/http handle deliberate aborts (e.g. broken streams)
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+
+				reqID, _ := r.Context().Value(logger.RequestIDKey).(string)
+				log.Error("panic recovered",
+					"request_id", reqID,
+					"panic", rec,
+					"method", r.Method,
+					"path", r.URL.Path,
+					"stack", string(debug.Stack()),
+				)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WithTimeout bounds each request's run time at d. The request context gets a
+// deadline (cancelling upstream calls made with it), and if the handler hasn't
+// started responding by then the client gets a 504. A response that has
+// already begun streaming is left to finish, since its status is already sent.
+//
+// Requests for which exempt returns true (e.g. CONNECT tunnels or SSE
+// endpoints, which are long-lived by design) run without a deadline.
+// d <= 0 disables the middleware.
+func WithTimeout(d time.Duration, exempt func(*http.Request) bool) Middleware {
+	return func(next http.Handler) http.Handler {
+		if d <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if exempt != nil && exempt(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+
+			tw := &timeoutWriter{ResponseWriter: w, ctx: ctx, h: w.Header().Clone()}
+			done := make(chan struct{})
+			panicked := make(chan any, 1)
+			go func() {
+				defer func() {
+					if rec := recover(); rec != nil {
+						panicked <- rec
+					}
+				}()
+				next.ServeHTTP(tw, r.WithContext(ctx))
+				close(done)
+			}()
+
+			select {
+			case <-done:
+			case rec := <-panicked:
+				// Re-raise on the serving goroutine so WithRecovery sees it
+				panic(rec)
+			case <-ctx.Done():
+				if tw.timeout() {
+					return
+				}
+				// Already streaming: the cancelled context will stop it shortly
+				select {
+				case <-done:
+				case rec := <-panicked:
+					panic(rec)
+				}
+			}
+		})
+	}
+}
+
+// ExemptMethodsAndPaths returns a WithTimeout exemption matching any of the
+// given methods or exact URL paths
+func ExemptMethodsAndPaths(methods []string, paths []string) func(*http.Request) bool {
+	return func(r *http.Request) bool {
+		for _, m := range methods {
+			if r.Method == m {
+				return true
+			}
+		}
+		for _, p := range paths {
+			if r.URL.Path == p {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// ExemptPaths returns an exemption matching requests for the gateway's own
+// routes: a path ending in "/" matches that subtree (like ServeMux), any
+// other path only itself. Forward-proxy requests never match, whatever their
+// target path, so "http://example.com/metrics" is still subject to limits.
+func ExemptPaths(paths []string) func(*http.Request) bool {
+	return func(r *http.Request) bool {
+		if r.Method == http.MethodConnect || r.URL.IsAbs() {
+			return false
+		}
+		for _, p := range paths {
+			if r.URL.Path == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(r.URL.Path, p)) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// timeoutWriter passes writes through until the deadline fires before any
+// response was started; after that the handler's writes are discarded. The
+// handler, which may outlive the deadline, gets its own header map (h); it is
+// copied to the real one when the response starts, so a late handler never
+// touches the headers of the 504.
+type timeoutWriter struct {
+	http.ResponseWriter
+	ctx context.Context
+	h   http.Header
+
+	mu       sync.Mutex
+	started  bool
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.h
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.expired() {
+		return
+	}
+	tw.start()
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.expired() {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.start()
+	return tw.ResponseWriter.Write(b)
+}
+
+// Flush implements the http.Flusher interface
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.expired() {
+		return
+	}
+	// Flushing sends the headers
+	tw.start()
+	if flusher, ok := tw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// start copies the handler's headers to the real writer as the response
+// begins (mu held)
+func (tw *timeoutWriter) start() {
+	if tw.started {
+		return
+	}
+	tw.started = true
+	dst := tw.ResponseWriter.Header()
+	clear(dst)
+	for k, vv := range tw.h {
+		dst[k] = vv
+	}
+}
+
+// timeout writes the 504 if nothing was sent yet, reporting whether it did
+func (tw *timeoutWriter) timeout() bool {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return tw.expired()
+}
+
+// expired reports whether the handler's output must be dropped, sending the
+// 504 the first time a deadline passes before the response started. A handler
+// that only reacts to the deadline by writing still gets the 504 (mu held).
+func (tw *timeoutWriter) expired() bool {
+	if tw.timedOut {
+		return true
+	}
+	if tw.started || tw.ctx.Err() == nil {
+		return false
+	}
+	tw.timedOut = true
+	http.Error(tw.ResponseWriter, "Gateway Timeout", http.StatusGatewayTimeout)
+	return true
+}
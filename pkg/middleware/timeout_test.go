@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWithTimeout(t *testing.T) {
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+		w.Write([]byte("late"))
+	})
+	h := Chain(slow, WithTimeout(20*time.Millisecond,
+		ExemptMethodsAndPaths([]string{http.MethodConnect}, []string{"/v1/inference"})))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected 504, got %d", w.Code)
+	}
+
+	// Exempt requests run to completion
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/inference", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "late" {
+		t.Errorf("exempt path: expected 200 late, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+// Run with -race: the handler keeps writing headers after the 504 went out
+func TestWithTimeout_LateHeaders(t *testing.T) {
+	done := make(chan struct{})
+	late := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		w.Header().Set("X-Before", "1")
+		<-r.Context().Done()
+		time.Sleep(10 * time.Millisecond)
+		w.Header().Set("X-Late", "1")
+		http.Error(w, "upstream failed", http.StatusBadGateway)
+	})
+	h := WithTimeout(20*time.Millisecond, nil)(late)
+
+	w := httptest.NewRecorder()
+	w.Header().Set("X-Request-ID", "abc")
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	<-done
+
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected 504, got %d", w.Code)
+	}
+	if w.Header().Get("X-Before") != "" || w.Header().Get("X-Late") != "" {
+		t.Errorf("handler headers leaked into the 504: %v", w.Header())
+	}
+	if w.Header().Get("X-Request-ID") != "abc" {
+		t.Error("headers set before the handler were lost")
+	}
+
+	// In time, the handler's headers go out with its response
+	fast := WithTimeout(time.Second, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Del("X-Request-ID")
+		w.Header().Set("X-Upstream", "1")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	w = httptest.NewRecorder()
+	w.Header().Set("X-Request-ID", "abc")
+	fast.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusAccepted || w.Header().Get("X-Upstream") != "1" || w.Header().Get("X-Request-ID") != "" {
+		t.Errorf("got %d %v, want 202 with the handler's headers", w.Code, w.Header())
+	}
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/aluko123/go-network-proxy/pkg/logger"
+	"github.com/aluko123/go-network-proxy/pkg/tracing"
+)
+
+// WithTracing starts a server span per request, continuing any incoming W3C
+// traceparent. The span context rides on the request context, so forwarded
+// HTTP requests and worker gRPC calls carry it onward. With no tracer
+// configured the span is a no-op that still propagates the parent.
+func WithTracing() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+			// Proxied URLs are unbounded, so name those spans by method only
+			name := r.Method + " " + r.URL.Path
+			if r.Method == http.MethodConnect || r.URL.IsAbs() {
+				name = "proxy " + r.Method
+			}
+
+			reqID, _ := r.Context().Value(logger.RequestIDKey).(string)
+			ctx, span := tracing.Tracer().Start(ctx, name,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("request_id", reqID),
+					attribute.String("http.request.method", r.Method),
+					attribute.String("server.address", r.Host),
+					attribute.String("url.path", r.URL.Path),
+				),
+			)
+			defer span.End()
+
+			recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+			next.ServeHTTP(recorder, r.WithContext(ctx))
+
+			span.SetAttributes(attribute.Int("http.response.status_code", recorder.statusCode))
+			if recorder.statusCode >= 500 {
+				span.SetStatus(codes.Error, http.StatusText(recorder.statusCode))
+			}
+		})
+	}
+}
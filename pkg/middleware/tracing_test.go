@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/aluko123/go-network-proxy/pkg/tracing"
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// forwarded returns the traceparent a handler would send upstream
+func forwarded() string {
+	var out string
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hdr := http.Header{}
+		otel.GetTextMapPropagator().Inject(r.Context(), propagation.HeaderCarrier(hdr))
+		out = hdr.Get("traceparent")
+	})
+	r := httptest.NewRequest(http.MethodGet, "/v1/inference", nil)
+	r.Header.Set("traceparent", testTraceparent)
+	Chain(inner, WithTracing(), WithRequestID()).ServeHTTP(httptest.NewRecorder(), r)
+	return out
+}
+
+func TestWithTracing_NoTracerStillPropagates(t *testing.T) {
+	if _, err := tracing.Setup(context.Background(), tracing.Config{}); err != nil {
+		t.Fatal(err)
+	}
+	otel.SetTracerProvider(noop.NewTracerProvider()) // what an unconfigured gateway runs
+
+	if got := forwarded(); got != testTraceparent {
+		t.Errorf("expected incoming traceparent forwarded unchanged, got %q", got)
+	}
+}
+
+func TestWithTracing_RecordsSpan(t *testing.T) {
+	if _, err := tracing.Setup(context.Background(), tracing.Config{}); err != nil {
+		t.Fatal(err)
+	}
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	got := forwarded()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name != "GET /v1/inference" {
+		t.Errorf("unexpected span name %q", span.Name)
+	}
+	if span.Parent.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("span not joined to incoming trace: %v", span.Parent.TraceID())
+	}
+	var reqID string
+	for _, kv := range span.Attributes {
+		if kv.Key == "request_id" {
+			reqID = kv.Value.AsString()
+		}
+	}
+	if reqID == "" {
+		t.Error("span missing request_id attribute")
+	}
+	want := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + span.SpanContext.SpanID().String() + "-01"
+	if got != want {
+		t.Errorf("forwarded traceparent = %q, want child span %q", got, want)
+	}
+}
@@ -0,0 +1,280 @@
+// Package resolver resolves upstream hostnames for the proxy's dialers,
+// caching answers for a short TTL and refusing blocked addresses.
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/aluko123/go-network-proxy/pkg/metrics"
+)
+
+// ErrBlocked is returned (wrapped) when every address a host resolves to is
+// blocked
+var ErrBlocked = errors.New("destination address is blocked")
+
+// lookupTimeout bounds a lookup shared by several dials, which runs detached
+// from any one dial's context
+const lookupTimeout = 10 * time.Second
+
+// Config holds resolver configuration
+type Config struct {
+	TTL        time.Duration     // how long answers are reused (0 = resolve every dial)
+	MaxEntries int               // cached hosts; when full, expired then arbitrary entries go
+	Blocked    func(net.IP) bool // addresses never dialed (nil = none)
+}
+
+// DefaultConfig returns the default resolver configuration
+func DefaultConfig() Config {
+	return Config{
+		TTL:        30 * time.Second,
+		MaxEntries: 10000,
+	}
+}
+
+// Resolver is a caching DNS resolver. It is safe for concurrent use, and
+// concurrent misses for one host share a single lookup.
+type Resolver struct {
+	cfg      Config
+	mu       sync.Mutex
+	entries  map[string]entry
+	inflight map[string]*call
+
+	lookupIP func(ctx context.Context, host string) ([]net.IP, error)
+	now      func() time.Time
+}
+
+type entry struct {
+	ips     []net.IP
+	expires time.Time
+}
+
+// call is a lookup in progress; ips and err are set before done is closed
+type call struct {
+	done chan struct{}
+	ips  []net.IP
+	err  error
+}
+
+// New returns a Resolver using the system resolver for lookups
+func New(cfg Config) *Resolver {
+	return &Resolver{
+		cfg:      cfg,
+		entries:  make(map[string]entry),
+		inflight: make(map[string]*call),
+		lookupIP: func(ctx context.Context, host string) ([]net.IP, error) {
+			return net.DefaultResolver.LookupIP(ctx, "ip", host)
+		},
+		now: time.Now,
+	}
+}
+
+// LookupIP returns host's addresses, from the cache while they are fresh
+func (r *Resolver) LookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	if r.cfg.TTL <= 0 {
+		metrics.DNSCacheLookups.WithLabelValues("miss").Inc()
+		return r.lookupIP(ctx, host)
+	}
+
+	r.mu.Lock()
+	if e, ok := r.entries[host]; ok && r.now().Before(e.expires) {
+		r.mu.Unlock()
+		metrics.DNSCacheLookups.WithLabelValues("hit").Inc()
+		return e.ips, nil
+	}
+	c, shared := r.inflight[host]
+	if !shared {
+		c = &call{done: make(chan struct{})}
+		r.inflight[host] = c
+		go r.resolve(host, c)
+	}
+	r.mu.Unlock()
+
+	if shared {
+		metrics.DNSCacheLookups.WithLabelValues("hit").Inc()
+	} else {
+		metrics.DNSCacheLookups.WithLabelValues("miss").Inc()
+	}
+	select {
+	case <-c.done:
+		return c.ips, c.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// resolve performs c's lookup and caches a successful answer
+func (r *Resolver) resolve(host string, c *call) {
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+	c.ips, c.err = r.lookupIP(ctx, host)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.inflight, host)
+	close(c.done)
+	if c.err != nil {
+		return
+	}
+	if len(r.entries) >= r.cfg.MaxEntries {
+		r.evict()
+	}
+	if r.cfg.MaxEntries > 0 {
+		r.entries[host] = entry{ips: c.ips, expires: r.now().Add(r.cfg.TTL)}
+	}
+}
+
+// evict makes room for one entry: expired entries go first, and if none have
+// expired an arbitrary one does. Callers hold mu.
+func (r *Resolver) evict() {
+	now := r.now()
+	for host, e := range r.entries {
+		if !now.Before(e.expires) {
+			delete(r.entries, host)
+		}
+	}
+	for host := range r.entries {
+		if len(r.entries) < r.cfg.MaxEntries {
+			break
+		}
+		delete(r.entries, host)
+	}
+}
+
+// Dialer returns a DialContext function for http.Transport and the tunnel
+// that resolves through r and skips blocked addresses. Addresses are tried in
+// order, racing the other family after d.FallbackDelay (Happy Eyeballs) as
+// net.Dialer does for hostnames.
+func (r *Resolver) Dialer(d *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		ips := []net.IP{net.ParseIP(host)}
+		if ips[0] == nil {
+			if ips, err = r.LookupIP(ctx, host); err != nil {
+				return nil, err
+			}
+		}
+		ips = r.usable(ips, network, d.LocalAddr)
+		if len(ips) == 0 {
+			return nil, fmt.Errorf("dial %s: %w", host, ErrBlocked)
+		}
+		return dialParallel(ctx, d, network, port, ips)
+	}
+}
+
+// usable drops blocked addresses and those the network or source address
+// can't reach
+func (r *Resolver) usable(ips []net.IP, network string, local net.Addr) []net.IP {
+	wantV4 := network == "tcp4"
+	wantV6 := network == "tcp6"
+	if tcp, ok := local.(*net.TCPAddr); ok && tcp.IP != nil {
+		wantV4 = tcp.IP.To4() != nil
+		wantV6 = !wantV4
+	}
+	var out []net.IP
+	for _, ip := range ips {
+		isV4 := ip.To4() != nil
+		if wantV4 && !isV4 || wantV6 && isV4 {
+			continue
+		}
+		if r.cfg.Blocked != nil && r.cfg.Blocked(ip) {
+			continue
+		}
+		out = append(out, ip)
+	}
+	return out
+}
+
+// dialParallel dials ips, which share port: those of the first address's
+// family in order, and the rest, in order, once that has taken
+// d.FallbackDelay (0 = 300ms, negative = never in parallel) or failed
+func dialParallel(ctx context.Context, d *net.Dialer, network, port string, ips []net.IP) (net.Conn, error) {
+	var primaries, fallbacks []net.IP
+	for _, ip := range ips {
+		if (ip.To4() != nil) == (ips[0].To4() != nil) {
+			primaries = append(primaries, ip)
+		} else {
+			fallbacks = append(fallbacks, ip)
+		}
+	}
+	if len(fallbacks) == 0 || d.FallbackDelay < 0 {
+		return dialSerial(ctx, d, network, port, ips)
+	}
+	delay := d.FallbackDelay
+	if delay == 0 {
+		delay = 300 * time.Millisecond
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan result, 2)
+	race := func(ips []net.IP) {
+		conn, err := dialSerial(ctx, d, network, port, ips)
+		results <- result{conn, err}
+	}
+
+	go race(primaries)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	pending, fallbackStarted := 1, false
+	var firstErr error
+	for {
+		select {
+		case <-timer.C:
+			go race(fallbacks)
+			pending, fallbackStarted = pending+1, true
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				if pending > 0 {
+					// The other attempt is cancelled; close it should it win anyway
+					go func() {
+						if res := <-results; res.conn != nil {
+							res.conn.Close()
+						}
+					}()
+				}
+				return res.conn, nil
+			}
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			if !fallbackStarted && timer.Stop() {
+				go race(fallbacks)
+				pending, fallbackStarted = pending+1, true
+			}
+			if pending == 0 {
+				return nil, firstErr
+			}
+		}
+	}
+}
+
+// dialSerial tries ips in order, returning the first connection made
+func dialSerial(ctx context.Context, d *net.Dialer, network, port string, ips []net.IP) (net.Conn, error) {
+	var firstErr error
+	for _, ip := range ips {
+		conn, err := d.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, firstErr
+}
@@ -0,0 +1,174 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aluko123/go-network-proxy/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// fakeResolver answers every host with ips and counts the lookups
+func fakeResolver(cfg Config, ips ...string) (*Resolver, *atomic.Int32) {
+	var lookups atomic.Int32
+	r := New(cfg)
+	r.lookupIP = func(context.Context, string) ([]net.IP, error) {
+		lookups.Add(1)
+		var out []net.IP
+		for _, ip := range ips {
+			out = append(out, net.ParseIP(ip))
+		}
+		return out, nil
+	}
+	return r, &lookups
+}
+
+func TestResolver_CachesUntilTTL(t *testing.T) {
+	r, lookups := fakeResolver(Config{TTL: time.Minute, MaxEntries: 10}, "192.0.2.1")
+	now := time.Unix(1000, 0)
+	r.now = func() time.Time { return now }
+	hits := testutil.ToFloat64(metrics.DNSCacheLookups.WithLabelValues("hit"))
+
+	for range 3 {
+		ips, err := r.LookupIP(context.Background(), "example.com")
+		if err != nil || len(ips) != 1 || !ips[0].Equal(net.ParseIP("192.0.2.1")) {
+			t.Fatalf("LookupIP = %v, %v", ips, err)
+		}
+	}
+	if got := lookups.Load(); got != 1 {
+		t.Errorf("expected 1 lookup within the TTL, got %d", got)
+	}
+	if got := testutil.ToFloat64(metrics.DNSCacheLookups.WithLabelValues("hit")) - hits; got != 2 {
+		t.Errorf("expected 2 cache hits, got %v", got)
+	}
+
+	now = now.Add(time.Minute)
+	r.LookupIP(context.Background(), "example.com")
+	if got := lookups.Load(); got != 2 {
+		t.Errorf("expected a new lookup once the TTL passed, got %d lookups", got)
+	}
+}
+
+func TestResolver_ZeroTTLDoesNotCache(t *testing.T) {
+	r, lookups := fakeResolver(Config{MaxEntries: 10}, "192.0.2.1")
+	r.LookupIP(context.Background(), "example.com")
+	r.LookupIP(context.Background(), "example.com")
+	if got := lookups.Load(); got != 2 {
+		t.Errorf("expected 2 lookups, got %d", got)
+	}
+}
+
+func TestResolver_ConcurrentMissesShareLookup(t *testing.T) {
+	r := New(Config{TTL: time.Minute, MaxEntries: 10})
+	var lookups atomic.Int32
+	release := make(chan struct{})
+	r.lookupIP = func(context.Context, string) ([]net.IP, error) {
+		lookups.Add(1)
+		<-release
+		return []net.IP{net.ParseIP("192.0.2.1")}, nil
+	}
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := r.LookupIP(context.Background(), "example.com"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if got := lookups.Load(); got != 1 {
+		t.Errorf("expected 1 shared lookup, got %d", got)
+	}
+}
+
+func TestResolver_EvictsAtMaxEntries(t *testing.T) {
+	r, _ := fakeResolver(Config{TTL: time.Minute, MaxEntries: 2}, "192.0.2.1")
+	for _, host := range []string{"a.example", "b.example", "c.example"} {
+		r.LookupIP(context.Background(), host)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.entries) != 2 {
+		t.Errorf("expected 2 cached hosts, got %d", len(r.entries))
+	}
+	if _, ok := r.entries["c.example"]; !ok {
+		t.Error("newest host was not cached")
+	}
+}
+
+func TestDialer_SkipsBlockedAddresses(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	blocked := func(ip net.IP) bool { return ip.Equal(net.ParseIP("192.0.2.1")) }
+	d := &net.Dialer{Timeout: time.Second}
+
+	// The blocked address comes first; only the allowed one is dialed
+	r, _ := fakeResolver(Config{TTL: time.Minute, MaxEntries: 10, Blocked: blocked}, "192.0.2.1", "127.0.0.1")
+	conn, err := r.Dialer(d)(context.Background(), "tcp", net.JoinHostPort("example.com", port))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	if got := conn.RemoteAddr().(*net.TCPAddr).IP; !got.Equal(net.ParseIP("127.0.0.1")) {
+		t.Errorf("dialed %s", got)
+	}
+	conn.Close()
+
+	r, _ = fakeResolver(Config{TTL: time.Minute, MaxEntries: 10, Blocked: blocked}, "192.0.2.1")
+	if _, err := r.Dialer(d)(context.Background(), "tcp", "example.com:443"); !errors.Is(err, ErrBlocked) {
+		t.Errorf("expected ErrBlocked for a host with only blocked addresses, got %v", err)
+	}
+	if _, err := r.Dialer(d)(context.Background(), "tcp", "192.0.2.1:443"); !errors.Is(err, ErrBlocked) {
+		t.Errorf("expected ErrBlocked for a blocked IP literal, got %v", err)
+	}
+}
+
+func TestDialer_FallsBackToOtherFamily(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	// Nothing listens on the IPv6 loopback port, so the IPv4 race wins
+	r, _ := fakeResolver(Config{TTL: time.Minute, MaxEntries: 10}, "::1", "127.0.0.1")
+	d := &net.Dialer{Timeout: time.Second, FallbackDelay: 10 * time.Millisecond}
+	conn, err := r.Dialer(d)(context.Background(), "tcp", net.JoinHostPort("example.com", port))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	conn.Close()
+}
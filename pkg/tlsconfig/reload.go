@@ -0,0 +1,65 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/aluko123/go-network-proxy/pkg/metrics"
+)
+
+// CertReloader serves a certificate pair from disk that can be reloaded while
+// the server runs. Handshakes after a Reload get the new certificate;
+// established connections keep the one they negotiated.
+type CertReloader struct {
+	certFile, keyFile string
+	cert              atomic.Pointer[tls.Certificate]
+}
+
+// NewCertReloader loads certFile and keyFile, failing if they don't form a
+// valid pair
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload re-reads the certificate pair. On error the current certificate
+// stays in use.
+func (r *CertReloader) Reload() error {
+	err := r.load()
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	metrics.TLSCertReloads.WithLabelValues(result).Inc()
+	return err
+}
+
+func (r *CertReloader) load() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load certificate: %w", err)
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return fmt.Errorf("parse certificate: %w", err)
+		}
+	}
+	r.cert.Store(&cert)
+	metrics.TLSCertExpiry.Set(float64(cert.Leaf.NotAfter.Unix()))
+	return nil
+}
+
+// Certificate returns the certificate currently served
+func (r *CertReloader) Certificate() *tls.Certificate {
+	return r.cert.Load()
+}
+
+// GetCertificate is a tls.Config.GetCertificate returning the current certificate
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
@@ -0,0 +1,77 @@
+// Package tlsconfig builds the server-side TLS settings for the gateway's
+// HTTPS listener from flag values.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// versions maps the accepted -tls-min-version values to crypto/tls constants
+var versions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Config holds the listener's TLS options
+type Config struct {
+	MinVersion   string   // "1.0" to "1.3"
+	CipherSuites []string // IANA names, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256; empty uses Go's defaults
+	// PreferServerCipherSuites is passed through to crypto/tls, which has
+	// ignored it since Go 1.18 and orders suites itself
+	PreferServerCipherSuites bool
+}
+
+// DefaultConfig returns TLS 1.2+ with Go's default cipher suites
+func DefaultConfig() Config {
+	return Config{MinVersion: "1.2"}
+}
+
+// New builds a tls.Config from cfg. Unknown or insecure suite names are an
+// error, as are TLS 1.3 suites, which crypto/tls does not let us choose.
+func New(cfg Config) (*tls.Config, error) {
+	version, ok := versions[cfg.MinVersion]
+	if !ok {
+		return nil, fmt.Errorf("unsupported TLS version %q (want 1.0, 1.1, 1.2 or 1.3)", cfg.MinVersion)
+	}
+	tlsCfg := &tls.Config{
+		MinVersion:               version,
+		PreferServerCipherSuites: cfg.PreferServerCipherSuites,
+	}
+
+	for _, name := range cfg.CipherSuites {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		id, err := cipherSuite(name)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.CipherSuites = append(tlsCfg.CipherSuites, id)
+	}
+	return tlsCfg, nil
+}
+
+// cipherSuite looks up a secure, configurable suite by name
+func cipherSuite(name string) (uint16, error) {
+	for _, s := range tls.InsecureCipherSuites() {
+		if s.Name == name {
+			return 0, fmt.Errorf("cipher suite %s is insecure", name)
+		}
+	}
+	for _, s := range tls.CipherSuites() {
+		if s.Name != name {
+			continue
+		}
+		if !slices.ContainsFunc(s.SupportedVersions, func(v uint16) bool { return v < tls.VersionTLS13 }) {
+			return 0, fmt.Errorf("cipher suite %s is TLS 1.3 only and not configurable", name)
+		}
+		return s.ID, nil
+	}
+	return 0, fmt.Errorf("unknown cipher suite %q", name)
+}
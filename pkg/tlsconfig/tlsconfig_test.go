@@ -0,0 +1,56 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"slices"
+	"testing"
+)
+
+func TestNew_Defaults(t *testing.T) {
+	cfg, err := New(DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MinVersion != tls.VersionTLS12 {
+		t.Errorf("MinVersion = %x, want TLS 1.2", cfg.MinVersion)
+	}
+	if cfg.CipherSuites != nil {
+		t.Errorf("CipherSuites = %v, want Go defaults", cfg.CipherSuites)
+	}
+}
+
+func TestNew_CipherSuites(t *testing.T) {
+	cfg, err := New(Config{
+		MinVersion:   "1.3",
+		CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", " TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256", ""},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MinVersion != tls.VersionTLS13 {
+		t.Errorf("MinVersion = %x, want TLS 1.3", cfg.MinVersion)
+	}
+	want := []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256}
+	if !slices.Equal(cfg.CipherSuites, want) {
+		t.Errorf("CipherSuites = %v, want %v", cfg.CipherSuites, want)
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"version", Config{MinVersion: "1.4"}},
+		{"unknown suite", Config{MinVersion: "1.2", CipherSuites: []string{"TLS_FAKE"}}},
+		{"insecure suite", Config{MinVersion: "1.2", CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}}},
+		{"tls 1.3 suite", Config{MinVersion: "1.2", CipherSuites: []string{"TLS_AES_128_GCM_SHA256"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.cfg); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Config holds OpenTelemetry tracing configuration
+type Config struct {
+	Endpoint    string  // OTLP gRPC collector address; empty disables export
+	Insecure    bool    // plaintext connection to the collector
+	ServiceName string  // service.name resource attribute
+	SampleRatio float64 // fraction of new traces sampled (parent decision wins)
+}
+
+// DefaultConfig returns the default tracing configuration
+func DefaultConfig() Config {
+	return Config{
+		Insecure:    true,
+		ServiceName: "go-network-proxy",
+		SampleRatio: 1,
+	}
+}
+
+const tracerName = "github.com/aluko123/go-network-proxy"
+
+// Setup installs the W3C trace context propagator and, when an endpoint is
+// configured, a global tracer provider exporting over OTLP. Without an
+// endpoint the default no-op tracer stays in place, so incoming traceparent
+// headers are still forwarded but no spans are recorded. The returned
+// function flushes and stops the exporter.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+	if cfg.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.Endpoint)}
+	if cfg.Insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(cfg.ServiceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// Tracer returns the gateway's tracer from the global provider
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
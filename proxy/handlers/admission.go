@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aluko123/go-network-proxy/inference/queue"
+	"github.com/aluko123/go-network-proxy/pkg/metrics"
+)
+
+// requestTimeoutHeader lets a client declare how long it is willing to wait,
+// as a Go duration ("30s") or whole seconds ("30")
+const requestTimeoutHeader = "X-Request-Timeout"
+
+// WaitEstimator predicts how long a new request on a queue would wait before
+// a worker starts it. ok is false when there is no basis for an estimate yet,
+// in which case the request is admitted.
+type WaitEstimator interface {
+	EstimateWait(pq *queue.PriorityQueue) (wait time.Duration, ok bool)
+}
+
+// SetAdmission turns away requests that would wait longer than maxWait, or
+// than the client's X-Request-Timeout if that is shorter, with 503 and a
+// Retry-After. A maxWait of 0 only enforces client timeouts. Passing a nil
+// estimator disables admission control.
+func (h *InferenceHandler) SetAdmission(est WaitEstimator, maxWait time.Duration) {
+	h.estimator = est
+	h.maxWait = maxWait
+}
+
+// requestTimeout parses the client's declared timeout; 0 means none
+func requestTimeout(r *http.Request) (time.Duration, error) {
+	v := r.Header.Get(requestTimeoutHeader)
+	if v == "" {
+		return 0, nil
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second, nil
+	}
+	if d, err := time.ParseDuration(v); err == nil && d > 0 {
+		return d, nil
+	}
+	return 0, fmt.Errorf("invalid %s %q", requestTimeoutHeader, v)
+}
+
+// admit reports whether pq's estimated wait fits within the limit for this
+// request, writing the 503 if not
+func (h *InferenceHandler) admit(w http.ResponseWriter, pq *queue.PriorityQueue, timeout time.Duration) bool {
+	limit := h.maxWait
+	if timeout > 0 && (limit == 0 || timeout < limit) {
+		limit = timeout
+	}
+	if h.estimator == nil || limit == 0 {
+		return true
+	}
+	wait, ok := h.estimator.EstimateWait(pq)
+	if !ok || wait <= limit {
+		return true
+	}
+
+	metrics.InferenceQueueRejectedTotal.WithLabelValues(pq.Name(), "admission").Inc()
+	// By then the backlog should have shrunk enough to fit the limit
+	retry := max(int(math.Ceil((wait - limit).Seconds())), 1)
+	w.Header().Set("Retry-After", strconv.Itoa(retry))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error":             fmt.Sprintf("estimated queue wait %s exceeds %s", wait.Round(time.Millisecond), limit),
+		"estimated_wait_ms": wait.Milliseconds(),
+	})
+	return false
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aluko123/go-network-proxy/inference/queue"
+)
+
+// fixedEstimate is a WaitEstimator that always predicts the same wait
+type fixedEstimate struct {
+	wait time.Duration
+	ok   bool
+}
+
+func (f fixedEstimate) EstimateWait(*queue.PriorityQueue) (time.Duration, bool) {
+	return f.wait, f.ok
+}
+
+func TestInferenceHandler_Admission(t *testing.T) {
+	pq := queue.NewPriorityQueue(0)
+	defer pq.Close()
+
+	var calls int32
+	startFakeWorker(pq, &calls)
+	h := NewInferenceHandler(pq)
+
+	withTimeout := func(timeout string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/v1/inference", strings.NewReader(`{"prompt":"hi"}`))
+		if timeout != "" {
+			r.Header.Set("X-Request-Timeout", timeout)
+		}
+		return r
+	}
+
+	tests := []struct {
+		name    string
+		est     fixedEstimate
+		maxWait time.Duration
+		timeout string
+		code    int
+		retry   string
+	}{
+		{"under the limit", fixedEstimate{2 * time.Second, true}, 5 * time.Second, "", http.StatusOK, ""},
+		{"over the limit", fixedEstimate{7500 * time.Millisecond, true}, 5 * time.Second, "", http.StatusServiceUnavailable, "3"},
+		{"client timeout is tighter", fixedEstimate{2 * time.Second, true}, 5 * time.Second, "1", http.StatusServiceUnavailable, "1"},
+		{"client timeout alone", fixedEstimate{2 * time.Second, true}, 0, "1500ms", http.StatusServiceUnavailable, "1"},
+		{"no limit at all", fixedEstimate{time.Hour, true}, 0, "", http.StatusOK, ""},
+		{"no estimate yet", fixedEstimate{}, time.Second, "", http.StatusOK, ""},
+		{"bad timeout", fixedEstimate{}, 0, "soon", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h.SetAdmission(tt.est, tt.maxWait)
+			before := atomic.LoadInt32(&calls)
+			w := serveInference(t, h, withTimeout(tt.timeout))
+			if w.Code != tt.code {
+				t.Fatalf("expected %d, got %d %q", tt.code, w.Code, w.Body.String())
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.retry {
+				t.Errorf("expected Retry-After %q, got %q", tt.retry, got)
+			}
+			if tt.code == http.StatusServiceUnavailable {
+				if !strings.Contains(w.Body.String(), "estimated_wait_ms") {
+					t.Errorf("expected estimated_wait_ms in %q", w.Body.String())
+				}
+				if atomic.LoadInt32(&calls) != before || pq.Len() != 0 {
+					t.Error("rejected request reached the queue")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/aluko123/go-network-proxy/inference/queue"
+	"github.com/aluko123/go-network-proxy/inference/router"
+)
+
+// EstimateHandler serves GET /v1/inference/estimate?model=<name>: the
+// model's queue depth, healthy workers, rolling average processing time and
+// the resulting estimated wait (see router.Estimate). Without a model it
+// reports on defaultModel, as the inference handler would route the request.
+func EstimateHandler(qs *queue.ModelQueues, rt *router.Router, defaultModel string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		model := r.URL.Query().Get("model")
+		if model == "" {
+			model = defaultModel
+		}
+		pq := qs.For(model)
+		if pq == nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("model %q is not served", model))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(struct {
+			Model string `json:"model"`
+			router.Estimate
+		}{model, rt.Estimate(pq)})
+	})
+}
@@ -1,16 +1,43 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"strings"
 	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/aluko123/go-network-proxy/pkg/bufpool"
+	"github.com/aluko123/go-network-proxy/pkg/logger"
+	"github.com/aluko123/go-network-proxy/pkg/metrics"
+	"github.com/aluko123/go-network-proxy/pkg/resolver"
 )
 
 // Config holds HTTP handler configuration
 type Config struct {
 	DialTimeout     time.Duration
 	IdleConnTimeout time.Duration
+	CopyBufferSize  int // bytes per response copy buffer (pooled)
+
+	// Transparent accepts origin-form requests ("GET /path") from clients
+	// that don't know they're being proxied, sending them to their Host
+	Transparent bool
+
+	// RemoveHeaders are dropped from forwarded requests (e.g. tracking
+	// headers), then SetHeaders are set on them, replacing the client's
+	// values (e.g. a generic User-Agent). Hop-by-hop headers are handled
+	// apart from these.
+	RemoveHeaders []string
+	SetHeaders    map[string]string
+
+	// Resolver resolves origins and refuses blocked addresses (nil = system
+	// resolver, nothing refused)
+	Resolver *resolver.Resolver
 }
 
 // DefaultConfig returns the default handler configuration
@@ -18,10 +45,17 @@ func DefaultConfig() Config {
 	return Config{
 		DialTimeout:     10 * time.Second,
 		IdleConnTimeout: 90 * time.Second,
+		CopyBufferSize:  bufpool.DefaultSize,
 	}
 }
 
-var transport *http.Transport
+var (
+	transport   *http.Transport
+	buffers     *bufpool.Pool
+	transparent bool
+	dropHeaders []string          // canonical names
+	setHeaders  map[string]string // canonical names
+)
 
 func init() {
 	SetConfig(DefaultConfig())
@@ -29,28 +63,181 @@ func init() {
 
 // SetConfig updates the handler configuration
 func SetConfig(c Config) {
+	d := &net.Dialer{
+		Timeout: c.DialTimeout,
+	}
+	dial := d.DialContext
+	if c.Resolver != nil {
+		dial = c.Resolver.Dialer(d)
+	}
 	transport = &http.Transport{
-		DialContext: (&net.Dialer{
-			Timeout: c.DialTimeout,
-		}).DialContext,
+		DialContext:         dial,
 		MaxIdleConns:        500,
 		MaxIdleConnsPerHost: 200,
 		IdleConnTimeout:     c.IdleConnTimeout,
 	}
+	buffers = bufpool.New(c.CopyBufferSize)
+	transparent = c.Transparent
+	dropHeaders = nil
+	for _, name := range c.RemoveHeaders {
+		dropHeaders = append(dropHeaders, http.CanonicalHeaderKey(strings.TrimSpace(name)))
+	}
+	setHeaders = make(map[string]string, len(c.SetHeaders))
+	for name, value := range c.SetHeaders {
+		setHeaders[http.CanonicalHeaderKey(name)] = value
+	}
 }
 
 // HandleHTTP handles regular HTTP requests (non-CONNECT)
 func HandleHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Host == "" && transparent {
+		if status, msg := resolveTarget(req); status != 0 {
+			http.Error(w, msg, status)
+			return
+		}
+	}
+
+	// Continue the caller's trace at the origin
+	otel.GetTextMapPropagator().Inject(req.Context(), propagation.HeaderCarrier(req.Header))
+	req = rewriteHeaders(req)
+
+	metrics.CountHost(req.URL.Host)
+
+	start := time.Now()
 	resp, err := transport.RoundTrip(req)
+	upstream := time.Since(start)
+	metrics.UpstreamDuration.WithLabelValues(req.Method).Observe(upstream.Seconds())
+	metrics.ObserveHostLatency(req.URL.Host, upstream)
+	logger.AddFields(req.Context(), "upstream_ms", upstream.Milliseconds())
 	if err != nil {
+		// The upload tripped the gateway's body size limit
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if errors.Is(err, resolver.ErrBlocked) {
+			metrics.BlockedRequests.Inc()
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusServiceUnavailable)
 		return
 	}
 
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		switchProtocols(w, req, resp)
+		return
+	}
 	CopyHeader(w.Header(), resp.Header)
 	w.WriteHeader(resp.StatusCode)
-	io.CopyBuffer(w, resp.Body, make([]byte, 32*1024))
+	buffers.Copy(w, resp.Body)
+}
+
+// rewriteHeaders applies the configured header removals and overrides to
+// the request about to be forwarded. The client's request keeps its headers.
+func rewriteHeaders(req *http.Request) *http.Request {
+	if len(dropHeaders) == 0 && len(setHeaders) == 0 {
+		return req
+	}
+	out := new(http.Request)
+	*out = *req
+	out.Header = req.Header.Clone()
+	for _, name := range dropHeaders {
+		out.Header.Del(name)
+	}
+	for name, value := range setHeaders {
+		out.Header.Set(name, value)
+	}
+	return out
+}
+
+// resolveTarget fills in the absolute URL an intercepted origin-form request
+// omits: the host comes from the Host header and the scheme from the listener
+// the request arrived on. A non-zero status rejects the request.
+func resolveTarget(req *http.Request) (int, string) {
+	if req.Host == "" {
+		return http.StatusBadRequest, "Missing Host header"
+	}
+	if isLocal(req) {
+		return http.StatusLoopDetected, "Request is addressed to the proxy itself"
+	}
+	req.URL.Scheme = "http"
+	if req.TLS != nil {
+		req.URL.Scheme = "https"
+	}
+	req.URL.Host = req.Host
+	return 0, ""
+}
+
+// isLocal reports whether req's Host names the address it was received on,
+// which would have the proxy send the request back to itself
+func isLocal(req *http.Request) bool {
+	local, ok := req.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok {
+		return false
+	}
+	localHost, localPort, err := net.SplitHostPort(local.String())
+	if err != nil {
+		return false
+	}
+	host, port, err := net.SplitHostPort(req.Host)
+	if err != nil {
+		host, port = req.Host, "80"
+		if req.TLS != nil {
+			port = "443"
+		}
+	}
+	if port != localPort {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return host == "localhost" || ip != nil && (ip.IsLoopback() || ip.Equal(net.ParseIP(localHost)))
+}
+
+// switchProtocols completes an Upgrade (e.g. WebSocket) the origin accepted:
+// it hands the client the 101, Upgrade and Connection headers included, then
+// copies bytes both ways until either side closes, like a CONNECT tunnel
+func switchProtocols(w http.ResponseWriter, req *http.Request, resp *http.Response) {
+	upstream, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		http.Error(w, "Upstream connection cannot be upgraded", http.StatusBadGateway)
+		return
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Hijacking not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	logger.AddFields(req.Context(), "upgrade", resp.Header.Get("Upgrade"))
+
+	// Upgrade and Connection are hop-by-hop, but this hop is what they negotiate
+	header := make(http.Header)
+	CopyHeader(header, resp.Header)
+	header["Connection"] = resp.Header["Connection"]
+	header["Upgrade"] = resp.Header["Upgrade"]
+	fmt.Fprintf(brw, "HTTP/1.1 %s\r\n", resp.Status)
+	header.Write(brw)
+	brw.WriteString("\r\n")
+	if err := brw.Flush(); err != nil {
+		return
+	}
+
+	// brw.Reader holds anything the client sent after its handshake
+	done := make(chan struct{}, 2)
+	go func() { buffers.Copy(upstream, brw.Reader); done <- struct{}{} }()
+	go func() { buffers.Copy(conn, upstream); done <- struct{}{} }()
+	<-done
+	// One side is gone: close both to end the other copy
+	conn.Close()
+	upstream.Close()
+	<-done
 }
 
 // CopyHeader copies HTTP headers from source to destination
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// echoUpgrade accepts any Upgrade and echoes the raw bytes back
+func echoUpgrade(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Upgrade") != "websocket" {
+		http.Error(w, "expected an upgrade", http.StatusBadRequest)
+		return
+	}
+	conn, brw, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-Websocket-Accept: abc\r\n\r\n")
+	brw.Flush()
+	io.Copy(conn, brw)
+}
+
+func TestHandleHTTP_Upgrade(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(echoUpgrade))
+	defer origin.Close()
+	proxy := httptest.NewServer(http.HandlerFunc(HandleHTTP))
+	defer proxy.Close()
+
+	conn, err := net.Dial("tcp", proxy.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// The first frame rides along with the handshake
+	io.WriteString(conn, "GET "+origin.URL+"/ws HTTP/1.1\r\nHost: "+origin.Listener.Addr().String()+
+		"\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\nhello")
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expected 101, got %d", resp.StatusCode)
+	}
+	for name, want := range map[string]string{"Upgrade": "websocket", "Connection": "Upgrade", "Sec-Websocket-Accept": "abc"} {
+		if got := resp.Header.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(br, buf); err != nil || string(buf) != "hello" {
+		t.Fatalf("echo of early data = %q, %v", buf, err)
+	}
+	io.WriteString(conn, "world")
+	if _, err := io.ReadFull(br, buf); err != nil || string(buf) != "world" {
+		t.Fatalf("echo = %q, %v", buf, err)
+	}
+}
+
+// echoTarget reports which host and path the origin saw
+func echoTarget(w http.ResponseWriter, r *http.Request) {
+	io.WriteString(w, r.Host+r.URL.Path)
+}
+
+func TestHandleHTTP_AbsoluteForm(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(echoTarget))
+	defer origin.Close()
+	proxy := httptest.NewServer(http.HandlerFunc(HandleHTTP))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	for _, mode := range []bool{false, true} {
+		c := DefaultConfig()
+		c.Transparent = mode
+		SetConfig(c)
+
+		resp, err := client.Get(origin.URL + "/page")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if want := origin.Listener.Addr().String() + "/page"; string(body) != want {
+			t.Errorf("transparent=%v: origin saw %q, want %q", mode, body, want)
+		}
+	}
+	SetConfig(DefaultConfig())
+}
+
+func TestHandleHTTP_OriginForm(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(echoTarget))
+	defer origin.Close()
+	proxy := httptest.NewServer(http.HandlerFunc(HandleHTTP))
+	defer proxy.Close()
+
+	// Like an intercepted client: the request goes to the proxy's address,
+	// but names the origin only in Host
+	get := func(host string) (int, string) {
+		req, _ := http.NewRequest(http.MethodGet, proxy.URL+"/page", nil)
+		req.Host = host
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	// Off by default: there is no target to send the request to
+	if status, _ := get(origin.Listener.Addr().String()); status == http.StatusOK {
+		t.Fatal("origin-form request proxied without -transparent")
+	}
+
+	c := DefaultConfig()
+	c.Transparent = true
+	SetConfig(c)
+	defer SetConfig(DefaultConfig())
+
+	status, body := get(origin.Listener.Addr().String())
+	if want := origin.Listener.Addr().String() + "/page"; status != http.StatusOK || body != want {
+		t.Errorf("got %d %q, want 200 %q", status, body, want)
+	}
+	if status, _ := get(proxy.Listener.Addr().String()); status != http.StatusLoopDetected {
+		t.Errorf("request to the proxy itself: got %d, want 508", status)
+	}
+	_, port, _ := net.SplitHostPort(proxy.Listener.Addr().String())
+	if status, _ := get("localhost:" + port); status != http.StatusLoopDetected {
+		t.Errorf("request to localhost: got %d, want 508", status)
+	}
+}
+
+func TestHandleHTTP_RewritesRequestHeaders(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Client-Data", "from-origin")
+		io.WriteString(w, r.Header.Get("User-Agent")+"|"+r.Header.Get("X-Client-Data")+"|"+r.Header.Get("Accept"))
+	}))
+	defer origin.Close()
+
+	c := DefaultConfig()
+	c.RemoveHeaders = []string{"x-client-data"}
+	c.SetHeaders = map[string]string{"user-agent": "proxy/1.0"}
+	SetConfig(c)
+	defer SetConfig(DefaultConfig())
+
+	req := httptest.NewRequest(http.MethodGet, origin.URL+"/", nil)
+	req.Header.Set("User-Agent", "browser")
+	req.Header.Set("X-Client-Data", "tracking")
+	req.Header.Set("Accept", "text/plain")
+	w := httptest.NewRecorder()
+	HandleHTTP(w, req)
+
+	if got, want := w.Body.String(), "proxy/1.0||text/plain"; got != want {
+		t.Errorf("origin saw %q, want %q", got, want)
+	}
+	// Only the forwarded request is rewritten
+	if got := req.Header.Get("User-Agent"); got != "browser" {
+		t.Errorf("client request's User-Agent changed to %q", got)
+	}
+	if got := w.Header().Get("X-Client-Data"); got != "from-origin" {
+		t.Errorf("response header X-Client-Data = %q, want the origin's", got)
+	}
+}
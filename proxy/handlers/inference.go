@@ -1,102 +1,356 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/aluko123/go-network-proxy/inference/cache"
 	pb "github.com/aluko123/go-network-proxy/inference/pb"
 	"github.com/aluko123/go-network-proxy/inference/queue"
+	"github.com/aluko123/go-network-proxy/inference/quota"
+	"github.com/aluko123/go-network-proxy/inference/worker"
 	"github.com/aluko123/go-network-proxy/pkg/logger"
 	"github.com/aluko123/go-network-proxy/pkg/metrics"
 )
 
+// InferenceConfig holds inference request defaults and limits. Zero disables
+// a limit.
+type InferenceConfig struct {
+	// Defaults for fields a request leaves out
+	DefaultModel       string
+	DefaultMaxTokens   int
+	DefaultTemperature float32
+	DefaultPriority    int
+
+	MaxPromptBytes int // longer prompts are rejected with 413
+	MaxTokens      int // max_tokens above this is clamped down to it
+
+	// Priorities outside [MinPriority, MaxPriority] are clamped into it, or
+	// rejected with 400 when StrictPriority is set and the client sent them
+	MinPriority    int
+	MaxPriority    int
+	StrictPriority bool
+	// MaxStopSequences caps the stop list; longer lists are rejected with 400
+	MaxStopSequences int
+	// Heartbeat is how often a stream still waiting for its first token gets
+	// a ": ping" comment, so idle-timeout proxies keep it open
+	Heartbeat time.Duration
+}
+
+// DefaultInferenceConfig returns the default inference defaults and limits
+func DefaultInferenceConfig() InferenceConfig {
+	return InferenceConfig{
+		DefaultModel:       "default-model",
+		DefaultMaxTokens:   100,
+		DefaultTemperature: 0.7,
+		DefaultPriority:    1,
+
+		MaxPromptBytes:   64 << 10,
+		MaxTokens:        4096,
+		MinPriority:      1,
+		MaxPriority:      10,
+		MaxStopSequences: 4,
+	}
+}
+
 type InferenceHandler struct {
-	queue *queue.PriorityQueue
+	cfg          InferenceConfig
+	queues       *queue.ModelQueues
+	cache        *cache.Cache                    // optional; nil disables response caching
+	priorityFunc PriorityFunc                    // optional; overrides the body's priority
+	available    func(*queue.PriorityQueue) bool // optional; false fails fast with 503
+	estimator    WaitEstimator                   // optional; enables admission control
+	maxWait      time.Duration                   // admission limit; 0 = client timeouts only
+	quota        *quota.Quota                    // optional; per-key and per-model token quotas
+	closing      atomic.Bool                     // set by Shutdown; new requests are turned away
 }
 
+// shutdownRetryAfter is the Retry-After sent while shutting down, long enough
+// for a load balancer to stop routing to this gateway
+const shutdownRetryAfter = 5 * time.Second
+
+// PriorityFunc derives a request's priority from the request itself (e.g. its
+// API key). A result <= 0 means the default (lowest) priority.
+type PriorityFunc func(*http.Request) int
+
+// NewInferenceHandler creates a handler that sends every request to one shared queue
 func NewInferenceHandler(pq *queue.PriorityQueue) *InferenceHandler {
+	return NewModelInferenceHandler(queue.NewModelQueues(pq))
+}
+
+// NewModelInferenceHandler creates a handler that pushes each request into the
+// queue for its model, falling back to the default queue
+func NewModelInferenceHandler(qs *queue.ModelQueues) *InferenceHandler {
 	return &InferenceHandler{
-		queue: pq,
+		cfg:    DefaultInferenceConfig(),
+		queues: qs,
+	}
+}
+
+// SetConfig replaces the handler's request defaults and limits. Start from
+// DefaultInferenceConfig: a zero DefaultTemperature means deterministic.
+func (h *InferenceHandler) SetConfig(cfg InferenceConfig) {
+	h.cfg = cfg
+}
+
+// SetPriorityFunc makes f the sole source of request priority. The
+// client-supplied "priority" field is then ignored, so callers can't promote
+// themselves. Passing nil restores the body value.
+func (h *InferenceHandler) SetPriorityFunc(f PriorityFunc) {
+	h.priorityFunc = f
+}
+
+// APIKeyPriority returns a PriorityFunc that looks up the request's API key
+// (X-API-Key header, or an "Authorization: Bearer" token) in tiers. Unknown
+// or missing keys get the default priority.
+func APIKeyPriority(tiers map[string]int) PriorityFunc {
+	return func(r *http.Request) int {
+		return tiers[apiKey(r)]
+	}
+}
+
+// clampPriority bounds p to [MinPriority, MaxPriority]; a zero bound is open
+func (h *InferenceHandler) clampPriority(p int) int {
+	if h.cfg.MinPriority > 0 {
+		p = max(p, h.cfg.MinPriority)
+	}
+	if h.cfg.MaxPriority > 0 {
+		p = min(p, h.cfg.MaxPriority)
 	}
+	return p
+}
+
+// apiKey returns the caller's API key from X-API-Key or an
+// "Authorization: Bearer" token, or "" if there is none
+func apiKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	key, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return key
+}
+
+// SetAvailability makes the handler reject requests with 503 instead of
+// queueing them when f reports that no healthy worker drains the request's
+// queue. Cached completions are still served. Passing nil disables the check.
+func (h *InferenceHandler) SetAvailability(f func(*queue.PriorityQueue) bool) {
+	h.available = f
+}
+
+// SetCache enables replaying cached completions for deterministic
+// (temperature 0) requests. Passing nil disables caching.
+func (h *InferenceHandler) SetCache(c *cache.Cache) {
+	h.cache = c
+}
+
+// Shutdown makes the handler turn new requests away with 503 and Retry-After
+// before reading them, so clients fail over while the requests already
+// accepted finish. It doesn't wait for them.
+func (h *InferenceHandler) Shutdown() {
+	h.closing.Store(true)
 }
 
 func (h *InferenceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.closing.Load() {
+		writeShuttingDown(w)
+		return
+	}
+
 	// 1. Parse request
 	var reqBody struct {
-		Prompt      string  `json:"prompt"`
-		MaxTokens   int     `json:"max_tokens"`
-		Temperature float32 `json:"temperature"`
-		Model       string  `json:"model"`
-		Priority    int     `json:"priority"` // Optional: Let users set priority (or derive from API key)
+		Prompt      string   `json:"prompt"`
+		MaxTokens   int      `json:"max_tokens"`
+		Temperature *float32 `json:"temperature"` // nil = default; explicit 0 = deterministic
+		Model       string   `json:"model"`
+		Priority    int      `json:"priority"` // Optional; ignored when a PriorityFunc is set
+		Stream      *bool    `json:"stream"`   // false = one JSON response instead of SSE
+		Stop        []string `json:"stop"`     // Optional stop sequences
+		Seed        *int64   `json:"seed"`     // Optional sampling seed
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeLimitError(w, "max_body_size", int(tooLarge.Limit), "request body exceeds the gateway limit")
+			return
+		}
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
+	if h.priorityFunc != nil {
+		reqBody.Priority = max(h.priorityFunc(r), 0)
+	} else if h.cfg.StrictPriority && reqBody.Priority != 0 && h.clampPriority(reqBody.Priority) != reqBody.Priority {
+		http.Error(w, fmt.Sprintf("Priority must be between %d and %d", h.cfg.MinPriority, h.cfg.MaxPriority), http.StatusBadRequest)
+		return
+	}
+
 	// Apply Defaults
-	if reqBody.Temperature <= 0 {
-		reqBody.Temperature = 0.7
+	temperature := h.cfg.DefaultTemperature
+	if reqBody.Temperature != nil && *reqBody.Temperature >= 0 {
+		temperature = *reqBody.Temperature
 	}
 	if reqBody.MaxTokens <= 0 {
-		reqBody.MaxTokens = 100
+		reqBody.MaxTokens = h.cfg.DefaultMaxTokens
 	}
 	if reqBody.Model == "" {
-		reqBody.Model = "default-model"
+		reqBody.Model = h.cfg.DefaultModel
 	}
-	if reqBody.Priority <= 0 {
-		reqBody.Priority = 1 // Default low priority
+	if reqBody.Priority == 0 {
+		reqBody.Priority = h.cfg.DefaultPriority
 	}
+	reqBody.Priority = h.clampPriority(reqBody.Priority)
 	if reqBody.Prompt == "" {
 		http.Error(w, "Prompt is required", http.StatusBadRequest)
 		return
 	}
+	if h.cfg.MaxPromptBytes > 0 && len(reqBody.Prompt) > h.cfg.MaxPromptBytes {
+		writeLimitError(w, "max_prompt_bytes", h.cfg.MaxPromptBytes,
+			fmt.Sprintf("prompt is %d bytes, limit is %d", len(reqBody.Prompt), h.cfg.MaxPromptBytes))
+		return
+	}
+	if h.cfg.MaxTokens > 0 && reqBody.MaxTokens > h.cfg.MaxTokens {
+		reqBody.MaxTokens = h.cfg.MaxTokens
+	}
+	// An empty stop sequence would match immediately; treat it as absent
+	reqBody.Stop = slices.DeleteFunc(reqBody.Stop, func(s string) bool { return s == "" })
+	if len(reqBody.Stop) == 0 {
+		reqBody.Stop = nil
+	}
+	if h.cfg.MaxStopSequences > 0 && len(reqBody.Stop) > h.cfg.MaxStopSequences {
+		http.Error(w, fmt.Sprintf("At most %d stop sequences are allowed", h.cfg.MaxStopSequences), http.StatusBadRequest)
+		return
+	}
+
+	pq := h.queues.For(reqBody.Model)
+	if pq == nil {
+		http.Error(w, fmt.Sprintf("Model %q is not served", reqBody.Model), http.StatusBadRequest)
+		return
+	}
+
+	timeout, err := requestTimeout(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	buffered := wantsBuffered(r, reqBody.Stream)
 
 	reqID, ok := r.Context().Value(logger.RequestIDKey).(string)
 	if !ok {
 		reqID = fmt.Sprintf("req-%d", time.Now().UnixNano())
 	}
 
+	// Cancelling ctx closes the worker stream: on client disconnect, or when
+	// the gateway cuts off a worker that overruns max_tokens
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
 	// 2. Create Internal Request
 	req := &queue.Request{
 		ID:          reqID,
 		Prompt:      reqBody.Prompt,
 		MaxTokens:   reqBody.MaxTokens,
-		Temperature: reqBody.Temperature,
+		Temperature: temperature,
+		Stop:        reqBody.Stop,
+		Seed:        reqBody.Seed,
 		Model:       reqBody.Model,
 		Priority:    reqBody.Priority,
 		SubmitTime:  time.Now(),
 		ResponseCh:  make(chan *pb.TokenResponse, 100), // Buffered to avoid blocking worker
 		ErrorCh:     make(chan error, 1),
+		Ctx:         ctx,
 	}
 
-	// 3. Enqueue (This is non-blocking usually, but we can measure queue time here)
-	if !h.queue.Push(req) {
-		http.Error(w, "Service shutting down", http.StatusServiceUnavailable)
+	// Deterministic requests can be served from (and stored into) the cache
+	var cacheKey string
+	if h.cache != nil && req.Temperature == 0 {
+		cacheKey = cache.Key(req.Model, req.Prompt, req.MaxTokens, req.Stop...)
+		if tokens, ok := h.cache.Get(cacheKey); ok {
+			metrics.InferenceCacheLookupsTotal.WithLabelValues(req.Model, "hit").Inc()
+			h.serveCached(w, req, tokens, buffered)
+			return
+		}
+		metrics.InferenceCacheLookupsTotal.WithLabelValues(req.Model, "miss").Inc()
+	}
+
+	// Nothing would pick the request up; don't leave the client hanging
+	if h.available != nil && !h.available(pq) {
+		metrics.InferenceQueueRejectedTotal.WithLabelValues(pq.Name(), "no_workers").Inc()
+		http.Error(w, "no inference workers available", http.StatusServiceUnavailable)
 		return
 	}
 
-	// 4. Stream Response
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
+	// Don't accept work that would sit in the queue past its deadline
+	if !h.admit(w, pq, timeout) {
+		return
+	}
 
-	flusher, ok := w.(http.Flusher)
-	if !ok {
-		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+	var charge quotaCharge
+	if h.quota != nil {
+		key := apiKey(r)
+		if !h.checkQuota(w, r, key, req.Model) {
+			return
+		}
+		charge = quotaCharge{q: h.quota, key: key, model: req.Model}
+	}
+
+	// 3. Enqueue (This is non-blocking usually, but we can measure queue time here)
+	if !pq.Push(req) {
+		if pq.Closed() {
+			writeShuttingDown(w)
+			return
+		}
+		http.Error(w, "Inference queue is full", http.StatusServiceUnavailable)
 		return
 	}
 
+	// 4. Stream Response (or collect it, in buffered mode)
+	var flusher http.Flusher
+	if !buffered {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+
+		flusher, ok = w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+	}
+	sse := getSSEEncoder()
+	defer putSSEEncoder(sse)
+
 	// Metrics tracking
 	priorityLabel := metrics.PriorityLabel(req.Priority)
 	var firstTokenReceived bool
 	var lastTokenCount int32
+	var collected []*pb.TokenResponse
+	var summary streamSummary
 	status := "success"
 
+	// Heartbeats only cover the wait for the first token; a nil channel
+	// never fires
+	var heartbeat <-chan time.Time
+	if !buffered && h.cfg.Heartbeat > 0 {
+		ticker := time.NewTicker(h.cfg.Heartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
 	defer func() {
+		// Charge whatever the last batch left over, even if the client left
+		charge.flush()
 		// Record end-to-end duration
 		metrics.InferenceRequestDuration.WithLabelValues(req.Model).Observe(time.Since(req.SubmitTime).Seconds())
 		// Record request count with final status
@@ -107,38 +361,253 @@ func (h *InferenceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		select {
 		case resp, ok := <-req.ResponseCh:
 			if !ok {
+				h.finish(w, req, cacheKey, collected, summary, buffered)
 				return // Channel closed (success)
 			}
 
 			// Track time to first token
 			if !firstTokenReceived {
 				firstTokenReceived = true
+				heartbeat = nil
 				metrics.InferenceTimeToFirstToken.WithLabelValues(req.Model).Observe(time.Since(req.SubmitTime).Seconds())
 			}
 
+			// Enforce the limit even if the worker ignores it: a token past
+			// max_tokens is dropped and the worker stream cancelled
+			if resp.Token != "" && summary.completion >= req.MaxTokens {
+				cancel()
+				metrics.InferenceMaxTokensEnforcedTotal.WithLabelValues(req.Model).Inc()
+				slog.Warn("worker exceeded max_tokens, stream cut off", "request_id", req.ID, "model", req.Model, "max_tokens", req.MaxTokens)
+				summary.finishReason = "length"
+				h.finish(w, req, cacheKey, collected, summary, buffered)
+				return
+			}
+
 			// Track tokens (using cumulative count from worker)
 			if resp.TokenCount > lastTokenCount {
-				metrics.InferenceTokensTotal.WithLabelValues(req.Model).Add(float64(resp.TokenCount - lastTokenCount))
+				delta := resp.TokenCount - lastTokenCount
+				metrics.InferenceTokensTotal.WithLabelValues(req.Model).Add(float64(delta))
+				charge.add(int64(delta))
 				lastTokenCount = resp.TokenCount
 			}
 
+			summary.add(resp)
+
 			// SSE Format: data: <token>\n\n
-			data, _ := json.Marshal(resp)
-			fmt.Fprintf(w, "data: %s\n\n", data)
-			flusher.Flush()
+			if !buffered {
+				sse.writeToken(w, resp)
+				flusher.Flush()
+			}
+
+			if cacheKey != "" || buffered {
+				collected = append(collected, resp)
+			}
 
 			if resp.Finished {
+				h.finish(w, req, cacheKey, collected, summary, buffered)
 				return
 			}
 
+		case <-heartbeat:
+			io.WriteString(w, ": ping\n\n")
+			flusher.Flush()
+
 		case err := <-req.ErrorCh:
 			status = "error"
+			code := http.StatusBadGateway
+			if errors.Is(err, worker.ErrTimeout) {
+				status, code = "timeout", http.StatusGatewayTimeout
+			}
+			if buffered {
+				writeJSONError(w, code, err.Error())
+				return
+			}
 			fmt.Fprintf(w, "event: error\ndata: %s\n\n", err.Error())
 			return
 
 		case <-r.Context().Done():
 			status = "cancelled"
+			// Drop it from the queue if no worker has picked it up yet. No
+			// worker will record its wait then, so do it here.
+			if pq.Remove(req) {
+				metrics.InferenceQueueWaitDuration.WithLabelValues(req.Model, priorityLabel, status).Observe(time.Since(req.SubmitTime).Seconds())
+			}
+			return
+		}
+	}
+}
+
+// serveCached replays a cached token stream as SSE (or one JSON completion)
+// without touching a worker
+func (h *InferenceHandler) serveCached(w http.ResponseWriter, req *queue.Request, tokens []*pb.TokenResponse, buffered bool) {
+	w.Header().Set("X-Inference-Cache", "hit")
+	var summary streamSummary
+	for _, resp := range tokens {
+		summary.add(resp)
+	}
+	done := summary.done(req.MaxTokens)
+
+	if buffered {
+		writeCompletion(w, tokens, done)
+	} else {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
 			return
 		}
+
+		sse := getSSEEncoder()
+		defer putSSEEncoder(sse)
+		for _, resp := range tokens {
+			resp.RequestId = req.ID
+			sse.writeToken(w, resp)
+		}
+		sse.writeEvent(w, "done", done)
+		flusher.Flush()
+	}
+
+	metrics.InferenceRequestDuration.WithLabelValues(req.Model).Observe(time.Since(req.SubmitTime).Seconds())
+	metrics.InferenceRequestsTotal.WithLabelValues(req.Model, metrics.PriorityLabel(req.Priority), "success").Inc()
+}
+
+// finish completes a successful request: caches it and writes the accumulated
+// completion in buffered mode, or the closing "done" event when streaming
+func (h *InferenceHandler) finish(w http.ResponseWriter, req *queue.Request, cacheKey string, tokens []*pb.TokenResponse, summary streamSummary, buffered bool) {
+	h.storeCached(cacheKey, tokens)
+	done := summary.done(req.MaxTokens)
+	if buffered {
+		writeCompletion(w, tokens, done)
+		return
+	}
+
+	sse := getSSEEncoder()
+	defer putSSEEncoder(sse)
+	sse.writeEvent(w, "done", done)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// wantsBuffered reports whether the client asked for a single JSON response
+// rather than SSE: "stream": false in the body, or an Accept header preferring
+// application/json over text/event-stream
+func wantsBuffered(r *http.Request, stream *bool) bool {
+	if stream != nil {
+		return !*stream
+	}
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/event-stream")
+}
+
+// completion is the buffered-mode response body
+type completion struct {
+	Text         string `json:"text"`
+	Tokens       int    `json:"tokens"`
+	FinishReason string `json:"finish_reason"`
+	Usage        usage  `json:"usage"`
+}
+
+// doneEvent is the payload of the "event: done" that closes an SSE stream
+type doneEvent struct {
+	FinishReason string `json:"finish_reason"`
+	Usage        usage  `json:"usage"`
+}
+
+type usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// streamSummary accumulates why a token stream stopped and how many tokens it
+// used, from the worker's final message where it reports them
+type streamSummary struct {
+	finishReason string
+	prompt       int
+	completion   int
+}
+
+func (s *streamSummary) add(resp *pb.TokenResponse) {
+	if resp.Token != "" {
+		s.completion++
+	}
+	// The worker's cumulative count is authoritative when it sends one
+	s.completion = max(s.completion, int(resp.TokenCount))
+	if resp.FinishReason != "" {
+		s.finishReason = resp.FinishReason
+	}
+	if resp.PromptTokens > 0 {
+		s.prompt = int(resp.PromptTokens)
+	}
+}
+
+// done builds the closing summary. Workers that don't report a finish reason
+// are assumed to have hit max_tokens if they produced that many.
+func (s streamSummary) done(maxTokens int) doneEvent {
+	reason := s.finishReason
+	if reason == "" {
+		reason = "stop"
+		if maxTokens > 0 && s.completion >= maxTokens {
+			reason = "length"
+		}
+	}
+	return doneEvent{
+		FinishReason: reason,
+		Usage: usage{
+			PromptTokens:     s.prompt,
+			CompletionTokens: s.completion,
+			TotalTokens:      s.prompt + s.completion,
+		},
+	}
+}
+
+// writeCompletion joins a token stream into one JSON completion
+func writeCompletion(w http.ResponseWriter, tokens []*pb.TokenResponse, done doneEvent) {
+	var text strings.Builder
+	for _, t := range tokens {
+		text.WriteString(t.Token)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(completion{
+		Text:         text.String(),
+		Tokens:       done.Usage.CompletionTokens,
+		FinishReason: done.FinishReason,
+		Usage:        done.Usage,
+	})
+}
+
+// writeJSONError writes {"error": msg} with the given status
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+// writeShuttingDown rejects a request because the gateway is shutting down.
+// The connection is closed too, so the client's retry opens a new one, most
+// likely to another gateway.
+func writeShuttingDown(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(shutdownRetryAfter.Seconds())))
+	w.Header().Set("Connection", "close")
+	writeJSONError(w, http.StatusServiceUnavailable, "gateway shutting down")
+}
+
+// writeLimitError rejects a request that exceeds a configured limit with 413,
+// naming the limit so clients know what to change
+func writeLimitError(w http.ResponseWriter, limit string, value int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusRequestEntityTooLarge)
+	json.NewEncoder(w).Encode(map[string]any{"error": msg, "limit": limit, "value": value})
+}
+
+// storeCached saves a completed token stream for a deterministic request
+func (h *InferenceHandler) storeCached(key string, tokens []*pb.TokenResponse) {
+	if key == "" || len(tokens) == 0 {
+		return
 	}
+	h.cache.Set(key, tokens)
 }
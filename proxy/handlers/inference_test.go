@@ -0,0 +1,575 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aluko123/go-network-proxy/inference/cache"
+	pb "github.com/aluko123/go-network-proxy/inference/pb"
+	"github.com/aluko123/go-network-proxy/inference/queue"
+	"github.com/aluko123/go-network-proxy/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// startFakeWorker pops requests from the queue and streams two tokens back,
+// counting how many requests actually reached a worker
+func startFakeWorker(pq *queue.PriorityQueue, calls *int32) {
+	go func() {
+		for {
+			req := pq.Pop()
+			if req == nil {
+				return
+			}
+			atomic.AddInt32(calls, 1)
+			req.ResponseCh <- &pb.TokenResponse{RequestId: req.ID, Token: "hello ", TokenCount: 1}
+			req.ResponseCh <- &pb.TokenResponse{RequestId: req.ID, Token: "world", TokenCount: 2, Finished: true}
+			close(req.ResponseCh)
+			pq.Done()
+		}
+	}()
+}
+
+func doInference(t *testing.T, h http.Handler, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	return serveInference(t, h, httptest.NewRequest(http.MethodPost, "/v1/inference", strings.NewReader(body)))
+}
+
+// serveInference runs one request through h, failing the test if it hangs
+func serveInference(t *testing.T, h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(w, r)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("inference request did not complete")
+	}
+	return w
+}
+
+func TestInferenceHandler_CacheHitSkipsWorker(t *testing.T) {
+	pq := queue.NewPriorityQueue(0)
+	defer pq.Close()
+
+	var calls int32
+	startFakeWorker(pq, &calls)
+
+	h := NewInferenceHandler(pq)
+	h.SetCache(cache.New(time.Minute, 10))
+
+	body := `{"prompt":"hi","model":"gpt2","max_tokens":5,"temperature":0}`
+
+	first := doInference(t, h, body)
+	second := doInference(t, h, body)
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("expected worker to be called once, got %d", got)
+	}
+	if second.Header().Get("X-Inference-Cache") != "hit" {
+		t.Error("expected second response to be served from cache")
+	}
+	if !strings.Contains(second.Body.String(), "world") {
+		t.Errorf("cached response missing tokens: %q", second.Body.String())
+	}
+	if first.Header().Get("X-Inference-Cache") == "hit" {
+		t.Error("first response should not be a cache hit")
+	}
+}
+
+func TestInferenceHandler_NonDeterministicNotCached(t *testing.T) {
+	pq := queue.NewPriorityQueue(0)
+	defer pq.Close()
+
+	var calls int32
+	startFakeWorker(pq, &calls)
+
+	c := cache.New(time.Minute, 10)
+	h := NewInferenceHandler(pq)
+	h.SetCache(c)
+
+	body := `{"prompt":"hi","model":"gpt2","max_tokens":5,"temperature":0.7}`
+
+	doInference(t, h, body)
+	doInference(t, h, body)
+
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("expected worker to be called twice, got %d", got)
+	}
+	if c.Len() != 0 {
+		t.Errorf("expected nothing cached, got %d entries", c.Len())
+	}
+}
+
+func TestInferenceHandler_BufferedResponse(t *testing.T) {
+	pq := queue.NewPriorityQueue(0)
+	defer pq.Close()
+
+	var calls int32
+	startFakeWorker(pq, &calls)
+	h := NewInferenceHandler(pq)
+
+	streamFalse := doInference(t, h, `{"prompt":"hi","stream":false}`)
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/inference", strings.NewReader(`{"prompt":"hi"}`))
+	r.Header.Set("Accept", "application/json")
+	acceptJSON := serveInference(t, h, r)
+
+	for name, w := range map[string]*httptest.ResponseRecorder{"stream=false": streamFalse, "accept": acceptJSON} {
+		if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s: expected application/json, got %q", name, ct)
+		}
+		var got completion
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%s: invalid JSON %q: %v", name, w.Body.String(), err)
+		}
+		if got.Text != "hello world" || got.Tokens != 2 {
+			t.Errorf("%s: expected {hello world, 2}, got %+v", name, got)
+		}
+	}
+}
+
+func TestInferenceHandler_BufferedError(t *testing.T) {
+	pq := queue.NewPriorityQueue(0)
+	defer pq.Close()
+
+	go func() {
+		req := pq.Pop()
+		req.ErrorCh <- errors.New("worker exploded")
+		pq.Done()
+	}()
+
+	w := doInference(t, NewInferenceHandler(pq), `{"prompt":"hi","stream":false}`)
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("expected 502, got %d", w.Code)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["error"] != "worker exploded" {
+		t.Errorf("expected JSON error, got %q", w.Body.String())
+	}
+}
+
+func TestInferenceHandler_PriorityFuncOverridesBody(t *testing.T) {
+	pq := queue.NewPriorityQueue(0)
+	defer pq.Close()
+
+	priorities := make(chan int, 2)
+	go func() {
+		for {
+			req := pq.Pop()
+			if req == nil {
+				return
+			}
+			priorities <- req.Priority
+			close(req.ResponseCh)
+			pq.Done()
+		}
+	}()
+
+	h := NewInferenceHandler(pq)
+	h.SetPriorityFunc(APIKeyPriority(map[string]int{"paid": 9}))
+
+	// A free-tier client asking for top priority is ignored
+	r := httptest.NewRequest(http.MethodPost, "/v1/inference", strings.NewReader(`{"prompt":"hi","priority":10}`))
+	r.Header.Set("X-API-Key", "free")
+	serveInference(t, h, r)
+	if got := <-priorities; got != 1 {
+		t.Errorf("unknown key: expected default priority 1, got %d", got)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/v1/inference", strings.NewReader(`{"prompt":"hi","priority":1}`))
+	r.Header.Set("Authorization", "Bearer paid")
+	serveInference(t, h, r)
+	if got := <-priorities; got != 9 {
+		t.Errorf("paid key: expected priority 9, got %d", got)
+	}
+}
+
+func TestInferenceHandler_ConfiguredDefaults(t *testing.T) {
+	qs := queue.NewModelQueues(nil)
+	pq := queue.NewPriorityQueue(0)
+	qs.Add("llama", pq)
+	defer pq.Close()
+
+	got := make(chan *queue.Request, 1)
+	go func() {
+		req := pq.Pop()
+		got <- req
+		close(req.ResponseCh)
+		pq.Done()
+	}()
+
+	h := NewModelInferenceHandler(qs)
+	cfg := DefaultInferenceConfig()
+	cfg.DefaultModel = "llama"
+	cfg.DefaultMaxTokens = 7
+	cfg.DefaultTemperature = 0.2
+	cfg.DefaultPriority = 5
+	h.SetConfig(cfg)
+
+	if w := doInference(t, h, `{"prompt":"hi"}`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	req := <-got
+	if req.Model != "llama" || req.MaxTokens != 7 || req.Temperature != 0.2 || req.Priority != 5 {
+		t.Errorf("expected the configured defaults, got model=%q max_tokens=%d temperature=%v priority=%d",
+			req.Model, req.MaxTokens, req.Temperature, req.Priority)
+	}
+}
+
+func TestInferenceHandler_PriorityRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		priority string
+		strict   bool
+		want     int // expected queued priority; 0 = rejected with 400
+	}{
+		{"omitted", ``, false, 1},
+		{"lower bound", `,"priority":1`, false, 1},
+		{"upper bound", `,"priority":10`, false, 10},
+		{"huge clamped", `,"priority":1000000`, false, 10},
+		{"negative clamped", `,"priority":-5`, false, 1},
+		{"strict in range", `,"priority":10`, true, 10},
+		{"strict omitted", ``, true, 1},
+		{"strict huge", `,"priority":11`, true, 0},
+		{"strict negative", `,"priority":-1`, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pq := queue.NewPriorityQueue(0)
+			defer pq.Close()
+
+			got := make(chan int, 1)
+			go func() {
+				req := pq.Pop()
+				if req == nil {
+					return
+				}
+				got <- req.Priority
+				close(req.ResponseCh)
+				pq.Done()
+			}()
+
+			h := NewInferenceHandler(pq)
+			cfg := DefaultInferenceConfig()
+			cfg.StrictPriority = tt.strict
+			h.SetConfig(cfg)
+
+			w := doInference(t, h, `{"prompt":"hi"`+tt.priority+`}`)
+			if tt.want == 0 {
+				if w.Code != http.StatusBadRequest {
+					t.Errorf("expected 400, got %d", w.Code)
+				}
+				return
+			}
+			if p := <-got; p != tt.want {
+				t.Errorf("expected priority %d, got %d", tt.want, p)
+			}
+		})
+	}
+}
+
+func TestInferenceHandler_Limits(t *testing.T) {
+	pq := queue.NewPriorityQueue(0)
+	defer pq.Close()
+
+	maxTokens := make(chan int, 1)
+	go func() {
+		for {
+			req := pq.Pop()
+			if req == nil {
+				return
+			}
+			maxTokens <- req.MaxTokens
+			close(req.ResponseCh)
+			pq.Done()
+		}
+	}()
+
+	h := NewInferenceHandler(pq)
+	cfg := DefaultInferenceConfig()
+	cfg.MaxPromptBytes, cfg.MaxTokens = 8, 50
+	h.SetConfig(cfg)
+
+	w := doInference(t, h, `{"prompt":"way too long a prompt"}`)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d", w.Code)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["limit"] != "max_prompt_bytes" {
+		t.Errorf("expected JSON error naming max_prompt_bytes, got %q", w.Body.String())
+	}
+
+	doInference(t, h, `{"prompt":"short","max_tokens":100000}`)
+	if got := <-maxTokens; got != 50 {
+		t.Errorf("expected max_tokens clamped to 50, got %d", got)
+	}
+}
+
+func TestInferenceHandler_FailsFastWithoutWorkers(t *testing.T) {
+	pq := queue.NewPriorityQueue(0)
+	defer pq.Close()
+
+	h := NewInferenceHandler(pq)
+	h.SetCache(cache.New(time.Minute, 10))
+	var available atomic.Bool
+	h.SetAvailability(func(q *queue.PriorityQueue) bool {
+		if q != pq {
+			t.Errorf("availability checked for the wrong queue")
+		}
+		return available.Load()
+	})
+
+	body := `{"prompt":"hi","model":"gpt2","max_tokens":5,"temperature":0}`
+	w := doInference(t, h, body)
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "no inference workers available") {
+		t.Fatalf("expected 503 no workers, got %d %q", w.Code, w.Body.String())
+	}
+	if pq.Len() != 0 {
+		t.Errorf("request was queued with no workers (len=%d)", pq.Len())
+	}
+
+	// Once a worker is back the request is served, and later cached
+	// copies don't need one
+	var calls int32
+	startFakeWorker(pq, &calls)
+	available.Store(true)
+	if w := doInference(t, h, body); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 with a worker, got %d", w.Code)
+	}
+	available.Store(false)
+	if w := doInference(t, h, body); w.Code != http.StatusOK || w.Header().Get("X-Inference-Cache") != "hit" {
+		t.Errorf("expected cached response without workers, got %d", w.Code)
+	}
+}
+
+func TestInferenceHandler_DoneEvent(t *testing.T) {
+	pq := queue.NewPriorityQueue(0)
+	defer pq.Close()
+
+	// The first request gets a worker-reported summary, the second none
+	go func() {
+		req := pq.Pop()
+		req.ResponseCh <- &pb.TokenResponse{RequestId: req.ID, Token: "a", TokenCount: 1}
+		req.ResponseCh <- &pb.TokenResponse{RequestId: req.ID, Finished: true, TokenCount: 1, FinishReason: "stop", PromptTokens: 4}
+		close(req.ResponseCh)
+		pq.Done()
+
+		req = pq.Pop()
+		req.ResponseCh <- &pb.TokenResponse{RequestId: req.ID, Token: "a"}
+		req.ResponseCh <- &pb.TokenResponse{RequestId: req.ID, Token: "b"}
+		close(req.ResponseCh)
+		pq.Done()
+	}()
+
+	h := NewInferenceHandler(pq)
+	w := doInference(t, h, `{"prompt":"hi","max_tokens":5}`)
+	body := w.Body.String()
+	if strings.Count(body, "prompt_tokens") != 1 {
+		t.Errorf("data events should not carry the summary: %q", body)
+	}
+	want := "event: done\ndata: {\"finish_reason\":\"stop\",\"usage\":{\"prompt_tokens\":4,\"completion_tokens\":1,\"total_tokens\":5}}\n\n"
+	if !strings.HasSuffix(body, want) {
+		t.Errorf("expected stream to end with %q, got %q", want, body)
+	}
+
+	// Without a reported reason, reaching max_tokens means "length"
+	w = doInference(t, h, `{"prompt":"hi","max_tokens":2,"stream":false}`)
+	var got completion
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", w.Body.String(), err)
+	}
+	if got.FinishReason != "length" || got.Usage.CompletionTokens != 2 || got.Tokens != 2 {
+		t.Errorf("expected length with 2 completion tokens, got %+v", got)
+	}
+}
+
+func TestInferenceHandler_StopAndSeed(t *testing.T) {
+	pq := queue.NewPriorityQueue(0)
+	defer pq.Close()
+
+	popped := make(chan *queue.Request, 2)
+	go func() {
+		for {
+			req := pq.Pop()
+			if req == nil {
+				return
+			}
+			popped <- req
+			close(req.ResponseCh)
+			pq.Done()
+		}
+	}()
+
+	h := NewInferenceHandler(pq)
+	cfg := DefaultInferenceConfig()
+	cfg.MaxStopSequences = 2
+	h.SetConfig(cfg)
+
+	w := doInference(t, h, `{"prompt":"hi","stop":["a","b","c"]}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for too many stop sequences, got %d", w.Code)
+	}
+
+	doInference(t, h, `{"prompt":"hi","stop":["\n\n",""],"seed":42}`)
+	req := <-popped
+	if len(req.Stop) != 1 || req.Stop[0] != "\n\n" || req.Seed == nil || *req.Seed != 42 {
+		t.Errorf("expected stop [\\n\\n] and seed 42, got %q %v", req.Stop, req.Seed)
+	}
+
+	// Without the fields the request is exactly as before
+	doInference(t, h, `{"prompt":"hi"}`)
+	if req := <-popped; req.Stop != nil || req.Seed != nil {
+		t.Errorf("expected no stop or seed, got %q %v", req.Stop, req.Seed)
+	}
+}
+
+func TestInferenceHandler_CutsOffRunawayWorker(t *testing.T) {
+	pq := queue.NewPriorityQueue(0)
+	defer pq.Close()
+
+	// A worker that ignores max_tokens and streams until cancelled
+	cancelled := make(chan struct{})
+	go func() {
+		req := pq.Pop()
+		defer pq.Done()
+		for n := int32(1); ; n++ {
+			select {
+			case req.ResponseCh <- &pb.TokenResponse{RequestId: req.ID, Token: "x", TokenCount: n}:
+			case <-req.Ctx.Done():
+				close(cancelled)
+				return
+			}
+		}
+	}()
+
+	before := testutil.ToFloat64(metrics.InferenceMaxTokensEnforcedTotal.WithLabelValues("gpt2"))
+	w := doInference(t, NewInferenceHandler(pq), `{"prompt":"hi","model":"gpt2","max_tokens":3}`)
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("worker stream was not cancelled")
+	}
+	body := w.Body.String()
+	if n := strings.Count(body, `"token":"x"`); n != 3 {
+		t.Errorf("expected exactly 3 tokens forwarded, got %d in %q", n, body)
+	}
+	if !strings.Contains(body, "event: done\ndata: {\"finish_reason\":\"length\"") {
+		t.Errorf("expected a length done event, got %q", body)
+	}
+	if got := testutil.ToFloat64(metrics.InferenceMaxTokensEnforcedTotal.WithLabelValues("gpt2")); got != before+1 {
+		t.Errorf("expected the enforcement counted, got %v", got-before)
+	}
+}
+
+func TestInferenceHandler_HeartbeatUntilFirstToken(t *testing.T) {
+	pq := queue.NewPriorityQueue(0)
+	defer pq.Close()
+
+	// A worker that sits on the request long enough for a few heartbeats,
+	// then streams slowly enough that any late ping would show up
+	go func() {
+		req := pq.Pop()
+		defer pq.Done()
+		time.Sleep(50 * time.Millisecond)
+		for n := int32(1); n <= 3; n++ {
+			req.ResponseCh <- &pb.TokenResponse{RequestId: req.ID, Token: "x", TokenCount: n, Finished: n == 3}
+			time.Sleep(30 * time.Millisecond)
+		}
+		close(req.ResponseCh)
+	}()
+
+	h := NewInferenceHandler(pq)
+	cfg := DefaultInferenceConfig()
+	cfg.Heartbeat = 10 * time.Millisecond
+	h.SetConfig(cfg)
+	body := doInference(t, h, `{"prompt":"hi","model":"gpt2"}`).Body.String()
+
+	first := strings.Index(body, "data:")
+	if first < 0 {
+		t.Fatalf("expected tokens, got %q", body)
+	}
+	if !strings.Contains(body[:first], ": ping\n\n") {
+		t.Errorf("expected pings before the first token, got %q", body)
+	}
+	if strings.Contains(body[first:], ": ping") {
+		t.Errorf("expected no pings once tokens flow, got %q", body)
+	}
+}
+
+func TestInferenceHandler_QueueWaitOfCancelledRequest(t *testing.T) {
+	pq := queue.NewPriorityQueue(0)
+	defer pq.Close()
+
+	waits := func() uint64 {
+		m := &dto.Metric{}
+		metrics.InferenceQueueWaitDuration.WithLabelValues("gpt2", "low", "cancelled").(prometheus.Metric).Write(m)
+		return m.GetHistogram().GetSampleCount()
+	}
+	before := waits()
+
+	// No worker: the client gives up while the request is still queued
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	r := httptest.NewRequest(http.MethodPost, "/v1/inference", strings.NewReader(`{"prompt":"hi","model":"gpt2"}`)).WithContext(ctx)
+	serveInference(t, NewInferenceHandler(pq), r)
+
+	if got := waits() - before; got != 1 {
+		t.Errorf("expected one cancelled queue wait recorded, got %d", got)
+	}
+	if pq.Len() != 0 {
+		t.Errorf("expected the request removed from the queue, %d left", pq.Len())
+	}
+}
+
+func TestInferenceHandler_ShuttingDown(t *testing.T) {
+	check := func(t *testing.T, w *httptest.ResponseRecorder) {
+		t.Helper()
+		if w.Code != http.StatusServiceUnavailable {
+			t.Fatalf("expected 503, got %d", w.Code)
+		}
+		if got := w.Header().Get("Retry-After"); got != "5" {
+			t.Errorf("expected Retry-After 5, got %q", got)
+		}
+		if got := w.Header().Get("Connection"); got != "close" {
+			t.Errorf("expected Connection: close, got %q", got)
+		}
+		var body map[string]string
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["error"] != "gateway shutting down" {
+			t.Errorf("expected a JSON shutdown error, got %q", w.Body)
+		}
+	}
+
+	t.Run("queue closed", func(t *testing.T) {
+		pq := queue.NewPriorityQueue(0)
+		pq.Close()
+		check(t, doInference(t, NewInferenceHandler(pq), `{"prompt":"hi"}`))
+	})
+
+	t.Run("handler shut down", func(t *testing.T) {
+		pq := queue.NewPriorityQueue(0)
+		defer pq.Close()
+		h := NewInferenceHandler(pq)
+		h.Shutdown()
+		// Rejected before the body is even read
+		check(t, doInference(t, h, `not json`))
+		if pq.Len() != 0 {
+			t.Errorf("expected nothing queued, got %d", pq.Len())
+		}
+	})
+}
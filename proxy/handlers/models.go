@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aluko123/go-network-proxy/inference/router"
+)
+
+// modelObject is one entry of GET /v1/models, in the OpenAI list format
+type modelObject struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// ModelsHandler serves GET /v1/models: every model the router's workers
+// host, as an OpenAI-compatible list
+func ModelsHandler(rt *router.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		models := rt.Models()
+		data := make([]modelObject, len(models))
+		for i, m := range models {
+			data[i] = modelObject{ID: m.ID, Object: "model", Created: m.Created.Unix(), OwnedBy: "go-network-proxy"}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"object": "list", "data": data})
+	})
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aluko123/go-network-proxy/inference/quota"
+	"github.com/aluko123/go-network-proxy/pkg/metrics"
+)
+
+// quotaFlushTokens is how many streamed tokens are charged per Redis round
+// trip; the remainder is charged when the request ends
+const quotaFlushTokens = 64
+
+// SetQuota enforces q's per-key and per-model token quotas: requests are
+// refused with 429 once a quota is used up, and streamed tokens are charged
+// against it. Passing nil disables quotas.
+func (h *InferenceHandler) SetQuota(q *quota.Quota) {
+	h.quota = q
+}
+
+// checkQuota reports whether the request may proceed, writing the rejection
+// if not. Admitted requests carry their tightest quota in X-Quota-* headers.
+func (h *InferenceHandler) checkQuota(w http.ResponseWriter, r *http.Request, key, model string) bool {
+	st, err := h.quota.Check(r.Context(), key, model)
+	if err != nil {
+		slog.Error("quota check failed", "error", err)
+		http.Error(w, "quota service unavailable", http.StatusServiceUnavailable)
+		return false
+	}
+	if st.Scope == "" {
+		return true
+	}
+
+	w.Header().Set("X-Quota-Scope", st.Scope+"/"+st.Period)
+	w.Header().Set("X-Quota-Limit", strconv.FormatInt(st.Limit, 10))
+	w.Header().Set("X-Quota-Remaining", strconv.FormatInt(st.Remaining(), 10))
+	w.Header().Set("X-Quota-Reset", strconv.FormatInt(st.Reset.Unix(), 10))
+	if !st.Exceeded() {
+		return true
+	}
+
+	metrics.InferenceQuotaRejectedTotal.WithLabelValues(st.Scope, st.Period).Inc()
+	retry := max(int(math.Ceil(time.Until(st.Reset).Seconds())), 1)
+	w.Header().Set("Retry-After", strconv.Itoa(retry))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error":  "token quota exhausted",
+		"scope":  st.Scope,
+		"period": st.Period,
+		"limit":  st.Limit,
+		"reset":  st.Reset.Unix(),
+	})
+	return false
+}
+
+// quotaCharge batches a request's streamed tokens into quota charges. The
+// zero value (no quota) ignores tokens.
+type quotaCharge struct {
+	q       *quota.Quota
+	key     string
+	model   string
+	pending int64
+}
+
+func (c *quotaCharge) add(n int64) {
+	if c.q == nil {
+		return
+	}
+	c.pending += n
+	if c.pending >= quotaFlushTokens {
+		c.flush()
+	}
+}
+
+// flush charges the pending tokens. It runs after the client may be gone,
+// so it doesn't use the request context.
+func (c *quotaCharge) flush() {
+	if c.q == nil || c.pending == 0 {
+		return
+	}
+	if err := c.q.Add(context.Background(), c.key, c.model, c.pending); err != nil {
+		slog.Error("quota charge failed", "error", err, "model", c.model, "tokens", c.pending)
+	}
+	c.pending = 0
+}
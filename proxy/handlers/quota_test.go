@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/aluko123/go-network-proxy/inference/queue"
+	"github.com/aluko123/go-network-proxy/inference/quota"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestInferenceHandler_Quota(t *testing.T) {
+	pq := queue.NewPriorityQueue(0)
+	defer pq.Close()
+
+	var calls int32
+	startFakeWorker(pq, &calls) // two tokens per request
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	cfg := quota.DefaultConfig()
+	cfg.Keys = map[string]quota.Limits{"team-a": {Daily: 3}}
+	q := quota.New(client, cfg)
+
+	h := NewInferenceHandler(pq)
+	h.SetQuota(q)
+
+	send := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/v1/inference", strings.NewReader(`{"prompt":"hi"}`))
+		r.Header.Set("X-API-Key", "team-a")
+		return serveInference(t, h, r)
+	}
+
+	w := send()
+	if w.Code != http.StatusOK || w.Header().Get("X-Quota-Remaining") != "3" || w.Header().Get("X-Quota-Scope") != "key/daily" {
+		t.Fatalf("expected 200 with 3 tokens remaining, got %d %v", w.Code, w.Header())
+	}
+	if st, _ := q.Check(context.Background(), "team-a", DefaultInferenceConfig().DefaultModel); st.Used != 2 {
+		t.Errorf("expected the streamed tokens charged, got %+v", st)
+	}
+
+	send() // 4 of 3 used: the request that crossed the line still completes
+	w = send()
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected 429 with Retry-After, got %d %v", w.Code, w.Header())
+	}
+	if !strings.Contains(w.Body.String(), "token quota exhausted") {
+		t.Errorf("expected a quota error body, got %q", w.Body.String())
+	}
+
+	// Keys without a quota are unaffected
+	if w := doInference(t, h, `{"prompt":"hi"}`); w.Code != http.StatusOK || w.Header().Get("X-Quota-Limit") != "" {
+		t.Errorf("expected an unlimited request, got %d %v", w.Code, w.Header())
+	}
+}
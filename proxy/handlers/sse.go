@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+
+	pb "github.com/aluko123/go-network-proxy/inference/pb"
+)
+
+// maxPooledSSEBuffer keeps an unusually large event from pinning its buffer
+const maxPooledSSEBuffer = 64 << 10
+
+// sseEncoder writes SSE data events through a reused buffer and json.Encoder,
+// so streaming a token does not allocate a fresh slice per event
+type sseEncoder struct {
+	buf bytes.Buffer
+	enc *json.Encoder
+	tok tokenEvent // reused by writeToken
+}
+
+// tokenEvent is the per-token data event. It carries the TokenResponse fields
+// clients have always seen; the finish reason and usage go in the final
+// "done" event instead.
+type tokenEvent struct {
+	RequestID  string `json:"request_id,omitempty"`
+	Token      string `json:"token,omitempty"`
+	Finished   bool   `json:"finished,omitempty"`
+	Error      string `json:"error,omitempty"`
+	TokenCount int32  `json:"token_count,omitempty"`
+}
+
+var ssePool = sync.Pool{
+	New: func() any {
+		e := &sseEncoder{}
+		e.enc = json.NewEncoder(&e.buf)
+		return e
+	},
+}
+
+func getSSEEncoder() *sseEncoder {
+	return ssePool.Get().(*sseEncoder)
+}
+
+func putSSEEncoder(e *sseEncoder) {
+	if e.buf.Cap() > maxPooledSSEBuffer {
+		return
+	}
+	ssePool.Put(e)
+}
+
+// writeToken writes one token as a data event
+func (e *sseEncoder) writeToken(w io.Writer, resp *pb.TokenResponse) error {
+	e.tok = tokenEvent{
+		RequestID:  resp.RequestId,
+		Token:      resp.Token,
+		Finished:   resp.Finished,
+		Error:      resp.Error,
+		TokenCount: resp.TokenCount,
+	}
+	return e.writeEvent(w, "", &e.tok)
+}
+
+// writeEvent writes v as one "data: <json>\n\n" event, preceded by an
+// "event: <name>" line unless name is empty
+func (e *sseEncoder) writeEvent(w io.Writer, name string, v any) error {
+	e.buf.Reset()
+	if name != "" {
+		e.buf.WriteString("event: ")
+		e.buf.WriteString(name)
+		e.buf.WriteByte('\n')
+	}
+	e.buf.WriteString("data: ")
+	if err := e.enc.Encode(v); err != nil { // Encode adds the first newline
+		return err
+	}
+	e.buf.WriteByte('\n')
+	_, err := w.Write(e.buf.Bytes())
+	return err
+}
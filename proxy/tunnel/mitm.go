@@ -0,0 +1,219 @@
+package tunnel
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	leafValidity     = 7 * 24 * time.Hour
+	leafRenewBefore  = time.Hour // reissue cached certificates this close to expiry
+	maxCachedLeaves  = 1000
+	interceptTimeout = 90 * time.Second // idle keep-alive on an intercepted connection
+)
+
+// Interceptor terminates CONNECT tunnels instead of splicing them: the client
+// gets a certificate for the requested host signed by the configured CA, and
+// each decrypted request is passed to a handler that forwards it to the
+// origin over a new TLS connection. Clients must trust the CA.
+type Interceptor struct {
+	ca      *x509.Certificate
+	caKey   crypto.Signer
+	leafKey *ecdsa.PrivateKey // shared by every issued certificate
+	handler http.Handler
+
+	mu     sync.Mutex
+	leaves map[string]*tls.Certificate // by SNI
+}
+
+// NewInterceptor returns an Interceptor issuing certificates from ca, which
+// must be a CA certificate with its private key. Decrypted requests reach
+// handler with an absolute https URL for the CONNECT authority.
+func NewInterceptor(ca tls.Certificate, handler http.Handler) (*Interceptor, error) {
+	if len(ca.Certificate) == 0 {
+		return nil, errors.New("mitm: no CA certificate")
+	}
+	leaf := ca.Leaf
+	if leaf == nil {
+		var err error
+		if leaf, err = x509.ParseCertificate(ca.Certificate[0]); err != nil {
+			return nil, err
+		}
+	}
+	if !leaf.IsCA {
+		return nil, errors.New("mitm: certificate is not a CA")
+	}
+	signer, ok := ca.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("mitm: CA key cannot sign")
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Interceptor{
+		ca:      leaf,
+		caKey:   signer,
+		leafKey: key,
+		handler: handler,
+		leaves:  make(map[string]*tls.Certificate),
+	}, nil
+}
+
+var interceptor *Interceptor
+
+// SetInterceptor makes HandleTunneling intercept tunnels with i (nil splices
+// them unread, the default)
+func SetInterceptor(i *Interceptor) {
+	interceptor = i
+}
+
+// serve speaks TLS to the client on conn, the hijacked connection of the
+// CONNECT request r, and hands each request read from it to the handler
+// until the client is done
+func (i *Interceptor) serve(conn net.Conn, r *http.Request) {
+	authority := dialAddr(r.Host)
+	host, _, _ := net.SplitHostPort(authority)
+
+	var inflight sync.WaitGroup
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		inflight.Add(1)
+		defer inflight.Done()
+		// Always forward to the host the tunnel was opened (and checked) for
+		req.URL.Scheme = "https"
+		req.URL.Host = authority
+		i.handler.ServeHTTP(w, req)
+	})
+
+	done := make(chan struct{})
+	var once sync.Once
+	srv := &http.Server{
+		Handler: handler,
+		TLSConfig: &tls.Config{
+			GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+				if hello.ServerName != "" {
+					return i.certificate(hello.ServerName)
+				}
+				return i.certificate(host)
+			},
+			NextProtos: []string{"http/1.1"},
+		},
+		ReadHeaderTimeout: interceptTimeout,
+		IdleTimeout:       interceptTimeout,
+		BaseContext:       func(net.Listener) context.Context { return r.Context() },
+		ConnState: func(_ net.Conn, state http.ConnState) {
+			if state == http.StateClosed || state == http.StateHijacked {
+				once.Do(func() { close(done) })
+			}
+		},
+		ErrorLog: slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+	srv.ServeTLS(&connListener{conns: oneConn(conn), done: done}, "", "")
+	// A hijacked (upgraded) request is still running
+	inflight.Wait()
+}
+
+// certificate returns a certificate for name signed by the CA, reusing the
+// cached one until it nears expiry
+func (i *Interceptor) certificate(name string) (*tls.Certificate, error) {
+	now := time.Now()
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if cert, ok := i.leaves[name]; ok && now.Before(cert.Leaf.NotAfter.Add(-leafRenewBefore)) {
+		return cert, nil
+	}
+
+	cert, err := i.issue(name, now)
+	if err != nil {
+		return nil, err
+	}
+	if len(i.leaves) >= maxCachedLeaves {
+		for k := range i.leaves {
+			delete(i.leaves, k)
+			break
+		}
+	}
+	i.leaves[name] = cert
+	return cert, nil
+}
+
+// issue signs a fresh certificate for name, valid for leafValidity but never
+// beyond the CA's own expiry
+func (i *Interceptor) issue(name string, now time.Time) (*tls.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	notAfter := now.Add(leafValidity)
+	if notAfter.After(i.ca.NotAfter) {
+		notAfter = i.ca.NotAfter
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    now.Add(-time.Hour), // tolerate client clock skew
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(name); ip != nil {
+		tmpl.IPAddresses = []net.IP{ip}
+	} else {
+		tmpl.DNSNames = []string{name}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, i.ca, &i.leafKey.PublicKey, i.caKey)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{der, i.ca.Raw},
+		PrivateKey:  i.leafKey,
+		Leaf:        leaf,
+	}, nil
+}
+
+// oneConn returns a closed channel holding just conn
+func oneConn(conn net.Conn) chan net.Conn {
+	conns := make(chan net.Conn, 1)
+	conns <- conn
+	close(conns)
+	return conns
+}
+
+// connListener lets http.Server serve connections that were accepted
+// elsewhere. Once they are handed out, Accept blocks until done is closed,
+// so Serve returns when the last connection is finished with.
+type connListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	if conn, ok := <-l.conns; ok {
+		return conn, nil
+	}
+	<-l.done
+	return nil, net.ErrClosed
+}
+
+func (l *connListener) Close() error { return nil }
+
+func (l *connListener) Addr() net.Addr { return &net.TCPAddr{} }
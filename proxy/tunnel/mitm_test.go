@@ -0,0 +1,140 @@
+package tunnel
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newCA returns a self-signed certificate, a CA or not
+func newCA(t *testing.T, isCA bool) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestHandleTunneling_Intercept(t *testing.T) {
+	ca := newCA(t, true)
+	seen := make(chan string, 1)
+	i, err := NewInterceptor(ca, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen <- r.Method + " " + r.URL.String() + " " + r.Header.Get("X-Secret")
+		io.WriteString(w, "filtered")
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetInterceptor(i)
+	defer SetInterceptor(nil)
+
+	srv := httptest.NewServer(http.HandlerFunc(HandleTunneling))
+	defer srv.Close()
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// Nothing listens for example.com here: only the interceptor answers
+	fmt.Fprint(conn, "CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\n\r\n")
+	br := bufio.NewReader(conn)
+	if status, _ := br.ReadString('\n'); !strings.Contains(status, "200") {
+		t.Fatalf("CONNECT returned %q", status)
+	}
+	for line := ""; line != "\r\n"; {
+		line, _ = br.ReadString('\n')
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Leaf)
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: "example.com", RootCAs: roots})
+	if err := tlsConn.Handshake(); err != nil {
+		t.Fatalf("handshake with the CA's certificate: %v", err)
+	}
+
+	// Two requests over one tunnel, each seen decrypted
+	tbr := bufio.NewReader(tlsConn)
+	for n := range 2 {
+		fmt.Fprintf(tlsConn, "GET /page?n=%d HTTP/1.1\r\nHost: example.com\r\nX-Secret: s3cret\r\n\r\n", n)
+		resp, err := http.ReadResponse(tbr, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "filtered" {
+			t.Errorf("body = %q", body)
+		}
+		if got, want := <-seen, fmt.Sprintf("GET https://example.com:443/page?n=%d s3cret", n); got != want {
+			t.Errorf("handler saw %q, want %q", got, want)
+		}
+	}
+}
+
+func TestInterceptor_Certificate(t *testing.T) {
+	ca := newCA(t, true)
+	i, err := NewInterceptor(ca, http.NotFoundHandler())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := i.certificate("a.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := i.certificate("a.example"); again != a {
+		t.Error("certificate was not cached")
+	}
+	if a.Leaf.NotAfter.After(ca.Leaf.NotAfter) {
+		t.Errorf("leaf outlives the CA: %s > %s", a.Leaf.NotAfter, ca.Leaf.NotAfter)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Leaf)
+	if _, err := a.Leaf.Verify(x509.VerifyOptions{DNSName: "a.example", Roots: roots}); err != nil {
+		t.Errorf("leaf does not verify: %v", err)
+	}
+
+	ip, err := i.certificate("10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ip.Leaf.IPAddresses) != 1 || len(ip.Leaf.DNSNames) != 0 {
+		t.Errorf("IP certificate has SANs %v %v", ip.Leaf.IPAddresses, ip.Leaf.DNSNames)
+	}
+}
+
+func TestNewInterceptor_RequiresCA(t *testing.T) {
+	if _, err := NewInterceptor(newCA(t, false), http.NotFoundHandler()); err == nil {
+		t.Error("accepted a certificate that is not a CA")
+	}
+}
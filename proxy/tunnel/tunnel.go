@@ -1,64 +1,163 @@
 package tunnel
 
 import (
+	"context"
+	"errors"
 	"io"
 	"net"
 	"net/http"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/aluko123/go-network-proxy/pkg/bufpool"
+	"github.com/aluko123/go-network-proxy/pkg/metrics"
+	"github.com/aluko123/go-network-proxy/pkg/middleware"
+	"github.com/aluko123/go-network-proxy/pkg/resolver"
 )
 
 // Config holds tunnel configuration
 type Config struct {
-	DialTimeout time.Duration
+	DialTimeout   time.Duration
+	KeepAlive     time.Duration // TCP keep-alive period for both ends (negative disables)
+	FallbackDelay time.Duration // Happy Eyeballs delay before trying IPv4 (0 = 300ms, negative disables)
+	LocalAddr     net.IP        // source address for upstream connections (nil = any)
+	// CopyBufferSize is the pooled buffer per direction. TCP to TCP copies
+	// are spliced by the kernel and skip it.
+	CopyBufferSize int
+	// Resolver resolves targets and refuses blocked addresses (nil = system
+	// resolver, nothing refused)
+	Resolver *resolver.Resolver
 }
 
 // DefaultConfig returns the default tunnel configuration
 func DefaultConfig() Config {
 	return Config{
-		DialTimeout: 10 * time.Second,
+		DialTimeout:    10 * time.Second,
+		KeepAlive:      30 * time.Second,
+		CopyBufferSize: bufpool.DefaultSize,
 	}
 }
 
-var config = DefaultConfig()
+// settings is what SetConfig derives from a Config. It is swapped whole, so
+// a tunnel keeps the dialer and buffers it started with.
+type settings struct {
+	dial    func(ctx context.Context, network, addr string) (net.Conn, error)
+	buffers *bufpool.Pool
+}
+
+var current atomic.Pointer[settings]
+
+func init() {
+	SetConfig(DefaultConfig())
+}
 
 // SetConfig updates the tunnel configuration
 func SetConfig(c Config) {
-	config = c
+	d := &net.Dialer{
+		Timeout:       c.DialTimeout,
+		KeepAlive:     c.KeepAlive,
+		FallbackDelay: c.FallbackDelay,
+	}
+	if c.LocalAddr != nil {
+		d.LocalAddr = &net.TCPAddr{IP: c.LocalAddr}
+	}
+	s := &settings{dial: d.DialContext, buffers: bufpool.New(c.CopyBufferSize)}
+	if c.Resolver != nil {
+		s.dial = c.Resolver.Dialer(d)
+	}
+	current.Store(s)
 }
 
 // HandleTunneling handles HTTPS CONNECT requests for tunneling
 func HandleTunneling(w http.ResponseWriter, r *http.Request) {
-	destConn, err := net.DialTimeout("tcp", r.Host, config.DialTimeout)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusServiceUnavailable)
-		return
-	}
-	defer destConn.Close()
-	w.WriteHeader(http.StatusOK)
+	metrics.CountHost(r.Host)
 
 	hj, ok := w.(http.Hijacker)
 	if !ok {
+		middleware.SetOutcome(r.Context(), middleware.OutcomeFailed)
 		http.Error(w, "Hijacking not supported", http.StatusInternalServerError)
 		return
 	}
 
-	srcConn, _, err := hj.Hijack()
+	if interceptor != nil {
+		intercept(w, hj, r)
+		return
+	}
+
+	s := current.Load()
+	destConn, err := s.dial(r.Context(), "tcp", dialAddr(r.Host))
+	if errors.Is(err, resolver.ErrBlocked) {
+		metrics.BlockedRequests.Inc()
+		middleware.SetOutcome(r.Context(), middleware.OutcomeBlocked)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
 	if err != nil {
+		middleware.SetOutcome(r.Context(), middleware.OutcomeFailed)
 		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer destConn.Close()
+	w.WriteHeader(http.StatusOK)
+
+	srcConn, _, err := hj.Hijack()
+	if err != nil {
+		// The 200 is already out, so only the outcome can record this
+		middleware.SetOutcome(r.Context(), middleware.OutcomeFailed)
+		return
 	}
 	defer srcConn.Close()
+	middleware.SetOutcome(r.Context(), middleware.OutcomeConnected)
 
+	start := time.Now()
 	var wg sync.WaitGroup
+	var failed atomic.Bool
 	wg.Add(2)
 
-	go transfer(&wg, destConn, srcConn)
-	go transfer(&wg, srcConn, destConn)
+	go transfer(&wg, &failed, s.buffers, destConn, srcConn)
+	go transfer(&wg, &failed, s.buffers, srcConn, destConn)
 	wg.Wait()
+
+	result := "closed"
+	if failed.Load() {
+		result = "error"
+	}
+	metrics.TunnelDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+}
+
+// intercept accepts the tunnel and serves it with the Interceptor. Each
+// decrypted request dials the origin itself, so nothing is dialed here.
+func intercept(w http.ResponseWriter, hj http.Hijacker, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	conn, _, err := hj.Hijack()
+	if err != nil {
+		middleware.SetOutcome(r.Context(), middleware.OutcomeFailed)
+		return
+	}
+	defer conn.Close()
+	middleware.SetOutcome(r.Context(), middleware.OutcomeIntercepted)
+
+	start := time.Now()
+	interceptor.serve(conn, r)
+	metrics.TunnelDuration.WithLabelValues("intercepted").Observe(time.Since(start).Seconds())
 }
 
-// transfer copies data between connections bidirectionally
-func transfer(wg *sync.WaitGroup, destination io.Writer, source io.Reader) {
+// dialAddr returns the address to dial for a CONNECT authority, defaulting
+// the port to 443. IPv6 literals keep (or gain) their brackets so the port
+// is not read as part of the address.
+func dialAddr(host string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"), "443")
+}
+
+// transfer copies data between connections bidirectionally, flagging copy errors
+func transfer(wg *sync.WaitGroup, failed *atomic.Bool, buffers *bufpool.Pool, destination io.Writer, source io.Reader) {
 	defer wg.Done()
-	io.Copy(destination, source)
+	if _, err := buffers.Copy(destination, source); err != nil {
+		failed.Store(true)
+	}
 }
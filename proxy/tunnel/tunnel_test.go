@@ -0,0 +1,229 @@
+package tunnel
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aluko123/go-network-proxy/pkg/logger"
+	"github.com/aluko123/go-network-proxy/pkg/metrics"
+	"github.com/aluko123/go-network-proxy/pkg/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// syncBuffer lets the test read log output written by server goroutines
+type syncBuffer struct {
+	mu sync.Mutex
+	bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.Buffer.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.Buffer.String()
+}
+
+func TestHandleTunneling_ReportsOutcome(t *testing.T) {
+	// Echo origin for the successful tunnel
+	origin, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer origin.Close()
+	go func() {
+		for {
+			conn, err := origin.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				line, _ := bufio.NewReader(conn).ReadString('\n')
+				conn.Write([]byte(line))
+			}()
+		}
+	}()
+
+	// A port with nothing listening
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	closedCount := func() uint64 {
+		m := &dto.Metric{}
+		metrics.TunnelDuration.WithLabelValues("closed").(prometheus.Metric).Write(m)
+		return m.GetHistogram().GetSampleCount()
+	}
+	before := closedCount()
+
+	var buf syncBuffer
+	log := logger.NewWithOptions(logger.Options{Format: "json", Output: &buf})
+	done := make(chan struct{}, 2)
+	h := middleware.WithLogging(log)(http.HandlerFunc(HandleTunneling))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r)
+		done <- struct{}{}
+	}))
+	defer srv.Close()
+
+	connect := func(target string) (*bufio.Reader, net.Conn) {
+		conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", target, target)
+		// Read the status line and headers; a 200 has no body before tunnel data
+		br := bufio.NewReader(conn)
+		status, _ := br.ReadString('\n')
+		for line := status; line != "\r\n" && line != ""; {
+			line, _ = br.ReadString('\n')
+		}
+		if target == closedAddr && !strings.Contains(status, "503") {
+			t.Errorf("dial failure returned %q", status)
+		}
+		return br, conn
+	}
+
+	br, conn := connect(origin.Addr().String())
+	fmt.Fprint(conn, "ping\n")
+	if line, _ := br.ReadString('\n'); line != "ping\n" {
+		t.Errorf("tunnel echoed %q", line)
+	}
+	conn.Close()
+
+	_, conn = connect(closedAddr)
+	conn.Close()
+
+	<-done
+	<-done
+	out := buf.String()
+	if !strings.Contains(out, `"outcome":"connected"`) {
+		t.Errorf("missing connected outcome: %s", out)
+	}
+	if !strings.Contains(out, `"outcome":"failed"`) {
+		t.Errorf("missing failed outcome: %s", out)
+	}
+	if got := closedCount() - before; got != 1 {
+		t.Errorf("expected 1 closed tunnel observed, got %d", got)
+	}
+}
+
+func TestDialAddr(t *testing.T) {
+	tests := map[string]string{
+		"example.com:443":    "example.com:443",
+		"example.com":        "example.com:443",
+		"10.0.0.1:8443":      "10.0.0.1:8443",
+		"[2001:db8::1]:8443": "[2001:db8::1]:8443",
+		"[2001:db8::1]":      "[2001:db8::1]:443",
+		"2001:db8::1":        "[2001:db8::1]:443",
+	}
+	for host, want := range tests {
+		if got := dialAddr(host); got != want {
+			t.Errorf("dialAddr(%q) = %q, want %q", host, got, want)
+		}
+	}
+}
+
+func TestHandleTunneling_IPv6(t *testing.T) {
+	origin, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	defer origin.Close()
+	go func() {
+		conn, err := origin.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("hello\n"))
+	}()
+
+	srv := httptest.NewServer(http.HandlerFunc(HandleTunneling))
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	target := origin.Addr().String() // "[::1]:port"
+	fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", target, target)
+
+	br := bufio.NewReader(conn)
+	status, _ := br.ReadString('\n')
+	if !strings.Contains(status, "200") {
+		t.Fatalf("CONNECT %s returned %q", target, status)
+	}
+	for line := status; line != "\r\n" && line != ""; {
+		line, _ = br.ReadString('\n')
+	}
+	if line, _ := br.ReadString('\n'); line != "hello\n" {
+		t.Errorf("tunnel read %q", line)
+	}
+}
+
+func TestHandleTunneling_LocalAddr(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.LocalAddr = net.ParseIP("127.0.0.2")
+	SetConfig(cfg)
+	defer SetConfig(DefaultConfig())
+
+	origin, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer origin.Close()
+	peer := make(chan string, 1)
+	go func() {
+		conn, err := origin.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+		peer <- host
+	}()
+
+	// The tunnel must be gone before the deferred SetConfig
+	closed := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(closed)
+		HandleTunneling(w, r)
+	}))
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	target := origin.Addr().String()
+	fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", target, target)
+	if status, _ := bufio.NewReader(conn).ReadString('\n'); !strings.Contains(status, "200") {
+		t.Fatalf("CONNECT returned %q", status)
+	}
+	if got := <-peer; got != "127.0.0.2" {
+		t.Errorf("upstream saw source %s, want 127.0.0.2", got)
+	}
+	conn.Close()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("tunnel did not close")
+	}
+}
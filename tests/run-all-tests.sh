@@ -21,7 +21,7 @@ fi
 
 if ! curl -s http://localhost:8080/metrics > /dev/null; then
     echo "❌ Proxy server is not running on port 8080"
-    echo "   Start it with: ./http-proxy/proxy-server"
+    echo "   Start it with: go run ./cmd/gateway"
     exit 1
 fi
 
@@ -10,7 +10,7 @@ Usage:
        python workers/mock_server.py --model gpt-large --port 50053 --latency 0.05 &
 
     2. Start the gateway with all workers:
-       go run cmd/gateway/main.go \
+       go run ./cmd/gateway \
          -worker-addrs "localhost:50051,localhost:50052,localhost:50053" \
          -limiter memory \
          -rate-limit 10000 \
@@ -0,0 +1,34 @@
+"""Helpers for serving BatchGenerate."""
+import asyncio
+
+
+async def merge(streams):
+    """Yield from several async iterators at once, as each produces items.
+
+    An exception from any stream cancels the others and is re-raised.
+    """
+    queue = asyncio.Queue()
+    done = object()
+
+    async def drain(stream):
+        try:
+            async for item in stream:
+                await queue.put(item)
+            await queue.put(done)
+        except Exception as e:
+            await queue.put(e)
+
+    tasks = [asyncio.create_task(drain(s)) for s in streams]
+    try:
+        remaining = len(tasks)
+        while remaining:
+            item = await queue.get()
+            if item is done:
+                remaining -= 1
+            elif isinstance(item, Exception):
+                raise item
+            else:
+                yield item
+    finally:
+        for task in tasks:
+            task.cancel()
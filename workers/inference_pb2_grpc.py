@@ -39,11 +39,21 @@ class ModelServiceStub(object):
                 request_serializer=inference__pb2.GenerateRequest.SerializeToString,
                 response_deserializer=inference__pb2.TokenResponse.FromString,
                 _registered_method=True)
+        self.BatchGenerate = channel.unary_stream(
+                '/inference.ModelService/BatchGenerate',
+                request_serializer=inference__pb2.BatchGenerateRequest.SerializeToString,
+                response_deserializer=inference__pb2.TokenResponse.FromString,
+                _registered_method=True)
         self.Health = channel.unary_unary(
                 '/inference.ModelService/Health',
                 request_serializer=inference__pb2.HealthRequest.SerializeToString,
                 response_deserializer=inference__pb2.HealthResponse.FromString,
                 _registered_method=True)
+        self.GetInfo = channel.unary_unary(
+                '/inference.ModelService/GetInfo',
+                request_serializer=inference__pb2.InfoRequest.SerializeToString,
+                response_deserializer=inference__pb2.InfoResponse.FromString,
+                _registered_method=True)
 
 
 class ModelServiceServicer(object):
@@ -56,6 +66,14 @@ class ModelServiceServicer(object):
         context.set_details('Method not implemented!')
         raise NotImplementedError('Method not implemented!')
 
+    def BatchGenerate(self, request, context):
+        """Generate several prompts of one model in a single pass, interleaving
+        their tokens; each response carries its request's request_id
+        """
+        context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+        context.set_details('Method not implemented!')
+        raise NotImplementedError('Method not implemented!')
+
     def Health(self, request, context):
         """Check worker health and load
         """
@@ -63,6 +81,13 @@ class ModelServiceServicer(object):
         context.set_details('Method not implemented!')
         raise NotImplementedError('Method not implemented!')
 
+    def GetInfo(self, request, context):
+        """Report status, the models served and current load
+        """
+        context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+        context.set_details('Method not implemented!')
+        raise NotImplementedError('Method not implemented!')
+
 
 def add_ModelServiceServicer_to_server(servicer, server):
     rpc_method_handlers = {
@@ -71,11 +96,21 @@ def add_ModelServiceServicer_to_server(servicer, server):
                     request_deserializer=inference__pb2.GenerateRequest.FromString,
                     response_serializer=inference__pb2.TokenResponse.SerializeToString,
             ),
+            'BatchGenerate': grpc.unary_stream_rpc_method_handler(
+                    servicer.BatchGenerate,
+                    request_deserializer=inference__pb2.BatchGenerateRequest.FromString,
+                    response_serializer=inference__pb2.TokenResponse.SerializeToString,
+            ),
             'Health': grpc.unary_unary_rpc_method_handler(
                     servicer.Health,
                     request_deserializer=inference__pb2.HealthRequest.FromString,
                     response_serializer=inference__pb2.HealthResponse.SerializeToString,
             ),
+            'GetInfo': grpc.unary_unary_rpc_method_handler(
+                    servicer.GetInfo,
+                    request_deserializer=inference__pb2.InfoRequest.FromString,
+                    response_serializer=inference__pb2.InfoResponse.SerializeToString,
+            ),
     }
     generic_handler = grpc.method_handlers_generic_handler(
             'inference.ModelService', rpc_method_handlers)
@@ -114,6 +149,33 @@ class ModelService(object):
             metadata,
             _registered_method=True)
 
+    @staticmethod
+    def BatchGenerate(request,
+            target,
+            options=(),
+            channel_credentials=None,
+            call_credentials=None,
+            insecure=False,
+            compression=None,
+            wait_for_ready=None,
+            timeout=None,
+            metadata=None):
+        return grpc.experimental.unary_stream(
+            request,
+            target,
+            '/inference.ModelService/BatchGenerate',
+            inference__pb2.BatchGenerateRequest.SerializeToString,
+            inference__pb2.TokenResponse.FromString,
+            options,
+            channel_credentials,
+            insecure,
+            call_credentials,
+            compression,
+            wait_for_ready,
+            timeout,
+            metadata,
+            _registered_method=True)
+
     @staticmethod
     def Health(request,
             target,
@@ -140,3 +202,30 @@ class ModelService(object):
             timeout,
             metadata,
             _registered_method=True)
+
+    @staticmethod
+    def GetInfo(request,
+            target,
+            options=(),
+            channel_credentials=None,
+            call_credentials=None,
+            insecure=False,
+            compression=None,
+            wait_for_ready=None,
+            timeout=None,
+            metadata=None):
+        return grpc.experimental.unary_unary(
+            request,
+            target,
+            '/inference.ModelService/GetInfo',
+            inference__pb2.InfoRequest.SerializeToString,
+            inference__pb2.InfoResponse.FromString,
+            options,
+            channel_credentials,
+            insecure,
+            call_credentials,
+            compression,
+            wait_for_ready,
+            timeout,
+            metadata,
+            _registered_method=True)
@@ -9,6 +9,7 @@ import logging
 import grpc
 import inference_pb2
 import inference_pb2_grpc
+from batching import merge
 
 logging.basicConfig(level=logging.INFO, format='%(asctime)s [%(levelname)s] %(message)s')
 logger = logging.getLogger(__name__)
@@ -18,9 +19,26 @@ class MockModelService(inference_pb2_grpc.ModelServiceServicer):
     def __init__(self, model_name: str, latency: float = 0.0):
         self.model_name = model_name
         self.latency = latency
+        self.in_flight = 0
         logger.info(f"Mock worker initialized: model={model_name}, latency={latency}s")
 
     async def Generate(self, request, context):
+        self.in_flight += 1
+        try:
+            async for resp in self._generate(request):
+                yield resp
+        finally:
+            self.in_flight -= 1
+
+    async def BatchGenerate(self, request, context):
+        self.in_flight += len(request.requests)
+        try:
+            async for resp in merge(self._generate(r) for r in request.requests):
+                yield resp
+        finally:
+            self.in_flight -= len(request.requests)
+
+    async def _generate(self, request):
         request_id = request.request_id or "unknown"
         logger.info(f"[{self.model_name}] Received request {request_id}: prompt='{request.prompt[:50]}...'")
 
@@ -31,6 +49,15 @@ class MockModelService(inference_pb2_grpc.ModelServiceServicer):
         # Generate mock tokens
         mock_tokens = [f"[{self.model_name}]"] + words[:max_tokens-1]
 
+        truncated = len(words) + 1 > len(mock_tokens)
+
+        # End at the first word containing a stop sequence, excluding it
+        for i, token in enumerate(mock_tokens):
+            if any(stop in token for stop in request.stop):
+                mock_tokens = mock_tokens[:i]
+                truncated = False
+                break
+
         for i, token in enumerate(mock_tokens):
             if self.latency > 0:
                 await asyncio.sleep(self.latency)
@@ -47,7 +74,9 @@ class MockModelService(inference_pb2_grpc.ModelServiceServicer):
             request_id=request_id,
             token="",
             token_count=len(mock_tokens),
-            finished=True
+            finished=True,
+            finish_reason="length" if truncated else "stop",
+            prompt_tokens=len(words)
         )
         logger.info(f"[{self.model_name}] Finished request {request_id}")
 
@@ -58,6 +87,16 @@ class MockModelService(inference_pb2_grpc.ModelServiceServicer):
             gpu_utilization=0.0
         )
 
+    async def GetInfo(self, request, context):
+        return inference_pb2.InfoResponse(
+            healthy=True,
+            models=[self.model_name],
+            in_flight=self.in_flight,
+            current_queue_size=0,
+            max_concurrent=0,  # no limit
+            gpu_utilization=0.0
+        )
+
 
 async def serve(args):
     service = MockModelService(args.model, args.latency)
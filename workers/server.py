@@ -3,31 +3,92 @@ import asyncio
 import logging
 import time
 import threading
+from contextlib import contextmanager
 import grpc
 import torch
 from transformers import AutoModelForCausalLM, AutoTokenizer, TextIteratorStreamer
 import inference_pb2
 import inference_pb2_grpc
+from batching import merge
 
 # Configure logging
 logging.basicConfig(level=logging.INFO, format='%(asctime)s [%(levelname)s] %(message)s')
 logger = logging.getLogger(__name__)
 
+class RNGGate:
+    """Orders sampling generations around torch's process-wide RNG.
+
+    A seeded generation reseeds that one RNG, so it is only reproducible if no
+    other sampling generation draws from it meanwhile: it holds the gate alone.
+    Unseeded sampling generations share it. A waiting seeded generation keeps
+    new unseeded ones out, so it is not starved.
+    """
+
+    def __init__(self):
+        self._cond = threading.Condition()
+        self._shared = 0
+        self._exclusive = False
+        self._waiting = 0
+
+    @contextmanager
+    def hold(self, exclusive):
+        with self._cond:
+            if exclusive:
+                self._waiting += 1
+                self._cond.wait_for(lambda: not self._exclusive and self._shared == 0)
+                self._waiting -= 1
+                self._exclusive = True
+            else:
+                self._cond.wait_for(lambda: not self._exclusive and self._waiting == 0)
+                self._shared += 1
+        try:
+            yield
+        finally:
+            with self._cond:
+                if exclusive:
+                    self._exclusive = False
+                else:
+                    self._shared -= 1
+                self._cond.notify_all()
+
+
 class ModelService(inference_pb2_grpc.ModelServiceServicer):
     def __init__(self, model_name, device="cpu", latency=0.0):
         logger.info(f"Loading model {model_name} on {device}...")
+        self.model_name = model_name
         self.device = device
         self.latency = latency
+        self.in_flight = 0
+        self.rng = RNGGate()
         self.tokenizer = AutoTokenizer.from_pretrained(model_name)
         self.model = AutoModelForCausalLM.from_pretrained(model_name).to(device)
         logger.info("Model loaded successfully!")
 
     async def Generate(self, request, context):
+        self.in_flight += 1
+        try:
+            async for resp in self._generate(request):
+                yield resp
+        finally:
+            self.in_flight -= 1
+
+    async def BatchGenerate(self, request, context):
+        # Each prompt still generates on its own thread; the tokens of all of
+        # them are interleaved on one stream, tagged with their request_id
+        self.in_flight += len(request.requests)
+        try:
+            async for resp in merge(self._generate(r) for r in request.requests):
+                yield resp
+        finally:
+            self.in_flight -= len(request.requests)
+
+    async def _generate(self, request):
         request_id = request.request_id or "unknown"
         logger.info(f"Received request {request_id}: prompt='{request.prompt}'")
 
         # 1. Tokenize
         inputs = self.tokenizer(request.prompt, return_tensors="pt").to(self.device)
+        prompt_tokens = inputs["input_ids"].shape[1]
         
         # 2. Setup Streaming
         streamer = TextIteratorStreamer(self.tokenizer, skip_prompt=True, skip_special_tokens=True)
@@ -45,14 +106,30 @@ class ModelService(inference_pb2_grpc.ModelServiceServicer):
         )
         if do_sample:
             generation_kwargs["temperature"] = request.temperature
+        if request.stop:
+            generation_kwargs["stop_strings"] = list(request.stop)
+            generation_kwargs["tokenizer"] = self.tokenizer
+        # 3. Run Generation in a separate thread (since model.generate is blocking).
+        # Greedy decoding never draws from the RNG, so only sampling is gated.
+        seed = request.seed if request.HasField("seed") else None
 
-        # 3. Run Generation in a separate thread (since model.generate is blocking)
-        thread = threading.Thread(target=self.model.generate, kwargs=generation_kwargs)
+        def run():
+            if not do_sample:
+                self.model.generate(**generation_kwargs)
+                return
+            with self.rng.hold(exclusive=seed is not None):
+                if seed is not None:
+                    torch.manual_seed(seed)
+                self.model.generate(**generation_kwargs)
+
+        thread = threading.Thread(target=run)
         thread.start()
 
         # 4. Yield Tokens
+        generated = []
         try:
             for new_text in streamer:
+                generated.append(new_text)
                 # Simulate latency if configured
                 if self.latency > 0:
                     await asyncio.sleep(self.latency)
@@ -63,11 +140,16 @@ class ModelService(inference_pb2_grpc.ModelServiceServicer):
                     finished=False
                 )
             
-            # Final message
+            # Final message: the streamer yields text pieces, not tokens,
+            # so count what was generated with the tokenizer
+            completion_tokens = len(self.tokenizer("".join(generated))["input_ids"])
             yield inference_pb2.TokenResponse(
                 request_id=request_id,
                 token="",
-                finished=True
+                finished=True,
+                token_count=completion_tokens,
+                finish_reason="length" if completion_tokens >= request.max_tokens else "stop",
+                prompt_tokens=prompt_tokens
             )
             logger.info(f"Finished request {request_id}")
 
@@ -88,6 +170,16 @@ class ModelService(inference_pb2_grpc.ModelServiceServicer):
             gpu_utilization=0.0 # CPU mode
         )
 
+    async def GetInfo(self, request, context):
+        return inference_pb2.InfoResponse(
+            healthy=True,
+            models=[self.model_name],
+            in_flight=self.in_flight,
+            current_queue_size=0,
+            max_concurrent=1,  # generate() runs one request per thread
+            gpu_utilization=0.0
+        )
+
 async def serve(args):
     service = ModelService(args.model, args.device, args.latency)
     